@@ -2,23 +2,151 @@
 package arg_parser
 
 import (
+	"errors"
+	"flag"
+	"io"
 	"kiv-zos-semestral-work/consts"
 	"kiv-zos-semestral-work/custom_errors"
 	"strings"
 )
 
-// GetFilenameFromArgs returns the filename from the arguments
-func GetFilenameFromArgs(args []string) (string, error) {
-	if len(args) != 2 {
-		return "", custom_errors.ErrInvalArgsCount
+// ProgramArgs holds the parsed program arguments
+type ProgramArgs struct {
+	// FsPath is the path to the filesystem file
+	FsPath string
+	// ReadOnly is a flag indicating if the filesystem should be opened read-only
+	ReadOnly bool
+	// Commands are the commands passed with the -c option (separated by ';'), empty if not set
+	Commands string
+	// ScriptPath is the path to the script file passed with the -f option, empty if not set
+	ScriptPath string
+	// KeepGoing is a flag indicating if the non-interactive execution should continue after a failed command
+	KeepGoing bool
+	// Output is the output format of the commands (consts.OutputFormatText or consts.OutputFormatJSON)
+	Output string
+	// DiffPaths are the paths of the two filesystem files compared in the diff mode, empty if not set
+	DiffPaths []string
+	// imageDiff is a flag indicating if the diff mode was requested (--diff)
+	imageDiff bool
+	// DiffClusters is a flag indicating if the diff mode lists the differing data clusters
+	DiffClusters bool
+}
+
+// IsInteractive returns true if the commands should be read from stdin
+func (a *ProgramArgs) IsInteractive() bool {
+	return a.Commands == "" && a.ScriptPath == ""
+}
+
+// IsImageDiff returns true if two filesystem files should be compared instead of opening one
+func (a *ProgramArgs) IsImageDiff() bool {
+	return len(a.DiffPaths) > 0
+}
+
+// newFlagSet creates the flag set for the program options bound to the given result.
+//
+// Both the short and the long form of an option is bound to the same variable.
+func newFlagSet(programName string, pRes *ProgramArgs) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(programName, flag.ContinueOnError)
+	// the usage is printed by the caller from consts.HelpMsg
+	flagSet.SetOutput(io.Discard)
+
+	flagSet.BoolVar(&pRes.ReadOnly, "r", false, "open the filesystem read-only")
+	flagSet.BoolVar(&pRes.ReadOnly, "read-only", false, "open the filesystem read-only")
+	flagSet.StringVar(&pRes.Commands, "c", "", "execute the ';' separated commands and exit")
+	flagSet.StringVar(&pRes.ScriptPath, "f", "", "execute the commands from the script file and exit")
+	flagSet.BoolVar(&pRes.KeepGoing, "keep-going", false, "do not stop on the first failed command")
+	flagSet.StringVar(&pRes.Output, "output", consts.OutputFormatText, "output format of the commands (text or json)")
+	flagSet.BoolVar(&pRes.imageDiff, "diff", false, "compare two filesystem files")
+	flagSet.BoolVar(&pRes.DiffClusters, "clusters", false, "list the differing data clusters in the diff mode")
+
+	return flagSet
+}
+
+// GetProgramArgs returns the parsed program arguments.
+//
+// Options can be placed before or after the filesystem path
+// (both "-opt" and "--opt" forms are accepted).
+//
+// The diff mode ("--diff a b") takes two filesystem paths and cannot be combined
+// with the command execution options.
+//
+// It returns ErrHelpWanted if help was requested, ErrUnknownOption for
+// unsupported options, ErrInvalidOutputFormat for unsupported output format,
+// ErrConflictingOptions for options that cannot be combined (or --keep-going
+// without -c or -f) and ErrInvalArgsCount if there is not exactly one filesystem path.
+func GetProgramArgs(args []string) (*ProgramArgs, error) {
+	if len(args) < 2 {
+		return nil, custom_errors.ErrInvalArgsCount
+	}
+
+	res := &ProgramArgs{}
+	flagSet := newFlagSet(args[0], res)
+
+	// flag package stops at the first positional argument,
+	// so the parsing is resumed after each of them
+	positional := make([]string, 0, 1)
+	remaining := args[1:]
+	for {
+		err := flagSet.Parse(remaining)
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, custom_errors.ErrHelpWanted
+		} else if err != nil {
+			return nil, custom_errors.ErrUnknownOption
+		}
+
+		if flagSet.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flagSet.Arg(0))
+		remaining = flagSet.Args()[1:]
 	}
 
-	if strings.ToLower(args[1]) == "--help" || strings.ToLower(args[1]) == "-h" {
-		return "", custom_errors.ErrHelpWanted
+	if res.Output != consts.OutputFormatText && res.Output != consts.OutputFormatJSON {
+		return nil, custom_errors.ErrInvalidOutputFormat
 	}
 
-	pathFilename := args[1]
+	if res.imageDiff {
+		return getImageDiffArgs(res, positional)
+	}
+
+	if len(positional) != 1 {
+		return nil, custom_errors.ErrInvalArgsCount
+	}
+	if (res.Commands != "" && res.ScriptPath != "") || (res.KeepGoing && res.IsInteractive()) || res.DiffClusters {
+		return nil, custom_errors.ErrConflictingOptions
+	}
+
+	pathFilename, err := validateFilename(positional[0])
+	if err != nil {
+		return nil, err
+	}
+	res.FsPath = pathFilename
+
+	return res, nil
+}
+
+// getImageDiffArgs validates the arguments of the diff mode (the two filesystem paths).
+func getImageDiffArgs(pRes *ProgramArgs, paths []string) (*ProgramArgs, error) {
+	if len(paths) != 2 {
+		return nil, custom_errors.ErrInvalArgsCount
+	}
+	if pRes.Commands != "" || pRes.ScriptPath != "" || pRes.ReadOnly || pRes.KeepGoing {
+		return nil, custom_errors.ErrConflictingOptions
+	}
+
+	for _, path := range paths {
+		pathFilename, err := validateFilename(path)
+		if err != nil {
+			return nil, err
+		}
+		pRes.DiffPaths = append(pRes.DiffPaths, pathFilename)
+	}
+
+	return pRes, nil
+}
 
+// validateFilename validates the filesystem file path
+func validateFilename(pathFilename string) (string, error) {
 	// validate pathFilename
 	if pathFilename == "" {
 		return "", custom_errors.ErrEmptyPath
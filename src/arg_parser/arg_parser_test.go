@@ -0,0 +1,81 @@
+package arg_parser
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetProgramArgs(t *testing.T) {
+	tests := []struct {
+		args    string
+		want    ProgramArgs
+		wantErr error
+	}{
+		// the options before or after the filesystem path
+		{"fs", ProgramArgs{FsPath: "fs"}, nil},
+		{"-r fs", ProgramArgs{FsPath: "fs", ReadOnly: true}, nil},
+		{"fs --read-only", ProgramArgs{FsPath: "fs", ReadOnly: true}, nil},
+		{"-c ls fs --keep-going", ProgramArgs{FsPath: "fs", Commands: "ls", KeepGoing: true}, nil},
+		{"fs -f script --output json", ProgramArgs{FsPath: "fs", ScriptPath: "script", Output: consts.OutputFormatJSON}, nil},
+		{"--output=text fs -c pwd", ProgramArgs{FsPath: "fs", Commands: "pwd"}, nil},
+		// a filesystem file named as the diff mode option
+		{"diff", ProgramArgs{FsPath: "diff"}, nil},
+		{"-r diff", ProgramArgs{FsPath: "diff", ReadOnly: true}, nil},
+
+		// the diff mode
+		{"--diff a b", ProgramArgs{DiffPaths: []string{"a", "b"}, imageDiff: true}, nil},
+		{"a --diff b --clusters", ProgramArgs{DiffPaths: []string{"a", "b"}, imageDiff: true, DiffClusters: true}, nil},
+		{"--diff diff b --output json", ProgramArgs{DiffPaths: []string{"diff", "b"}, imageDiff: true, Output: consts.OutputFormatJSON}, nil},
+
+		// the conflicts
+		{"fs -c ls -f script", ProgramArgs{}, custom_errors.ErrConflictingOptions},
+		{"fs --keep-going", ProgramArgs{}, custom_errors.ErrConflictingOptions},
+		{"fs -r --keep-going", ProgramArgs{}, custom_errors.ErrConflictingOptions},
+		{"fs --clusters", ProgramArgs{}, custom_errors.ErrConflictingOptions},
+		{"--diff a b -c ls", ProgramArgs{}, custom_errors.ErrConflictingOptions},
+		{"--diff a b -f script", ProgramArgs{}, custom_errors.ErrConflictingOptions},
+		{"--diff a b -r", ProgramArgs{}, custom_errors.ErrConflictingOptions},
+		{"--diff a b --keep-going", ProgramArgs{}, custom_errors.ErrConflictingOptions},
+
+		// the invalid arguments
+		{"", ProgramArgs{}, custom_errors.ErrInvalArgsCount},
+		{"fs other", ProgramArgs{}, custom_errors.ErrInvalArgsCount},
+		{"diff a b", ProgramArgs{}, custom_errors.ErrInvalArgsCount},
+		{"--diff a", ProgramArgs{}, custom_errors.ErrInvalArgsCount},
+		{"--diff a b c", ProgramArgs{}, custom_errors.ErrInvalArgsCount},
+		{"fs -x", ProgramArgs{}, custom_errors.ErrUnknownOption},
+		{"fs -c", ProgramArgs{}, custom_errors.ErrUnknownOption},
+		{"fs --output xml", ProgramArgs{}, custom_errors.ErrInvalidOutputFormat},
+		{"fs -h", ProgramArgs{}, custom_errors.ErrHelpWanted},
+		{"f*s", ProgramArgs{}, custom_errors.ErrInvalidPathCharacter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			pArgs, err := GetProgramArgs(append([]string{"myfs"}, strings.Fields(tt.args)...))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.want.Output == "" {
+				tt.want.Output = consts.OutputFormatText
+			}
+			if !reflect.DeepEqual(*pArgs, tt.want) {
+				t.Errorf("args %+v, want %+v", *pArgs, tt.want)
+			}
+			if pArgs.IsImageDiff() != tt.want.imageDiff {
+				t.Errorf("image diff %v", pArgs.IsImageDiff())
+			}
+		})
+	}
+}
@@ -9,6 +9,16 @@ type Command struct {
 	Name string
 	// Args are the arguments of the command
 	Args []string
+	// Quoted marks the arguments written (at least partly) in quotes, nil if none is marked
+	Quoted []bool
+	// Input is the text passed to the command by a here-document in a script, nil if none
+	Input []byte
+}
+
+// IsArgQuoted returns true if the argument at the index was written in quotes
+// (a quoted argument is never an operator).
+func (c *Command) IsArgQuoted(idx int) bool {
+	return idx < len(c.Quoted) && c.Quoted[idx]
 }
 
 // ToString returns the command as a string
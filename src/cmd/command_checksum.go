@@ -0,0 +1,260 @@
+// command_checksum.go contains the implementation of the sha256sum, md5sum and crc32 commands
+package cmd
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"os"
+	"strings"
+)
+
+// checksumArgs are the parsed arguments of the checksum commands
+type checksumArgs struct {
+	// manifestPath is the path of the checksum file to verify, empty if the paths are hashed
+	manifestPath string
+	// isHostManifest is true if the checksum file is on the host filesystem
+	isHostManifest bool
+	// paths are the paths of the hashed files
+	paths []string
+}
+
+// parseChecksumArgs parses the arguments of the checksum commands
+// ("sha256sum s1 ..." or "sha256sum -c manifest [--host]").
+func parseChecksumArgs(args []string) (*checksumArgs, error) {
+	res := &checksumArgs{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case consts.ChecksumCheckOpt:
+			if i+1 >= len(args) || res.manifestPath != "" {
+				return nil, custom_errors.ErrInvalArgsCount
+			}
+			res.manifestPath = args[i+1]
+			i++
+
+		case consts.ChecksumHostOpt:
+			res.isHostManifest = true
+
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				return nil, custom_errors.ErrUnknownOption
+			}
+			err := validatePathFormat(args[i])
+			if err != nil {
+				return nil, err
+			}
+			res.paths = append(res.paths, args[i])
+		}
+	}
+
+	// either the manifest is verified or the paths are hashed
+	if res.manifestPath == "" && (len(res.paths) == 0 || res.isHostManifest) {
+		return nil, custom_errors.ErrInvalArgsCount
+	}
+	if res.manifestPath != "" && len(res.paths) > 0 {
+		return nil, custom_errors.ErrInvalArgsCount
+	}
+	if res.manifestPath != "" && !res.isHostManifest {
+		err := validatePathFormat(res.manifestPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// newHash returns the hash computed by the checksum command.
+func newHash(cmdName string) hash.Hash {
+	switch cmdName {
+	case consts.Md5sumCommand:
+		return md5.New()
+	case consts.Crc32Command:
+		return crc32.NewIEEE()
+	default:
+		return sha256.New()
+	}
+}
+
+// getFileChecksum returns the hex encoded checksum of the file (streamed from its cluster chain).
+func getFileChecksum(cmdName string, path string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (string, error) {
+	normAbsPath, err := makePathNormAbs(path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return "", err
+	}
+
+	pReader, err := utils.NewFileReader(pFs, fatsRef, dataRef, normAbsPath)
+	if err != nil {
+		return "", err
+	}
+
+	h := newHash(cmdName)
+	_, err = io.Copy(h, pReader)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// openSourceFile opens the file on the host (isHost) or in the filesystem for reading.
+// The returned function closes the file.
+func openSourceFile(path string, isHost bool, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (io.Reader, func(), error) {
+	if isHost {
+		pFile, err := os.Open(path)
+		if err != nil {
+			logging.Info(fmt.Sprintf("Error opening the host file \"%s\": %s", path, err))
+			return nil, nil, custom_errors.ErrInFileNotFound
+		}
+
+		info, err := pFile.Stat()
+		if err != nil || info.IsDir() {
+			pFile.Close()
+			return nil, nil, custom_errors.ErrIsDir
+		}
+		return pFile, func() { pFile.Close() }, nil
+	}
+
+	normAbsPath, err := makePathNormAbs(path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, nil, err
+	}
+	pReader, err := utils.NewFileReader(pFs, fatsRef, dataRef, normAbsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pReader, func() {}, nil
+}
+
+// parseManifestLine splits the manifest line ("CHECKSUM  path" or "CHECKSUM *path")
+// into the checksum and the path.
+func parseManifestLine(line string) (string, string, error) {
+	checksum, path, found := strings.Cut(line, " ")
+	path = strings.TrimPrefix(strings.TrimPrefix(path, " "), consts.ChecksumBinaryMark)
+	if !found || path == "" {
+		return "", "", custom_errors.ErrInvalidManifest
+	}
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return "", "", custom_errors.ErrInvalidManifest
+	}
+
+	return strings.ToLower(checksum), path, nil
+}
+
+// verifyManifest verifies the checksums of the files listed in the manifest.
+//
+// It returns ErrChecksumMismatch if any of the files does not match or cannot be read.
+func verifyManifest(cmdName string, args *checksumArgs, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	reader, closeManifest, err := openSourceFile(args.manifestPath, args.isHostManifest, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, args.manifestPath)
+	}
+	defer closeManifest()
+
+	results := make([]checksumStatusPayload, 0)
+	failed := 0
+	var lineErr error
+	err = readLines(reader, func(line string) bool {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, consts.CommentSymbol) {
+			return true
+		}
+
+		expected, path, err := parseManifestLine(line)
+		if err != nil {
+			lineErr = err
+			return false
+		}
+
+		status := consts.ChecksumOKStatus
+		actual, err := getFileChecksum(cmdName, path, pFs, fatsRef, dataRef)
+		if err != nil {
+			status = consts.ChecksumUnreadableStatus
+			failed++
+		} else if actual != expected {
+			status = consts.ChecksumFailedStatus
+			failed++
+		}
+
+		printTextf("%s: %s\n", path, status)
+		results = append(results, checksumStatusPayload{Path: path, Status: status})
+		return true
+	})
+	if lineErr != nil {
+		return nil, custom_errors.WithPath(lineErr, args.manifestPath)
+	} else if err != nil {
+		return nil, custom_errors.WithPath(err, args.manifestPath)
+	}
+
+	if failed > 0 {
+		printTextf(consts.ChecksumMismatchMsg, failed, len(results))
+		return results, custom_errors.ErrChecksumMismatch
+	}
+
+	return results, nil
+}
+
+// checksumCommand handles the sha256sum, md5sum and crc32 commands.
+//
+// The checksums of the files ("CHECKSUM  path", the format of the manifest) are printed,
+// or the checksums listed in the manifest (-c) are verified. The files are streamed through
+// utils.FileReader. The glob patterns in the paths are expanded. A failure of one of the files
+// is printed and the rest of the files is processed (ErrPartialFailure is returned).
+func checksumCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	args, err := parseChecksumArgs(pCommand.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.manifestPath != "" {
+		return verifyManifest(pCommand.Name, args, pFs, fatsRef, dataRef)
+	}
+
+	paths := make([]string, 0, len(args.paths))
+	for _, pattern := range args.paths {
+		matches, err := globImagePaths(pattern, pFs, fatsRef, dataRef)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+
+	failed := false
+	results := make([]checksumPayload, 0, len(paths))
+	for _, path := range paths {
+		checksum, err := getFileChecksum(pCommand.Name, path, pFs, fatsRef, dataRef)
+		if err != nil {
+			if len(paths) == 1 {
+				return nil, custom_errors.WithPath(err, path)
+			}
+
+			printTextf("%s: %s\n", path, custom_errors.GetUserMsg(err))
+			failed = true
+			continue
+		}
+
+		printTextf(consts.ChecksumLineFormat, checksum, path)
+		results = append(results, checksumPayload{Path: path, Checksum: checksum})
+	}
+
+	if failed {
+		return results, custom_errors.ErrPartialFailure
+	}
+
+	return results, nil
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"kiv-zos-semestral-work/custom_errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksumArgs(t *testing.T) {
+	tests := []struct {
+		args    string
+		want    checksumArgs
+		wantErr error
+	}{
+		{"/a", checksumArgs{paths: []string{"/a"}}, nil},
+		{"a b/c", checksumArgs{paths: []string{"a", "b/c"}}, nil},
+		{"-c sums", checksumArgs{manifestPath: "sums"}, nil},
+		{"-c sums --host", checksumArgs{manifestPath: "sums", isHostManifest: true}, nil},
+		{"--host -c sums", checksumArgs{manifestPath: "sums", isHostManifest: true}, nil},
+
+		{"", checksumArgs{}, custom_errors.ErrInvalArgsCount},
+		{"--host", checksumArgs{}, custom_errors.ErrInvalArgsCount},
+		{"/a --host", checksumArgs{}, custom_errors.ErrInvalArgsCount},
+		{"-c", checksumArgs{}, custom_errors.ErrInvalArgsCount},
+		{"-c sums -c other", checksumArgs{}, custom_errors.ErrInvalArgsCount},
+		{"-c sums /a", checksumArgs{}, custom_errors.ErrInvalArgsCount},
+		{"-x /a", checksumArgs{}, custom_errors.ErrUnknownOption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			pArgs, err := parseChecksumArgs(strings.Fields(tt.args))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*pArgs, tt.want) {
+				t.Errorf("args %+v, want %+v", *pArgs, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifestLine(t *testing.T) {
+	tests := []struct {
+		line         string
+		wantChecksum string
+		wantPath     string
+		wantErr      error
+	}{
+		{"352441c2  /abc", "352441c2", "/abc", nil},
+		{"352441C2  /abc", "352441c2", "/abc", nil},
+		{"352441c2 */abc", "352441c2", "/abc", nil},
+		{"352441c2 rel/path", "352441c2", "rel/path", nil},
+
+		{"352441c2", "", "", custom_errors.ErrInvalidManifest},
+		{"352441c2  ", "", "", custom_errors.ErrInvalidManifest},
+		{"xyz  /abc", "", "", custom_errors.ErrInvalidManifest},
+		{"352441c  /abc", "", "", custom_errors.ErrInvalidManifest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			checksum, path, err := parseManifestLine(tt.line)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if checksum != tt.wantChecksum || path != tt.wantPath {
+				t.Errorf("got %q %q, want %q %q", checksum, path, tt.wantChecksum, tt.wantPath)
+			}
+		})
+	}
+}
+
+// newChecksumTestFS returns the filesystem with the hashed files:
+// /abc ("abc"), /empty and /d/big (spanning more clusters).
+func newChecksumTestFS(t *testing.T) (*cmdTestFS, []byte) {
+	f := newCmdTestFS(t, "1MB")
+	f.run("mkdir /d")
+	f.writeFile("/abc", []byte("abc"))
+	f.writeFile("/empty", []byte{})
+
+	big := make([]byte, 10007)
+	for i := range big {
+		big[i] = byte(i * 7)
+	}
+	f.writeFile("/d/big", big)
+	return f, big
+}
+
+func TestChecksum(t *testing.T) {
+	f, big := newChecksumTestFS(t)
+	bigSum := sha256.Sum256(big)
+
+	tests := []struct {
+		input string
+		want  []checksumPayload
+	}{
+		{"sha256sum /abc", []checksumPayload{{"/abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"}}},
+		{"md5sum /abc", []checksumPayload{{"/abc", "900150983cd24fb0d6963f7d28e17f72"}}},
+		{"crc32 /abc", []checksumPayload{{"/abc", "352441c2"}}},
+		{"sha256sum /empty", []checksumPayload{{"/empty", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}}},
+		{"md5sum /empty", []checksumPayload{{"/empty", "d41d8cd98f00b204e9800998ecf8427e"}}},
+		{"crc32 /empty", []checksumPayload{{"/empty", "00000000"}}},
+		{"sha256sum /d/big", []checksumPayload{{"/d/big", hex.EncodeToString(bigSum[:])}}},
+		{"crc32 /abc /empty", []checksumPayload{{"/abc", "352441c2"}, {"/empty", "00000000"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			payload, text, err := f.exec(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(payload, tt.want) {
+				t.Errorf("payload %+v, want %+v", payload, tt.want)
+			}
+
+			var expected strings.Builder
+			for _, sum := range tt.want {
+				expected.WriteString(sum.Checksum + "  " + sum.Path + "\n")
+			}
+			if text != expected.String() {
+				t.Errorf("printed %q, want %q", text, expected.String())
+			}
+		})
+	}
+}
+
+func TestChecksumErrors(t *testing.T) {
+	f, _ := newChecksumTestFS(t)
+
+	if _, _, err := f.exec("crc32 /none"); !errors.Is(err, custom_errors.ErrEntryNotFound) {
+		t.Errorf("crc32 /none: error %v, want %v", err, custom_errors.ErrEntryNotFound)
+	}
+	if _, _, err := f.exec("crc32 /d"); !errors.Is(err, custom_errors.ErrIsDir) {
+		t.Errorf("crc32 /d: error %v, want %v", err, custom_errors.ErrIsDir)
+	}
+
+	// the rest of the files is hashed
+	payload, text, err := f.exec("crc32 /none /abc")
+	if !errors.Is(err, custom_errors.ErrPartialFailure) {
+		t.Errorf("error %v, want %v", err, custom_errors.ErrPartialFailure)
+	}
+	if want := []checksumPayload{{"/abc", "352441c2"}}; !reflect.DeepEqual(payload, want) {
+		t.Errorf("payload %+v, want %+v", payload, want)
+	}
+	if !strings.HasPrefix(text, "/none: ") || !strings.HasSuffix(text, "352441c2  /abc\n") {
+		t.Errorf("printed %q", text)
+	}
+}
+
+func TestChecksumManifest(t *testing.T) {
+	dir := chdirTemp(t)
+	f, _ := newChecksumTestFS(t)
+
+	// the printed checksums are the manifest
+	_, manifest, err := f.exec("sha256sum /abc /empty /d/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.writeFile("/sums", []byte("# comment\n\n"+manifest))
+	writeHostFile(t, dir, "sums", manifest)
+
+	all := []checksumStatusPayload{{"/abc", "OK"}, {"/empty", "OK"}, {"/d/big", "OK"}}
+	for _, input := range []string{"sha256sum -c /sums", "sha256sum -c sums --host"} {
+		payload, text, err := f.exec(input)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if !reflect.DeepEqual(payload, all) {
+			t.Errorf("%s: payload %+v, want %+v", input, payload, all)
+		}
+		if want := "/abc: OK\n/empty: OK\n/d/big: OK\n"; text != want {
+			t.Errorf("%s: printed %q, want %q", input, text, want)
+		}
+	}
+
+	// the relative paths of the manifest are resolved against the current directory
+	f.writeFile("/d/sums", []byte(strings.ReplaceAll(manifest, "  /d/big", "  big")))
+	f.run("cd /d")
+	if _, _, err := f.exec("sha256sum -c sums"); err != nil {
+		t.Errorf("relative manifest: %v", err)
+	}
+	f.run("cd /")
+
+	// md5 checksums do not match the sha256 manifest
+	payload, _, err := f.exec("md5sum -c /sums")
+	if !errors.Is(err, custom_errors.ErrChecksumMismatch) {
+		t.Errorf("md5sum -c: error %v, want %v", err, custom_errors.ErrChecksumMismatch)
+	}
+	if want := []checksumStatusPayload{{"/abc", "FAILED"}, {"/empty", "FAILED"}, {"/d/big", "FAILED"}}; !reflect.DeepEqual(payload, want) {
+		t.Errorf("md5sum -c: payload %+v, want %+v", payload, want)
+	}
+
+	// the changed and the removed files are detected
+	f.run("echo changed > /abc")
+	f.run("rm /empty")
+	payload, text, err := f.exec("sha256sum -c sums --host")
+	if !errors.Is(err, custom_errors.ErrChecksumMismatch) {
+		t.Errorf("error %v, want %v", err, custom_errors.ErrChecksumMismatch)
+	}
+	want := []checksumStatusPayload{{"/abc", "FAILED"}, {"/empty", "FAILED open or read"}, {"/d/big", "OK"}}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("payload %+v, want %+v", payload, want)
+	}
+	if !strings.HasSuffix(text, "WARNING: 2 of 3 computed checksums did NOT match\n") {
+		t.Errorf("printed %q", text)
+	}
+}
+
+func TestChecksumManifestErrors(t *testing.T) {
+	chdirTemp(t)
+	f, _ := newChecksumTestFS(t)
+	f.writeFile("/bad", []byte("352441c2  /abc\nnot a checksum line\n"))
+
+	tests := []struct {
+		input   string
+		wantErr error
+	}{
+		{"crc32 -c /none", custom_errors.ErrEntryNotFound},
+		{"crc32 -c none --host", custom_errors.ErrInFileNotFound},
+		{"crc32 -c /d", custom_errors.ErrIsDir},
+		{"crc32 -c /bad", custom_errors.ErrInvalidManifest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if _, _, err := f.exec(tt.input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
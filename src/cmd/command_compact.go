@@ -0,0 +1,93 @@
+// command_compact.go contains the implementation of the compact command
+package cmd
+
+import (
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+)
+
+// compactOptions are the parsed arguments of the compact command
+type compactOptions struct {
+	// headroom is the free space in bytes kept after the used clusters
+	headroom uint32
+	// sparse is true if the content of the free clusters is discarded (they are not stored in the filesystem file)
+	sparse bool
+}
+
+// parseCompactArgs parses the arguments of the compact command ([--headroom size] [--sparse]).
+func parseCompactArgs(args []string) (*compactOptions, error) {
+	opts := &compactOptions{headroom: consts.DefaultCompactHeadroom}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case consts.CompactHeadroomOpt:
+			if i+1 >= len(args) {
+				return nil, custom_errors.ErrInvalArgsCount
+			}
+			i++
+
+			headroom, err := parseByteSize(args[i])
+			if err != nil {
+				return nil, err
+			}
+			opts.headroom = headroom
+
+		case consts.CompactSparseOpt:
+			opts.sparse = true
+
+		default:
+			return nil, custom_errors.ErrUnknownOption
+		}
+	}
+
+	return opts, nil
+}
+
+// compactCommand handles the compact command.
+//
+// All used clusters are moved to the front of the data region and the filesystem is shrunk
+// to them plus the headroom (see utils.CompactFileSystem). With --sparse the content of the free
+// clusters is discarded, so they are deallocated in the filesystem file when it is written.
+func compactCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, pFatsRef *[][]int32, pDataRef *[]byte) (bool, any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || pFatsRef == nil || pDataRef == nil {
+		return false, nil, custom_errors.ErrNilPointer
+	}
+
+	opts, err := parseCompactArgs(pCommand.Args)
+	if err != nil {
+		return false, nil, err
+	}
+
+	currDirPath, err := utils.GetAbsolutePathFromPwd(pFs, P_CurrDir, *pFatsRef, *pDataRef)
+	if err != nil {
+		return false, nil, err
+	}
+
+	res, err := utils.CompactFileSystem(pFs, pFatsRef, pDataRef, opts.headroom, opts.sparse)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// the current directory could have been moved (and the data region was reallocated)
+	err = refreshCurrDir(currDirPath, pFs, *pFatsRef, *pDataRef)
+	if err != nil {
+		return true, nil, err
+	}
+
+	printTextf("Filesystem compacted from %d to %d bytes. Allocatable data space: %d bytes\n",
+		res.OldSize, pFs.DiskSize, len(*pDataRef))
+	printTextf("Relocated clusters: %d\n", res.Relocated)
+
+	payload := compactPayload{
+		OldSize:           res.OldSize,
+		Size:              pFs.DiskSize,
+		AllocatableSize:   len(*pDataRef),
+		RelocatedClusters: res.Relocated,
+		Sparse:            opts.sparse,
+	}
+
+	return res.Relocated > 0 || res.OldSize != pFs.DiskSize || opts.sparse, payload, nil
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/utils"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCompactArgs(t *testing.T) {
+	tests := []struct {
+		args    string
+		want    compactOptions
+		wantErr error
+	}{
+		{"", compactOptions{}, nil},
+		{"--sparse", compactOptions{sparse: true}, nil},
+		{"--headroom 100", compactOptions{headroom: 100}, nil},
+		{"--headroom 1MB --sparse", compactOptions{headroom: 1000000, sparse: true}, nil},
+
+		{"--headroom", compactOptions{}, custom_errors.ErrInvalArgsCount},
+		{"--headroom x", compactOptions{}, custom_errors.ErrInvalidOptionValue},
+		{"--headroom -1", compactOptions{}, custom_errors.ErrInvalidOptionValue},
+		{"--dense", compactOptions{}, custom_errors.ErrUnknownOption},
+		{"10KB", compactOptions{}, custom_errors.ErrUnknownOption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			pOpts, err := parseCompactArgs(strings.Fields(tt.args))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*pOpts, tt.want) {
+				t.Errorf("options %+v, want %+v", *pOpts, tt.want)
+			}
+		})
+	}
+}
+
+// checkCompacted fails the test if the used clusters are not at the front of the FAT
+// or the number of the free clusters after them differs.
+func checkCompacted(t *testing.T, f *cmdTestFS, freeClusters uint32) {
+	t.Helper()
+
+	usage := f.checkUsage()
+	if usage.Free != freeClusters {
+		t.Errorf("%d free clusters, want %d", usage.Free, freeClusters)
+	}
+	if uint64(f.pFs.DiskSize) != utils.GetFSSizeForClusters(usage.Total) {
+		t.Errorf("disk size %d for %d clusters", f.pFs.DiskSize, usage.Total)
+	}
+	for cluster := range usage.Used {
+		if f.fats[0][cluster] == consts.FatFree {
+			t.Fatalf("free cluster %d between the used clusters", cluster)
+		}
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   string
+		aCount int
+		bCount int
+	}{
+		{"small", "1MB", 20, 20},
+		{"indexed directory", "10MB", 300, 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newCmdTestFS(t, tt.size)
+			contents := f.populateFragmented(tt.aCount, tt.bCount)
+			f.run("rm /big")
+			delete(contents, "/big")
+			oldSize := f.pFs.DiskSize
+
+			// the current directory is found again if its chain is moved
+			f.run("cd /a")
+			payload, text, err := f.exec("compact --headroom 10KB")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, ok := payload.(compactPayload)
+			if !ok {
+				t.Fatalf("payload %T", payload)
+			}
+			if res.OldSize != oldSize || res.Size != f.pFs.DiskSize || res.Size >= oldSize ||
+				res.AllocatableSize != len(f.data) || res.RelocatedClusters == 0 || res.Sparse {
+				t.Errorf("payload %+v (old size %d)", res, oldSize)
+			}
+			if !strings.HasPrefix(text, "Filesystem compacted from ") {
+				t.Errorf("printed %q", text)
+			}
+
+			// the headroom is rounded up to whole clusters
+			checkCompacted(t, f, 3)
+			f.checkFS()
+			f.checkContents(contents)
+			if pwd := f.run("pwd"); pwd != (pwdPayload{Path: "/a"}) {
+				t.Errorf("pwd %+v after compact", pwd)
+			}
+
+			// the headroom is used by the next write, the filesystem never grows
+			f.writeFile("/a/new", make([]byte, 4000))
+			contents["/a/new"] = make([]byte, 4000)
+			size := f.pFs.DiskSize
+			f.run("compact --headroom 1MB")
+			if f.pFs.DiskSize != size {
+				t.Errorf("disk size %d after compact with a larger headroom, want %d", f.pFs.DiskSize, size)
+			}
+			f.run("compact")
+			checkCompacted(t, f, 0)
+			f.checkFS()
+			f.checkContents(contents)
+
+			// the full filesystem grows only by resize
+			if _, _, err = f.exec("echo x > /full"); !errors.Is(err, custom_errors.ErrNoFreeCluster) {
+				t.Errorf("write to the compacted filesystem: error %v, want %v", err, custom_errors.ErrNoFreeCluster)
+			}
+			f.checkFS()
+			f.run("resize " + tt.size)
+			f.run("echo x > /full")
+			contents["/full"] = []byte("x\n")
+			f.checkFS()
+			f.checkContents(contents)
+
+			f.run("compact")
+			reloadImage(t, f)
+			checkCompacted(t, f, 0)
+			f.checkFS()
+			f.checkContents(contents)
+		})
+	}
+}
+
+func TestCompactSparse(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	contents := f.populateFragmented(20, 20)
+	f.run("rm /big")
+	delete(contents, "/big")
+
+	res, ok := f.run("compact --sparse --headroom 40KB").(compactPayload)
+	if !ok || !res.Sparse {
+		t.Fatalf("payload %+v", res)
+	}
+	checkCompacted(t, f, 10)
+
+	// the content of the free clusters is discarded
+	for cluster, value := range f.fats[0] {
+		if value != consts.FatFree {
+			continue
+		}
+		clusterData := f.data[cluster*int(f.pFs.ClusterSize) : (cluster+1)*int(f.pFs.ClusterSize)]
+		if !utils.IsClusterEmpty(clusterData) {
+			t.Fatalf("free cluster %d is not zeroed", cluster)
+		}
+	}
+	f.checkFS()
+	f.checkContents(contents)
+
+	reloadImage(t, f)
+	f.checkFS()
+	f.checkContents(contents)
+}
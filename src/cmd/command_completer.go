@@ -0,0 +1,150 @@
+// command_completer.go contains the completion of the command names and paths
+package cmd
+
+import (
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"sort"
+	"strings"
+)
+
+// commandNames are the names of all the commands (for the completion)
+var commandNames = []string{
+	consts.CurrDirCommand,
+	consts.HelpCommand,
+	consts.ExitCommand,
+	consts.CheckCommand,
+	consts.DebugCommand,
+	consts.RemoveCommand,
+	consts.MakeDirCommand,
+	consts.RemoveDirCommand,
+	consts.ConcatCommand,
+	consts.ChangeDirCommand,
+	consts.InfoCommand,
+	consts.InterpretScriptCommand,
+	consts.FormatCommand,
+	consts.BugCommand,
+	consts.CopyCommand,
+	consts.MoveCommand,
+	consts.CopyInsideFSCommand,
+	consts.CopyOutsideFSCommand,
+	consts.ListCommand,
+	consts.FindCommand,
+	consts.TreeCommand,
+	consts.DiskUsageCommand,
+	consts.DiskFreeCommand,
+	consts.StatCommand,
+	consts.HeadCommand,
+	consts.TailCommand,
+	consts.WordCountCommand,
+	consts.GrepCommand,
+	consts.HexdumpCommand,
+	consts.XxdCommand,
+	consts.EchoCommand,
+	consts.TruncateCommand,
+	consts.WriteCommand,
+	consts.Sha256sumCommand,
+	consts.Md5sumCommand,
+	consts.Crc32Command,
+	consts.CompareCommand,
+	consts.DiffCommand,
+	consts.DefragCommand,
+	consts.ResizeCommand,
+	consts.CompactCommand,
+}
+
+// isImagePathArg returns true if the argument at the index of the command is a path in the filesystem.
+func isImagePathArg(cmdName string, argIdx int) bool {
+	switch cmdName {
+	case consts.FormatCommand, consts.ResizeCommand, consts.CompactCommand, consts.InterpretScriptCommand:
+		return false
+	case consts.CopyInsideFSCommand:
+		return argIdx == 1
+	case consts.CopyOutsideFSCommand:
+		return argIdx == 0
+	default:
+		return true
+	}
+}
+
+// completePath returns the paths in the filesystem starting with the prefix.
+//
+// Directories are returned with the trailing path delimiter.
+func completePath(prefix string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) []string {
+	dirPart := prefix[:strings.LastIndex(prefix, consts.PathDelimiter)+1]
+	namePrefix := prefix[len(dirPart):]
+
+	dirPath := dirPart
+	if dirPath == "" {
+		dirPath = consts.CurrDirSymbol
+	}
+	absDirPath, err := makePathNormAbs(dirPath, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil
+	}
+
+	branchDirEntries, err := utils.GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, absDirPath)
+	if err != nil {
+		return nil
+	}
+	pDir := branchDirEntries[len(branchDirEntries)-1]
+	if pDir.IsFile {
+		return nil
+	}
+
+	entries, err := utils.GetDirEntries(pFs, pDir, fatsRef, dataRef)
+	if err != nil {
+		return nil
+	}
+
+	res := make([]string, 0)
+	for _, pEntry := range entries {
+		name := utils.GetNormalizedStrFromMem(pEntry.Name[:])
+		if !strings.HasPrefix(name, namePrefix) {
+			continue
+		}
+
+		candidate := dirPart + name
+		if !pEntry.IsFile {
+			candidate += consts.PathDelimiter
+		}
+		res = append(res, candidate)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// GetCompletions returns the candidates replacing the last word of the line.
+//
+// The first word is completed from the command names, the path arguments
+// from the entries of the filesystem (if it is initialized).
+func GetCompletions(line string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) []string {
+	words := strings.Fields(line)
+	// the word being completed is empty if the line ends with a space
+	if len(words) == 0 || strings.HasSuffix(line, " ") {
+		words = append(words, "")
+	}
+	word := words[len(words)-1]
+
+	res := make([]string, 0)
+	if len(words) == 1 {
+		for _, name := range commandNames {
+			if strings.HasPrefix(name, word) {
+				res = append(res, name)
+			}
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	if pFs == nil || fatsRef == nil || dataRef == nil || P_CurrDir == nil {
+		return res
+	}
+	if !isImagePathArg(words[0], len(words)-2) {
+		return res
+	}
+
+	return completePath(word, pFs, fatsRef, dataRef)
+}
@@ -0,0 +1,87 @@
+// command_defrag.go contains the implementation of the defrag command
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+)
+
+// InterruptChan is closed when the program is interrupted (set by the main program).
+// Long running commands stop at a consistent point when it is closed.
+var InterruptChan <-chan struct{} = nil
+
+// printFragmentation prints the fragmentation score with the label.
+func printFragmentation(label string, fragmentation utils.Fragmentation) {
+	printTextf(consts.FragmentationFormat, label, fragmentation.Score(), fragmentation.FragmentedChains, fragmentation.Chains)
+}
+
+// refreshCurrDir finds the current directory again by its path (its start cluster could have been moved).
+func refreshCurrDir(currDirPath string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) error {
+	pDirEntries, err := utils.GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, currDirPath)
+	if err != nil {
+		return err
+	}
+
+	P_CurrDir = pDirEntries[len(pDirEntries)-1]
+	return nil
+}
+
+// defragCommand handles the defrag command.
+//
+// The cluster chains of the entry on the path (the root directory by default) and all entries
+// below it are moved into contiguous runs (see utils.Defragment). The fragmentation score
+// (the percentage of the links between the chain clusters that are not adjacent) is printed
+// before and after. If the program is interrupted, the chains moved so far are kept.
+func defragCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (bool, any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return false, nil, custom_errors.ErrNilPointer
+	}
+
+	path := consts.PathDelimiter
+	if len(pCommand.Args) == 1 {
+		path = pCommand.Args[0]
+	}
+
+	normAbsPath, _, err := getEntryByPath(path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return false, nil, custom_errors.WithPath(err, path)
+	}
+
+	currDirPath, err := utils.GetAbsolutePathFromPwd(pFs, P_CurrDir, fatsRef, dataRef)
+	if err != nil {
+		return false, nil, err
+	}
+
+	res, err := utils.Defragment(pFs, fatsRef, dataRef, normAbsPath, InterruptChan)
+	if err != nil && !errors.Is(err, custom_errors.ErrInterrupted) {
+		return false, nil, err
+	}
+	stopErr := err
+
+	if res.Relocated > 0 {
+		err = refreshCurrDir(currDirPath, pFs, fatsRef, dataRef)
+		if err != nil {
+			return true, nil, err
+		}
+	}
+
+	printFragmentation("Fragmentation before:", res.Before)
+	printTextf("Relocated chains:     %d\n", res.Relocated)
+	printTextf("Skipped chains:       %d (no contiguous free run)\n", res.Skipped)
+	printFragmentation("Fragmentation after: ", res.After)
+
+	payload := defragPayload{
+		Path:        normAbsPath,
+		ScoreBefore: res.Before.Score(),
+		ScoreAfter:  res.After.Score(),
+		Chains:      res.After.Chains,
+		Relocated:   res.Relocated,
+		Skipped:     res.Skipped,
+	}
+
+	return res.Relocated > 0, payload, stopErr
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/utils"
+	"testing"
+)
+
+// getFragmentation returns the fragmentation of the whole filesystem or fails the test.
+func getFragmentation(t *testing.T, f *cmdTestFS) utils.Fragmentation {
+	t.Helper()
+
+	fragmentation, err := utils.GetFragmentation(f.pFs, f.fats, f.data, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fragmentation
+}
+
+// getRootFragments returns 1 if the root chain is fragmented, 0 otherwise (its start stays at cluster 0,
+// so only the rest of it is moved into a contiguous run if the whole chain does not fit there).
+func getRootFragments(t *testing.T, f *cmdTestFS) int {
+	t.Helper()
+
+	if len(utils.GetClusterRuns(f.getChain("/"))) > 1 {
+		return 1
+	}
+	return 0
+}
+
+func TestDefragRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   string
+		aCount int
+		bCount int
+	}{
+		{"small", "1MB", 20, 20},
+		{"indexed directory", "10MB", 300, 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newCmdTestFS(t, tt.size)
+			contents := f.populateFragmented(tt.aCount, tt.bCount)
+			f.checkFS()
+
+			before := getFragmentation(t, f)
+			if before.FragmentedChains == 0 {
+				t.Fatal("the populated filesystem is not fragmented")
+			}
+
+			// the current directory is found again if its chain is moved
+			f.run("cd /a")
+			payload, _, err := f.exec("defrag")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, ok := payload.(defragPayload)
+			if !ok {
+				t.Fatalf("payload %T", payload)
+			}
+
+			after := getFragmentation(t, f)
+			if res.Path != "/" || res.Relocated == 0 || res.ScoreBefore != before.Score() || res.ScoreAfter != after.Score() {
+				t.Errorf("payload %+v, score %.2f before and %.2f after", res, before.Score(), after.Score())
+			}
+			if after.FragmentedChains-getRootFragments(t, f) != res.Skipped || after.Chains != before.Chains || after.Score() >= before.Score() {
+				t.Errorf("fragmentation %+v after (%d skipped), %+v before", after, res.Skipped, before)
+			}
+
+			f.checkFS()
+			f.checkContents(contents)
+			if pwd := f.run("pwd"); pwd != (pwdPayload{Path: "/a"}) {
+				t.Errorf("pwd %+v after defrag", pwd)
+			}
+			if _, _, err = f.exec("ls"); err != nil {
+				t.Errorf("ls in the current directory: %v", err)
+			}
+
+			// the defragmented filesystem stays consistent after the next changes
+			f.run("rm /big")
+			f.writeFile("/new", make([]byte, 9000))
+			contents["/new"] = make([]byte, 9000)
+			delete(contents, "/big")
+			f.run("defrag /a")
+			f.checkFS()
+			f.checkContents(contents)
+		})
+	}
+}
+
+func TestDefragSubtree(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	contents := f.populateFragmented(20, 20)
+
+	fragmentedB, err := utils.GetFragmentation(f.pFs, f.fats, f.data, "/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, ok := f.run("defrag /b").(defragPayload)
+	if !ok {
+		t.Fatal("defrag payload")
+	}
+	if res.Path != "/b" || res.Chains != fragmentedB.Chains {
+		t.Errorf("payload %+v, %d chains below /b", res, fragmentedB.Chains)
+	}
+
+	// the chains outside of the path are not moved
+	afterB, err := utils.GetFragmentation(f.pFs, f.fats, f.data, "/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if afterB.FragmentedChains != res.Skipped {
+		t.Errorf("%d fragmented chains below /b, %d skipped", afterB.FragmentedChains, res.Skipped)
+	}
+	f.checkFS()
+	f.checkContents(contents)
+
+	if _, _, err = f.exec("defrag /none"); !errors.Is(err, custom_errors.ErrPathNotFound) {
+		t.Errorf("defrag /none: error %v, want %v", err, custom_errors.ErrPathNotFound)
+	}
+}
+
+func TestDefragInterrupted(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	contents := f.populateFragmented(20, 20)
+
+	interrupt := make(chan struct{})
+	close(interrupt)
+	InterruptChan = interrupt
+	defer func() {
+		InterruptChan = nil
+	}()
+
+	if _, _, err := f.exec("defrag"); !errors.Is(err, custom_errors.ErrInterrupted) {
+		t.Errorf("error %v, want %v", err, custom_errors.ErrInterrupted)
+	}
+	f.checkFS()
+	f.checkContents(contents)
+
+	// the interrupted defragmentation is finished by the next run
+	InterruptChan = nil
+	f.run("defrag")
+	f.checkFS()
+	f.checkContents(contents)
+}
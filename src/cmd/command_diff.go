@@ -0,0 +1,451 @@
+// command_diff.go contains the implementation of the cmp and diff commands
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// compareArgs are the parsed arguments of the cmp and diff commands
+type compareArgs struct {
+	// first is the path of the first file (or directory) in the filesystem
+	first string
+	// second is the path of the second file (or directory)
+	second string
+	// isHostSecond is true if the second path is on the host filesystem
+	isHostSecond bool
+	// recursive is true if the directories are compared recursively (diff only)
+	recursive bool
+}
+
+// parseCompareArgs parses the arguments of the cmp and diff commands
+// ("cmp a1 a2 [--host]" or "diff [-r] a1 a2 [--host]").
+func parseCompareArgs(cmdName string, args []string) (*compareArgs, error) {
+	res := &compareArgs{}
+	paths := make([]string, 0, 2)
+	for _, arg := range args {
+		switch {
+		case arg == consts.CompareHostOpt:
+			res.isHostSecond = true
+		case arg == consts.DiffRecursiveOpt && cmdName == consts.DiffCommand:
+			res.recursive = true
+		case strings.HasPrefix(arg, "-"):
+			return nil, custom_errors.ErrUnknownOption
+		default:
+			paths = append(paths, arg)
+		}
+	}
+
+	if len(paths) != 2 {
+		return nil, custom_errors.ErrInvalArgsCount
+	}
+	res.first, res.second = paths[0], paths[1]
+
+	err := validatePathFormat(res.first)
+	if err != nil {
+		return nil, err
+	}
+	if !res.isHostSecond {
+		err = validatePathFormat(res.second)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// firstDifference is the position of the first difference of the compared files
+type firstDifference struct {
+	// identical is true if the files have the same content
+	identical bool
+	// offset is the 0-based offset of the first differing byte
+	offset int64
+	// line is the 1-based line of the first differing byte
+	line int64
+	// shorterFile is 1 or 2 if the file ended at the offset (it is the prefix of the other one), 0 otherwise
+	shorterFile int
+}
+
+// findFirstDifference streams the both readers and returns the position of their first difference.
+func findFirstDifference(first io.Reader, second io.Reader) (firstDifference, error) {
+	firstReader := bufio.NewReader(first)
+	secondReader := bufio.NewReader(second)
+	res := firstDifference{line: 1}
+	for {
+		firstByte, firstErr := firstReader.ReadByte()
+		if firstErr != nil && !errors.Is(firstErr, io.EOF) {
+			return res, firstErr
+		}
+		secondByte, secondErr := secondReader.ReadByte()
+		if secondErr != nil && !errors.Is(secondErr, io.EOF) {
+			return res, secondErr
+		}
+
+		switch {
+		case firstErr != nil && secondErr != nil:
+			res.identical = true
+			return res, nil
+		case firstErr != nil:
+			res.shorterFile = 1
+			return res, nil
+		case secondErr != nil:
+			res.shorterFile = 2
+			return res, nil
+		case firstByte != secondByte:
+			return res, nil
+		}
+
+		if firstByte == '\n' {
+			res.line++
+		}
+		res.offset++
+	}
+}
+
+// compareSourceFiles returns the position of the first difference of the files.
+func compareSourceFiles(args *compareArgs, first string, second string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (firstDifference, error) {
+	firstReader, closeFirst, err := openSourceFile(first, false, pFs, fatsRef, dataRef)
+	if err != nil {
+		return firstDifference{}, custom_errors.WithPath(err, first)
+	}
+	defer closeFirst()
+
+	secondReader, closeSecond, err := openSourceFile(second, args.isHostSecond, pFs, fatsRef, dataRef)
+	if err != nil {
+		return firstDifference{}, custom_errors.WithPath(err, second)
+	}
+	defer closeSecond()
+
+	return findFirstDifference(firstReader, secondReader)
+}
+
+// readSourceFile reads the whole content of the file on the host (isHost) or in the filesystem.
+func readSourceFile(path string, isHost bool, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) ([]byte, error) {
+	reader, closeFile, err := openSourceFile(path, isHost, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, path)
+	}
+	defer closeFile()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, path)
+	}
+
+	return content, nil
+}
+
+// isBinaryContent returns true if the leading bytes of the content contain a NUL byte.
+func isBinaryContent(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), consts.BinaryProbeSize)], 0) >= 0
+}
+
+// splitContentLines splits the content into the lines (without the line terminators).
+func splitContentLines(content []byte) []string {
+	if len(content) == 0 {
+		return []string{}
+	}
+
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// diffFiles prints the unified diff of the text files, or the first differing byte of the binary files.
+//
+// It returns ErrFilesDiffer if the files are not the same.
+func diffFiles(args *compareArgs, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	firstContent, err := readSourceFile(args.first, false, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+	secondContent, err := readSourceFile(args.second, args.isHostSecond, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := diffPayload{First: args.first, Second: args.second}
+	if bytes.Equal(firstContent, secondContent) {
+		printText(consts.CmdSuccessMsg)
+		payload.Identical = true
+		return payload, nil
+	}
+
+	if isBinaryContent(firstContent) || isBinaryContent(secondContent) {
+		diff, err := findFirstDifference(bytes.NewReader(firstContent), bytes.NewReader(secondContent))
+		if err != nil {
+			return nil, err
+		}
+
+		printTextf(consts.DiffBinaryFormat, args.first, args.second, diff.offset+1)
+		payload.Binary = true
+		payload.Offset = diff.offset
+		return payload, custom_errors.ErrFilesDiffer
+	}
+
+	ops, err := utils.DiffLines(splitContentLines(firstContent), splitContentLines(secondContent), consts.DiffMaxEdits)
+	if err != nil {
+		return nil, err
+	}
+
+	printTextf(consts.DiffFirstFileHeader, args.first)
+	printTextf(consts.DiffSecondFileHeader, args.second)
+	payload.Lines = utils.UnifiedDiffHunks(ops, consts.DiffContextLines)
+	for _, line := range payload.Lines {
+		printText(line)
+	}
+
+	return payload, custom_errors.ErrFilesDiffer
+}
+
+// isSourceDir returns true if the path on the host (isHost) or in the filesystem is a directory.
+func isSourceDir(path string, isHost bool, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (bool, error) {
+	if isHost {
+		info, err := os.Stat(path)
+		if err != nil {
+			logging.Info(fmt.Sprintf("Error reading the host path \"%s\": %s", path, err))
+			return false, custom_errors.ErrInFileNotFound
+		}
+		return info.IsDir(), nil
+	}
+
+	_, pEntry, err := getEntryByPath(path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return false, err
+	}
+
+	return !pEntry.IsFile, nil
+}
+
+// listImageTree returns the entries below the directory in the filesystem
+// (the paths relative to the directory mapped to whether the entry is a directory).
+func listImageTree(path string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (map[string]bool, error) {
+	matches, err := findEntries(&findOptions{startPath: path, maxDepth: -1}, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]bool, len(matches))
+	for _, match := range matches[1:] {
+		relPath := strings.TrimPrefix(match.absPath[len(matches[0].absPath):], consts.PathDelimiter)
+		res[relPath] = !match.pEntry.IsFile
+	}
+
+	return res, nil
+}
+
+// listHostTree returns the regular files and directories below the directory on the host
+// (the paths relative to the directory mapped to whether the entry is a directory).
+func listHostTree(path string) (map[string]bool, error) {
+	res := make(map[string]bool)
+	err := filepath.WalkDir(path, func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entryPath == path || (!d.IsDir() && !d.Type().IsRegular()) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(path, entryPath)
+		if err != nil {
+			return err
+		}
+		res[filepath.ToSlash(relPath)] = d.IsDir()
+		return nil
+	})
+	if err != nil {
+		logging.Info(fmt.Sprintf("Error walking the host directory \"%s\": %s", path, err))
+		return nil, custom_errors.ErrInFileNotFound
+	}
+
+	return res, nil
+}
+
+// getSecondTreePath returns the path of the entry below the second directory.
+func getSecondTreePath(args *compareArgs, relPath string) string {
+	if args.isHostSecond {
+		return filepath.Join(args.second, filepath.FromSlash(relPath))
+	}
+
+	return strings.TrimSuffix(args.second, consts.PathDelimiter) + consts.PathDelimiter + relPath
+}
+
+// diffTrees lists the entries added, removed and changed between the directories.
+// The entries below an added or removed directory are not listed.
+//
+// It returns ErrFilesDiffer if the directories are not the same.
+func diffTrees(args *compareArgs, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	firstTree, err := listImageTree(args.first, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, args.first)
+	}
+
+	var secondTree map[string]bool
+	if args.isHostSecond {
+		secondTree, err = listHostTree(args.second)
+	} else {
+		secondTree, err = listImageTree(args.second, pFs, fatsRef, dataRef)
+	}
+	if err != nil {
+		return nil, custom_errors.WithPath(err, args.second)
+	}
+
+	relPaths := make([]string, 0, len(firstTree)+len(secondTree))
+	for relPath := range firstTree {
+		relPaths = append(relPaths, relPath)
+	}
+	for relPath := range secondTree {
+		if _, found := firstTree[relPath]; !found {
+			relPaths = append(relPaths, relPath)
+		}
+	}
+	sort.Strings(relPaths)
+
+	payload := treeDiffPayload{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	collapsed := make(map[string]bool)
+	for _, relPath := range relPaths {
+		// the entries below the added or removed directory are not listed (they do not have to sort
+		// right after it, e.g. "a.d" sorts between "a" and "a/x")
+		if hasCollapsedAncestor(collapsed, relPath) {
+			continue
+		}
+
+		firstIsDir, inFirst := firstTree[relPath]
+		secondIsDir, inSecond := secondTree[relPath]
+
+		status := ""
+		switch {
+		case !inFirst:
+			status = consts.DiffAddedStatus
+			payload.Added = append(payload.Added, relPath)
+		case !inSecond:
+			status = consts.DiffRemovedStatus
+			payload.Removed = append(payload.Removed, relPath)
+		case firstIsDir != secondIsDir:
+			status = consts.DiffChangedStatus
+			payload.Changed = append(payload.Changed, relPath)
+		case !firstIsDir:
+			firstPath := strings.TrimSuffix(args.first, consts.PathDelimiter) + consts.PathDelimiter + relPath
+			diff, err := compareSourceFiles(args, firstPath, getSecondTreePath(args, relPath), pFs, fatsRef, dataRef)
+			if err != nil {
+				return nil, err
+			}
+			if !diff.identical {
+				status = consts.DiffChangedStatus
+				payload.Changed = append(payload.Changed, relPath)
+			}
+		}
+
+		if (status == consts.DiffAddedStatus && secondIsDir) || (status == consts.DiffRemovedStatus && firstIsDir) {
+			collapsed[relPath] = true
+		}
+		if status != "" {
+			printTextf("%s: %s\n", status, relPath)
+		}
+	}
+
+	if len(payload.Added)+len(payload.Removed)+len(payload.Changed) > 0 {
+		return payload, custom_errors.ErrFilesDiffer
+	}
+
+	printText(consts.CmdSuccessMsg)
+	return payload, nil
+}
+
+// hasCollapsedAncestor returns true if any of the ancestor directories of the relative path is collapsed.
+func hasCollapsedAncestor(collapsed map[string]bool, relPath string) bool {
+	for idx := strings.LastIndex(relPath, consts.PathDelimiter); idx > 0; idx = strings.LastIndex(relPath[:idx], consts.PathDelimiter) {
+		if collapsed[relPath[:idx]] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compareCommand handles the cmp command.
+//
+// The files are streamed and the first differing byte (or the end of the shorter file) is printed.
+// It returns ErrFilesDiffer if the files are not the same.
+func compareCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	args, err := parseCompareArgs(pCommand.Name, pCommand.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := compareSourceFiles(args, args.first, args.second, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := comparePayload{First: args.first, Second: args.second, Identical: diff.identical}
+	if diff.identical {
+		printText(consts.CmdSuccessMsg)
+		return payload, nil
+	}
+
+	payload.Offset = diff.offset
+	payload.Line = diff.line
+	switch diff.shorterFile {
+	case 1:
+		payload.EOF = args.first
+		printTextf(consts.CompareEOFFormat, args.first, diff.offset)
+	case 2:
+		payload.EOF = args.second
+		printTextf(consts.CompareEOFFormat, args.second, diff.offset)
+	default:
+		printTextf(consts.CompareDifferFormat, args.first, args.second, diff.offset+1, diff.line)
+	}
+
+	return payload, custom_errors.ErrFilesDiffer
+}
+
+// diffCommand handles the diff command.
+//
+// Text files are compared line by line (unified diff), binary files by the first differing byte.
+// With -r the directories are compared recursively (see diffTrees).
+func diffCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	args, err := parseCompareArgs(pCommand.Name, pCommand.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.recursive {
+		firstIsDir, err := isSourceDir(args.first, false, pFs, fatsRef, dataRef)
+		if err != nil {
+			return nil, custom_errors.WithPath(err, args.first)
+		}
+		secondIsDir, err := isSourceDir(args.second, args.isHostSecond, pFs, fatsRef, dataRef)
+		if err != nil {
+			return nil, custom_errors.WithPath(err, args.second)
+		}
+
+		if firstIsDir && secondIsDir {
+			return diffTrees(args, pFs, fatsRef, dataRef)
+		}
+	}
+
+	return diffFiles(args, pFs, fatsRef, dataRef)
+}
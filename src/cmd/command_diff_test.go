@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/custom_errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCompareArgs(t *testing.T) {
+	tests := []struct {
+		cmdName string
+		args    string
+		want    compareArgs
+		wantErr error
+	}{
+		{"cmp", "/a /b", compareArgs{first: "/a", second: "/b"}, nil},
+		{"cmp", "a host.txt --host", compareArgs{first: "a", second: "host.txt", isHostSecond: true}, nil},
+		{"diff", "-r /a /b", compareArgs{first: "/a", second: "/b", recursive: true}, nil},
+		{"diff", "/a --host -r dir", compareArgs{first: "/a", second: "dir", isHostSecond: true, recursive: true}, nil},
+
+		{"cmp", "/a", compareArgs{}, custom_errors.ErrInvalArgsCount},
+		{"cmp", "/a /b /c", compareArgs{}, custom_errors.ErrInvalArgsCount},
+		{"cmp", "-r /a /b", compareArgs{}, custom_errors.ErrUnknownOption},
+		{"diff", "-x /a /b", compareArgs{}, custom_errors.ErrUnknownOption},
+		{"diff", "--host", compareArgs{}, custom_errors.ErrInvalArgsCount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmdName+" "+tt.args, func(t *testing.T) {
+			pArgs, err := parseCompareArgs(tt.cmdName, strings.Fields(tt.args))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*pArgs, tt.want) {
+				t.Errorf("args %+v, want %+v", *pArgs, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	dir := chdirTemp(t)
+	f := newCmdTestFS(t, "1MB")
+	f.run("mkdir /d")
+
+	big := strings.Repeat("0123456789", 1000)
+	files := map[string]string{
+		"same":  "ab\ncd\n",
+		"other": "ab\ncX\n",
+		"short": "ab\n",
+		"big":   big,
+		"big2":  big[:5000] + "!" + big[5001:],
+	}
+	for name, content := range files {
+		f.writeFile("/"+name, []byte(content))
+		writeHostFile(t, dir, name, content)
+	}
+	f.writeFile("/copy", []byte(files["same"]))
+
+	tests := []struct {
+		input    string
+		want     comparePayload
+		wantText string
+	}{
+		{"cmp /same /copy", comparePayload{First: "/same", Second: "/copy", Identical: true}, "OK\n"},
+		{"cmp /same same --host", comparePayload{First: "/same", Second: "same", Identical: true}, "OK\n"},
+		{"cmp /big big --host", comparePayload{First: "/big", Second: "big", Identical: true}, "OK\n"},
+		{"cmp /same /other", comparePayload{First: "/same", Second: "/other", Offset: 4, Line: 2},
+			"/same /other differ: byte 5, line 2\n"},
+		{"cmp /same other --host", comparePayload{First: "/same", Second: "other", Offset: 4, Line: 2},
+			"/same other differ: byte 5, line 2\n"},
+		{"cmp /big /big2", comparePayload{First: "/big", Second: "/big2", Offset: 5000, Line: 1},
+			"/big /big2 differ: byte 5001, line 1\n"},
+		{"cmp /short /same", comparePayload{First: "/short", Second: "/same", Offset: 3, Line: 2, EOF: "/short"},
+			"EOF on /short after byte 3\n"},
+		{"cmp /same short --host", comparePayload{First: "/same", Second: "short", Offset: 3, Line: 2, EOF: "short"},
+			"EOF on short after byte 3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			payload, text, err := f.exec(tt.input)
+			if tt.want.Identical && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want.Identical && !errors.Is(err, custom_errors.ErrFilesDiffer) {
+				t.Errorf("error %v, want %v", err, custom_errors.ErrFilesDiffer)
+			}
+
+			if payload != tt.want {
+				t.Errorf("payload %+v, want %+v", payload, tt.want)
+			}
+			if text != tt.wantText {
+				t.Errorf("printed %q, want %q", text, tt.wantText)
+			}
+		})
+	}
+
+	errTests := []struct {
+		input   string
+		wantErr error
+	}{
+		{"cmp /none /same", custom_errors.ErrEntryNotFound},
+		{"cmp /same /none", custom_errors.ErrEntryNotFound},
+		{"cmp /same none --host", custom_errors.ErrInFileNotFound},
+		{"cmp /d /same", custom_errors.ErrIsDir},
+		{"cmp /same . --host", custom_errors.ErrIsDir},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.input, func(t *testing.T) {
+			if _, _, err := f.exec(tt.input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	dir := chdirTemp(t)
+	f := newCmdTestFS(t, "1MB")
+
+	first := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	second := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n"
+	f.writeFile("/first", []byte(first))
+	f.writeFile("/second", []byte(second))
+	f.writeFile("/copy", []byte(first))
+	f.writeFile("/bin", []byte("abc\x00def"))
+	f.writeFile("/bin2", []byte("abc\x00deX"))
+	writeHostFile(t, dir, "second", second)
+
+	payload, text, err := f.exec("diff /first /copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (diffPayload{First: "/first", Second: "/copy", Identical: true}); !reflect.DeepEqual(payload, want) {
+		t.Errorf("payload %+v, want %+v", payload, want)
+	}
+	if text != "OK\n" {
+		t.Errorf("printed %q", text)
+	}
+
+	lines := []string{"@@ -2,9 +2,10 @@", " 2", " 3", " 4", "-5", "+five", " 6", " 7", " 8", " 9", " 10", "+11"}
+	for _, tt := range []struct {
+		input  string
+		second string
+	}{
+		{"diff /first /second", "/second"},
+		{"diff /first second --host", "second"},
+	} {
+		payload, text, err := f.exec(tt.input)
+		if !errors.Is(err, custom_errors.ErrFilesDiffer) {
+			t.Errorf("%s: error %v, want %v", tt.input, err, custom_errors.ErrFilesDiffer)
+		}
+
+		want := diffPayload{First: "/first", Second: tt.second, Lines: lines}
+		if !reflect.DeepEqual(payload, want) {
+			t.Errorf("%s: payload %+v, want %+v", tt.input, payload, want)
+		}
+		wantText := "--- /first\n+++ " + tt.second + "\n" + strings.Join(lines, "\n") + "\n"
+		if text != wantText {
+			t.Errorf("%s: printed %q, want %q", tt.input, text, wantText)
+		}
+	}
+
+	payload, text, err = f.exec("diff /bin /bin2")
+	if !errors.Is(err, custom_errors.ErrFilesDiffer) {
+		t.Errorf("binary: error %v, want %v", err, custom_errors.ErrFilesDiffer)
+	}
+	if want := (diffPayload{First: "/bin", Second: "/bin2", Binary: true, Offset: 6}); !reflect.DeepEqual(payload, want) {
+		t.Errorf("binary: payload %+v, want %+v", payload, want)
+	}
+	if want := "Binary files /bin and /bin2 differ: byte 7\n"; text != want {
+		t.Errorf("binary: printed %q, want %q", text, want)
+	}
+
+	if _, _, err = f.exec("diff /first none --host"); !errors.Is(err, custom_errors.ErrInFileNotFound) {
+		t.Errorf("missing host file: error %v, want %v", err, custom_errors.ErrInFileNotFound)
+	}
+}
+
+func TestDiffTrees(t *testing.T) {
+	dir := chdirTemp(t)
+	f := newCmdTestFS(t, "1MB")
+
+	// the first tree and its copy with the changes
+	for _, path := range []string{"/x", "/x/sub", "/x/gone", "/x/gone/deep", "/x/kind", "/y", "/y/sub", "/y/new", "/y/new/deep"} {
+		f.run("mkdir " + path)
+	}
+	for path, content := range map[string]string{
+		"/x/same": "same\n", "/x/sub/changed": "old\n", "/x/sub/kept": "kept\n", "/x/gone/deep/f": "f\n", "/x/removed": "r\n",
+		"/y/same": "same\n", "/y/sub/changed": "new\n", "/y/sub/kept": "kept\n", "/y/new/deep/f": "f\n", "/y/added": "a\n",
+		"/y/kind": "now a file\n",
+	} {
+		f.writeFile(path, []byte(content))
+	}
+
+	want := treeDiffPayload{
+		Added:   []string{"added", "new"},
+		Removed: []string{"gone", "removed"},
+		Changed: []string{"kind", "sub/changed"},
+	}
+	wantText := "added: added\nremoved: gone\nchanged: kind\nadded: new\nremoved: removed\nchanged: sub/changed\n"
+
+	payload, text, err := f.exec("diff -r /x /y")
+	if !errors.Is(err, custom_errors.ErrFilesDiffer) {
+		t.Errorf("error %v, want %v", err, custom_errors.ErrFilesDiffer)
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("payload %+v, want %+v", payload, want)
+	}
+	if text != wantText {
+		t.Errorf("printed %q, want %q", text, wantText)
+	}
+
+	// the same tree on the host
+	for _, path := range []string{"y", "y/sub", "y/new", "y/new/deep"} {
+		if err := os.Mkdir(dir+"/"+path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{"same", "sub/changed", "sub/kept", "new/deep/f", "added", "kind"} {
+		writeHostFile(t, dir, "y/"+path, string(f.readFile("/y/"+path)))
+	}
+	payload, text, err = f.exec("diff -r /x y --host")
+	if !errors.Is(err, custom_errors.ErrFilesDiffer) {
+		t.Errorf("host: error %v, want %v", err, custom_errors.ErrFilesDiffer)
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("host: payload %+v, want %+v", payload, want)
+	}
+	if text != wantText {
+		t.Errorf("host: printed %q, want %q", text, wantText)
+	}
+
+	payload, text, err = f.exec("diff -r /y y --host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (treeDiffPayload{Added: []string{}, Removed: []string{}, Changed: []string{}}); !reflect.DeepEqual(payload, want) {
+		t.Errorf("identical: payload %+v", payload)
+	}
+	if text != "OK\n" {
+		t.Errorf("identical: printed %q", text)
+	}
+
+	// the names sorting between the collapsed directory and its entries ("a" < "a.d" < "a.d/y" < "a/x")
+	for _, path := range []string{"/p", "/q", "/q/a", "/q/a/x", "/q/a.d", "/q/a.d/y", "/q/a.d/y/z", "/p/b", "/p/b/c"} {
+		f.run("mkdir " + path)
+	}
+	f.writeFile("/q/a/x/f", []byte("f\n"))
+	f.writeFile("/q/a.d/y/g", []byte("g\n"))
+	f.writeFile("/q/a-", []byte("-\n"))
+	f.writeFile("/p/b/c/h", []byte("h\n"))
+	f.writeFile("/p/b.txt", []byte("b\n"))
+	want = treeDiffPayload{Added: []string{"a", "a-", "a.d"}, Removed: []string{"b", "b.txt"}, Changed: []string{}}
+	payload, text, err = f.exec("diff -r /p /q")
+	if !errors.Is(err, custom_errors.ErrFilesDiffer) {
+		t.Errorf("collapsed: error %v, want %v", err, custom_errors.ErrFilesDiffer)
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("collapsed: payload %+v, want %+v", payload, want)
+	}
+	if wantText := "added: a\nadded: a-\nadded: a.d\nremoved: b\nremoved: b.txt\n"; text != wantText {
+		t.Errorf("collapsed: printed %q, want %q", text, wantText)
+	}
+
+	if _, _, err = f.exec("diff -r /x none --host"); !errors.Is(err, custom_errors.ErrInFileNotFound) {
+		t.Errorf("missing host directory: error %v, want %v", err, custom_errors.ErrInFileNotFound)
+	}
+	// without -r the directories are read as the files
+	if _, _, err = f.exec("diff /x /y"); !errors.Is(err, custom_errors.ErrIsDir) {
+		t.Errorf("directories without -r: error %v, want %v", err, custom_errors.ErrIsDir)
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"kiv-zos-semestral-work/consts"
 	"kiv-zos-semestral-work/custom_errors"
@@ -20,6 +21,33 @@ import (
 // P_CurrDir is a global variable that holds the current directory
 var P_CurrDir *pseudo_fat.DirectoryEntry = nil
 
+// IsReadOnly is a global variable that holds whether the filesystem is opened read-only
+var IsReadOnly = false
+
+// isModifyingCommand returns true if the command can modify the filesystem.
+func isModifyingCommand(cmdName string) bool {
+	switch cmdName {
+	case
+		consts.FormatCommand,
+		consts.MakeDirCommand,
+		consts.RemoveDirCommand,
+		consts.RemoveCommand,
+		consts.CopyCommand,
+		consts.MoveCommand,
+		consts.CopyInsideFSCommand,
+		consts.TruncateCommand,
+		consts.WriteCommand,
+		consts.DefragCommand,
+		consts.ResizeCommand,
+		consts.CompactCommand,
+		consts.BugCommand:
+		return true
+
+	default:
+		return false
+	}
+}
+
 // sortDirectoryEntries sorts the entries placing directories first and then sorting by name.
 // It sorts the slice in place.
 func sortDirectoryEntries(entries []*pseudo_fat.DirectoryEntry) {
@@ -36,7 +64,7 @@ func sortDirectoryEntries(entries []*pseudo_fat.DirectoryEntry) {
 
 // helpCommand prints the help message
 func helpCommand() error {
-	fmt.Print(consts.HelpMsg)
+	printTextf("%s", consts.HelpMsg)
 	return nil
 }
 
@@ -98,7 +126,7 @@ func formatCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, pFatsRef *[][]
 	// assign current directory
 	P_CurrDir = &rootDir
 
-	fmt.Printf("Filesystem formatted to %d bytes. Allocatable data space: %d bytes\n", size, allocatableSize)
+	printTextf("Filesystem formatted to %d bytes. Allocatable data space: %d bytes\n", size, allocatableSize)
 	return true, nil
 }
 
@@ -161,7 +189,7 @@ func changeDirCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][
 	// get the directory entry
 	pDirEntries, err := utils.GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, absPath)
 	if err != nil {
-		if err == custom_errors.ErrEntryNotFound {
+		if errors.Is(err, custom_errors.ErrEntryNotFound) {
 			return false, custom_errors.ErrPathNotFound
 		}
 		return false, err
@@ -254,14 +282,10 @@ func removeCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]in
 
 	err = utils.RemoveFile(pFs, fatsRef, dataRef, normAbsPath)
 	if err != nil {
-		switch err {
-		case custom_errors.ErrEntryNotFound:
-			fmt.Println(consts.FileNotFound)
-		default:
-			return false, fmt.Errorf("error removing file: %s", err)
+		if errors.Is(err, custom_errors.ErrEntryNotFound) {
+			return false, custom_errors.ErrFileNotFound
 		}
-
-		return false, nil
+		return false, fmt.Errorf("error removing file: %w", err)
 	}
 
 	return true, nil
@@ -292,7 +316,7 @@ func listCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int3
 	// get the directory entries
 	branchDirEntries, err := utils.GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, normAbsPath)
 	if err != nil {
-		if err == custom_errors.ErrEntryNotFound {
+		if errors.Is(err, custom_errors.ErrEntryNotFound) {
 			return nil, custom_errors.ErrPathNotFound
 		}
 		return nil, err
@@ -301,6 +325,11 @@ func listCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int3
 	// get the target directory
 	targetDir := branchDirEntries[len(branchDirEntries)-1]
 
+	// listing a file shows only the file itself
+	if targetDir.IsFile {
+		return []*pseudo_fat.DirectoryEntry{targetDir}, nil
+	}
+
 	// get the directory entries
 	dirEntries, err := utils.GetDirEntries(pFs, targetDir, fatsRef, dataRef)
 	if err != nil {
@@ -326,7 +355,7 @@ func copyInsideFS(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int
 	// check if the input file exists
 	_, err := os.Stat(pCommand.Args[0])
 	if os.IsNotExist(err) {
-		return false, custom_errors.ErrInFileNotFound
+		return false, custom_errors.WithPath(custom_errors.ErrInFileNotFound, pCommand.Args[0])
 	} else if err != nil {
 		return false, err
 	}
@@ -340,17 +369,17 @@ func copyInsideFS(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int
 	// check if the file name is valid
 	baseName := utils.GetPathBasename(pCommand.Args[1])
 	if baseName == consts.CurrDirSymbol || baseName == consts.ParentDirSymbol || baseName == "" {
-		return false, custom_errors.ErrInvalidDirEntryName
+		return false, custom_errors.WithPath(custom_errors.ErrInvalidDirEntryName, pCommand.Args[1])
 	}
 
 	absPath, err := makePathNormAbs(pCommand.Args[1], pFs, fatsRef, dataRef)
 	if err != nil {
-		return false, err
+		return false, custom_errors.WithPath(err, pCommand.Args[1])
 	}
 
 	err = utils.CopyInsideFS(pFs, fatsRef, dataRef, absPath, fileData)
 	if err != nil {
-		return false, err
+		return false, custom_errors.WithPath(err, pCommand.Args[1])
 	}
 
 	return true, nil
@@ -369,13 +398,13 @@ func moveCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int3
 	// check if the file name is valid
 	srcBasename := utils.GetPathBasename(pCommand.Args[0])
 	if srcBasename == consts.CurrDirSymbol || srcBasename == consts.ParentDirSymbol || srcBasename == "" {
-		return false, custom_errors.ErrInvalidDirEntryName
+		return false, custom_errors.WithPath(custom_errors.ErrInvalidDirEntryName, pCommand.Args[0])
 	}
 
 	// get the source path
 	srcPath, err := makePathNormAbs(pCommand.Args[0], pFs, fatsRef, dataRef)
 	if err != nil {
-		return false, err
+		return false, custom_errors.WithPath(err, pCommand.Args[0])
 	}
 
 	unprocessedDestPath := pCommand.Args[1]
@@ -386,7 +415,7 @@ func moveCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int3
 	// get the destination path
 	destPath, err := makePathNormAbs(unprocessedDestPath, pFs, fatsRef, dataRef)
 	if err != nil {
-		return false, err
+		return false, custom_errors.WithPath(err, pCommand.Args[1])
 	}
 
 	if srcPath == destPath {
@@ -414,13 +443,13 @@ func copyCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int3
 	// check if the file name is valid
 	srcBasename := utils.GetPathBasename(pCommand.Args[0])
 	if srcBasename == consts.CurrDirSymbol || srcBasename == consts.ParentDirSymbol || srcBasename == "" {
-		return false, custom_errors.ErrInvalidDirEntryName
+		return false, custom_errors.WithPath(custom_errors.ErrInvalidDirEntryName, pCommand.Args[0])
 	}
 
 	// get the source path
 	srcPath, err := makePathNormAbs(pCommand.Args[0], pFs, fatsRef, dataRef)
 	if err != nil {
-		return false, err
+		return false, custom_errors.WithPath(err, pCommand.Args[0])
 	}
 
 	// get the destination path
@@ -431,7 +460,7 @@ func copyCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int3
 
 	destPath, err := makePathNormAbs(unprocessedDestPath, pFs, fatsRef, dataRef)
 	if err != nil {
-		return false, err
+		return false, custom_errors.WithPath(err, pCommand.Args[1])
 	}
 
 	err = utils.CopyFile(pFs, fatsRef, dataRef, srcPath, destPath)
@@ -512,24 +541,21 @@ func infoCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int3
 }
 
 // checkCommand checks the filesystem.
-func checkCommand(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) {
+//
+// It returns the found problems (one line each), empty if the filesystem is consistent.
+func checkCommand(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) ([]string, error) {
 	// sanity check
 	if pFs == nil || fatsRef == nil || dataRef == nil {
-		fmt.Println("FILESYSTEM ERROR: FILESYSTEM IS NOT INITIALIZED")
-		return
+		return nil, custom_errors.ErrFSUninitialized
 	}
 
+	problems := make([]string, 0)
+
 	// check for any broken FAT entries
-	noErrs := true
 	for i := 0; i < len(fatsRef); i++ {
 		for j := 0; j < len(fatsRef[i]); j++ {
 			if fatsRef[i][j] == consts.FatBadCluster {
-				if noErrs {
-					fmt.Println("FILESYSTEM CORRUPTED:")
-					noErrs = false
-				}
-
-				fmt.Printf("BAD CLUSTER AT: FAT%d[%d]", i, j)
+				problems = append(problems, fmt.Sprintf("FILESYSTEM CORRUPTED: BAD CLUSTER AT: FAT%d[%d]", i, j))
 			}
 		}
 	}
@@ -538,7 +564,8 @@ func checkCommand(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte)
 	queue := make([]*pseudo_fat.DirectoryEntry, 0)
 	pRootDir, err := utils.GetRootDirEntry(pFs, fatsRef, dataRef)
 	if err != nil {
-		fmt.Println("FILESYSTEM CORRUPTED WITH ERROR: ", err)
+		problems = append(problems, fmt.Sprintf("FILESYSTEM CORRUPTED WITH ERROR: %s", err))
+		return problems, nil
 	}
 
 	queue = append(queue, pRootDir)
@@ -551,8 +578,7 @@ func checkCommand(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte)
 			// check the cluster chain
 			pCurrEntryFromData, err = utils.ReadDirectoryEntryFromCluster(dataRef[pCurrEntry.StartCluster*uint32(pFs.ClusterSize) : (pCurrEntry.StartCluster+1)*uint32(pFs.ClusterSize)])
 			if err != nil {
-				fmt.Printf("FILESYSTEM ENTRY \"%s\" CORRUPTED WITH ERROR: %s\n", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), err)
-				noErrs = false
+				problems = append(problems, fmt.Sprintf("FILESYSTEM ENTRY \"%s\" CORRUPTED WITH ERROR: %s", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), err))
 			}
 
 			if utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]) != utils.GetNormalizedStrFromMem(pCurrEntryFromData.Name[:]) ||
@@ -560,21 +586,18 @@ func checkCommand(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte)
 				pCurrEntry.StartCluster != pCurrEntryFromData.StartCluster ||
 				pCurrEntry.ParentCluster != pCurrEntryFromData.ParentCluster ||
 				pCurrEntry.Size != pCurrEntryFromData.Size {
-				fmt.Printf("FILESYSTEM ENTRY \"%s\" CORRUPTED: METADATA MISSMATCH COMPARED TO PARENT REFERENCE\n", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]))
-				noErrs = false
+				problems = append(problems, fmt.Sprintf("FILESYSTEM ENTRY \"%s\" CORRUPTED: METADATA MISSMATCH COMPARED TO PARENT REFERENCE", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:])))
 			}
 
 			// check the fat chains
 			for i := 0; i < len(fatsRef); i++ {
 				clusterChain, err := utils.GetClusterChain(pCurrEntry.StartCluster, fatsRef[i])
 				if err != nil {
-					fmt.Printf("FILESYSTEM ENTRY \"%s\" CORRUPTED WHILE READING FAT%d: %s\n", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), i, err)
-					noErrs = false
+					problems = append(problems, fmt.Sprintf("FILESYSTEM ENTRY \"%s\" CORRUPTED WHILE READING FAT%d: %s", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), i, err))
 				}
 
 				if len(clusterChain)-1 != int(math.Ceil(float64(pCurrEntry.Size)/float64(pFs.ClusterSize))) { // -1 because the last cluster is not counted
-					fmt.Printf("FILESYSTEM ENTRY \"%s\" CORRUPTED WHILE READING FAT%d: DATA SIZE MISMATCH\n", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), i)
-					noErrs = false
+					problems = append(problems, fmt.Sprintf("FILESYSTEM ENTRY \"%s\" CORRUPTED WHILE READING FAT%d: DATA SIZE MISMATCH", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), i))
 				}
 			}
 
@@ -583,8 +606,7 @@ func checkCommand(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte)
 			if utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]) != consts.PathDelimiter {
 				pCurrEntryFromData, err = utils.ReadDirectoryEntryFromCluster(dataRef[pCurrEntry.StartCluster*uint32(pFs.ClusterSize) : (pCurrEntry.StartCluster+1)*uint32(pFs.ClusterSize)])
 				if err != nil {
-					fmt.Printf("FILESYSTEM ENTRY \"%s\" CORRUPTED WITH ERROR: %s\n", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), err)
-					noErrs = false
+					problems = append(problems, fmt.Sprintf("FILESYSTEM ENTRY \"%s\" CORRUPTED WITH ERROR: %s", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), err))
 				}
 
 				if utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]) != utils.GetNormalizedStrFromMem(pCurrEntryFromData.Name[:]) ||
@@ -592,16 +614,17 @@ func checkCommand(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte)
 					pCurrEntry.StartCluster != pCurrEntryFromData.StartCluster ||
 					pCurrEntry.ParentCluster != pCurrEntryFromData.ParentCluster ||
 					pCurrEntry.Size != pCurrEntryFromData.Size {
-					fmt.Printf("FILESYSTEM ENTRY \"%s\" CORRUPTED\n", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]))
-					noErrs = false
+					problems = append(problems, fmt.Sprintf("FILESYSTEM ENTRY \"%s\" CORRUPTED", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:])))
 				}
 			}
 
 			// add the children to the queue
 			children, err := utils.GetDirEntries(pFs, pCurrEntry, fatsRef, dataRef)
 			if err != nil {
-				fmt.Printf("FILESYSTEM ENTRY \"%s\" CORRUPTED WITH ERROR: %s\n", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), err)
-				noErrs = false
+				problems = append(problems, fmt.Sprintf("FILESYSTEM ENTRY \"%s\" CORRUPTED WITH ERROR: %s", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), err))
+			} else if err = utils.VerifyDirIndex(pFs, fatsRef, dataRef, pCurrEntry, children); err != nil {
+				// the index of the directory has to match its children
+				problems = append(problems, fmt.Sprintf("FILESYSTEM ENTRY \"%s\" CORRUPTED WITH ERROR: %s", utils.GetNormalizedStrFromMem(pCurrEntry.Name[:]), err))
 			}
 
 			if len(children) > 0 {
@@ -610,9 +633,7 @@ func checkCommand(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte)
 		}
 	}
 
-	if noErrs {
-		fmt.Println(consts.CmdSuccessMsg)
-	}
+	return problems, nil
 }
 
 // bugCommand handles the bug command.
@@ -677,108 +698,60 @@ func bugCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32
 			fatsRef[randFAT][lastInChain] = int32(randCluster)
 			logging.Debug(fmt.Sprintf("Corrupted FAT%d[%d] with cycle to %d", randFAT, lastInChain, randCluster))
 		}
+		utils.NotifyFatChanged(fatsRef, randCluster, clusterChain[len(clusterChain)-1])
 
 	case corruptDirEntry:
 		logging.Debug(fmt.Sprintf("Corrupting directory entry %s", utils.GetNormalizedStrFromMem(pEntry.Name[:])))
 		// randomize the bytes
 		// debug print the bytes from dataRef before the corruption
-		fmt.Println(dataRef[pEntry.StartCluster*uint32(pFs.ClusterSize) : (pEntry.StartCluster+1)*uint32(pFs.ClusterSize)])
+		logging.Debug(fmt.Sprintf("Directory entry bytes before: %v", dataRef[pEntry.StartCluster*uint32(pFs.ClusterSize):(pEntry.StartCluster+1)*uint32(pFs.ClusterSize)]))
 		for b := 0; b < int(unsafe.Sizeof(*pEntry)); b++ {
 			dataRef[pEntry.StartCluster*uint32(pFs.ClusterSize)+uint32(b)] = byte(rand.Intn(consts.ByteSizeInt))
 		}
+		utils.InvalidateDirCache()
 		logging.Debug(fmt.Sprintf("Corrupted directory entry %s", utils.GetNormalizedStrFromMem(pEntry.Name[:])))
 		// print the bytes from dataRef after the corruption
-		fmt.Println(dataRef[pEntry.StartCluster*uint32(pFs.ClusterSize) : (pEntry.StartCluster+1)*uint32(pFs.ClusterSize)])
+		logging.Debug(fmt.Sprintf("Directory entry bytes after: %v", dataRef[pEntry.StartCluster*uint32(pFs.ClusterSize):(pEntry.StartCluster+1)*uint32(pFs.ClusterSize)]))
 	}
 
 	return true, nil
 }
 
-// interpretScriptCommand interprets the script command.
-func interpretScriptCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, pFatsRef *[][]int32, pDataRef *[]byte, endFlag chan struct{}) (bool, error) {
-	// sanity checks
-	if pCommand == nil || pFs == nil || pFatsRef == nil || pDataRef == nil {
-		return false, custom_errors.ErrNilPointer
-	}
-	if len(pCommand.Args) != 1 {
-		return false, custom_errors.ErrInvalArgsCount
-	}
-
-	fsChanged := false
-	var err error = nil
-	commands := make([]*Command, 0)
-	commands = append(commands, pCommand)
-	for {
-		pCurrCommand := commands[0]
-		fmt.Println(pCurrCommand.ToString())
-		commands = commands[1:]
-
-		if pCurrCommand.Name == consts.InterpretScriptCommand {
-			pScriptFile, err := os.ReadFile(pCurrCommand.Args[0])
-			if err != nil {
-				return fsChanged, err
-			}
-
-			scriptLines := strings.Split(string(pScriptFile), consts.ScriptDelimiter)
-			trailingCommands := commands
-			commands = make([]*Command, 0)
-			for _, line := range scriptLines {
-				// parse command
-				if line != "" && !strings.HasPrefix(line, consts.CommentSymbol) {
-					pCommand, err = ParseCommand(line)
-					if err != nil {
-						return fsChanged, err
-					}
-
-					// append the command to the commands
-					commands = append(commands, pCommand)
-				}
-			}
-
-			commands = append(commands, trailingCommands...)
-
-		} else {
-			if P_CurrDir == nil {
-				fsChanged, err = handleUninitializedFSCmd(pFs, pFatsRef, pDataRef, pCurrCommand, endFlag)
-			} else {
-				fsChanged, err = handleInitializedFSCmd(pFs, pFatsRef, pDataRef, pCurrCommand, endFlag)
-			}
-		}
-
-		if len(commands) < 1 {
-			break
-		}
-	}
-
-	return fsChanged, err
-}
-
 // handleUninitializedFSCmd handles the command when the filesystem is not initialized.
+//
+// It returns whether the filesystem was changed and the payload of the command result.
 func handleUninitializedFSCmd(pFs *pseudo_fat.FileSystem,
 	pFatsRef *[][]int32,
 	pDataRef *[]byte,
 	pCommand *Command,
-	endFlag chan struct{}) (bool, error) {
+	endFlag chan struct{}) (bool, any, error) {
 
 	fsChanged := false
+	var payload any = nil
 	var err error = nil
 
+	if IsReadOnly && isModifyingCommand(pCommand.Name) {
+		return fsChanged, payload, custom_errors.ErrReadOnly
+	}
+
 	switch pCommand.Name {
 	case consts.FormatCommand:
 		fsChanged, err = formatCommand(pCommand, pFs, pFatsRef, pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, err
 		}
+		payload = formatPayload{Size: pFs.DiskSize, AllocatableSize: len(*pDataRef)}
 
 	case consts.HelpCommand:
 		err = helpCommand()
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, err
 		}
+		payload = helpPayload{Help: consts.HelpMsg}
 
 	case consts.ExitCommand:
 		close(endFlag)
-		return fsChanged, err
+		return fsChanged, payload, err
 
 	case consts.DebugCommand,
 		consts.CurrDirCommand,
@@ -795,144 +768,244 @@ func handleUninitializedFSCmd(pFs *pseudo_fat.FileSystem,
 		consts.CopyCommand,
 		consts.MoveCommand,
 		consts.CopyInsideFSCommand,
-		consts.CopyOutsideFSCommand:
-		fmt.Println(consts.FSUninitializedMsg)
+		consts.CopyOutsideFSCommand,
+		consts.FindCommand,
+		consts.TreeCommand,
+		consts.DiskUsageCommand,
+		consts.DiskFreeCommand,
+		consts.StatCommand,
+		consts.HeadCommand,
+		consts.TailCommand,
+		consts.WordCountCommand,
+		consts.GrepCommand,
+		consts.HexdumpCommand,
+		consts.XxdCommand,
+		consts.EchoCommand,
+		consts.TruncateCommand,
+		consts.WriteCommand,
+		consts.Sha256sumCommand,
+		consts.Md5sumCommand,
+		consts.Crc32Command,
+		consts.CompareCommand,
+		consts.DiffCommand,
+		consts.DefragCommand,
+		consts.ResizeCommand,
+		consts.CompactCommand:
+		return fsChanged, payload, custom_errors.ErrFSUninitialized
 
 	default:
-		return fsChanged, fmt.Errorf("unknown command to execute (logic error): %s", pCommand.Name)
+		return fsChanged, payload, fmt.Errorf("unknown command to execute (logic error): %s", pCommand.Name)
 	}
 
-	return fsChanged, err
+	return fsChanged, payload, err
 }
 
 // handleInitializedFSCmd handles the command when the filesystem is initialized.
+//
+// It returns whether the filesystem was changed and the payload of the command result.
+// The text output is printed directly (see printText).
 func handleInitializedFSCmd(pFs *pseudo_fat.FileSystem,
 	pFatsRef *[][]int32,
 	pDataRef *[]byte,
 	pCommand *Command,
-	endFlag chan struct{}) (bool, error) {
+	endFlag chan struct{}) (bool, any, error) {
 
 	fsChanged := false
+	var payload any = nil
 	var err error = nil
 
+	if IsReadOnly && isModifyingCommand(pCommand.Name) {
+		return fsChanged, payload, custom_errors.ErrReadOnly
+	}
+
+	if hasGlobArgs(pCommand) {
+		return handleGlobCmd(pFs, pFatsRef, pDataRef, pCommand, endFlag)
+	}
+
 	switch pCommand.Name {
 	case consts.HelpCommand:
 		err = helpCommand()
-		return fsChanged, err
+		return fsChanged, helpPayload{Help: consts.HelpMsg}, err
 
 	case consts.ExitCommand:
 		close(endFlag)
-		return fsChanged, err
+		return fsChanged, payload, err
 
 	case consts.FormatCommand:
 		fsChanged, err = formatCommand(pCommand, pFs, pFatsRef, pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, err
 		}
+		payload = formatPayload{Size: pFs.DiskSize, AllocatableSize: len(*pDataRef)}
 
 	case consts.CurrDirCommand:
-		if P_CurrDir == nil {
-			fmt.Println(consts.FSUninitializedMsg)
-		} else {
-			pwd, err := utils.GetAbsolutePathFromPwd(pFs, P_CurrDir, *pFatsRef, *pDataRef)
-			if err != nil {
-				return fsChanged, err
-			}
-			fmt.Println(pwd)
+		pwd, err := utils.GetAbsolutePathFromPwd(pFs, P_CurrDir, *pFatsRef, *pDataRef)
+		if err != nil {
+			return fsChanged, payload, err
 		}
-		return fsChanged, err
+		printText(pwd)
+		return fsChanged, pwdPayload{Path: pwd}, err
 
 	case consts.ChangeDirCommand:
 		fsChanged, err = changeDirCommand(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
 		}
 
 	case consts.MakeDirCommand:
 		fsChanged, err = mkdirCommand(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
 		}
 
 	case consts.RemoveDirCommand:
 		fsChanged, err = rmdirCommand(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
 		}
 
 	case consts.RemoveCommand:
 		fsChanged, err = removeCommand(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
 		}
 
 	case consts.ListCommand:
 		var entries []*pseudo_fat.DirectoryEntry
 		entries, err = listCommand(pCommand, pFs, *pFatsRef, *pDataRef)
-		if err != nil {
-			return fsChanged, err
-		} else {
-			sortDirectoryEntries(entries)
-			for _, entry := range entries {
-				fmt.Println(entry.ToStringLS())
-			}
+		if err != nil && len(pCommand.Args) > 0 {
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
+		} else if err != nil {
+			return fsChanged, payload, err
+		}
+
+		sortDirectoryEntries(entries)
+		for _, entry := range entries {
+			printText(entry.ToStringLS())
 		}
-		return fsChanged, err
+		return fsChanged, getEntriesPayload(entries), err
 
 	case consts.CopyInsideFSCommand:
 		fsChanged, err = copyInsideFS(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, err
 		}
 
 	case consts.CopyOutsideFSCommand:
 		normAbsSrcPath, err := makePathNormAbs(pCommand.Args[0], pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
 		}
 
 		var dataRef []byte
 		dataRef, err = utils.GetFileBytes(pFs, *pFatsRef, *pDataRef, normAbsSrcPath)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
 		}
 
 		err = os.WriteFile(pCommand.Args[1], dataRef, consts.NewFilePermissions)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[1])
 		}
 
 	case consts.MoveCommand:
 		fsChanged, err = moveCommand(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, err
 		}
 
 	case consts.CopyCommand:
 		fsChanged, err = copyCommand(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, err
 		}
 
 	case consts.InterpretScriptCommand:
-		fsChanged, err = interpretScriptCommand(pCommand, pFs, pFatsRef, pDataRef, endFlag)
-		return fsChanged, err
+		return interpretScriptCommand(pCommand, pFs, pFatsRef, pDataRef, endFlag)
+
+	case consts.FindCommand:
+		return findCommand(pCommand, pFs, pFatsRef, pDataRef, endFlag)
+
+	case consts.TreeCommand:
+		payload, err = treeCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+		return fsChanged, payload, err
+
+	case consts.DiskUsageCommand:
+		payload, err = diskUsageCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+		return fsChanged, payload, err
+
+	case consts.DiskFreeCommand:
+		payload, err = diskFreeCommand(pFs, *pFatsRef, *pDataRef)
+		return fsChanged, payload, err
+
+	case
+		consts.HeadCommand,
+		consts.TailCommand,
+		consts.WordCountCommand,
+		consts.GrepCommand,
+		consts.HexdumpCommand,
+		consts.XxdCommand:
+		payload, err = textCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+		return fsChanged, payload, err
+
+	case consts.Sha256sumCommand, consts.Md5sumCommand, consts.Crc32Command:
+		payload, err = checksumCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+		return fsChanged, payload, err
+
+	case consts.CompareCommand:
+		payload, err = compareCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+		return fsChanged, payload, err
+
+	case consts.DiffCommand:
+		payload, err = diffCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+		return fsChanged, payload, err
+
+	case consts.DefragCommand:
+		return defragCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+
+	case consts.ResizeCommand:
+		return resizeCommand(pCommand, pFs, pFatsRef, pDataRef)
+
+	case consts.CompactCommand:
+		return compactCommand(pCommand, pFs, pFatsRef, pDataRef)
+
+	case consts.EchoCommand:
+		return echoCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+
+	case consts.TruncateCommand:
+		fsChanged, err = truncateCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+		if err != nil {
+			return fsChanged, payload, err
+		}
+
+	case consts.WriteCommand:
+		fsChanged, err = writeCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+		if err != nil {
+			return fsChanged, payload, err
+		}
+
+	case consts.StatCommand:
+		payload, err = statCommand(pCommand, pFs, *pFatsRef, *pDataRef)
+		if err != nil {
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
+		}
+		return fsChanged, payload, err
 
 	case consts.ConcatCommand:
 		var dataRef []byte
 		dataRef, err = concatCommand(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
 		}
 
-		fmt.Println(string(dataRef))
-		return fsChanged, err
+		printText(string(dataRef))
+		return fsChanged, newCatPayload(dataRef), err
 
 	case consts.InfoCommand:
 		var clusters []uint32
 		clusters, err = infoCommand(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
 		}
 
 		filename := utils.GetPathBasename(pCommand.Args[0])
@@ -946,16 +1019,28 @@ func handleInitializedFSCmd(pFs *pseudo_fat.FileSystem,
 			}
 		}
 
-		fmt.Println(res)
+		printText(res)
+		payload = infoPayload{Name: filename, Clusters: clusters}
 
 	case consts.CheckCommand:
-		checkCommand(pFs, *pFatsRef, *pDataRef)
-		return fsChanged, err
+		var problems []string
+		problems, err = checkCommand(pFs, *pFatsRef, *pDataRef)
+		if err != nil {
+			return fsChanged, payload, err
+		}
+
+		for _, problem := range problems {
+			printText(problem)
+		}
+		if len(problems) == 0 {
+			printText(consts.CmdSuccessMsg)
+		}
+		return fsChanged, checkPayload{Consistent: len(problems) == 0, Problems: problems}, err
 
 	case consts.BugCommand:
 		fsChanged, err = bugCommand(pCommand, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, custom_errors.WithPath(err, pCommand.Args[0])
 		}
 
 	case consts.DebugCommand:
@@ -964,7 +1049,7 @@ func handleInitializedFSCmd(pFs *pseudo_fat.FileSystem,
 		queue := make([]*pseudo_fat.DirectoryEntry, 0)
 		pRootDir, err := utils.GetRootDirEntry(pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return fsChanged, err
+			return fsChanged, payload, err
 		}
 
 		queue = append(queue, pRootDir)
@@ -981,7 +1066,7 @@ func handleInitializedFSCmd(pFs *pseudo_fat.FileSystem,
 			if !pCurrEntry.IsFile {
 				children, err := utils.GetDirEntries(pFs, pCurrEntry, *pFatsRef, *pDataRef)
 				if err != nil {
-					return fsChanged, err
+					return fsChanged, payload, err
 				}
 
 				queue = append(queue, children...)
@@ -991,59 +1076,87 @@ func handleInitializedFSCmd(pFs *pseudo_fat.FileSystem,
 		logging.Debug("DEBUG STOP")
 	}
 
-	fmt.Printf("%s\n", consts.CmdSuccessMsg)
+	printText(consts.CmdSuccessMsg)
 
-	return fsChanged, err
+	return fsChanged, payload, err
 }
 
-// ExecuteCommand executes the given command.
-// It returns an error if any.
-func ExecuteCommand(
+// executeCommand executes the given command and writes the changed filesystem to the file.
+//
+// It returns the payload of the command result.
+func executeCommand(
 	pCommand *Command,
 	endFlag chan struct{},
 	pFile *os.File,
 	pFs *pseudo_fat.FileSystem,
 	pFatsRef *[][]int32,
-	pDataRef *[]byte) error {
+	pDataRef *[]byte) (any, error) {
 
-	// sanity check
-	if pCommand == nil || endFlag == nil || pFs == nil {
-		return custom_errors.ErrNilPointer
-	}
 	// check if the filesystem is initialized
 	if pFatsRef == nil || pDataRef == nil {
 		if pCommand.Name != consts.ExitCommand && pCommand.Name != consts.HelpCommand && pCommand.Name != consts.FormatCommand {
-			return custom_errors.ErrFSUninitialized
+			return nil, custom_errors.ErrFSUninitialized
 		}
 	}
 
 	var fsChanged bool
+	var payload any
 	var err error
 
 	if P_CurrDir == nil {
-		fsChanged, err = handleUninitializedFSCmd(pFs, pFatsRef, pDataRef, pCommand, endFlag)
+		fsChanged, payload, err = handleUninitializedFSCmd(pFs, pFatsRef, pDataRef, pCommand, endFlag)
 	} else {
-		fsChanged, err = handleInitializedFSCmd(pFs, pFatsRef, pDataRef, pCommand, endFlag)
+		fsChanged, payload, err = handleInitializedFSCmd(pFs, pFatsRef, pDataRef, pCommand, endFlag)
 	}
 
+	var cmdErr error = nil
 	if err != nil {
-		if custom_errors.IsErrDefined(err) {
-			errParts := strings.Split(err.Error(), ":")
-			fmt.Println(strings.ToUpper(errParts[len(errParts)-1]))
+		if errors.Is(err, custom_errors.ErrFSUninitialized) {
+			cmdErr = err
+		} else if custom_errors.IsErrDefined(err) {
+			printText(custom_errors.GetUserMsg(err))
+			cmdErr = fmt.Errorf("%w: %w", custom_errors.ErrCmdFailed, err)
 		} else {
-			return fmt.Errorf("error executing command: %s", err)
+			return nil, fmt.Errorf("error executing command: %w", err)
 		}
 	}
 
 	// if the filesystem was changed, write it to the file
 	if fsChanged {
-		fmt.Println("Filesystem changed, writing to the file...")
+		printText("Filesystem changed, writing to the file...")
 		err := utils.WriteFileSystem(pFile, pFs, *pFatsRef, *pDataRef)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		fmt.Println("Updated filesystem written to the file.")
+		printText("Updated filesystem written to the file.")
 	}
 
-	return nil
+	return payload, cmdErr
+}
+
+// ExecuteCommand executes the given command.
+//
+// Errors with a message for the user are printed and returned wrapped
+// in ErrCmdFailed. ErrFSUninitialized is returned as is so the caller
+// can hint the user. Other errors are returned wrapped with context.
+//
+// In the JSON output mode the result (including the errors) is printed
+// as one JSON object instead.
+func ExecuteCommand(
+	pCommand *Command,
+	endFlag chan struct{},
+	pFile *os.File,
+	pFs *pseudo_fat.FileSystem,
+	pFatsRef *[][]int32,
+	pDataRef *[]byte) error {
+
+	// sanity check
+	if pCommand == nil || endFlag == nil || pFs == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	payload, err := executeCommand(pCommand, endFlag, pFile, pFs, pFatsRef, pDataRef)
+	PrintResult(NewCommandResult(strings.TrimSpace(pCommand.ToString()), payload, err))
+
+	return err
 }
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/custom_errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestUsageAfterCommands checks that the usage counters match a rescan of the FAT after every mutating command.
+func TestUsageAfterCommands(t *testing.T) {
+	dir := chdirTemp(t)
+	writeHostFile(t, dir, "host.bin", strings.Repeat("host file\n", 1000))
+
+	f := newCmdTestFS(t, "1MB")
+	steps := []struct {
+		input   string
+		heredoc []byte
+	}{
+		{"mkdir /a", nil},
+		{"mkdir /a/b", nil},
+		{"incp host.bin /a/big", nil},
+		{"cp /a/big /a/b/copy", nil},
+		{"mv /a/b/copy /moved", nil},
+		{"echo hello > /e", nil},
+		{"echo more >> /e", nil},
+		{"truncate -s 9000 /e", nil},
+		{"truncate -s 1 /e", nil},
+		{"write /w", bytes.Repeat([]byte("here-document\n"), 500)},
+		{"write /w", []byte("short\n")},
+		{"rm /moved", nil},
+		{"rmdir /a/b", nil},
+		{"defrag", nil},
+		{"resize 2MB", nil},
+		{"compact --headroom 8KB", nil},
+		{"resize 1MB", nil},
+		{"compact --sparse", nil},
+		{"resize 1MB", nil},
+	}
+	for _, step := range steps {
+		if _, _, err := f.execWithInput(step.input, step.heredoc); err != nil {
+			t.Fatalf("%s: %v", step.input, err)
+		}
+		f.checkFS()
+	}
+
+	// the FAT corrupted by the bug command is reported back to the counters
+	for i := range 10 {
+		path := fmt.Sprintf("/bug%d", i)
+		f.writeFile(path, make([]byte, 9000))
+		f.run("bug " + path)
+		f.checkUsage()
+	}
+
+	// the formatted filesystem is tracked from scratch
+	f.run("format 2MB")
+	f.checkFS()
+}
+
+// fillFS writes the file /fill leaving the number of the free clusters.
+func fillFS(t *testing.T, f *cmdTestFS, freeClusters uint32) {
+	t.Helper()
+
+	// the self reference and the entry cluster in the root directory are used as well
+	dataClusters := f.checkUsage().Free - freeClusters - 2
+	f.writeFile("/fill", make([]byte, dataClusters*uint32(f.pFs.ClusterSize)))
+	if free := f.checkUsage().Free; free != freeClusters {
+		t.Fatalf("%d free clusters, want %d", free, freeClusters)
+	}
+}
+
+// TestNoFreeClusterLeavesFSUnchanged checks that the commands fail with ErrNoFreeCluster
+// before anything is written if there are not enough free clusters.
+func TestNoFreeClusterLeavesFSUnchanged(t *testing.T) {
+	dir := chdirTemp(t)
+	writeHostFile(t, dir, "host.txt", "host file\n")
+
+	tests := []struct {
+		freeClusters uint32
+		input        string
+		heredoc      []byte
+	}{
+		// a new entry needs its self reference and the entry cluster in the parent directory
+		{1, "mkdir /new", nil},
+		{1, "mkdir /d/new", nil},
+		{1, "echo x > /new", nil},
+		{2, "echo x > /new", nil},
+		{2, "cp /d/f /new", nil},
+		{2, "incp host.txt /new", nil},
+		{2, "write /new", []byte("x")},
+		{2, "truncate -s 1 /new", nil},
+		// the content of an existing file needs new clusters
+		{0, "echo x >> /d/f", nil},
+		{1, "truncate -s 9000 /d/f", nil},
+		{1, "write /d/f", make([]byte, 9000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			f := newCmdTestFS(t, "1MB")
+			f.run("mkdir /d")
+			f.writeFile("/d/f", make([]byte, 4000))
+			fillFS(t, f, tt.freeClusters)
+
+			fats := [][]int32{slices.Clone(f.fats[0]), slices.Clone(f.fats[1])}
+			data := slices.Clone(f.data)
+
+			if _, _, err := f.execWithInput(tt.input, tt.heredoc); !errors.Is(err, custom_errors.ErrNoFreeCluster) {
+				t.Errorf("error %v, want %v", err, custom_errors.ErrNoFreeCluster)
+			}
+
+			for i := range fats {
+				if !slices.Equal(f.fats[i], fats[i]) {
+					t.Errorf("FAT %d changed by the failed command", i)
+				}
+			}
+			if !bytes.Equal(f.data, data) {
+				t.Error("data changed by the failed command")
+			}
+			f.checkFS()
+		})
+	}
+}
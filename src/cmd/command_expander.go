@@ -0,0 +1,381 @@
+// command_expander.go contains the expansion of glob patterns in the command arguments
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// globPaths expands the glob pattern into the sorted matching paths.
+//
+// Relative patterns produce paths relative to the current directory
+// (if the match is inside it), absolute patterns produce absolute paths.
+func globPaths(pattern string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) ([]string, error) {
+	absPattern, err := makePathNormAbs(pattern, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := utils.Glob(pFs, fatsRef, dataRef, absPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(pattern, consts.PathDelimiter) {
+		return matches, nil
+	}
+
+	// make the matches relative to the current directory
+	pwd, err := utils.GetAbsolutePathFromPwd(pFs, P_CurrDir, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(pwd, consts.PathDelimiter) + consts.PathDelimiter
+	for i, match := range matches {
+		if strings.HasPrefix(match, prefix) {
+			matches[i] = match[len(prefix):]
+		}
+	}
+
+	return matches, nil
+}
+
+// pathExists returns true if the path (or any path matching the glob pattern) exists.
+func pathExists(path string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (bool, error) {
+	if utils.HasGlobMeta(path) {
+		matches, err := globPaths(path, pFs, fatsRef, dataRef)
+		if err != nil {
+			return false, err
+		}
+		return len(matches) > 0, nil
+	}
+
+	absPath, err := makePathNormAbs(path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = utils.GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, absPath)
+	if errors.Is(err, custom_errors.ErrEntryNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// getPathOperandIdxs returns the indexes of the arguments of the command that are paths in the filesystem.
+//
+// The other arguments (the options and their values, sizes and text) are never expanded.
+// It returns nil for the commands without such paths and for the commands expanding the paths themselves.
+func getPathOperandIdxs(pCommand *Command) []int {
+	args := pCommand.Args
+
+	switch pCommand.Name {
+	case consts.FormatCommand, consts.ResizeCommand, consts.CompactCommand, consts.InterpretScriptCommand,
+		consts.HeadCommand, consts.TailCommand, consts.WordCountCommand, consts.GrepCommand,
+		consts.HexdumpCommand, consts.XxdCommand, consts.Sha256sumCommand, consts.Md5sumCommand, consts.Crc32Command:
+		return nil
+
+	case consts.FindCommand:
+		// only the start path, the patterns of the options are matched by find
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			return []int{0}
+		}
+		return nil
+
+	case consts.EchoCommand:
+		_, op, _, err := getEchoRedirect(pCommand)
+		if err != nil || op == "" {
+			return nil
+		}
+		return []int{len(args) - 1}
+
+	case consts.TruncateCommand:
+		if len(args) != 3 {
+			return nil
+		}
+		return []int{2}
+
+	case consts.TreeCommand, consts.DiskUsageCommand, consts.CompareCommand, consts.DiffCommand:
+		idxs := make([]int, 0, 2)
+		for i := 0; i < len(args); i++ {
+			switch {
+			case pCommand.Name == consts.TreeCommand && args[i] == consts.TreeLevelOpt:
+				i++ // the level
+			case strings.HasPrefix(args[i], "-"):
+			default:
+				idxs = append(idxs, i)
+			}
+		}
+		return idxs
+	}
+
+	idxs := make([]int, len(args))
+	for i := range args {
+		idxs[i] = i
+	}
+	return idxs
+}
+
+// hasGlobArgs returns true if any of the command path arguments is a glob pattern.
+func hasGlobArgs(pCommand *Command) bool {
+	for _, idx := range getPathOperandIdxs(pCommand) {
+		if utils.HasGlobMeta(pCommand.Args[idx]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globHostPaths expands the glob pattern against the host filesystem.
+//
+// It returns ErrNoMatch if nothing matches.
+func globHostPaths(pattern string) ([]string, error) {
+	if !utils.HasGlobMeta(pattern) {
+		return []string{pattern}, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, custom_errors.WithPath(custom_errors.ErrInvalidPattern, pattern)
+	} else if len(matches) == 0 {
+		return nil, custom_errors.WithPath(custom_errors.ErrNoMatch, pattern)
+	}
+
+	return matches, nil
+}
+
+// globImagePaths expands the glob pattern against the filesystem.
+//
+// It returns ErrNoMatch if nothing matches.
+func globImagePaths(pattern string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) ([]string, error) {
+	if !utils.HasGlobMeta(pattern) {
+		return []string{pattern}, nil
+	}
+
+	matches, err := globPaths(pattern, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, pattern)
+	} else if len(matches) == 0 {
+		return nil, custom_errors.WithPath(custom_errors.ErrNoMatch, pattern)
+	}
+
+	return matches, nil
+}
+
+// getSingleMatch returns the only match of the paths.
+//
+// It returns ErrAmbiguousPattern if there are more matches.
+func getSingleMatch(matches []string) (string, error) {
+	if len(matches) != 1 {
+		return "", custom_errors.ErrAmbiguousPattern
+	}
+
+	return matches[0], nil
+}
+
+// expandCommandGlobs expands the glob patterns in the command path arguments (see getPathOperandIdxs).
+//
+// One command is returned for each matched path, together with the path (the target).
+// For the copy and move commands the source is expanded and the destination has to match
+// at most one path. If more sources are matched, the destination is treated as a directory.
+// The compared paths, the redirection and the written path have to match at most one path.
+//
+// It returns ErrNoMatch if any pattern matches nothing (the command
+// is then not executed at all).
+func expandCommandGlobs(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) ([]*Command, []string, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return nil, nil, custom_errors.ErrNilPointer
+	}
+
+	res := make([]*Command, 0)
+	targets := make([]string, 0)
+
+	switch pCommand.Name {
+	case
+		consts.CopyCommand,
+		consts.MoveCommand,
+		consts.CopyInsideFSCommand,
+		consts.CopyOutsideFSCommand:
+		if len(pCommand.Args) != 2 {
+			return nil, nil, custom_errors.ErrInvalArgsCount
+		}
+
+		var srcs []string
+		var dest string
+		var err error
+
+		// the source and the destination can be on the host filesystem
+		if pCommand.Name == consts.CopyInsideFSCommand {
+			srcs, err = globHostPaths(pCommand.Args[0])
+		} else {
+			srcs, err = globImagePaths(pCommand.Args[0], pFs, fatsRef, dataRef)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var destMatches []string
+		if pCommand.Name == consts.CopyOutsideFSCommand {
+			destMatches, err = globHostPaths(pCommand.Args[1])
+		} else {
+			destMatches, err = globImagePaths(pCommand.Args[1], pFs, fatsRef, dataRef)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		dest, err = getSingleMatch(destMatches)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, src := range srcs {
+			srcDest := dest
+			if len(srcs) > 1 {
+				if pCommand.Name == consts.CopyOutsideFSCommand {
+					srcDest = filepath.Join(dest, filepath.Base(src))
+				} else {
+					srcDest = strings.TrimSuffix(dest, consts.PathDelimiter) + consts.PathDelimiter + utils.GetPathBasename(src)
+				}
+			}
+
+			res = append(res, &Command{Name: pCommand.Name, Args: []string{src, srcDest}})
+			targets = append(targets, src)
+		}
+
+	case consts.CompareCommand, consts.DiffCommand:
+		idxs := getPathOperandIdxs(pCommand)
+		if len(idxs) != 2 {
+			return nil, nil, custom_errors.ErrInvalArgsCount
+		}
+
+		// the second path can be on the host filesystem
+		args := slices.Clone(pCommand.Args)
+		for i, idx := range idxs {
+			var matches []string
+			var err error
+			if i == 1 && slices.Contains(args, consts.CompareHostOpt) {
+				matches, err = globHostPaths(args[idx])
+			} else {
+				matches, err = globImagePaths(args[idx], pFs, fatsRef, dataRef)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+
+			args[idx], err = getSingleMatch(matches)
+			if err != nil {
+				return nil, nil, custom_errors.WithPath(err, pCommand.Args[idx])
+			}
+		}
+
+		res = append(res, &Command{Name: pCommand.Name, Args: args})
+		targets = append(targets, args[idxs[0]])
+
+	default:
+		idxs := getPathOperandIdxs(pCommand)
+		if len(idxs) != 1 {
+			return nil, nil, custom_errors.ErrInvalArgsCount
+		}
+		idx := idxs[0]
+
+		matches, err := globImagePaths(pCommand.Args[idx], pFs, fatsRef, dataRef)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// the current directory can be changed only to one directory and only one file can be written
+		single := pCommand.Name == consts.ChangeDirCommand || pCommand.Name == consts.EchoCommand || pCommand.Name == consts.WriteCommand
+		if single && len(matches) > 1 {
+			return nil, nil, custom_errors.WithPath(custom_errors.ErrAmbiguousPattern, pCommand.Args[idx])
+		}
+
+		for _, match := range matches {
+			args := slices.Clone(pCommand.Args)
+			args[idx] = match
+			res = append(res, &Command{Name: pCommand.Name, Args: args, Quoted: pCommand.Quoted, Input: pCommand.Input})
+			targets = append(targets, match)
+		}
+	}
+
+	return res, targets, nil
+}
+
+// executeTargets executes the commands, each for one of the targets.
+//
+// Failures of the single targets are printed and the execution continues
+// with the next target (the changes made by the previous ones are kept).
+// ErrPartialFailure is returned if any of them failed. The payload holds
+// the results of the single targets.
+func executeTargets(pFs *pseudo_fat.FileSystem,
+	pFatsRef *[][]int32,
+	pDataRef *[]byte,
+	targets []string,
+	pCommands []*Command,
+	printHeaders bool,
+	endFlag chan struct{}) (bool, any, error) {
+
+	fsChanged := false
+	failed := false
+	results := make([]targetPayload, 0, len(pCommands))
+	for i, pTargetCommand := range pCommands {
+		if printHeaders {
+			printTextf("%s:\n", targets[i])
+		}
+
+		changed := false
+		var payload any
+		err := ValidateCommand(pTargetCommand)
+		if err == nil {
+			changed, payload, err = handleInitializedFSCmd(pFs, pFatsRef, pDataRef, pTargetCommand, endFlag)
+		}
+		fsChanged = fsChanged || changed
+
+		result := targetPayload{Target: targets[i], Status: consts.StatusOK, Payload: payload}
+		if err != nil {
+			printTextf("%s: %s\n", targets[i], custom_errors.GetUserMsg(err))
+			result.Status = consts.StatusError
+			result.ErrorCode = string(custom_errors.GetCode(err))
+			result.Error = custom_errors.GetUserMsg(err)
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	if failed {
+		return fsChanged, results, custom_errors.ErrPartialFailure
+	}
+
+	return fsChanged, results, nil
+}
+
+// handleGlobCmd expands the glob patterns in the command and executes
+// the command for each of the matched paths (see executeTargets).
+func handleGlobCmd(pFs *pseudo_fat.FileSystem,
+	pFatsRef *[][]int32,
+	pDataRef *[]byte,
+	pCommand *Command,
+	endFlag chan struct{}) (bool, any, error) {
+
+	pCommands, targets, err := expandCommandGlobs(pCommand, pFs, *pFatsRef, *pDataRef)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// a single target behaves as if the path was written out
+	if len(pCommands) == 1 {
+		return handleInitializedFSCmd(pFs, pFatsRef, pDataRef, pCommands[0], endFlag)
+	}
+
+	return executeTargets(pFs, pFatsRef, pDataRef, targets, pCommands, pCommand.Name == consts.ListCommand, endFlag)
+}
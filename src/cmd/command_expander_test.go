@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetPathOperandIdxs(t *testing.T) {
+	tests := []struct {
+		input    string
+		want     []int
+		wantGlob bool
+	}{
+		{"ls a*", []int{0}, true},
+		{"rm a b", []int{0, 1}, false},
+		{"cd /", []int{0}, false},
+		{"format 10M*", nil, false},
+		{"resize 10MB", nil, false},
+		{"tree a/*", []int{0}, true},
+		{"tree -L 2 a/*", []int{2}, true},
+		{"tree -L 2*", nil, false},
+		{"du -s a/*", []int{1}, true},
+		{"du", []int{}, false},
+		{"cmp a/* b", []int{0, 1}, true},
+		{"diff -r a b*", []int{1, 2}, true},
+		{"diff --host a *.txt", []int{1, 2}, true},
+		{"truncate -s 10* a", []int{2}, false},
+		{"truncate -s 10 a*", []int{2}, true},
+		{"echo * ?", nil, false},
+		{"echo * > a*", []int{2}, true},
+		{"echo a >> b", []int{2}, false},
+		{"write a*", []int{0}, true},
+		{"find a* -name *.txt", []int{0}, true},
+		{"find -name *.txt", nil, false},
+		{"grep a* b*", nil, false},
+		{"sha256sum a*", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			words := strings.Fields(tt.input)
+			pCommand := &Command{Name: words[0], Args: words[1:]}
+
+			got := getPathOperandIdxs(pCommand)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("getPathOperandIdxs(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			if gotGlob := hasGlobArgs(pCommand); gotGlob != tt.wantGlob {
+				t.Errorf("hasGlobArgs(%q) = %v, want %v", tt.input, gotGlob, tt.wantGlob)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+// command_find.go contains the implementation of the find command
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sizeFilter is the comparison of the entry size with the find size value
+type sizeFilter int
+
+const (
+	// sizeAny does not filter by the size
+	sizeAny sizeFilter = iota
+	// sizeEqual matches the entries with the exact size
+	sizeEqual
+	// sizeGreater matches the entries larger than the size
+	sizeGreater
+	// sizeLess matches the entries smaller than the size
+	sizeLess
+)
+
+// findOptions are the parsed arguments of the find command
+type findOptions struct {
+	// startPath is the path the search starts at
+	startPath string
+	// namePattern is the pattern the entry name has to match, empty for any name
+	namePattern string
+	// entryType is consts.FindTypeFile or consts.FindTypeDir, empty for any type
+	entryType string
+	// sizeFilter is the comparison of the entry size with the size
+	sizeFilter sizeFilter
+	// size is the size in bytes compared with the entry size
+	size uint32
+	// maxDepth is the maximum depth below the start path, -1 for unlimited
+	maxDepth int
+	// execWords is the command executed for each match, empty if none
+	execWords []string
+}
+
+// findMatch is an entry found by the find command
+type findMatch struct {
+	// absPath is the absolute path of the entry
+	absPath string
+	// pEntry is the found entry
+	pEntry *pseudo_fat.DirectoryEntry
+	// depth is the depth of the entry below the start path
+	depth int
+}
+
+// parseFindSize parses the size value of the find command ("+10KB", "-1MB", "500B", "42").
+func parseFindSize(value string) (sizeFilter, uint32, error) {
+	filter := sizeEqual
+	if strings.HasPrefix(value, consts.SizeGreaterPrefix) {
+		filter = sizeGreater
+		value = value[len(consts.SizeGreaterPrefix):]
+	} else if strings.HasPrefix(value, consts.SizeLessPrefix) {
+		filter = sizeLess
+		value = value[len(consts.SizeLessPrefix):]
+	}
+
+	size, err := parseByteSize(value)
+	if err != nil {
+		return sizeAny, 0, err
+	}
+
+	return filter, size, nil
+}
+
+// parseByteSize parses the size option value in bytes or with a unit ("500", "500B", "10KB", "1.5MB").
+func parseByteSize(value string) (uint32, error) {
+	// the size without a unit is in bytes
+	if _, err := strconv.ParseUint(value, 10, 32); err == nil {
+		value += consts.UnitB
+	}
+
+	size, err := utils.ParseSize(value)
+	if err != nil {
+		return 0, custom_errors.ErrInvalidOptionValue
+	}
+
+	return size, nil
+}
+
+// parseFindArgs parses the arguments of the find command.
+//
+// The optional start path is followed by the options. The -exec option
+// takes the rest of the arguments as the command to execute.
+func parseFindArgs(args []string) (*findOptions, error) {
+	opts := &findOptions{startPath: consts.CurrDirSymbol, maxDepth: -1}
+
+	i := 0
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		err := validatePathFormat(args[0])
+		if err != nil {
+			return nil, err
+		}
+		opts.startPath = args[0]
+		i++
+	}
+
+	for i < len(args) {
+		opt := args[i]
+		if opt == consts.FindExecOpt {
+			execWords := args[i+1:]
+			if len(execWords) > 0 && slices.Contains(consts.FindExecTerminators, execWords[len(execWords)-1]) {
+				execWords = execWords[:len(execWords)-1]
+			}
+			if len(execWords) == 0 {
+				return nil, custom_errors.ErrInvalArgsCount
+			}
+			if !slices.Contains(commandNames, execWords[0]) {
+				return nil, custom_errors.ErrUnknownCmd
+			}
+
+			opts.execWords = execWords
+			break
+		}
+
+		// the other options have a value
+		if i+1 >= len(args) {
+			return nil, custom_errors.ErrInvalArgsCount
+		}
+		value := args[i+1]
+		i += 2
+
+		switch opt {
+		case consts.FindNameOpt:
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, custom_errors.ErrInvalidPattern
+			}
+			opts.namePattern = value
+
+		case consts.FindTypeOpt:
+			if value != consts.FindTypeFile && value != consts.FindTypeDir {
+				return nil, custom_errors.ErrInvalidOptionValue
+			}
+			opts.entryType = value
+
+		case consts.FindSizeOpt:
+			filter, size, err := parseFindSize(value)
+			if err != nil {
+				return nil, err
+			}
+			opts.sizeFilter = filter
+			opts.size = size
+
+		case consts.FindMaxDepthOpt:
+			maxDepth, err := strconv.Atoi(value)
+			if err != nil || maxDepth < 0 {
+				return nil, custom_errors.ErrInvalidOptionValue
+			}
+			opts.maxDepth = maxDepth
+
+		default:
+			return nil, custom_errors.ErrUnknownOption
+		}
+	}
+
+	return opts, nil
+}
+
+// matches returns true if the entry satisfies all the predicates.
+func (opts *findOptions) matches(match findMatch) bool {
+	name := utils.GetNormalizedStrFromMem(match.pEntry.Name[:])
+	if opts.namePattern != "" {
+		if ok, _ := path.Match(opts.namePattern, name); !ok {
+			return false
+		}
+	}
+
+	switch opts.entryType {
+	case consts.FindTypeFile:
+		if !match.pEntry.IsFile {
+			return false
+		}
+	case consts.FindTypeDir:
+		if match.pEntry.IsFile {
+			return false
+		}
+	}
+
+	switch opts.sizeFilter {
+	case sizeEqual:
+		return match.pEntry.Size == opts.size
+	case sizeGreater:
+		return match.pEntry.Size > opts.size
+	case sizeLess:
+		return match.pEntry.Size < opts.size
+	}
+
+	return true
+}
+
+// findEntries walks the tree from the start path (breadth-first)
+// and returns the entries satisfying the predicates.
+func findEntries(opts *findOptions, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) ([]findMatch, error) {
+	absStartPath, err := makePathNormAbs(opts.startPath, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+
+	branchDirEntries, err := utils.GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, absStartPath)
+	if err != nil {
+		if errors.Is(err, custom_errors.ErrEntryNotFound) {
+			return nil, custom_errors.ErrPathNotFound
+		}
+		return nil, err
+	}
+
+	res := make([]findMatch, 0)
+	queue := []findMatch{{absPath: absStartPath, pEntry: branchDirEntries[len(branchDirEntries)-1], depth: 0}}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+
+		if opts.matches(curr) {
+			res = append(res, curr)
+		}
+
+		if curr.pEntry.IsFile || (opts.maxDepth >= 0 && curr.depth >= opts.maxDepth) {
+			continue
+		}
+
+		children, err := utils.GetDirEntries(pFs, curr.pEntry, fatsRef, dataRef)
+		if err != nil {
+			return nil, err
+		}
+		sortDirectoryEntries(children)
+
+		for _, pChild := range children {
+			childPath := utils.JoinAbsPath(curr.absPath, utils.GetNormalizedStrFromMem(pChild.Name[:]))
+			queue = append(queue, findMatch{absPath: childPath, pEntry: pChild, depth: curr.depth + 1})
+		}
+	}
+
+	return res, nil
+}
+
+// getExecCommand returns the command executed for the matched path
+// (the placeholder is replaced by the path, or the path is appended if there is no placeholder).
+func getExecCommand(execWords []string, absPath string) *Command {
+	args := make([]string, 0, len(execWords))
+	hasPlaceholder := false
+	for _, word := range execWords[1:] {
+		if strings.Contains(word, consts.FindExecPlaceholder) {
+			hasPlaceholder = true
+			word = strings.ReplaceAll(word, consts.FindExecPlaceholder, absPath)
+		}
+		args = append(args, word)
+	}
+	if !hasPlaceholder {
+		args = append(args, absPath)
+	}
+
+	return &Command{Name: execWords[0], Args: args}
+}
+
+// findCommand handles the find command.
+//
+// The absolute paths of the found entries are printed, or the -exec command
+// is executed for each of them (see executeTargets).
+func findCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, pFatsRef *[][]int32, pDataRef *[]byte, endFlag chan struct{}) (bool, any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || pFatsRef == nil || pDataRef == nil {
+		return false, nil, custom_errors.ErrNilPointer
+	}
+
+	opts, err := parseFindArgs(pCommand.Args)
+	if err != nil {
+		return false, nil, err
+	}
+
+	matches, err := findEntries(opts, pFs, *pFatsRef, *pDataRef)
+	if err != nil {
+		return false, nil, custom_errors.WithPath(err, opts.startPath)
+	}
+
+	if len(opts.execWords) == 0 {
+		entries := make([]*pseudo_fat.DirectoryEntry, 0, len(matches))
+		paths := make([]string, 0, len(matches))
+		for _, match := range matches {
+			printText(match.absPath)
+			entries = append(entries, match.pEntry)
+			paths = append(paths, match.absPath)
+		}
+
+		return false, getFoundPayload(paths, entries), nil
+	}
+
+	// the matches are collected first, so the executed commands do not affect the search
+	targets := make([]string, 0, len(matches))
+	pCommands := make([]*Command, 0, len(matches))
+	for _, match := range matches {
+		targets = append(targets, match.absPath)
+		pCommands = append(pCommands, getExecCommand(opts.execWords, match.absPath))
+	}
+
+	return executeTargets(pFs, pFatsRef, pDataRef, targets, pCommands, false, endFlag)
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseFindArgs(t *testing.T) {
+	tests := []struct {
+		args    string
+		want    findOptions
+		wantErr error
+	}{
+		{"", findOptions{startPath: ".", maxDepth: -1}, nil},
+		{"/a", findOptions{startPath: "/a", maxDepth: -1}, nil},
+		{"a/b -name *.txt", findOptions{startPath: "a/b", namePattern: "*.txt", maxDepth: -1}, nil},
+		{"-type f", findOptions{startPath: ".", entryType: "f", maxDepth: -1}, nil},
+		{"-type d -maxdepth 0", findOptions{startPath: ".", entryType: "d", maxDepth: 0}, nil},
+		{"-size 100", findOptions{startPath: ".", sizeFilter: sizeEqual, size: 100, maxDepth: -1}, nil},
+		{"-size 100B", findOptions{startPath: ".", sizeFilter: sizeEqual, size: 100, maxDepth: -1}, nil},
+		{"-size +10KB", findOptions{startPath: ".", sizeFilter: sizeGreater, size: 10000, maxDepth: -1}, nil},
+		{"-size -1MB", findOptions{startPath: ".", sizeFilter: sizeLess, size: 1000000, maxDepth: -1}, nil},
+		{"-name a -name b", findOptions{startPath: ".", namePattern: "b", maxDepth: -1}, nil},
+		{"/ -exec rm {}", findOptions{startPath: "/", maxDepth: -1, execWords: []string{"rm", "{}"}}, nil},
+		{"/ -exec rm {} ;", findOptions{startPath: "/", maxDepth: -1, execWords: []string{"rm", "{}"}}, nil},
+		{`/ -exec rm {} \;`, findOptions{startPath: "/", maxDepth: -1, execWords: []string{"rm", "{}"}}, nil},
+		{"-type f -exec cat", findOptions{startPath: ".", entryType: "f", maxDepth: -1, execWords: []string{"cat"}}, nil},
+		{"-exec ls -name x", findOptions{startPath: ".", maxDepth: -1, execWords: []string{"ls", "-name", "x"}}, nil},
+
+		{"-name", findOptions{}, custom_errors.ErrInvalArgsCount},
+		{"/a -type", findOptions{}, custom_errors.ErrInvalArgsCount},
+		{"-type x", findOptions{}, custom_errors.ErrInvalidOptionValue},
+		{"-size abc", findOptions{}, custom_errors.ErrInvalidOptionValue},
+		{"-size +", findOptions{}, custom_errors.ErrInvalidOptionValue},
+		{"-size 10XB", findOptions{}, custom_errors.ErrInvalidOptionValue},
+		{"-maxdepth -1", findOptions{}, custom_errors.ErrInvalidOptionValue},
+		{"-maxdepth x", findOptions{}, custom_errors.ErrInvalidOptionValue},
+		{"-depth 1", findOptions{}, custom_errors.ErrUnknownOption},
+		{"/a /b", findOptions{}, custom_errors.ErrInvalArgsCount},
+		{"/a /b c", findOptions{}, custom_errors.ErrUnknownOption},
+		{"-name [", findOptions{}, custom_errors.ErrInvalidPattern},
+		{"-exec", findOptions{}, custom_errors.ErrInvalArgsCount},
+		{"-exec ;", findOptions{}, custom_errors.ErrInvalArgsCount},
+		{"-exec nope {}", findOptions{}, custom_errors.ErrUnknownCmd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			pOpts, err := parseFindArgs(strings.Fields(tt.args))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*pOpts, tt.want) {
+				t.Errorf("options %+v, want %+v", *pOpts, tt.want)
+			}
+		})
+	}
+}
+
+// newFindTestFS returns the filesystem with the tree searched by the find tests.
+func newFindTestFS(t *testing.T) *cmdTestFS {
+	f := newCmdTestFS(t, "1MB")
+	for _, dir := range []string{"/a", "/a/b", "/c"} {
+		f.run("mkdir " + dir)
+	}
+	f.writeFile("/a/b/deep.txt", make([]byte, 12000))
+	f.writeFile("/a/x.txt", make([]byte, 100))
+	f.writeFile("/a/y.log", make([]byte, 5000))
+	f.writeFile("/top.txt", make([]byte, 10))
+	return f
+}
+
+// getFoundPaths returns the paths of the find payload.
+func getFoundPaths(t *testing.T, payload any) []string {
+	t.Helper()
+
+	found, ok := payload.([]foundPayload)
+	if !ok {
+		t.Fatalf("payload %T", payload)
+	}
+	paths := make([]string, len(found))
+	for i, entry := range found {
+		paths[i] = entry.Path
+	}
+	return paths
+}
+
+func TestFindPredicates(t *testing.T) {
+	all := []string{"/", "/a", "/c", "/top.txt", "/a/b", "/a/x.txt", "/a/y.log", "/a/b/deep.txt"}
+
+	tests := []struct {
+		pwd   string
+		input string
+		want  []string
+	}{
+		{"/", "find", all},
+		{"/", "find /", all},
+		{"/", "find / -type f", []string{"/top.txt", "/a/x.txt", "/a/y.log", "/a/b/deep.txt"}},
+		{"/", "find / -type d", []string{"/", "/a", "/c", "/a/b"}},
+		{"/", "find / -name *.txt", []string{"/top.txt", "/a/x.txt", "/a/b/deep.txt"}},
+		{"/", "find / -name ?.txt", []string{"/a/x.txt"}},
+		{"/", "find / -name [ab]", []string{"/a", "/a/b"}},
+		{"/", "find / -name none", []string{}},
+		{"/", "find / -size +1KB", []string{"/a/y.log", "/a/b/deep.txt"}},
+		{"/", "find / -size -1KB -type f", []string{"/top.txt", "/a/x.txt"}},
+		{"/", "find / -size 100", []string{"/a/x.txt"}},
+		{"/", "find / -size 5KB", []string{"/a/y.log"}},
+		{"/", "find / -size +5KB", []string{"/a/b/deep.txt"}},
+		{"/", "find / -size -5000", []string{"/", "/a", "/c", "/top.txt", "/a/b", "/a/x.txt"}},
+		{"/", "find / -maxdepth 0", []string{"/"}},
+		{"/", "find / -maxdepth 1", []string{"/", "/a", "/c", "/top.txt"}},
+		{"/", "find / -maxdepth 2 -name *.txt", []string{"/top.txt", "/a/x.txt"}},
+		{"/", "find a -maxdepth 1", []string{"/a", "/a/b", "/a/x.txt", "/a/y.log"}},
+		{"/", "find /a -name *.txt -type f -size -1KB", []string{"/a/x.txt"}},
+		{"/", "find /a/x.txt", []string{"/a/x.txt"}},
+		{"/", "find /a/x.txt -type d", []string{}},
+		{"/", "find /c", []string{"/c"}},
+		{"/a", "find . -name *.log", []string{"/a/y.log"}},
+		{"/a", "find", []string{"/a", "/a/b", "/a/x.txt", "/a/y.log", "/a/b/deep.txt"}},
+		{"/a/b", "find .. -maxdepth 0", []string{"/a"}},
+		{"/a/b", "find ../.. -type d -maxdepth 1", []string{"/", "/a", "/c"}},
+	}
+
+	f := newFindTestFS(t)
+	for _, tt := range tests {
+		t.Run(tt.pwd+" "+tt.input, func(t *testing.T) {
+			f.run("cd " + tt.pwd)
+
+			payload, text, err := f.exec(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := getFoundPaths(t, payload); !slices.Equal(got, tt.want) {
+				t.Errorf("found %q, want %q", got, tt.want)
+			}
+
+			wantText := strings.Join(tt.want, "\n")
+			if len(tt.want) > 0 {
+				wantText += "\n"
+			}
+			if text != wantText {
+				t.Errorf("printed %q, want %q", text, wantText)
+			}
+		})
+	}
+}
+
+func TestFindPayload(t *testing.T) {
+	f := newFindTestFS(t)
+
+	payload := f.run("find /a -maxdepth 1")
+	want := []foundPayload{
+		{Path: "/a", Type: "dir", Size: 0},
+		{Path: "/a/b", Type: "dir", Size: 0},
+		{Path: "/a/x.txt", Type: "file", Size: 100},
+		{Path: "/a/y.log", Type: "file", Size: 5000},
+	}
+	if got, ok := payload.([]foundPayload); !ok || !slices.Equal(got, want) {
+		t.Errorf("payload %+v, want %+v", payload, want)
+	}
+}
+
+func TestFindErrors(t *testing.T) {
+	f := newFindTestFS(t)
+
+	tests := []struct {
+		input   string
+		wantErr error
+	}{
+		{"find /missing", custom_errors.ErrPathNotFound},
+		{"find /a/x.txt/y", custom_errors.ErrPathNotFound},
+		{"find / -type x", custom_errors.ErrInvalidOptionValue},
+		{"find / -exec nope", custom_errors.ErrUnknownCmd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if _, _, err := f.exec(tt.input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// getTargets returns the targets of the payload of the executed commands and their statuses.
+func getTargets(t *testing.T, payload any) ([]string, []string) {
+	t.Helper()
+
+	results, ok := payload.([]targetPayload)
+	if !ok {
+		t.Fatalf("payload %T", payload)
+	}
+	targets, statuses := make([]string, len(results)), make([]string, len(results))
+	for i, result := range results {
+		targets[i], statuses[i] = result.Target, result.Status
+	}
+	return targets, statuses
+}
+
+func TestFindExec(t *testing.T) {
+	t.Run("placeholder", func(t *testing.T) {
+		f := newFindTestFS(t)
+		payload := f.run("find / -name *.log -exec rm {} ;")
+		if targets, _ := getTargets(t, payload); !slices.Equal(targets, []string{"/a/y.log"}) {
+			t.Errorf("targets %q", targets)
+		}
+		if _, _, err := f.exec("stat /a/y.log"); err == nil {
+			t.Error("/a/y.log not removed")
+		}
+	})
+
+	t.Run("path appended", func(t *testing.T) {
+		f := newFindTestFS(t)
+		f.writeFile("/a/x.txt", []byte("x"))
+		f.writeFile("/top.txt", []byte("top"))
+
+		payload := f.run("find / -name *.txt -size -100 -exec cat")
+		results := payload.([]targetPayload)
+		if len(results) != 2 || results[0].Payload != (catPayload{Content: "top", Encoding: consts.EncodingUTF8}) || results[1].Payload != (catPayload{Content: "x", Encoding: consts.EncodingUTF8}) {
+			t.Errorf("results %+v", results)
+		}
+	})
+
+	t.Run("placeholder in word", func(t *testing.T) {
+		f := newFindTestFS(t)
+		f.run("find /a -maxdepth 1 -type f -exec cp {} {}2")
+		for _, path := range []string{"/a/x.txt2", "/a/y.log2"} {
+			if _, _, err := f.exec("stat " + path); err != nil {
+				t.Errorf("%s: %v", path, err)
+			}
+		}
+	})
+
+	t.Run("matches collected first", func(t *testing.T) {
+		f := newFindTestFS(t)
+		payload := f.run("find / -type d -name ? -exec mkdir {}/n")
+		if targets, _ := getTargets(t, payload); !slices.Equal(targets, []string{"/a", "/c", "/a/b"}) {
+			t.Errorf("targets %q", targets)
+		}
+		if _, _, err := f.exec("stat /a/n/n"); err == nil {
+			t.Error("the created directory was searched")
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		f := newFindTestFS(t)
+		payload, _, err := f.exec("find / -maxdepth 1 -type d -name ? -exec rmdir {}")
+		if !errors.Is(err, custom_errors.ErrPartialFailure) {
+			t.Fatalf("error %v, want ErrPartialFailure", err)
+		}
+		targets, statuses := getTargets(t, payload)
+		if !slices.Equal(targets, []string{"/a", "/c"}) || !slices.Equal(statuses, []string{"error", "ok"}) {
+			t.Errorf("targets %q with statuses %q", targets, statuses)
+		}
+		if _, _, err = f.exec("stat /c"); err == nil {
+			t.Error("/c not removed")
+		}
+	})
+}
@@ -0,0 +1,368 @@
+// command_output.go contains the output of the command results (plain text or JSON)
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"unicode/utf8"
+)
+
+// OutputFormat is a global variable that holds the output format of the commands
+// (consts.OutputFormatText or consts.OutputFormatJSON)
+var OutputFormat = consts.OutputFormatText
+
+// CommandResult is the result of a command printed as one JSON object in the JSON output mode
+type CommandResult struct {
+	// Command is the executed command
+	Command string `json:"command"`
+	// Status is consts.StatusOK or consts.StatusError
+	Status string `json:"status"`
+	// ErrorCode identifies the error, empty on success
+	ErrorCode string `json:"error_code,omitempty"`
+	// Error is the error message for the user, empty on success
+	Error string `json:"error,omitempty"`
+	// Path is the path the error relates to, empty if unknown
+	Path string `json:"path,omitempty"`
+	// Payload is the command specific data, nil if the command has no output
+	Payload any `json:"payload,omitempty"`
+	// Location is the script file and line of the command, empty outside of scripts
+	Location string `json:"location,omitempty"`
+}
+
+// entryPayload is the directory entry listed by the ls command
+type entryPayload struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Size         uint32 `json:"size"`
+	StartCluster uint32 `json:"start_cluster"`
+}
+
+// foundPayload is the entry found by the find command
+type foundPayload struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	Size uint32 `json:"size"`
+}
+
+// treeNode is the entry printed by the tree command
+type treeNode struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	Size     uint32     `json:"size"`
+	Children []treeNode `json:"children,omitempty"`
+}
+
+// treePayload is the result of the tree command
+type treePayload struct {
+	Root        treeNode `json:"root"`
+	Directories int      `json:"directories"`
+	Files       int      `json:"files"`
+}
+
+// diskUsagePayload is the usage of the path printed by the du command
+type diskUsagePayload struct {
+	Path     string `json:"path"`
+	Clusters uint32 `json:"clusters"`
+	Bytes    uint32 `json:"bytes"`
+}
+
+// diskFreePayload is the result of the df command
+type diskFreePayload struct {
+	ClusterSize         uint32 `json:"cluster_size"`
+	TotalClusters       uint32 `json:"total_clusters"`
+	UsedClusters        uint32 `json:"used_clusters"`
+	FreeClusters        uint32 `json:"free_clusters"`
+	BadClusters         uint32 `json:"bad_clusters"`
+	SelfRefClusters     uint32 `json:"self_reference_clusters"`
+	ParentEntryClusters uint32 `json:"parent_entry_clusters"`
+}
+
+// clusterRunPayload is the run of contiguous clusters printed by the stat command
+type clusterRunPayload struct {
+	StartCluster uint32 `json:"start_cluster"`
+	Count        uint32 `json:"count"`
+	StartOffset  uint64 `json:"start_offset"`
+	EndOffset    uint64 `json:"end_offset"`
+}
+
+// statPayload is the entry metadata printed by the stat command
+type statPayload struct {
+	Path          string              `json:"path"`
+	Type          string              `json:"type"`
+	Size          uint32              `json:"size"`
+	StartCluster  uint32              `json:"start_cluster"`
+	ParentCluster uint32              `json:"parent_cluster"`
+	ClusterCount  int                 `json:"cluster_count"`
+	Fragments     int                 `json:"fragments"`
+	Runs          []clusterRunPayload `json:"runs"`
+	SelfReference string              `json:"self_reference"`
+}
+
+// textLinesPayload is the lines of the file printed by the head and tail commands
+type textLinesPayload struct {
+	Path  string   `json:"path"`
+	Lines []string `json:"lines"`
+}
+
+// wordCountPayload is the counts of the file printed by the wc command
+type wordCountPayload struct {
+	Path  string `json:"path"`
+	Lines int    `json:"lines"`
+	Words int    `json:"words"`
+	Bytes int64  `json:"bytes"`
+}
+
+// grepMatchPayload is the matching line printed by the grep command
+type grepMatchPayload struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// hexdumpPayload is the hex encoded content printed by the hexdump command
+type hexdumpPayload struct {
+	Path    string `json:"path,omitempty"`
+	Cluster *int64 `json:"cluster,omitempty"`
+	Offset  uint64 `json:"offset"`
+	Data    string `json:"data"`
+}
+
+// echoPayload is the text printed by the echo command
+type echoPayload struct {
+	Text string `json:"text"`
+}
+
+// checksumPayload is the checksum of the file printed by the checksum commands
+type checksumPayload struct {
+	Path     string `json:"path"`
+	Checksum string `json:"checksum"`
+}
+
+// checksumStatusPayload is the verification result of the file listed in the checksum manifest
+type checksumStatusPayload struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+// comparePayload is the first difference of the files printed by the cmp command
+type comparePayload struct {
+	First     string `json:"first"`
+	Second    string `json:"second"`
+	Identical bool   `json:"identical"`
+	Offset    int64  `json:"offset,omitempty"`
+	Line      int64  `json:"line,omitempty"`
+	EOF       string `json:"eof,omitempty"`
+}
+
+// diffPayload is the difference of the files printed by the diff command
+type diffPayload struct {
+	First     string   `json:"first"`
+	Second    string   `json:"second"`
+	Identical bool     `json:"identical"`
+	Binary    bool     `json:"binary,omitempty"`
+	Offset    int64    `json:"offset,omitempty"`
+	Lines     []string `json:"lines,omitempty"`
+}
+
+// treeDiffPayload is the difference of the directories printed by the recursive diff command
+type treeDiffPayload struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// superblockDiffPayload is the superblock field differing in the compared filesystems
+type superblockDiffPayload struct {
+	Field  string `json:"field"`
+	First  string `json:"first"`
+	Second string `json:"second"`
+}
+
+// fatDiffPayload is the FAT entry differing in the compared filesystems
+type fatDiffPayload struct {
+	Fat     int    `json:"fat"`
+	Cluster uint32 `json:"cluster"`
+	First   int32  `json:"first"`
+	Second  int32  `json:"second"`
+}
+
+// imageDiffPayload is the difference of the filesystems printed by the diff mode
+type imageDiffPayload struct {
+	Superblock []superblockDiffPayload `json:"superblock"`
+	Added      []string                `json:"added"`
+	Removed    []string                `json:"removed"`
+	Modified   []string                `json:"modified"`
+	Fats       []fatDiffPayload        `json:"fats"`
+	Clusters   []clusterRunPayload     `json:"clusters,omitempty"`
+}
+
+// defragPayload is the result of the defrag command
+type defragPayload struct {
+	Path        string  `json:"path"`
+	ScoreBefore float64 `json:"score_before"`
+	ScoreAfter  float64 `json:"score_after"`
+	Chains      int     `json:"chains"`
+	Relocated   int     `json:"relocated"`
+	Skipped     int     `json:"skipped"`
+}
+
+// infoPayload is the cluster information printed by the info command
+type infoPayload struct {
+	Name     string   `json:"name"`
+	Clusters []uint32 `json:"clusters"`
+}
+
+// pwdPayload is the current directory printed by the pwd command
+type pwdPayload struct {
+	Path string `json:"path"`
+}
+
+// catPayload is the file content printed by the cat command
+type catPayload struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+// newCatPayload returns the payload with the content as it is if it is valid UTF-8,
+// base64 encoded otherwise (a JSON string cannot hold arbitrary bytes).
+func newCatPayload(content []byte) catPayload {
+	if utf8.Valid(content) {
+		return catPayload{Content: string(content), Encoding: consts.EncodingUTF8}
+	}
+
+	return catPayload{Content: base64.StdEncoding.EncodeToString(content), Encoding: consts.EncodingBase64}
+}
+
+// formatPayload is the result of the format command
+type formatPayload struct {
+	Size            uint32 `json:"size"`
+	AllocatableSize int    `json:"allocatable_size"`
+}
+
+// resizePayload is the result of the resize command
+type resizePayload struct {
+	OldSize           uint32 `json:"old_size"`
+	Size              uint32 `json:"size"`
+	AllocatableSize   int    `json:"allocatable_size"`
+	RelocatedClusters int    `json:"relocated_clusters"`
+}
+
+// compactPayload is the result of the compact command
+type compactPayload struct {
+	OldSize           uint32 `json:"old_size"`
+	Size              uint32 `json:"size"`
+	AllocatableSize   int    `json:"allocatable_size"`
+	RelocatedClusters int    `json:"relocated_clusters"`
+	Sparse            bool   `json:"sparse"`
+}
+
+// checkPayload is the result of the check command
+type checkPayload struct {
+	Consistent bool     `json:"consistent"`
+	Problems   []string `json:"problems"`
+}
+
+// helpPayload is the help message
+type helpPayload struct {
+	Help string `json:"help"`
+}
+
+// scriptPayload is the summary of the load command
+type scriptPayload struct {
+	Script    string `json:"script"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Stopped   bool   `json:"stopped"`
+}
+
+// targetPayload is the result for one of the paths matched by a glob pattern
+type targetPayload struct {
+	Target    string `json:"target"`
+	Status    string `json:"status"`
+	ErrorCode string `json:"error_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Payload   any    `json:"payload,omitempty"`
+}
+
+// IsJSONOutput returns true if the command results are printed as JSON.
+func IsJSONOutput() bool {
+	return OutputFormat == consts.OutputFormatJSON
+}
+
+// printText prints the line only in the text output mode.
+func printText(line string) {
+	if !IsJSONOutput() {
+		fmt.Println(line)
+	}
+}
+
+// printTextf prints the formatted text only in the text output mode.
+func printTextf(format string, args ...any) {
+	if !IsJSONOutput() {
+		fmt.Printf(format, args...)
+	}
+}
+
+// getEntriesPayload returns the payload of the ls command.
+func getEntriesPayload(entries []*pseudo_fat.DirectoryEntry) []entryPayload {
+	res := make([]entryPayload, 0, len(entries))
+	for _, pEntry := range entries {
+		entryType := consts.EntryTypeDir
+		if pEntry.IsFile {
+			entryType = consts.EntryTypeFile
+		}
+
+		res = append(res, entryPayload{
+			Name:         utils.GetNormalizedStrFromMem(pEntry.Name[:]),
+			Type:         entryType,
+			Size:         pEntry.Size,
+			StartCluster: pEntry.StartCluster,
+		})
+	}
+
+	return res
+}
+
+// getFoundPayload returns the payload of the find command.
+func getFoundPayload(paths []string, entries []*pseudo_fat.DirectoryEntry) []foundPayload {
+	res := make([]foundPayload, 0, len(entries))
+	for i, entry := range getEntriesPayload(entries) {
+		res = append(res, foundPayload{Path: paths[i], Type: entry.Type, Size: entry.Size})
+	}
+
+	return res
+}
+
+// NewCommandResult creates the result of the command (failed if err is not nil).
+func NewCommandResult(input string, payload any, err error) *CommandResult {
+	pResult := &CommandResult{Command: input, Status: consts.StatusOK, Payload: payload}
+	if err != nil {
+		pResult.Status = consts.StatusError
+		pResult.ErrorCode = string(custom_errors.GetCode(err))
+		pResult.Error = custom_errors.GetUserMsg(err)
+		pResult.Path = custom_errors.GetPath(err)
+	}
+
+	return pResult
+}
+
+// PrintResult prints the result as one JSON object on a line (only in the JSON output mode).
+func PrintResult(pResult *CommandResult) {
+	if !IsJSONOutput() {
+		return
+	}
+
+	resultBytes, err := json.Marshal(pResult)
+	if err != nil {
+		logging.Error(fmt.Sprintf("Error encoding the command result: %s", err))
+		return
+	}
+
+	fmt.Println(string(resultBytes))
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"strings"
+	"testing"
+)
+
+// setJSONOutput switches to the JSON output mode for the test.
+func setJSONOutput(t *testing.T) {
+	t.Helper()
+
+	OutputFormat = consts.OutputFormatJSON
+	t.Cleanup(func() {
+		OutputFormat = consts.OutputFormatText
+	})
+}
+
+// decodeResults decodes the printed lines as the JSON results (one per line).
+func decodeResults(t *testing.T, text string) []map[string]any {
+	t.Helper()
+
+	res := make([]map[string]any, 0)
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		var result map[string]any
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("line %q is not a JSON object: %v", line, err)
+		}
+		res = append(res, result)
+	}
+	return res
+}
+
+func TestPrintResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		payload any
+		err     error
+		want    string
+	}{
+		{"success", "pwd", pwdPayload{Path: "/a"}, nil,
+			`{"command":"pwd","status":"ok","payload":{"path":"/a"}}`},
+		{"success without payload", "mkdir a", nil, nil,
+			`{"command":"mkdir a","status":"ok"}`},
+		{"error", "cat /none", nil, custom_errors.WithPath(custom_errors.ErrEntryNotFound, "/none"),
+			`{"command":"cat /none","status":"error","error_code":"` + string(custom_errors.CodeEntryNotFound) +
+				`","error":"` + custom_errors.GetUserMsg(custom_errors.ErrEntryNotFound) + `","path":"/none"}`},
+		{"error with payload", "load s", scriptPayload{Script: "s", Failed: 1}, custom_errors.ErrScriptFailed,
+			`{"command":"load s","status":"error","error_code":"` + string(custom_errors.CodeScriptFailed) +
+				`","error":"` + custom_errors.GetUserMsg(custom_errors.ErrScriptFailed) +
+				`","payload":{"script":"s","succeeded":0,"failed":1,"stopped":false}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pResult := NewCommandResult(tt.input, tt.payload, tt.err)
+
+			// nothing is printed in the text mode
+			if text := captureStdout(t, func() { PrintResult(pResult) }); text != "" {
+				t.Errorf("text mode printed %q", text)
+			}
+
+			setJSONOutput(t)
+			if text := captureStdout(t, func() { PrintResult(pResult) }); text != tt.want+"\n" {
+				t.Errorf("printed %q, want %q", text, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteCommandJSON(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	binary := []byte{0x00, 0xff, 0xfe, 'a', 0x80, '\n'}
+	f.writeFile("/bin", binary)
+	f.writeFile("/text", []byte("čeština\n"))
+	setJSONOutput(t)
+
+	inputs := []string{"cat /bin", "cat /text", "cat /none", "pwd"}
+	text := captureStdout(t, func() {
+		for _, input := range inputs {
+			pCommand, err := ParseCommand(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ExecuteCommand(pCommand, f.endFlag, nil, f.pFs, &f.fats, &f.data)
+		}
+	})
+
+	// one result per command, nothing else is printed
+	results := decodeResults(t, text)
+	if len(results) != len(inputs) {
+		t.Fatalf("%d results printed for %d commands: %q", len(results), len(inputs), text)
+	}
+	for i, result := range results {
+		if result["command"] != inputs[i] {
+			t.Errorf("result %d of command %v, want %q", i, result["command"], inputs[i])
+		}
+	}
+
+	// the binary content is not corrupted
+	payload, _ := results[0]["payload"].(map[string]any)
+	content, err := base64.StdEncoding.DecodeString(payload["content"].(string))
+	if payload["encoding"] != consts.EncodingBase64 || err != nil || string(content) != string(binary) {
+		t.Errorf("binary cat payload %v (decoded %q, %v)", payload, content, err)
+	}
+	payload, _ = results[1]["payload"].(map[string]any)
+	if payload["encoding"] != consts.EncodingUTF8 || payload["content"] != "čeština\n" {
+		t.Errorf("text cat payload %v", payload)
+	}
+	if results[2]["status"] != consts.StatusError || results[2]["error_code"] != string(custom_errors.CodeEntryNotFound) {
+		t.Errorf("missing file result %v", results[2])
+	}
+}
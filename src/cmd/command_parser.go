@@ -2,20 +2,121 @@
 package cmd
 
 import (
-	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
 	"strings"
+	"unicode"
 )
 
-// ParseCommand parses the input string into a Command struct
+// ParseCommand parses the input string into a Command struct.
+//
+// The words are separated by whitespace outside the quotes. The single or double quotes
+// group the characters (including whitespace) into one word and are removed. The words
+// with a quoted part are marked in Command.Quoted. The unquoted redirection operators
+// of the echo command are split from the words they are attached to ("echo hi >f").
+//
+// It returns ErrEmptyCmdName for an empty input and ErrUnterminatedQuote if a quote is not closed.
 func ParseCommand(input string) (*Command, error) {
 	// split the input into words
-	words := strings.Fields(input)
+	words, quoted, err := splitWords(input)
+	if err != nil {
+		return nil, err
+	}
 	if len(words) == 0 {
-		return nil, errors.New("empty input")
+		return nil, custom_errors.ErrEmptyCmdName
+	}
+
+	pCommand := &Command{Name: words[0], Args: words[1:], Quoted: quoted[1:]}
+	if pCommand.Name == consts.EchoCommand {
+		splitRedirectOps(pCommand)
+	}
+
+	return pCommand, nil
+}
+
+// splitWords splits the input into the words (see ParseCommand).
+//
+// It returns the words and whether each of them has a quoted part.
+func splitWords(input string) ([]string, []bool, error) {
+	words := make([]string, 0)
+	quoted := make([]bool, 0)
+
+	var sb strings.Builder
+	var quote rune
+	inWord := false
+	isQuoted := false
+	for _, c := range input {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				sb.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+			isQuoted = true
+		case unicode.IsSpace(c):
+			if inWord {
+				words = append(words, sb.String())
+				quoted = append(quoted, isQuoted)
+				sb.Reset()
+				inWord = false
+				isQuoted = false
+			}
+		default:
+			sb.WriteRune(c)
+			inWord = true
+		}
 	}
 
-	cmdName := words[0]
-	cmdArgs := words[1:]
+	if quote != 0 {
+		return nil, nil, custom_errors.ErrUnterminatedQuote
+	}
+	if inWord {
+		words = append(words, sb.String())
+		quoted = append(quoted, isQuoted)
+	}
+
+	return words, quoted, nil
+}
+
+// splitRedirectOps splits the redirection operators (">" and ">>") attached to the unquoted
+// arguments of the command into separate arguments ("hi>>f" becomes "hi", ">>", "f").
+// The arguments with a quoted part are kept as they are.
+func splitRedirectOps(pCommand *Command) {
+	args := make([]string, 0, len(pCommand.Args))
+	quoted := make([]bool, 0, len(pCommand.Args))
+	for i, arg := range pCommand.Args {
+		if pCommand.IsArgQuoted(i) || arg == consts.RedirectWriteOp || arg == consts.RedirectAppendOp {
+			args = append(args, arg)
+			quoted = append(quoted, pCommand.IsArgQuoted(i))
+			continue
+		}
+
+		for arg != "" {
+			idx := strings.Index(arg, consts.RedirectWriteOp)
+			if idx < 0 {
+				args = append(args, arg)
+				quoted = append(quoted, false)
+				break
+			}
+			if idx > 0 {
+				args = append(args, arg[:idx])
+				quoted = append(quoted, false)
+			}
+
+			op := consts.RedirectWriteOp
+			if strings.HasPrefix(arg[idx:], consts.RedirectAppendOp) {
+				op = consts.RedirectAppendOp
+			}
+			args = append(args, op)
+			quoted = append(quoted, false)
+			arg = arg[idx+len(op):]
+		}
+	}
 
-	return &Command{Name: cmdName, Args: cmdArgs}, nil
+	pCommand.Args = args
+	pCommand.Quoted = quoted
 }
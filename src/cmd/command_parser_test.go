@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/custom_errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    *Command
+		wantErr error
+	}{
+		{"ls", &Command{Name: "ls", Args: []string{}, Quoted: []bool{}}, nil},
+		{"  cp  /a\t/b ", &Command{Name: "cp", Args: []string{"/a", "/b"}, Quoted: []bool{false, false}}, nil},
+		{`grep "a b" /f`, &Command{Name: "grep", Args: []string{"a b", "/f"}, Quoted: []bool{true, false}}, nil},
+		{`echo 'it"s' x"y z"w ""`, &Command{Name: "echo", Args: []string{`it"s`, "xy zw", ""}, Quoted: []bool{true, true, true}}, nil},
+		{`"ls" /`, &Command{Name: "ls", Args: []string{"/"}, Quoted: []bool{false}}, nil},
+
+		// only the operators of echo are split
+		{"echo a>b>>c", &Command{Name: "echo", Args: []string{"a", ">", "b", ">>", "c"},
+			Quoted: []bool{false, false, false, false, false}}, nil},
+		{`echo ">"f`, &Command{Name: "echo", Args: []string{">f"}, Quoted: []bool{true}}, nil},
+		{"grep a>b /f", &Command{Name: "grep", Args: []string{"a>b", "/f"}, Quoted: []bool{false, false}}, nil},
+
+		{"", nil, custom_errors.ErrEmptyCmdName},
+		{"   ", nil, custom_errors.ErrEmptyCmdName},
+		{`echo "a`, nil, custom_errors.ErrUnterminatedQuote},
+		{`echo 'a"`, nil, custom_errors.ErrUnterminatedQuote},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			pCommand, err := ParseCommand(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(pCommand, tt.want) {
+				t.Errorf("parsed %+v, want %+v", pCommand, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// command_resize.go contains the implementation of the resize command
+package cmd
+
+import (
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+)
+
+// resizeCommand handles the resize command.
+//
+// The filesystem is resized to the size without losing its data (see utils.ResizeFileSystem).
+// The used clusters above the new cluster count are moved below it when shrinking.
+func resizeCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, pFatsRef *[][]int32, pDataRef *[]byte) (bool, any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || pFatsRef == nil || pDataRef == nil {
+		return false, nil, custom_errors.ErrNilPointer
+	}
+
+	size, err := utils.ParseFSSize(pCommand.Args[0])
+	if err != nil {
+		return false, nil, err
+	}
+
+	currDirPath, err := utils.GetAbsolutePathFromPwd(pFs, P_CurrDir, *pFatsRef, *pDataRef)
+	if err != nil {
+		return false, nil, err
+	}
+
+	res, err := utils.ResizeFileSystem(pFs, pFatsRef, pDataRef, size)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// the current directory could have been moved (and the data region was reallocated)
+	err = refreshCurrDir(currDirPath, pFs, *pFatsRef, *pDataRef)
+	if err != nil {
+		return true, nil, err
+	}
+
+	printTextf("Filesystem resized from %d to %d bytes. Allocatable data space: %d bytes\n",
+		res.OldSize, pFs.DiskSize, len(*pDataRef))
+	if res.Relocated > 0 {
+		printTextf("Relocated clusters: %d\n", res.Relocated)
+	}
+
+	payload := resizePayload{
+		OldSize:           res.OldSize,
+		Size:              pFs.DiskSize,
+		AllocatableSize:   len(*pDataRef),
+		RelocatedClusters: res.Relocated,
+	}
+
+	return res.OldSize != pFs.DiskSize, payload, nil
+}
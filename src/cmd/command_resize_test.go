@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"kiv-zos-semestral-work/utils"
+	"os"
+	"slices"
+	"testing"
+)
+
+// resizeTo resizes the filesystem of the test to the cluster count and returns the payload.
+func resizeTo(t *testing.T, f *cmdTestFS, clusterCount uint32) resizePayload {
+	t.Helper()
+
+	payload, ok := f.run(fmt.Sprintf("resize %dB", utils.GetFSSizeForClusters(clusterCount))).(resizePayload)
+	if !ok {
+		t.Fatalf("payload %T", payload)
+	}
+	if len(f.fats[0]) != int(clusterCount) || payload.Size != f.pFs.DiskSize || payload.AllocatableSize != len(f.data) {
+		t.Fatalf("%d clusters after the resize to %d, payload %+v", len(f.fats[0]), clusterCount, payload)
+	}
+	return payload
+}
+
+// checkBelow fails the test if a cluster of the chain of the entry (or of its directory index) is not below the limit.
+func checkBelow(t *testing.T, f *cmdTestFS, absPath string, limit uint32) {
+	t.Helper()
+
+	chain := f.getChain(absPath)
+	branch, err := utils.GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, absPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexClusters, err := utils.GetDirIndexClusters(f.pFs, f.fats, f.data, branch[len(branch)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := slices.Max(append(chain, indexClusters...)); max >= limit {
+		t.Fatalf("%s uses the cluster %d above the limit %d", absPath, max, limit)
+	}
+}
+
+func TestResizeShrinkRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   string
+		aCount int
+		bCount int
+	}{
+		{"small", "1MB", 20, 20},
+		{"indexed directory", "10MB", 300, 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newCmdTestFS(t, tt.size)
+			contents := f.populateFragmented(tt.aCount, tt.bCount)
+
+			f.run("rm /big")
+			delete(contents, "/big")
+			clusterCount := uint32(len(f.fats[0]))
+
+			// the directory /a and its last files are written behind the used cluster count
+			limit := f.checkUsage().Used + 2
+			for _, path := range []string{"/a", fmt.Sprintf("/a/f%d", tt.aCount-1)} {
+				if chain := f.getChain(path); slices.Max(chain) < limit {
+					t.Fatalf("chain %v of %s is below the limit %d", chain, path, limit)
+				}
+			}
+
+			f.run("cd /a")
+			if payload := resizeTo(t, f, limit); payload.RelocatedClusters == 0 {
+				t.Errorf("payload %+v without the relocated clusters", payload)
+			}
+			f.checkFS()
+			f.checkContents(contents)
+			for _, path := range []string{"/", "/a", "/b", fmt.Sprintf("/a/f%d", tt.aCount-1), "/a/f1"} {
+				checkBelow(t, f, path, limit)
+			}
+			if pwd := f.run("pwd"); pwd != (pwdPayload{Path: "/a"}) {
+				t.Errorf("pwd %+v after the shrink", pwd)
+			}
+
+			// grown back, the freed space is usable and the image is loaded the same
+			resizeTo(t, f, clusterCount)
+			f.checkFS()
+			f.checkContents(contents)
+			contents["/a/big"] = make([]byte, int(f.checkUsage().Free-2)*int(f.pFs.ClusterSize))
+			f.writeFile("/a/big", contents["/a/big"])
+			reloadImage(t, f)
+			f.checkFS()
+			f.checkContents(contents)
+		})
+	}
+}
+
+func TestResizeGrowRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   string
+		aCount int
+		bCount int
+	}{
+		{"small", "1MB", 20, 20},
+		{"indexed directory", "10MB", 300, 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newCmdTestFS(t, tt.size)
+			contents := f.populateFragmented(tt.aCount, tt.bCount)
+			clusterCount := uint32(len(f.fats[0]))
+			f.writeFile("/filler", make([]byte, int(f.checkUsage().Free-4)*int(f.pFs.ClusterSize)))
+
+			if payload := resizeTo(t, f, 2*clusterCount); payload.RelocatedClusters != 0 {
+				t.Errorf("payload %+v with the relocated clusters", payload)
+			}
+			f.checkFS()
+			f.checkContents(contents)
+
+			// the new directory and files are written to the added clusters, the indexed directory grows there
+			f.run("mkdir /grown")
+			for i := range 5 {
+				path := fmt.Sprintf("/grown/f%d", i)
+				contents[path] = []byte(fmt.Sprintf("grown file %d\n", i))
+				f.writeFile(path, contents[path])
+				path = fmt.Sprintf("/a/grown%d", i)
+				contents[path] = []byte(path)
+				f.writeFile(path, contents[path])
+			}
+			if slices.Max(f.getChain("/grown")) < clusterCount {
+				t.Fatalf("chain %v of /grown is not in the added clusters", f.getChain("/grown"))
+			}
+			f.checkFS()
+
+			// shrunk back after the space is freed below, everything is moved below the original count
+			f.run("rm /filler")
+			f.run("rm /big")
+			delete(contents, "/big")
+			if payload := resizeTo(t, f, clusterCount); payload.RelocatedClusters == 0 {
+				t.Errorf("payload %+v without the relocated clusters", payload)
+			}
+			f.checkFS()
+			f.checkContents(contents)
+			for _, path := range []string{"/grown", "/grown/f4", "/a"} {
+				checkBelow(t, f, path, clusterCount)
+			}
+
+			reloadImage(t, f)
+			f.checkFS()
+			f.checkContents(contents)
+		})
+	}
+}
+
+// reloadImage writes the filesystem to the host file and loads it back as the filesystem of the test.
+func reloadImage(t *testing.T, f *cmdTestFS) {
+	t.Helper()
+
+	pFile, err := os.Create(t.TempDir() + string(os.PathSeparator) + "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pFile.Close()
+
+	if err = utils.WriteFileSystem(pFile, f.pFs, f.fats, f.data); err != nil {
+		t.Fatal(err)
+	}
+	info, err := pFile.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(f.pFs.DiskSize) {
+		t.Errorf("host file of %d bytes, disk size %d", info.Size(), f.pFs.DiskSize)
+	}
+
+	pFs, pFats, pData, err := utils.GetFileSystem(pFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.pFs, f.fats, f.data = pFs, *pFats, *pData
+	P_CurrDir, err = utils.GetRootDirEntry(f.pFs, f.fats, f.data)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,322 @@
+// command_space.go contains the implementation of the tree, du and df commands
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"strconv"
+	"strings"
+)
+
+// spaceArgs are the parsed arguments of the tree and du commands
+type spaceArgs struct {
+	// path is the path of the entry, current directory if not set
+	path string
+	// maxLevel is the maximum depth of the printed tree, -1 for unlimited
+	maxLevel int
+	// summarize is true if only the total of the path should be printed
+	summarize bool
+}
+
+// parseSpaceArgs parses the arguments of the tree ("[-L n] [a1]") and du ("[-s] [a1]") commands.
+func parseSpaceArgs(cmdName string, args []string) (*spaceArgs, error) {
+	res := &spaceArgs{path: consts.CurrDirSymbol, maxLevel: -1}
+
+	hasPath := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case cmdName == consts.TreeCommand && arg == consts.TreeLevelOpt:
+			if i+1 >= len(args) {
+				return nil, custom_errors.ErrInvalArgsCount
+			}
+			level, err := strconv.Atoi(args[i+1])
+			if err != nil || level < 1 {
+				return nil, custom_errors.ErrInvalidOptionValue
+			}
+			res.maxLevel = level
+			i++
+
+		case cmdName == consts.DiskUsageCommand && arg == consts.DiskUsageSummaryOpt:
+			res.summarize = true
+
+		case strings.HasPrefix(arg, "-"):
+			return nil, custom_errors.ErrUnknownOption
+
+		default:
+			if hasPath {
+				return nil, custom_errors.ErrInvalArgsCount
+			}
+			err := validatePathFormat(arg)
+			if err != nil {
+				return nil, err
+			}
+			res.path = arg
+			hasPath = true
+		}
+	}
+
+	return res, nil
+}
+
+// getEntryByPath returns the normalized absolute path and the entry at the path.
+func getEntryByPath(path string, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (string, *pseudo_fat.DirectoryEntry, error) {
+	normAbsPath, err := makePathNormAbs(path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return "", nil, err
+	}
+
+	branchDirEntries, err := utils.GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, normAbsPath)
+	if errors.Is(err, custom_errors.ErrEntryNotFound) {
+		return "", nil, custom_errors.ErrPathNotFound
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	return normAbsPath, branchDirEntries[len(branchDirEntries)-1], nil
+}
+
+// getEntryTypeName returns the entry type name used in the payloads.
+func getEntryTypeName(pEntry *pseudo_fat.DirectoryEntry) string {
+	if pEntry.IsFile {
+		return consts.EntryTypeFile
+	}
+
+	return consts.EntryTypeDir
+}
+
+// buildTree prints the children of the directory (with the prefix of its level)
+// and returns their payload nodes.
+//
+// The number of the printed directories and files is added to the counters.
+func buildTree(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte,
+	pDir *pseudo_fat.DirectoryEntry, prefix string, level int, maxLevel int,
+	pDirCount *int, pFileCount *int) ([]treeNode, error) {
+
+	children, err := utils.GetDirEntries(pFs, pDir, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+	sortDirectoryEntries(children)
+
+	nodes := make([]treeNode, 0, len(children))
+	for i, pChild := range children {
+		isLast := i == len(children)-1
+		branch, indent := consts.TreeBranch, consts.TreeIndent
+		if isLast {
+			branch, indent = consts.TreeLastBranch, consts.TreeLastIndent
+		}
+
+		name := utils.GetNormalizedStrFromMem(pChild.Name[:])
+		printText(prefix + branch + name)
+
+		node := treeNode{Name: name, Type: getEntryTypeName(pChild), Size: pChild.Size}
+		if pChild.IsFile {
+			*pFileCount++
+		} else {
+			*pDirCount++
+			if maxLevel < 0 || level < maxLevel {
+				node.Children, err = buildTree(pFs, fatsRef, dataRef, pChild, prefix+indent, level+1, maxLevel, pDirCount, pFileCount)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// treeCommand handles the tree command.
+//
+// It prints the directory tree below the path (up to the -L levels).
+func treeCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	args, err := parseSpaceArgs(pCommand.Name, pCommand.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	normAbsPath, pEntry, err := getEntryByPath(args.path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, args.path)
+	}
+
+	printText(normAbsPath)
+	root := treeNode{Name: normAbsPath, Type: getEntryTypeName(pEntry), Size: pEntry.Size}
+	dirCount, fileCount := 0, 0
+	if !pEntry.IsFile {
+		root.Children, err = buildTree(pFs, fatsRef, dataRef, pEntry, "", 1, args.maxLevel, &dirCount, &fileCount)
+		if err != nil {
+			return nil, custom_errors.WithPath(err, args.path)
+		}
+	}
+
+	printText("")
+	printTextf("%d directories, %d files\n", dirCount, fileCount)
+
+	return treePayload{Root: root, Directories: dirCount, Files: fileCount}, nil
+}
+
+// getContentUsage returns the number of clusters consumed by the entry chain and all its
+// descendants (the child entry clusters are part of the directory chain, the index clusters are
+// counted with the directory).
+//
+// The usage of the directories below (including the entry) is appended to the usages in post-order.
+func getContentUsage(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte,
+	pEntry *pseudo_fat.DirectoryEntry, absPath string, pUsages *[]diskUsagePayload) (uint32, error) {
+
+	chain, err := utils.GetClusterChain(pEntry.StartCluster, fatsRef[0])
+	if err != nil {
+		return 0, err
+	}
+	clusters := uint32(len(chain))
+
+	if !pEntry.IsFile {
+		children, err := utils.GetDirEntries(pFs, pEntry, fatsRef, dataRef)
+		if err != nil {
+			return 0, err
+		}
+		sortDirectoryEntries(children)
+
+		indexClusters, err := utils.GetDirIndexClusters(pFs, fatsRef, dataRef, pEntry)
+		if err != nil {
+			return 0, err
+		}
+		clusters += uint32(len(indexClusters))
+
+		for _, pChild := range children {
+			childPath := utils.JoinAbsPath(absPath, utils.GetNormalizedStrFromMem(pChild.Name[:]))
+			childClusters, err := getContentUsage(pFs, fatsRef, dataRef, pChild, childPath, pUsages)
+			if err != nil {
+				return 0, err
+			}
+			clusters += childClusters
+		}
+	}
+
+	// the entry cluster in the parent directory is freed together with the entry (root has none)
+	reported := clusters
+	if absPath != consts.PathDelimiter {
+		reported++
+	}
+	if !pEntry.IsFile {
+		*pUsages = append(*pUsages, diskUsagePayload{Path: absPath, Clusters: reported, Bytes: reported * uint32(pFs.ClusterSize)})
+	}
+
+	return clusters, nil
+}
+
+// diskUsageCommand handles the du command.
+//
+// It prints the clusters consumed by the path and each directory below it (only the path with -s),
+// including the self reference, the parent entry and the directory index clusters.
+func diskUsageCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	args, err := parseSpaceArgs(pCommand.Name, pCommand.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	normAbsPath, pEntry, err := getEntryByPath(args.path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, args.path)
+	}
+
+	usages := make([]diskUsagePayload, 0)
+	clusters, err := getContentUsage(pFs, fatsRef, dataRef, pEntry, normAbsPath, &usages)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, args.path)
+	}
+
+	if pEntry.IsFile {
+		clusters++ // the entry cluster in the parent directory
+		usages = append(usages, diskUsagePayload{Path: normAbsPath, Clusters: clusters, Bytes: clusters * uint32(pFs.ClusterSize)})
+	}
+	if args.summarize {
+		usages = usages[len(usages)-1:]
+	}
+
+	for _, usage := range usages {
+		printTextf("%d\t%d\t%s\n", usage.Clusters, usage.Bytes, usage.Path)
+	}
+
+	return usages, nil
+}
+
+// diskFreeCommand handles the df command.
+//
+// It prints the total, used and free clusters of the FAT (and in bytes) and the overhead
+// of the self reference and parent entry clusters.
+func diskFreeCommand(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	// sanity check
+	if pFs == nil || fatsRef == nil || dataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	fatUsage := utils.GetFatUsage(fatsRef[0])
+
+	// every entry has the self reference cluster and every entry except root has the parent entry cluster
+	pRootDir, err := utils.GetRootDirEntry(pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+
+	entryCount := uint32(0)
+	queue := []*pseudo_fat.DirectoryEntry{pRootDir}
+	for len(queue) > 0 {
+		pCurrEntry := queue[0]
+		queue = queue[1:]
+		entryCount++
+
+		if !pCurrEntry.IsFile {
+			children, err := utils.GetDirEntries(pFs, pCurrEntry, fatsRef, dataRef)
+			if err != nil {
+				return nil, err
+			}
+			queue = append(queue, children...)
+		}
+	}
+
+	clusterSize := uint32(pFs.ClusterSize)
+	res := diskFreePayload{
+		ClusterSize:         clusterSize,
+		TotalClusters:       fatUsage.Total,
+		UsedClusters:        fatUsage.Used,
+		FreeClusters:        fatUsage.Free,
+		BadClusters:         fatUsage.Bad,
+		SelfRefClusters:     entryCount,
+		ParentEntryClusters: entryCount - 1,
+	}
+
+	rows := []struct {
+		name     string
+		clusters uint32
+	}{
+		{"total", res.TotalClusters},
+		{"used", res.UsedClusters},
+		{"free", res.FreeClusters},
+		{"bad", res.BadClusters},
+		{"self references", res.SelfRefClusters},
+		{"parent entries", res.ParentEntryClusters},
+	}
+
+	printTextf("%-16s%10s%14s\n", "", "CLUSTERS", "BYTES")
+	for _, row := range rows {
+		printTextf("%-16s%10d%14d\n", row.name, row.clusters, row.clusters*clusterSize)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/custom_errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSpaceArgs(t *testing.T) {
+	tests := []struct {
+		cmdName string
+		args    string
+		want    spaceArgs
+		wantErr error
+	}{
+		{"tree", "", spaceArgs{path: ".", maxLevel: -1}, nil},
+		{"tree", "/a", spaceArgs{path: "/a", maxLevel: -1}, nil},
+		{"tree", "-L 2", spaceArgs{path: ".", maxLevel: 2}, nil},
+		{"tree", "a -L 1", spaceArgs{path: "a", maxLevel: 1}, nil},
+		{"tree", "-L 1 -L 3 /", spaceArgs{path: "/", maxLevel: 3}, nil},
+		{"du", "", spaceArgs{path: ".", maxLevel: -1}, nil},
+		{"du", "-s", spaceArgs{path: ".", maxLevel: -1, summarize: true}, nil},
+		{"du", "/a -s", spaceArgs{path: "/a", maxLevel: -1, summarize: true}, nil},
+
+		{"tree", "-L", spaceArgs{}, custom_errors.ErrInvalArgsCount},
+		{"tree", "-L 0", spaceArgs{}, custom_errors.ErrInvalidOptionValue},
+		{"tree", "-L x", spaceArgs{}, custom_errors.ErrInvalidOptionValue},
+		{"tree", "-s", spaceArgs{}, custom_errors.ErrUnknownOption},
+		{"tree", "/a /b", spaceArgs{}, custom_errors.ErrInvalArgsCount},
+		{"du", "-L 1", spaceArgs{}, custom_errors.ErrUnknownOption},
+		{"du", "-x", spaceArgs{}, custom_errors.ErrUnknownOption},
+		{"du", "/a /b", spaceArgs{}, custom_errors.ErrInvalArgsCount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmdName+" "+tt.args, func(t *testing.T) {
+			pArgs, err := parseSpaceArgs(tt.cmdName, strings.Fields(tt.args))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*pArgs, tt.want) {
+				t.Errorf("args %+v, want %+v", *pArgs, tt.want)
+			}
+		})
+	}
+}
+
+// newSpaceTestFS returns the filesystem with the tree measured by the space tests:
+//
+//	/a (chain 3: self reference, b, f)
+//	/a/b (chain 1)
+//	/a/f (4001 bytes, chain 3)
+//	/top.txt (10 bytes, chain 2)
+//
+// The root chain has 3 clusters (self reference, a, top.txt), 12 clusters are used in total.
+func newSpaceTestFS(t *testing.T) *cmdTestFS {
+	f := newCmdTestFS(t, "1MB")
+	f.run("mkdir /a")
+	f.run("mkdir /a/b")
+	f.writeFile("/a/f", make([]byte, 4001))
+	f.writeFile("/top.txt", make([]byte, 10))
+	return f
+}
+
+func TestDiskUsage(t *testing.T) {
+	tests := []struct {
+		pwd   string
+		input string
+		want  []diskUsagePayload
+	}{
+		{"/", "du", []diskUsagePayload{{"/a/b", 2, 8000}, {"/a", 8, 32000}, {"/", 12, 48000}}},
+		{"/", "du /", []diskUsagePayload{{"/a/b", 2, 8000}, {"/a", 8, 32000}, {"/", 12, 48000}}},
+		{"/", "du -s", []diskUsagePayload{{"/", 12, 48000}}},
+		{"/", "du /a", []diskUsagePayload{{"/a/b", 2, 8000}, {"/a", 8, 32000}}},
+		{"/", "du -s /a", []diskUsagePayload{{"/a", 8, 32000}}},
+		{"/", "du /a/b", []diskUsagePayload{{"/a/b", 2, 8000}}},
+		{"/", "du /a/f", []diskUsagePayload{{"/a/f", 4, 16000}}},
+		{"/", "du -s /top.txt", []diskUsagePayload{{"/top.txt", 3, 12000}}},
+		{"/a", "du -s .", []diskUsagePayload{{"/a", 8, 32000}}},
+		{"/a", "du f", []diskUsagePayload{{"/a/f", 4, 16000}}},
+		{"/a/b", "du ..", []diskUsagePayload{{"/a/b", 2, 8000}, {"/a", 8, 32000}}},
+	}
+
+	f := newSpaceTestFS(t)
+	for _, tt := range tests {
+		t.Run(tt.pwd+" "+tt.input, func(t *testing.T) {
+			f.run("cd " + tt.pwd)
+
+			payload, text, err := f.exec(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(payload, tt.want) {
+				t.Errorf("payload %+v, want %+v", payload, tt.want)
+			}
+
+			var expected strings.Builder
+			for _, usage := range tt.want {
+				fmt.Fprintf(&expected, "%d\t%d\t%s\n", usage.Clusters, usage.Bytes, usage.Path)
+			}
+			if text != expected.String() {
+				t.Errorf("printed %q, want %q", text, expected.String())
+			}
+		})
+	}
+
+	f.run("cd /")
+	if _, _, err := f.exec("du /none"); !errors.Is(err, custom_errors.ErrPathNotFound) {
+		t.Errorf("du /none: error %v, want %v", err, custom_errors.ErrPathNotFound)
+	}
+}
+
+func TestDiskFree(t *testing.T) {
+	f := newSpaceTestFS(t)
+	usage := f.checkUsage()
+
+	payload, text, err := f.exec("df")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := diskFreePayload{
+		ClusterSize:         4000,
+		TotalClusters:       usage.Total,
+		UsedClusters:        12,
+		FreeClusters:        usage.Total - 12,
+		BadClusters:         0,
+		SelfRefClusters:     5,
+		ParentEntryClusters: 4,
+	}
+	if payload != want {
+		t.Errorf("payload %+v, want %+v", payload, want)
+	}
+	if usage.Used != want.UsedClusters {
+		t.Errorf("rescan %d used clusters, want %d", usage.Used, want.UsedClusters)
+	}
+
+	for _, row := range []string{"total", "used", "free", "bad", "self references", "parent entries"} {
+		if !strings.Contains(text, row) {
+			t.Errorf("row %q not printed:\n%s", row, text)
+		}
+	}
+	if !strings.Contains(text, fmt.Sprintf("used%22d%14d\n", 12, 48000)) {
+		t.Errorf("used row not printed:\n%s", text)
+	}
+}
+
+// getDiskUsageTotal returns the clusters reported by du -s for the path.
+func getDiskUsageTotal(t *testing.T, f *cmdTestFS, path string) uint32 {
+	t.Helper()
+
+	usages, ok := f.run("du -s " + path).([]diskUsagePayload)
+	if !ok || len(usages) != 1 {
+		t.Fatalf("du -s %s: payload %+v", path, usages)
+	}
+	return usages[0].Clusters
+}
+
+// checkDiskUsageMatchesUsed fails the test if du -s / does not report all the used clusters of df.
+func checkDiskUsageMatchesUsed(t *testing.T, f *cmdTestFS) {
+	t.Helper()
+
+	df, ok := f.run("df").(diskFreePayload)
+	if !ok {
+		t.Fatal("df payload")
+	}
+	if du := getDiskUsageTotal(t, f, "/"); du != df.UsedClusters {
+		t.Errorf("du -s / reports %d clusters, df %d used", du, df.UsedClusters)
+	}
+	if used := f.checkUsage().Used; used != df.UsedClusters {
+		t.Errorf("df reports %d used clusters, rescan %d", df.UsedClusters, used)
+	}
+}
+
+func TestDiskUsageMatchesUsed(t *testing.T) {
+	f := newCmdTestFS(t, "5MB")
+	checkDiskUsageMatchesUsed(t, f)
+
+	f.run("mkdir /a")
+	f.run("mkdir /a/b")
+	f.writeFile("/a/b/f", make([]byte, 9000))
+	checkDiskUsageMatchesUsed(t, f)
+
+	// the directory index clusters are counted with the directory
+	f.run("mkdir /big")
+	before := getDiskUsageTotal(t, f, "/big")
+	for i := range 257 {
+		f.writeFile(fmt.Sprintf("/big/f%d", i), []byte{byte(i)})
+	}
+	checkDiskUsageMatchesUsed(t, f)
+	if got, files := getDiskUsageTotal(t, f, "/big"), uint32(257*3); got <= before+files {
+		t.Errorf("du -s /big reports %d clusters, want more than %d (files without the index)", got, before+files)
+	}
+
+	f.run("rm /big/f0")
+	f.run("mv /a/b/f /big/moved")
+	f.run("rmdir /a/b")
+	checkDiskUsageMatchesUsed(t, f)
+}
+
+func TestTree(t *testing.T) {
+	f := newSpaceTestFS(t)
+
+	payload, text, err := f.exec("tree /")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := treePayload{
+		Root: treeNode{Name: "/", Type: "dir", Children: []treeNode{
+			{Name: "a", Type: "dir", Children: []treeNode{
+				{Name: "b", Type: "dir", Children: []treeNode{}},
+				{Name: "f", Type: "file", Size: 4001},
+			}},
+			{Name: "top.txt", Type: "file", Size: 10},
+		}},
+		Directories: 2,
+		Files:       2,
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("payload %+v, want %+v", payload, want)
+	}
+	wantText := "/\n├── a\n│   ├── b\n│   └── f\n└── top.txt\n\n2 directories, 2 files\n"
+	if text != wantText {
+		t.Errorf("printed %q, want %q", text, wantText)
+	}
+
+	tests := []struct {
+		input     string
+		wantDirs  int
+		wantFiles int
+		wantText  string
+	}{
+		{"tree -L 1 /", 1, 1, "/\n├── a\n└── top.txt\n\n1 directories, 1 files\n"},
+		{"tree -L 2 /", 2, 2, wantText},
+		{"tree /a", 1, 1, "/a\n├── b\n└── f\n\n1 directories, 1 files\n"},
+		{"tree /a/b", 0, 0, "/a/b\n\n0 directories, 0 files\n"},
+		{"tree /top.txt", 0, 0, "/top.txt\n\n0 directories, 0 files\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			payload, text, err := f.exec(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tree, ok := payload.(treePayload)
+			if !ok {
+				t.Fatalf("payload %T", payload)
+			}
+			if tree.Directories != tt.wantDirs || tree.Files != tt.wantFiles {
+				t.Errorf("%d directories, %d files, want %d, %d", tree.Directories, tree.Files, tt.wantDirs, tt.wantFiles)
+			}
+			if text != tt.wantText {
+				t.Errorf("printed %q, want %q", text, tt.wantText)
+			}
+		})
+	}
+
+	// the directories below the level are counted but not listed
+	tree := f.run("tree -L 1 /").(treePayload)
+	if children := tree.Root.Children[0].Children; children != nil {
+		t.Errorf("children of a listed below the level: %+v", children)
+	}
+}
@@ -0,0 +1,92 @@
+// command_stat.go contains the implementation of the stat command
+package cmd
+
+import (
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+)
+
+// getSelfRefStatus compares the self reference copy of the entry (first cluster of its chain)
+// with the copy in the parent directory.
+func getSelfRefStatus(pFs *pseudo_fat.FileSystem, dataRef []byte, pEntry *pseudo_fat.DirectoryEntry, normAbsPath string) string {
+	// root is referenced only by itself
+	if normAbsPath == consts.PathDelimiter {
+		return consts.SelfRefNone
+	}
+
+	clusterSize := uint32(pFs.ClusterSize)
+	pSelfRef, err := utils.ReadDirectoryEntryFromCluster(dataRef[pEntry.StartCluster*clusterSize : (pEntry.StartCluster+1)*clusterSize])
+	if err != nil {
+		return consts.SelfRefMismatch
+	}
+
+	if utils.GetNormalizedStrFromMem(pEntry.Name[:]) != utils.GetNormalizedStrFromMem(pSelfRef.Name[:]) ||
+		pEntry.IsFile != pSelfRef.IsFile ||
+		pEntry.StartCluster != pSelfRef.StartCluster ||
+		pEntry.ParentCluster != pSelfRef.ParentCluster ||
+		pEntry.Size != pSelfRef.Size {
+		return consts.SelfRefMismatch
+	}
+
+	return consts.SelfRefMatch
+}
+
+// statCommand handles the stat command.
+//
+// It prints the metadata of the file or directory and the layout of its cluster chain
+// (the runs of contiguous clusters and their byte offsets within the filesystem file).
+func statCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+	if len(pCommand.Args) != 1 {
+		return nil, custom_errors.ErrInvalArgsCount
+	}
+
+	normAbsPath, pEntry, err := getEntryByPath(pCommand.Args[0], pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := utils.GetClusterChain(pEntry.StartCluster, fatsRef[0])
+	if err != nil {
+		return nil, err
+	}
+
+	res := statPayload{
+		Path:          normAbsPath,
+		Type:          getEntryTypeName(pEntry),
+		Size:          pEntry.Size,
+		StartCluster:  pEntry.StartCluster,
+		ParentCluster: pEntry.ParentCluster,
+		ClusterCount:  len(chain),
+		Runs:          make([]clusterRunPayload, 0),
+		SelfReference: getSelfRefStatus(pFs, dataRef, pEntry, normAbsPath),
+	}
+	for _, run := range utils.GetClusterRuns(chain) {
+		res.Runs = append(res.Runs, clusterRunPayload{
+			StartCluster: run.Start,
+			Count:        run.Count,
+			StartOffset:  utils.GetClusterOffset(pFs.DataStartAddr, pFs.ClusterSize, run.Start),
+			EndOffset:    utils.GetClusterOffset(pFs.DataStartAddr, pFs.ClusterSize, run.Start+run.Count),
+		})
+	}
+	res.Fragments = len(res.Runs)
+
+	printTextf("Path:           %s\n", res.Path)
+	printTextf("Type:           %s\n", res.Type)
+	printTextf("Size:           %d\n", res.Size)
+	printTextf("Start cluster:  %d\n", res.StartCluster)
+	printTextf("Parent cluster: %d\n", res.ParentCluster)
+	printTextf("Clusters:       %d\n", res.ClusterCount)
+	printTextf("Fragments:      %d\n", res.Fragments)
+	for _, run := range res.Runs {
+		printTextf("  clusters %d-%d\tbytes %d-%d\n", run.StartCluster, run.StartCluster+run.Count-1, run.StartOffset, run.EndOffset-1)
+	}
+	printTextf("Self reference: %s\n", res.SelfReference)
+
+	return res, nil
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/utils"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newStatTestFS returns the filesystem with the directory /d, the fragmented file /d/f (clusters 4-6 and 10)
+// and the file /g (clusters 8-9). The root chain is fragmented as well (clusters 0-1 and 7).
+func newStatTestFS(t *testing.T) *cmdTestFS {
+	t.Helper()
+
+	f := newCmdTestFS(t, "1MB")
+	f.run("mkdir /d")
+	f.writeFile("/d/f", make([]byte, 8000))
+	f.writeFile("/g", make([]byte, 10))
+	f.run("echo x >> /d/f")
+	return f
+}
+
+// getRunPayload returns the run of the clusters with the byte offsets in the filesystem file of the test.
+func getRunPayload(f *cmdTestFS, start uint32, count uint32) clusterRunPayload {
+	return clusterRunPayload{
+		StartCluster: start,
+		Count:        count,
+		StartOffset:  uint64(f.pFs.DataStartAddr) + uint64(start)*uint64(f.pFs.ClusterSize),
+		EndOffset:    uint64(f.pFs.DataStartAddr) + uint64(start+count)*uint64(f.pFs.ClusterSize),
+	}
+}
+
+func TestStat(t *testing.T) {
+	f := newStatTestFS(t)
+
+	tests := []struct {
+		input string
+		want  statPayload
+	}{
+		{"stat /", statPayload{Path: "/", Type: consts.EntryTypeDir, ClusterCount: 3, Fragments: 2,
+			Runs: []clusterRunPayload{getRunPayload(f, 0, 2), getRunPayload(f, 7, 1)}, SelfReference: consts.SelfRefNone}},
+		{"stat /d", statPayload{Path: "/d", Type: consts.EntryTypeDir, StartCluster: 2, ClusterCount: 2, Fragments: 1,
+			Runs: []clusterRunPayload{getRunPayload(f, 2, 2)}, SelfReference: consts.SelfRefMatch}},
+		{"stat /d/f", statPayload{Path: "/d/f", Type: consts.EntryTypeFile, Size: 8002, StartCluster: 4, ParentCluster: 2,
+			ClusterCount: 4, Fragments: 2, Runs: []clusterRunPayload{getRunPayload(f, 4, 3), getRunPayload(f, 10, 1)},
+			SelfReference: consts.SelfRefMatch}},
+		{"stat /g", statPayload{Path: "/g", Type: consts.EntryTypeFile, Size: 10, StartCluster: 8, ClusterCount: 2, Fragments: 1,
+			Runs: []clusterRunPayload{getRunPayload(f, 8, 2)}, SelfReference: consts.SelfRefMatch}},
+		{"stat /d/../d/./f", statPayload{Path: "/d/f", Type: consts.EntryTypeFile, Size: 8002, StartCluster: 4, ParentCluster: 2,
+			ClusterCount: 4, Fragments: 2, Runs: []clusterRunPayload{getRunPayload(f, 4, 3), getRunPayload(f, 10, 1)},
+			SelfReference: consts.SelfRefMatch}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			payload := f.run(tt.input)
+			if !reflect.DeepEqual(payload, tt.want) {
+				t.Errorf("payload %+v, want %+v", payload, tt.want)
+			}
+
+			// the runs cover the chain
+			var chain []uint32
+			for _, run := range tt.want.Runs {
+				for cluster := run.StartCluster; cluster < run.StartCluster+run.Count; cluster++ {
+					chain = append(chain, cluster)
+				}
+			}
+			if got := f.getChain(tt.want.Path); !reflect.DeepEqual(got, chain) {
+				t.Errorf("chain %v, runs %v", got, chain)
+			}
+		})
+	}
+
+	// relative to the current directory
+	f.run("cd /d")
+	if payload, ok := f.run("stat f").(statPayload); !ok || payload.Path != "/d/f" {
+		t.Errorf("relative path: payload %+v", payload)
+	}
+}
+
+func TestStatText(t *testing.T) {
+	f := newStatTestFS(t)
+
+	_, text, err := f.exec("stat /d/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"Path:           /d/f",
+		"Type:           file",
+		"Size:           8002",
+		"Start cluster:  4",
+		"Parent cluster: 2",
+		"Clusters:       4",
+		"Fragments:      2",
+		"  clusters 4-6\tbytes 18023-30022",
+		"  clusters 10-10\tbytes 42023-46022",
+		"Self reference: match",
+	}, "\n") + "\n"
+	if text != want {
+		t.Errorf("printed\n%s\nwant\n%s", text, want)
+	}
+}
+
+func TestStatSelfRefMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(selfRef []byte)
+	}{
+		{"size", func(selfRef []byte) {
+			pEntry, err := utils.ReadDirectoryEntryFromCluster(selfRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pEntry.Size++
+			entryBytes, err := utils.StructToBytes(*pEntry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			copy(selfRef, entryBytes)
+		}},
+		{"parent cluster", func(selfRef []byte) {
+			pEntry, err := utils.ReadDirectoryEntryFromCluster(selfRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pEntry.ParentCluster = 0
+			entryBytes, err := utils.StructToBytes(*pEntry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			copy(selfRef, entryBytes)
+		}},
+		{"zeroed", func(selfRef []byte) {
+			clear(selfRef)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newStatTestFS(t)
+			clusterSize := int(f.pFs.ClusterSize)
+			tt.corrupt(f.data[4*clusterSize : 5*clusterSize])
+
+			payload, ok := f.run("stat /d/f").(statPayload)
+			if !ok || payload.SelfReference != consts.SelfRefMismatch {
+				t.Errorf("payload %+v, want the self reference %s", payload, consts.SelfRefMismatch)
+			}
+			// the other entries are not affected
+			if payload, ok := f.run("stat /g").(statPayload); !ok || payload.SelfReference != consts.SelfRefMatch {
+				t.Errorf("/g: payload %+v", payload)
+			}
+		})
+	}
+}
+
+func TestStatErrors(t *testing.T) {
+	f := newStatTestFS(t)
+
+	tests := []struct {
+		input   string
+		wantErr error
+	}{
+		{"stat /none", custom_errors.ErrPathNotFound},
+		{"stat /g/x", custom_errors.ErrPathNotFound},
+		{"stat", custom_errors.ErrInvalArgsCount},
+		{"stat /d /g", custom_errors.ErrInvalArgsCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if _, _, err := f.exec(tt.input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,468 @@
+// command_text.go contains the implementation of the head, tail, wc, grep and hexdump commands
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// textArgs are the parsed arguments of the text commands
+type textArgs struct {
+	// lineCount is the number of the lines printed by head and tail
+	lineCount int
+	// byteCount is the number of the bytes printed by hexdump, -1 for the whole file
+	byteCount int
+	// cluster is the raw cluster printed by hexdump, -1 if a file is printed
+	cluster int64
+	// ignoreCase is true if grep matches case insensitively
+	ignoreCase bool
+	// lineNumbers is true if grep prints the line numbers
+	lineNumbers bool
+	// pPattern is the compiled grep pattern
+	pPattern *regexp.Regexp
+	// paths are the paths of the files
+	paths []string
+}
+
+// parseTextArgs parses the arguments of the text commands:
+//
+//	head|tail [-n N] s1 ...
+//	wc s1 ...
+//	grep [-i] [-n] PATTERN s1 ...
+//	hexdump|xxd [-n N] s1
+//	hexdump|xxd --cluster N
+func parseTextArgs(cmdName string, args []string) (*textArgs, error) {
+	res := &textArgs{lineCount: consts.DefaultLineCount, byteCount: -1, cluster: -1}
+
+	pattern := ""
+	hasPattern := cmdName != consts.GrepCommand
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		isHead := cmdName == consts.HeadCommand || cmdName == consts.TailCommand
+		isGrep := cmdName == consts.GrepCommand
+		isHexdump := cmdName == consts.HexdumpCommand || cmdName == consts.XxdCommand
+
+		switch {
+		case len(res.paths) == 0 && hasPattern && (isHead || isHexdump) &&
+			(arg == consts.LineCountOpt || arg == consts.HexdumpClusterOpt):
+			if i+1 >= len(args) {
+				return nil, custom_errors.ErrInvalArgsCount
+			}
+			value, err := strconv.Atoi(args[i+1])
+			if err != nil || value < 0 {
+				return nil, custom_errors.ErrInvalidOptionValue
+			}
+			i++
+
+			switch {
+			case arg == consts.HexdumpClusterOpt:
+				res.cluster = int64(value)
+			case isHead:
+				res.lineCount = value
+			default:
+				res.byteCount = value
+			}
+
+		case isGrep && !hasPattern && arg == consts.GrepIgnoreCaseOpt:
+			res.ignoreCase = true
+
+		case isGrep && !hasPattern && arg == consts.GrepLineNumberOpt:
+			res.lineNumbers = true
+
+		case !hasPattern:
+			pattern = arg
+			hasPattern = true
+
+		case strings.HasPrefix(arg, "-") && len(res.paths) == 0:
+			return nil, custom_errors.ErrUnknownOption
+
+		default:
+			err := validatePathFormat(arg)
+			if err != nil {
+				return nil, err
+			}
+			res.paths = append(res.paths, arg)
+		}
+	}
+
+	if !hasPattern {
+		return nil, custom_errors.ErrInvalArgsCount
+	}
+	if cmdName == consts.GrepCommand {
+		if res.ignoreCase {
+			pattern = consts.RegexpIgnoreCaseFlag + pattern
+		}
+
+		pPattern, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, custom_errors.ErrInvalidPattern
+		}
+		res.pPattern = pPattern
+	}
+
+	// hexdump prints either one file or one raw cluster
+	if cmdName == consts.HexdumpCommand || cmdName == consts.XxdCommand {
+		if (res.cluster < 0 && len(res.paths) != 1) || (res.cluster >= 0 && len(res.paths) != 0) {
+			return nil, custom_errors.ErrInvalArgsCount
+		}
+		return res, nil
+	}
+
+	if len(res.paths) == 0 {
+		return nil, custom_errors.ErrInvalArgsCount
+	}
+
+	return res, nil
+}
+
+// readLines calls the callback for each line of the reader (without the line terminator)
+// until the callback returns false.
+func readLines(reader io.Reader, callback func(line string) bool) error {
+	bufReader := bufio.NewReader(reader)
+	for {
+		line, err := bufReader.ReadString('\n')
+		if line != "" && !callback(strings.TrimSuffix(line, "\n")) {
+			return nil
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// headLines returns the first lineCount lines of the file.
+func headLines(pReader *utils.FileReader, lineCount int) ([]string, error) {
+	lines := make([]string, 0)
+	if lineCount == 0 {
+		return lines, nil
+	}
+
+	err := readLines(pReader, func(line string) bool {
+		lines = append(lines, line)
+		return len(lines) < lineCount
+	})
+
+	return lines, err
+}
+
+// tailLines returns the last lineCount lines of the file (only the last lines are kept while reading).
+func tailLines(pReader *utils.FileReader, lineCount int) ([]string, error) {
+	lines := make([]string, 0, lineCount)
+	if lineCount == 0 {
+		return lines, nil
+	}
+
+	err := readLines(pReader, func(line string) bool {
+		if len(lines) == lineCount {
+			lines = lines[1:]
+		}
+		lines = append(lines, line)
+		return true
+	})
+
+	return lines, err
+}
+
+// countWords returns the number of the lines, words and bytes of the file.
+func countWords(pReader *utils.FileReader) (wordCountPayload, error) {
+	res := wordCountPayload{Bytes: pReader.Size()}
+
+	inWord := false
+	bufReader := bufio.NewReader(pReader)
+	for {
+		r, _, err := bufReader.ReadRune()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return res, err
+		}
+
+		if r == '\n' {
+			res.Lines++
+		}
+		if unicode.IsSpace(r) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			res.Words++
+		}
+	}
+
+	return res, nil
+}
+
+// grepLines returns the lines of the file matching the pattern.
+func grepLines(pReader *utils.FileReader, path string, pPattern *regexp.Regexp) ([]grepMatchPayload, error) {
+	matches := make([]grepMatchPayload, 0)
+	lineNumber := 0
+	err := readLines(pReader, func(line string) bool {
+		lineNumber++
+		if pPattern.MatchString(line) {
+			matches = append(matches, grepMatchPayload{Path: path, Line: lineNumber, Text: line})
+		}
+		return true
+	})
+
+	return matches, err
+}
+
+// formatHexdumpLine returns the line of the canonical hex dump ("offset  hex bytes  |ascii|").
+func formatHexdumpLine(offset uint64, chunk []byte) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%08x ", offset)
+	for i := 0; i < consts.HexdumpBytesPerLine; i++ {
+		if i%(consts.HexdumpBytesPerLine/2) == 0 {
+			builder.WriteString(" ")
+		}
+		if i < len(chunk) {
+			fmt.Fprintf(&builder, "%02x ", chunk[i])
+		} else {
+			builder.WriteString("   ")
+		}
+	}
+
+	builder.WriteString(" |")
+	for _, b := range chunk {
+		if b >= ' ' && b <= '~' {
+			builder.WriteByte(b)
+		} else {
+			builder.WriteByte('.')
+		}
+	}
+	builder.WriteString("|")
+
+	return builder.String()
+}
+
+// hexdump prints the canonical hex dump of the reader (offsets start at the baseOffset).
+// The repeated lines are replaced by a single "*" line.
+//
+// It returns the dumped bytes in the JSON output mode (the payload is not printed otherwise,
+// so the text mode dumps the file without holding it in memory), nil in the text mode.
+func hexdump(reader io.Reader, baseOffset uint64) ([]byte, error) {
+	var dumped []byte
+	isCollecting := IsJSONOutput()
+	chunk := make([]byte, consts.HexdumpBytesPerLine)
+	var prevChunk []byte
+	isSqueezing := false
+	offset := baseOffset
+	for {
+		n, err := io.ReadFull(reader, chunk)
+		if n > 0 {
+			if n == len(chunk) && bytes.Equal(chunk, prevChunk) {
+				if !isSqueezing {
+					printText(consts.HexdumpSqueezeLine)
+					isSqueezing = true
+				}
+			} else {
+				printText(formatHexdumpLine(offset, chunk[:n]))
+				isSqueezing = false
+			}
+
+			prevChunk = append(prevChunk[:0], chunk[:n]...)
+			if isCollecting {
+				dumped = append(dumped, chunk[:n]...)
+			}
+			offset += uint64(n)
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	printTextf("%08x\n", offset)
+
+	return dumped, nil
+}
+
+// hexdumpCommand handles the hexdump and xxd commands.
+//
+// It prints the file content (or the raw cluster with --cluster) as the canonical hex dump.
+// The offsets of a raw cluster are the byte offsets within the filesystem file.
+func hexdumpCommand(args *textArgs, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	if args.cluster >= 0 {
+		if args.cluster >= int64(len(fatsRef[0])) {
+			return nil, custom_errors.ErrClusterOutOfRange
+		}
+
+		clusterSize := int64(pFs.ClusterSize)
+		clusterData := dataRef[args.cluster*clusterSize : (args.cluster+1)*clusterSize]
+		offset := utils.GetClusterOffset(pFs.DataStartAddr, pFs.ClusterSize, uint32(args.cluster))
+		dumped, err := hexdump(bytes.NewReader(clusterData), offset)
+		if err != nil {
+			return nil, err
+		}
+
+		return hexdumpPayload{Cluster: &args.cluster, Offset: offset, Data: hex.EncodeToString(dumped)}, nil
+	}
+
+	normAbsPath, err := makePathNormAbs(args.paths[0], pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, args.paths[0])
+	}
+	pReader, err := utils.NewFileReader(pFs, fatsRef, dataRef, normAbsPath)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, args.paths[0])
+	}
+
+	var reader io.Reader = pReader
+	if args.byteCount >= 0 {
+		reader = io.LimitReader(pReader, int64(args.byteCount))
+	}
+	dumped, err := hexdump(reader, 0)
+	if err != nil {
+		return nil, custom_errors.WithPath(err, args.paths[0])
+	}
+
+	return hexdumpPayload{Path: normAbsPath, Data: hex.EncodeToString(dumped)}, nil
+}
+
+// processTextFile executes the text command for one file and prints its output.
+func processTextFile(cmdName string, args *textArgs, path string, printHeader bool,
+	pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+
+	normAbsPath, err := makePathNormAbs(path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return nil, err
+	}
+	pReader, err := utils.NewFileReader(pFs, fatsRef, dataRef, normAbsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cmdName {
+	case consts.HeadCommand, consts.TailCommand:
+		var lines []string
+		if cmdName == consts.HeadCommand {
+			lines, err = headLines(pReader, args.lineCount)
+		} else {
+			lines, err = tailLines(pReader, args.lineCount)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if printHeader {
+			printTextf(consts.TextFileHeaderFormat, path)
+		}
+		for _, line := range lines {
+			printText(line)
+		}
+		return textLinesPayload{Path: path, Lines: lines}, nil
+
+	case consts.WordCountCommand:
+		counts, err := countWords(pReader)
+		if err != nil {
+			return nil, err
+		}
+		counts.Path = path
+
+		printTextf("%7d %7d %7d %s\n", counts.Lines, counts.Words, counts.Bytes, path)
+		return counts, nil
+
+	case consts.GrepCommand:
+		matches, err := grepLines(pReader, path, args.pPattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			prefix := ""
+			if printHeader {
+				prefix += match.Path + ":"
+			}
+			if args.lineNumbers {
+				prefix += strconv.Itoa(match.Line) + ":"
+			}
+			printText(prefix + match.Text)
+		}
+		return matches, nil
+	}
+
+	return nil, custom_errors.ErrUnknownCmd
+}
+
+// textCommand handles the head, tail, wc, grep and hexdump commands.
+//
+// The files are read through utils.FileReader (the content is not copied as a whole).
+// The glob patterns in the paths are expanded. A failure of one of the files is printed
+// and the rest of the files is processed (ErrPartialFailure is returned).
+func textCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	args, err := parseTextArgs(pCommand.Name, pCommand.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	if pCommand.Name == consts.HexdumpCommand || pCommand.Name == consts.XxdCommand {
+		return hexdumpCommand(args, pFs, fatsRef, dataRef)
+	}
+
+	paths := make([]string, 0, len(args.paths))
+	for _, pattern := range args.paths {
+		matches, err := globImagePaths(pattern, pFs, fatsRef, dataRef)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+
+	failed := false
+	results := make([]any, 0, len(paths))
+	totals := wordCountPayload{Path: consts.WordCountTotalName}
+	for _, path := range paths {
+		result, err := processTextFile(pCommand.Name, args, path, len(paths) > 1, pFs, fatsRef, dataRef)
+		if err != nil {
+			if len(paths) == 1 {
+				return nil, custom_errors.WithPath(err, path)
+			}
+
+			printTextf("%s: %s\n", path, custom_errors.GetUserMsg(err))
+			failed = true
+			continue
+		}
+		results = append(results, result)
+
+		if counts, ok := result.(wordCountPayload); ok {
+			totals.Lines += counts.Lines
+			totals.Words += counts.Words
+			totals.Bytes += counts.Bytes
+		}
+	}
+
+	if pCommand.Name == consts.WordCountCommand && len(paths) > 1 {
+		printTextf("%7d %7d %7d %s\n", totals.Lines, totals.Words, totals.Bytes, totals.Path)
+		results = append(results, totals)
+	}
+
+	var payload any = results
+	if len(paths) == 1 && len(results) == 1 {
+		payload = results[0]
+	}
+	if failed {
+		return payload, custom_errors.ErrPartialFailure
+	}
+
+	return payload, nil
+}
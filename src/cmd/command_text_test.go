@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/custom_errors"
+	"strings"
+	"testing"
+)
+
+func TestHexdumpCluster(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	lastCluster := len(f.fats[0]) - 1
+	clusterSize := uint64(f.pFs.ClusterSize)
+
+	tests := []struct {
+		input   string
+		cluster int
+		wantErr error
+	}{
+		{"hexdump --cluster 0", 0, nil},
+		{fmt.Sprintf("xxd --cluster %d", lastCluster), lastCluster, nil},
+		{fmt.Sprintf("hexdump --cluster %d", lastCluster+1), 0, custom_errors.ErrClusterOutOfRange},
+		{"hexdump --cluster 99999999999", 0, custom_errors.ErrClusterOutOfRange},
+		{"hexdump --cluster -1", 0, custom_errors.ErrInvalidOptionValue},
+		{"hexdump --cluster x", 0, custom_errors.ErrInvalidOptionValue},
+		{"hexdump --cluster", 0, custom_errors.ErrInvalArgsCount},
+		{"hexdump --cluster 1 /a", 0, custom_errors.ErrInvalArgsCount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			payload, text, err := f.exec(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			// the offsets are the byte offsets within the filesystem file
+			offset := uint64(f.pFs.DataStartAddr) + uint64(tt.cluster)*clusterSize
+			pPayload, ok := payload.(hexdumpPayload)
+			if !ok || pPayload.Cluster == nil || *pPayload.Cluster != int64(tt.cluster) || pPayload.Offset != offset {
+				t.Errorf("payload %+v", payload)
+			}
+			lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+			if !strings.HasPrefix(lines[0], fmt.Sprintf("%08x ", offset)) || lines[len(lines)-1] != fmt.Sprintf("%08x", offset+clusterSize) {
+				t.Errorf("printed %q ... %q", lines[0], lines[len(lines)-1])
+			}
+		})
+	}
+}
+
+func TestHexdumpFile(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	content := []byte(strings.Repeat("a", 40) + "xyz")
+	f.writeFile("/a", content)
+
+	want := strings.Join([]string{
+		"00000000  61 61 61 61 61 61 61 61  61 61 61 61 61 61 61 61  |aaaaaaaaaaaaaaaa|",
+		"*",
+		"00000020  61 61 61 61 61 61 61 61  78 79 7a                 |aaaaaaaaxyz|",
+		"0000002b",
+	}, "\n") + "\n"
+	payload, text, err := f.exec("hexdump /a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != want {
+		t.Errorf("printed\n%s\nwant\n%s", text, want)
+	}
+	// the bytes are collected for the JSON output only
+	if pPayload, ok := payload.(hexdumpPayload); !ok || pPayload.Path != "/a" || pPayload.Data != "" {
+		t.Errorf("text mode payload %+v", payload)
+	}
+
+	setJSONOutput(t)
+	payload, _, err = f.exec("hexdump -n 41 /a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pPayload, ok := payload.(hexdumpPayload); !ok || pPayload.Data != hex.EncodeToString(content[:41]) {
+		t.Errorf("JSON mode payload %+v", payload)
+	}
+}
@@ -4,6 +4,7 @@ package cmd
 import (
 	"kiv-zos-semestral-work/consts"
 	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/utils"
 	"strconv"
 	"strings"
 )
@@ -28,17 +29,24 @@ func validatePathFormat(path string) error {
 		return custom_errors.ErrEmptyPath
 	}
 
-	// check if the path is too long
+	// glob patterns are expanded before the execution
+	isPattern := utils.HasGlobMeta(path)
+	allowedCharacters := consts.AllowedPathCharacters
+	if isPattern {
+		allowedCharacters += consts.GlobPatternCharacters
+	}
+
+	// check if the path is too long (pattern segments can be longer than the names they match)
 	parts := strings.Split(path, consts.PathDelimiter)
 	for _, part := range parts {
-		if len(part) > consts.MaxFileNameLength {
+		if len(part) > consts.MaxFileNameLength && !utils.HasGlobMeta(part) {
 			return custom_errors.ErrPathTooLong
 		}
 	}
 
 	// check if the path format is valid
 	for _, c := range path {
-		if !strings.Contains(consts.AllowedPathCharacters, string(c)) {
+		if !strings.Contains(allowedCharacters, string(c)) {
 			return custom_errors.ErrInvalidPathCharacter
 		}
 	}
@@ -73,7 +81,8 @@ func getPathsCountForCommand(cmdName string) (int, error) {
 		consts.ConcatCommand,
 		consts.ChangeDirCommand,
 		consts.InfoCommand,
-		consts.InterpretScriptCommand,
+		consts.StatCommand,
+		consts.WriteCommand,
 		consts.BugCommand:
 		return 1, nil
 
@@ -143,6 +152,22 @@ func validateFormatCommand(cmd *Command) error {
 	return nil
 }
 
+// validateLoadCommand validates the load command (options followed by the script path)
+func validateLoadCommand(cmd *Command) error {
+	// check if the number of arguments is correct
+	if len(cmd.Args) < 1 {
+		return custom_errors.ErrInvalArgsCount
+	}
+
+	for _, opt := range cmd.Args[:len(cmd.Args)-1] {
+		if opt != consts.ScriptStopOnErrorOpt && opt != consts.ScriptContinueOnErrorOpt {
+			return custom_errors.ErrUnknownOption
+		}
+	}
+
+	return validatePathFormat(cmd.Args[len(cmd.Args)-1])
+}
+
 // ValidateCommand validates the command
 func ValidateCommand(cmd *Command) error {
 	// sanity check
@@ -162,7 +187,8 @@ func ValidateCommand(cmd *Command) error {
 		consts.HelpCommand,
 		consts.ExitCommand,
 		consts.CheckCommand,
-		consts.DebugCommand:
+		consts.DebugCommand,
+		consts.DiskFreeCommand:
 		return validateOneWordCommand(cmd)
 
 	// two or three word commands with only paths as arguments
@@ -173,19 +199,51 @@ func ValidateCommand(cmd *Command) error {
 		consts.ConcatCommand,
 		consts.ChangeDirCommand,
 		consts.InfoCommand,
-		consts.InterpretScriptCommand,
 		consts.CopyCommand,
 		consts.MoveCommand,
 		consts.CopyInsideFSCommand,
 		consts.CopyOutsideFSCommand,
+		consts.StatCommand,
+		consts.WriteCommand,
 		consts.BugCommand:
 		return validateArgPathsCommand(cmd)
 
 	// edge cases
-	case consts.FormatCommand:
+	case consts.FormatCommand, consts.ResizeCommand:
 		return validateFormatCommand(cmd)
-	case consts.ListCommand:
+	case consts.ListCommand, consts.DefragCommand:
 		return validateListCommand(cmd)
+	case consts.InterpretScriptCommand:
+		return validateLoadCommand(cmd)
+	case consts.FindCommand:
+		_, err := parseFindArgs(cmd.Args)
+		return err
+	case consts.Sha256sumCommand, consts.Md5sumCommand, consts.Crc32Command:
+		_, err := parseChecksumArgs(cmd.Args)
+		return err
+	case consts.CompareCommand, consts.DiffCommand:
+		_, err := parseCompareArgs(cmd.Name, cmd.Args)
+		return err
+	case consts.EchoCommand:
+		return validateEchoCommand(cmd)
+	case consts.CompactCommand:
+		_, err := parseCompactArgs(cmd.Args)
+		return err
+	case consts.TruncateCommand:
+		_, _, err := parseTruncateArgs(cmd.Args)
+		return err
+	case consts.TreeCommand, consts.DiskUsageCommand:
+		_, err := parseSpaceArgs(cmd.Name, cmd.Args)
+		return err
+	case
+		consts.HeadCommand,
+		consts.TailCommand,
+		consts.WordCountCommand,
+		consts.GrepCommand,
+		consts.HexdumpCommand,
+		consts.XxdCommand:
+		_, err := parseTextArgs(cmd.Name, cmd.Args)
+		return err
 
 	default:
 		return custom_errors.ErrUnknownCmd
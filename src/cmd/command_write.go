@@ -0,0 +1,166 @@
+// command_write.go contains the implementation of the echo, truncate and write commands
+package cmd
+
+import (
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"strings"
+)
+
+// getEchoRedirect splits the echo arguments into the text words, the redirection
+// operator (empty if none) and the target path. A quoted operator is a text word
+// (the attached operators are split by the parser, see ParseCommand).
+//
+// It returns ErrInvalArgsCount if the redirection is not followed by exactly one path.
+func getEchoRedirect(pCommand *Command) ([]string, string, string, error) {
+	args := pCommand.Args
+	idx := -1
+	for i, arg := range args {
+		if (arg == consts.RedirectWriteOp || arg == consts.RedirectAppendOp) && !pCommand.IsArgQuoted(i) {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return args, "", "", nil
+	}
+	if idx != len(args)-2 {
+		return nil, "", "", custom_errors.ErrInvalArgsCount
+	}
+
+	return args[:idx], args[idx], args[idx+1], nil
+}
+
+// validateEchoCommand validates the echo command ("echo [text...] [>|>> s1]")
+func validateEchoCommand(cmd *Command) error {
+	_, op, path, err := getEchoRedirect(cmd)
+	if err != nil || op == "" {
+		return err
+	}
+
+	return validatePathFormat(path)
+}
+
+// parseTruncateArgs parses the arguments of the truncate command ("truncate -s SIZE s1").
+func parseTruncateArgs(args []string) (uint32, string, error) {
+	if len(args) != 3 {
+		return 0, "", custom_errors.ErrInvalArgsCount
+	}
+	if args[0] != consts.TruncateSizeOpt {
+		return 0, "", custom_errors.ErrUnknownOption
+	}
+
+	size, err := parseByteSize(args[1])
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = validatePathFormat(args[2])
+	if err != nil {
+		return 0, "", err
+	}
+
+	return size, args[2], nil
+}
+
+// echoCommand handles the echo command.
+//
+// The text is printed, or written to the file with ">" (replacing its content)
+// or appended to the file with ">>". The file is created if it does not exist.
+func echoCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (bool, any, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return false, nil, custom_errors.ErrNilPointer
+	}
+
+	words, op, path, err := getEchoRedirect(pCommand)
+	if err != nil {
+		return false, nil, err
+	}
+
+	text := strings.Join(words, " ")
+	if op == "" {
+		printText(text)
+		return false, echoPayload{Text: text}, nil
+	}
+	if IsReadOnly {
+		return false, nil, custom_errors.ErrReadOnly
+	}
+
+	normAbsPath, err := makePathNormAbs(path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return false, nil, custom_errors.WithPath(err, path)
+	}
+
+	content := []byte(text + consts.ScriptDelimiter)
+	if op == consts.RedirectAppendOp {
+		err = utils.AppendFile(pFs, fatsRef, dataRef, normAbsPath, content)
+	} else {
+		err = utils.WriteFile(pFs, fatsRef, dataRef, normAbsPath, content)
+	}
+	if err != nil {
+		return false, nil, custom_errors.WithPath(err, path)
+	}
+
+	printText(consts.CmdSuccessMsg)
+	return true, nil, nil
+}
+
+// truncateCommand handles the truncate command.
+//
+// The file is shrunk or extended with zeros to the size (created if it does not exist).
+func truncateCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (bool, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return false, custom_errors.ErrNilPointer
+	}
+
+	size, path, err := parseTruncateArgs(pCommand.Args)
+	if err != nil {
+		return false, err
+	}
+
+	normAbsPath, err := makePathNormAbs(path, pFs, fatsRef, dataRef)
+	if err != nil {
+		return false, custom_errors.WithPath(err, path)
+	}
+
+	err = utils.TruncateFile(pFs, fatsRef, dataRef, normAbsPath, size)
+	if err != nil {
+		return false, custom_errors.WithPath(err, path)
+	}
+
+	return true, nil
+}
+
+// writeCommand handles the write command.
+//
+// The content of the file is replaced by the here-document of the command
+// (the file is created if it does not exist). It returns ErrMissingInput
+// if the command has no here-document (it is available only in the scripts).
+func writeCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) (bool, error) {
+	// sanity check
+	if pCommand == nil || pFs == nil || fatsRef == nil || dataRef == nil {
+		return false, custom_errors.ErrNilPointer
+	}
+	if len(pCommand.Args) != 1 {
+		return false, custom_errors.ErrInvalArgsCount
+	}
+	if pCommand.Input == nil {
+		return false, custom_errors.ErrMissingInput
+	}
+
+	normAbsPath, err := makePathNormAbs(pCommand.Args[0], pFs, fatsRef, dataRef)
+	if err != nil {
+		return false, custom_errors.WithPath(err, pCommand.Args[0])
+	}
+
+	err = utils.WriteFile(pFs, fatsRef, dataRef, normAbsPath, pCommand.Input)
+	if err != nil {
+		return false, custom_errors.WithPath(err, pCommand.Args[0])
+	}
+
+	return true, nil
+}
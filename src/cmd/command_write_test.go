@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"kiv-zos-semestral-work/custom_errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetEchoRedirect(t *testing.T) {
+	tests := []struct {
+		args      string
+		wantWords []string
+		wantOp    string
+		wantPath  string
+		wantErr   error
+	}{
+		{"", []string{}, "", "", nil},
+		{"hello world", []string{"hello", "world"}, "", "", nil},
+		{"hello > f", []string{"hello"}, ">", "f", nil},
+		{"a b >> /d/f", []string{"a", "b"}, ">>", "/d/f", nil},
+		{"> f", []string{}, ">", "f", nil},
+
+		{"hello >", nil, "", "", custom_errors.ErrInvalArgsCount},
+		{"hello > f g", nil, "", "", custom_errors.ErrInvalArgsCount},
+		{"> f > g", nil, "", "", custom_errors.ErrInvalArgsCount},
+
+		// the attached operators are split by the parser
+		{"hello >f", []string{"hello"}, ">", "f", nil},
+		{"hello>>f", []string{"hello"}, ">>", "f", nil},
+		{"a b>> /d/f", []string{"a", "b"}, ">>", "/d/f", nil},
+		{"hello >f g", nil, "", "", custom_errors.ErrInvalArgsCount},
+		{"hello >f>g", nil, "", "", custom_errors.ErrInvalArgsCount},
+
+		// the quoted operators are the text
+		{`">" f`, []string{">", "f"}, "", "", nil},
+		{`'a > b' >> f`, []string{"a > b"}, ">>", "f", nil},
+		{`">>" > f`, []string{">>"}, ">", "f", nil},
+		{`"x>"y`, []string{"x>y"}, "", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			pCommand, err := ParseCommand("echo " + tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			words, op, path, err := getEchoRedirect(pCommand)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(words, tt.wantWords) || op != tt.wantOp || path != tt.wantPath {
+				t.Errorf("got %q %q %q, want %q %q %q", words, op, path, tt.wantWords, tt.wantOp, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestEcho(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	f.run("mkdir /d")
+
+	payload, text, err := f.exec("echo hello  world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload != (echoPayload{Text: "hello world"}) || text != "hello world\n" {
+		t.Errorf("payload %+v, printed %q", payload, text)
+	}
+
+	steps := []struct {
+		pwd   string
+		input string
+		path  string
+		want  string
+	}{
+		{"/", "echo first > /d/f", "/d/f", "first\n"},
+		{"/", "echo second line > /d/f", "/d/f", "second line\n"},
+		{"/", "echo third >> /d/f", "/d/f", "second line\nthird\n"},
+		{"/d", "echo fourth >> f", "/d/f", "second line\nthird\nfourth\n"},
+		{"/d", "echo new >> ../new", "/new", "new\n"},
+		{"/", "echo > /empty", "/empty", "\n"},
+		{"/", "echo attached >/d/f", "/d/f", "attached\n"},
+		{"/d", "echo more>>f", "/d/f", "attached\nmore\n"},
+		{"/", `echo "a  >  b" '>' c >> /d/f`, "/d/f", "attached\nmore\na  >  b > c\n"},
+	}
+	for _, step := range steps {
+		f.run("cd " + step.pwd)
+		_, text, err := f.exec(step.input)
+		if err != nil {
+			t.Fatalf("%s: %v", step.input, err)
+		}
+		if text != "OK\n" {
+			t.Errorf("%s: printed %q", step.input, text)
+		}
+		if got := string(f.readFile(step.path)); got != step.want {
+			t.Errorf("%s: content %q, want %q", step.input, got, step.want)
+		}
+	}
+	f.checkUsage()
+}
+
+func TestEchoErrors(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	f.run("mkdir /d")
+	f.writeFile("/f", []byte("kept\n"))
+
+	tests := []struct {
+		input   string
+		wantErr error
+	}{
+		{"echo x >", custom_errors.ErrInvalArgsCount},
+		{"echo x > /f /g", custom_errors.ErrInvalArgsCount},
+		{"echo x > /d", custom_errors.ErrIsDir},
+		{"echo x >> /d", custom_errors.ErrIsDir},
+		{"echo x > /none/f", custom_errors.ErrPathNotFound},
+		{"echo x >/f >/g", custom_errors.ErrInvalArgsCount},
+		{`echo "x > /f`, custom_errors.ErrUnterminatedQuote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if _, _, err := f.exec(tt.input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	IsReadOnly = true
+	defer func() {
+		IsReadOnly = false
+	}()
+	if _, _, err := f.exec("echo x > /f"); !errors.Is(err, custom_errors.ErrReadOnly) {
+		t.Errorf("read-only echo: error %v, want %v", err, custom_errors.ErrReadOnly)
+	}
+	// printing is allowed in the read-only mode
+	if _, text, err := f.exec("echo x"); err != nil || text != "x\n" {
+		t.Errorf("read-only echo without redirect: printed %q, error %v", text, err)
+	}
+	if got := string(f.readFile("/f")); got != "kept\n" {
+		t.Errorf("content %q changed by failed commands", got)
+	}
+}
+
+func TestEchoAppendExtendsChain(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+
+	// the file fills its data cluster up to the last byte and the next cluster is taken
+	f.writeFile("/f", bytes.Repeat([]byte("a"), 3998))
+	f.writeFile("/other", []byte("x"))
+	chain := f.getChain("/f")
+	if len(chain) != 2 {
+		t.Fatalf("chain %v, want self reference and one data cluster", chain)
+	}
+
+	f.run("echo b >> /f")
+	extended := f.getChain("/f")
+	if len(extended) != 2 || !slices.Equal(extended, chain) {
+		t.Errorf("chain %v after the append fitting the last cluster, want %v", extended, chain)
+	}
+
+	f.run("echo c >> /f")
+	extended = f.getChain("/f")
+	if len(extended) != 3 || !slices.Equal(extended[:2], chain) {
+		t.Errorf("chain %v after the append over the cluster, want %v extended", extended, chain)
+	}
+
+	want := strings.Repeat("a", 3998) + "b\nc\n"
+	if got := string(f.readFile("/f")); got != want {
+		t.Errorf("content of %d bytes, want %d", len(got), len(want))
+	}
+	if got := string(f.readFile("/other")); got != "x" {
+		t.Errorf("other file content %q", got)
+	}
+	f.checkUsage()
+}
+
+func TestParseTruncateArgs(t *testing.T) {
+	tests := []struct {
+		args     string
+		wantSize uint32
+		wantPath string
+		wantErr  error
+	}{
+		{"-s 0 f", 0, "f", nil},
+		{"-s 100 /a/f", 100, "/a/f", nil},
+		{"-s 5KB f", 5000, "f", nil},
+
+		{"", 0, "", custom_errors.ErrInvalArgsCount},
+		{"-s 10", 0, "", custom_errors.ErrInvalArgsCount},
+		{"-s 10 f g", 0, "", custom_errors.ErrInvalArgsCount},
+		{"-x 10 f", 0, "", custom_errors.ErrUnknownOption},
+		{"-s -1 f", 0, "", custom_errors.ErrInvalidOptionValue},
+		{"-s abc f", 0, "", custom_errors.ErrInvalidOptionValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			size, path, err := parseTruncateArgs(strings.Fields(tt.args))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if size != tt.wantSize || path != tt.wantPath {
+				t.Errorf("got %d %q, want %d %q", size, path, tt.wantSize, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	content := make([]byte, 9000)
+	for i := range content {
+		content[i] = byte(i%250 + 1)
+	}
+	f.writeFile("/f", content)
+	free := f.checkUsage().Free
+
+	steps := []struct {
+		input      string
+		path       string
+		want       []byte
+		wantChain  int
+		wantChange uint32
+	}{
+		{"truncate -s 4001 /f", "/f", content[:4001], 3, 1},
+		{"truncate -s 10 /f", "/f", content[:10], 2, 2},
+		{"truncate -s 10 /f", "/f", content[:10], 2, 2},
+		{"truncate -s 8KB /f", "/f", append(slices.Clone(content[:10]), make([]byte, 7990)...), 3, 1},
+		{"truncate -s 0 /f", "/f", []byte{}, 1, 3},
+		{"truncate -s 5 /new", "/new", make([]byte, 5), 2, 0},
+	}
+	for _, step := range steps {
+		f.run(step.input)
+
+		if got := f.readFile(step.path); !bytes.Equal(got, step.want) {
+			t.Errorf("%s: content of %d bytes differs (want %d)", step.input, len(got), len(step.want))
+		}
+		if chain := f.getChain(step.path); len(chain) != step.wantChain {
+			t.Errorf("%s: chain %v, want %d clusters", step.input, chain, step.wantChain)
+		}
+		if got := f.checkUsage().Free; got != free+step.wantChange {
+			t.Errorf("%s: %d free clusters, want %d", step.input, got, free+step.wantChange)
+		}
+	}
+}
+
+func TestTruncateErrors(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	f.run("mkdir /d")
+	f.writeFile("/f", []byte("kept"))
+
+	tests := []struct {
+		input   string
+		wantErr error
+	}{
+		{"truncate -s 10 /d", custom_errors.ErrIsDir},
+		{"truncate -s 10 /none/f", custom_errors.ErrPathNotFound},
+		{"truncate -s 10MB /f", custom_errors.ErrNoFreeCluster},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if _, _, err := f.exec(tt.input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := string(f.readFile("/f")); got != "kept" {
+		t.Errorf("content %q changed by failed commands", got)
+	}
+	f.checkUsage()
+}
+
+func TestWrite(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	f.run("mkdir /d")
+	f.run("cd /d")
+
+	long := bytes.Repeat([]byte("line of the here-document\n"), 400)
+	for _, step := range []struct {
+		input   string
+		heredoc []byte
+		path    string
+	}{
+		{"write f", []byte("first\n"), "/d/f"},
+		{"write /d/f", long, "/d/f"},
+		{"write f", []byte("short\n"), "/d/f"},
+		{"write ../empty", []byte{}, "/empty"},
+	} {
+		if _, _, err := f.execWithInput(step.input, step.heredoc); err != nil {
+			t.Fatalf("%s: %v", step.input, err)
+		}
+		if got := f.readFile(step.path); !bytes.Equal(got, step.heredoc) {
+			t.Errorf("%s: content of %d bytes, want %d", step.input, len(got), len(step.heredoc))
+		}
+		f.checkUsage()
+	}
+	if chain := f.getChain("/d/f"); len(chain) != 2 {
+		t.Errorf("chain %v of the rewritten file, want 2 clusters", chain)
+	}
+
+	tests := []struct {
+		input   string
+		heredoc []byte
+		wantErr error
+	}{
+		{"write f", nil, custom_errors.ErrMissingInput},
+		{"write", []byte("x"), custom_errors.ErrInvalArgsCount},
+		{"write f g", []byte("x"), custom_errors.ErrInvalArgsCount},
+		{"write /d", []byte("x"), custom_errors.ErrIsDir},
+		{"write /none/f", []byte("x"), custom_errors.ErrPathNotFound},
+		{"write f", make([]byte, 2_000_000), custom_errors.ErrNoFreeCluster},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if _, _, err := f.execWithInput(tt.input, tt.heredoc); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := string(f.readFile("/d/f")); got != "short\n" {
+		t.Errorf("content %q changed by failed commands", got)
+	}
+	f.checkUsage()
+}
+
+// TestWriteHeredocScript writes the files by the here-documents of a script.
+func TestWriteHeredocScript(t *testing.T) {
+	dir := chdirTemp(t)
+	writeHostFile(t, dir, "main.txt", "mkdir d\nwrite d/f <<EOF\nfirst\n  indented\nEOF\necho end >> d/f\n")
+
+	f := newCmdTestFS(t, "1MB")
+	f.run("load main.txt")
+
+	want := "first\n  indented\nend\n"
+	if got := string(f.readFile("/d/f")); got != want {
+		t.Errorf("content %q, want %q", got, want)
+	}
+}
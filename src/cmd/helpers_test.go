@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	devNull, err := os.Open(os.DevNull)
+	if err == nil {
+		logging.SetOutput(devNull)
+	}
+
+	os.Exit(m.Run())
+}
+
+// cmdTestFS is an in-memory filesystem formatted by the format command
+type cmdTestFS struct {
+	pFs     *pseudo_fat.FileSystem
+	fats    [][]int32
+	data    []byte
+	tb      testing.TB
+	endFlag chan struct{}
+}
+
+// newCmdTestFS formats the filesystem of the size ("format SIZE") with the root as the current directory.
+func newCmdTestFS(tb testing.TB, size string) *cmdTestFS {
+	tb.Helper()
+
+	P_CurrDir = nil
+	IsReadOnly = false
+	f := &cmdTestFS{pFs: &pseudo_fat.FileSystem{}, tb: tb, endFlag: make(chan struct{})}
+	f.run("format " + size)
+	return f
+}
+
+// exec parses, validates and executes the command line like the shell does.
+// It returns the payload of the result, the printed text and the error.
+func (f *cmdTestFS) exec(input string) (any, string, error) {
+	f.tb.Helper()
+	return f.execWithInput(input, nil)
+}
+
+// execWithInput executes the command line with the here-document input (see exec).
+func (f *cmdTestFS) execWithInput(input string, heredoc []byte) (any, string, error) {
+	f.tb.Helper()
+
+	pCommand, err := ParseCommand(input)
+	if err != nil {
+		return nil, "", err
+	}
+	pCommand.Input = heredoc
+	if err = ValidateCommand(pCommand); err != nil {
+		return nil, "", err
+	}
+
+	var payload any
+	text := captureStdout(f.tb, func() {
+		if P_CurrDir == nil {
+			_, payload, err = handleUninitializedFSCmd(f.pFs, &f.fats, &f.data, pCommand, f.endFlag)
+		} else {
+			_, payload, err = handleInitializedFSCmd(f.pFs, &f.fats, &f.data, pCommand, f.endFlag)
+		}
+	})
+	return payload, text, err
+}
+
+// run executes the command line and returns its payload, the test fails if the command fails.
+func (f *cmdTestFS) run(input string) any {
+	f.tb.Helper()
+
+	payload, _, err := f.exec(input)
+	if err != nil {
+		f.tb.Fatalf("%s: %v", input, err)
+	}
+	return payload
+}
+
+// readFile returns the content of the file or fails the test.
+func (f *cmdTestFS) readFile(absPath string) []byte {
+	f.tb.Helper()
+
+	content, err := utils.GetFileBytes(f.pFs, f.fats, f.data, absPath)
+	if err != nil {
+		f.tb.Fatalf("read %s: %v", absPath, err)
+	}
+	return content
+}
+
+// writeFile writes the file or fails the test.
+func (f *cmdTestFS) writeFile(absPath string, content []byte) {
+	f.tb.Helper()
+
+	if err := utils.WriteFile(f.pFs, f.fats, f.data, absPath, content); err != nil {
+		f.tb.Fatalf("write %s: %v", absPath, err)
+	}
+}
+
+// getChain returns the cluster chain of the entry or fails the test.
+func (f *cmdTestFS) getChain(absPath string) []uint32 {
+	f.tb.Helper()
+
+	branch, err := utils.GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, absPath)
+	if err != nil {
+		f.tb.Fatalf("entry %s: %v", absPath, err)
+	}
+	chain, err := utils.GetClusterChain(branch[len(branch)-1].StartCluster, f.fats[0])
+	if err != nil {
+		f.tb.Fatalf("chain of %s: %v", absPath, err)
+	}
+	return chain
+}
+
+// checkUsage fails the test if the usage counters do not match a rescan of the FAT
+// and returns the rescanned usage.
+func (f *cmdTestFS) checkUsage() utils.FatUsage {
+	f.tb.Helper()
+
+	expected := utils.FatUsage{Total: uint32(len(f.fats[0]))}
+	for _, value := range f.fats[0] {
+		switch value {
+		case consts.FatFree:
+			expected.Free++
+		case consts.FatBadCluster:
+			expected.Bad++
+		default:
+			expected.Used++
+		}
+	}
+
+	if got := utils.GetFatUsage(f.fats[0]); got != expected {
+		f.tb.Fatalf("usage counters %+v, rescan %+v", got, expected)
+	}
+	return expected
+}
+
+// checkFS fails the test if the check command reports a problem, the FATs differ, a used cluster
+// is not owned by exactly one chain (of an entry or a directory index) or the usage counters are stale.
+func (f *cmdTestFS) checkFS() {
+	f.tb.Helper()
+
+	if _, text, err := f.exec("check"); err != nil || text != consts.CmdSuccessMsg+"\n" {
+		f.tb.Fatalf("check: %q, error %v", text, err)
+	}
+
+	for i := 1; i < len(f.fats); i++ {
+		if !slices.Equal(f.fats[i], f.fats[0]) {
+			f.tb.Fatalf("FAT %d differs from FAT 0", i)
+		}
+	}
+
+	pRoot, err := utils.GetRootDirEntry(f.pFs, f.fats, f.data)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	owners := make(map[uint32]string)
+	own := func(clusters []uint32, owner string) {
+		for _, cluster := range clusters {
+			if other, found := owners[cluster]; found {
+				f.tb.Fatalf("cluster %d is shared by %s and %s", cluster, other, owner)
+			}
+			owners[cluster] = owner
+		}
+	}
+	var walk func(pEntry *pseudo_fat.DirectoryEntry, path string)
+	walk = func(pEntry *pseudo_fat.DirectoryEntry, path string) {
+		chain, err := utils.GetClusterChain(pEntry.StartCluster, f.fats[0])
+		if err != nil {
+			f.tb.Fatalf("chain of %s: %v", path, err)
+		}
+		own(chain, path)
+		if pEntry.IsFile {
+			return
+		}
+
+		indexClusters, err := utils.GetDirIndexClusters(f.pFs, f.fats, f.data, pEntry)
+		if err != nil {
+			f.tb.Fatalf("index of %s: %v", path, err)
+		}
+		own(indexClusters, path+" (index)")
+
+		children, err := utils.GetDirEntries(f.pFs, pEntry, f.fats, f.data)
+		if err != nil {
+			f.tb.Fatalf("entries of %s: %v", path, err)
+		}
+		for _, pChild := range children {
+			walk(pChild, utils.JoinAbsPath(path, utils.GetNormalizedStrFromMem(pChild.Name[:])))
+		}
+	}
+	walk(pRoot, consts.PathDelimiter)
+
+	for cluster, value := range f.fats[0] {
+		used := value != consts.FatFree && value != consts.FatBadCluster
+		if _, found := owners[uint32(cluster)]; used != found {
+			f.tb.Fatalf("cluster %d (FAT value %d) owned: %v", cluster, value, found)
+		}
+	}
+
+	f.checkUsage()
+}
+
+// checkContents fails the test if the content of a file differs from the expected one.
+func (f *cmdTestFS) checkContents(contents map[string][]byte) {
+	f.tb.Helper()
+
+	for path, content := range contents {
+		if got := f.readFile(path); !bytes.Equal(got, content) {
+			f.tb.Fatalf("content of %s (%d bytes) differs from the written one (%d bytes)", path, len(got), len(content))
+		}
+	}
+}
+
+// populateFragmented fills the filesystem with the fragmented chains and returns the contents of the files:
+// the files of /a (indexed with more than 256 of them) are written alternately with the files of /b,
+// every other file of /b is removed and the freed runs are reused by /big and the appends to /a/f1.
+func (f *cmdTestFS) populateFragmented(aCount int, bCount int) map[string][]byte {
+	f.tb.Helper()
+
+	contents := make(map[string][]byte)
+	write := func(path string, content []byte) {
+		f.writeFile(path, content)
+		contents[path] = content
+	}
+
+	f.run("mkdir /a")
+	f.run("mkdir /b")
+	for i := range max(aCount, bCount) {
+		if i < aCount {
+			write(fmt.Sprintf("/a/f%d", i), []byte(fmt.Sprintf("file %d of a\n", i)))
+		}
+		if i < bCount {
+			write(fmt.Sprintf("/b/g%d", i), bytes.Repeat([]byte{byte(i)}, 4000+i))
+		}
+	}
+	for i := 0; i < bCount; i += 2 {
+		path := fmt.Sprintf("/b/g%d", i)
+		f.run("rm " + path)
+		delete(contents, path)
+	}
+
+	usage := f.checkUsage()
+	big := make([]byte, int(usage.Free)/2*int(f.pFs.ClusterSize))
+	for i := range big {
+		big[i] = byte(i % 251)
+	}
+	write("/big", big)
+
+	for i := range 3 {
+		line := fmt.Sprintf("appended line %d\n", i)
+		f.run("echo " + line[:len(line)-1] + " >> /a/f1")
+		contents["/a/f1"] = append(contents["/a/f1"], line...)
+		f.run(fmt.Sprintf("truncate -s %d /a/f1", len(contents["/a/f1"])+4000))
+		contents["/a/f1"] = append(contents["/a/f1"], make([]byte, 4000)...)
+	}
+
+	return contents
+}
+
+// captureStdout returns the text printed to the standard output by the function.
+func captureStdout(tb testing.TB, fn func()) string {
+	tb.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.Bytes()
+	}()
+
+	defer func() {
+		os.Stdout = stdout
+	}()
+	fn()
+	w.Close()
+	text := <-done
+	r.Close()
+
+	return string(text)
+}
+
+// chdirTemp changes the working directory to a new temporary directory until the test ends,
+// so the host files are given by short relative paths (the path segments are limited in length).
+func chdirTemp(tb testing.TB) string {
+	tb.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	dir := tb.TempDir()
+	if err = os.Chdir(dir); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	return dir
+}
+
+// writeHostFile writes the file to the test directory on the host and returns its path.
+func writeHostFile(tb testing.TB, dir string, name string, content string) string {
+	tb.Helper()
+
+	path := dir + string(os.PathSeparator) + name
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
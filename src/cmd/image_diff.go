@@ -0,0 +1,286 @@
+// image_diff.go contains the comparison of two filesystem files (the diff mode of the program)
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"sort"
+	"strings"
+)
+
+// DiffImage is a loaded filesystem file compared by DiffImages
+type DiffImage struct {
+	// Path is the path of the filesystem file on the host
+	Path string
+	// PFs is the loaded filesystem
+	PFs *pseudo_fat.FileSystem
+	// Fats are the loaded FATs (nil for an uninitialized filesystem)
+	Fats [][]int32
+	// Data is the loaded data region (nil for an uninitialized filesystem)
+	Data []byte
+}
+
+// isInitialized returns true if the image contains a formatted filesystem.
+func (img *DiffImage) isInitialized() bool {
+	return img.Fats != nil && img.Data != nil
+}
+
+// imageTreeEntry is an entry of the filesystem tree compared by DiffImages
+type imageTreeEntry struct {
+	// pEntry is the directory entry
+	pEntry *pseudo_fat.DirectoryEntry
+	// absPath is the absolute path of the entry
+	absPath string
+}
+
+// getSuperblockFields returns the names and the values of the superblock fields.
+func getSuperblockFields(pFs *pseudo_fat.FileSystem) [][2]string {
+	return [][2]string{
+		{"Signature", utils.GetNormalizedStrFromMem(pFs.Signature[:])},
+		{"DiskSize", fmt.Sprint(pFs.DiskSize)},
+		{"ClusterSize", fmt.Sprint(pFs.ClusterSize)},
+		{"FatCount", fmt.Sprint(pFs.FatCount)},
+		{"Fat01StartAddr", fmt.Sprint(pFs.Fat01StartAddr)},
+		{"Fat02StartAddr", fmt.Sprint(pFs.Fat02StartAddr)},
+		{"DataStartAddr", fmt.Sprint(pFs.DataStartAddr)},
+	}
+}
+
+// listImageEntries returns the entries of the whole filesystem tree mapped by their absolute paths
+// (the root directory is not included).
+func listImageEntries(img *DiffImage) (map[string]imageTreeEntry, error) {
+	res := make(map[string]imageTreeEntry)
+	if !img.isInitialized() {
+		return res, nil
+	}
+
+	pRoot, err := utils.GetRootDirEntry(img.PFs, img.Fats, img.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := []imageTreeEntry{{pEntry: pRoot, absPath: consts.PathDelimiter}}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+
+		children, err := utils.GetDirEntries(img.PFs, curr.pEntry, img.Fats, img.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pChild := range children {
+			child := imageTreeEntry{
+				pEntry:  pChild,
+				absPath: utils.JoinAbsPath(curr.absPath, utils.GetNormalizedStrFromMem(pChild.Name[:])),
+			}
+			res[child.absPath] = child
+			if !pChild.IsFile {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// getImageFileHash returns the SHA-256 of the file content in the image.
+func getImageFileHash(img *DiffImage, absPath string) ([]byte, error) {
+	pReader, err := utils.NewFileReader(img.PFs, img.Fats, img.Data, absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(h, pReader)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// diffImagePaths compares the trees of the images and records the added, removed and modified paths.
+func diffImagePaths(first *DiffImage, second *DiffImage, pPayload *imageDiffPayload) error {
+	firstEntries, err := listImageEntries(first)
+	if err != nil {
+		return custom_errors.WithPath(err, first.Path)
+	}
+	secondEntries, err := listImageEntries(second)
+	if err != nil {
+		return custom_errors.WithPath(err, second.Path)
+	}
+
+	paths := make([]string, 0, len(firstEntries)+len(secondEntries))
+	for path := range firstEntries {
+		paths = append(paths, path)
+	}
+	for path := range secondEntries {
+		if _, found := firstEntries[path]; !found {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		firstEntry, inFirst := firstEntries[path]
+		secondEntry, inSecond := secondEntries[path]
+
+		switch {
+		case !inFirst:
+			printTextf("%s: %s\n", consts.DiffAddedStatus, path)
+			pPayload.Added = append(pPayload.Added, path)
+		case !inSecond:
+			printTextf("%s: %s\n", consts.DiffRemovedStatus, path)
+			pPayload.Removed = append(pPayload.Removed, path)
+		case firstEntry.pEntry.IsFile != secondEntry.pEntry.IsFile:
+			printTextf("%s: %s (%s -> %s)\n", consts.DiffModifiedStatus, path,
+				getEntryTypeName(firstEntry.pEntry), getEntryTypeName(secondEntry.pEntry))
+			pPayload.Modified = append(pPayload.Modified, path)
+		case !firstEntry.pEntry.IsFile:
+			// the directories are compared by their children
+		case firstEntry.pEntry.Size != secondEntry.pEntry.Size:
+			printTextf("%s: %s (size %d -> %d)\n", consts.DiffModifiedStatus, path,
+				firstEntry.pEntry.Size, secondEntry.pEntry.Size)
+			pPayload.Modified = append(pPayload.Modified, path)
+		default:
+			firstHash, err := getImageFileHash(first, path)
+			if err != nil {
+				return custom_errors.WithPath(err, path)
+			}
+			secondHash, err := getImageFileHash(second, path)
+			if err != nil {
+				return custom_errors.WithPath(err, path)
+			}
+
+			if !bytes.Equal(firstHash, secondHash) {
+				printTextf("%s: %s (content)\n", consts.DiffModifiedStatus, path)
+				pPayload.Modified = append(pPayload.Modified, path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// diffImageFats compares the FATs of the images entry by entry (up to the shorter FAT).
+func diffImageFats(first *DiffImage, second *DiffImage, pPayload *imageDiffPayload) {
+	if !first.isInitialized() || !second.isInitialized() {
+		return
+	}
+
+	for i := range min(len(first.Fats), len(second.Fats)) {
+		firstFat, secondFat := first.Fats[i], second.Fats[i]
+		for cluster := range min(len(firstFat), len(secondFat)) {
+			if firstFat[cluster] == secondFat[cluster] {
+				continue
+			}
+
+			printTextf(consts.ImageDiffFatFormat, i, cluster, firstFat[cluster], secondFat[cluster])
+			pPayload.Fats = append(pPayload.Fats, fatDiffPayload{
+				Fat:     i,
+				Cluster: uint32(cluster),
+				First:   firstFat[cluster],
+				Second:  secondFat[cluster],
+			})
+		}
+	}
+}
+
+// diffImageClusters compares the data regions of the images cluster by cluster
+// (up to the smaller data region) and records the runs of the differing clusters.
+func diffImageClusters(first *DiffImage, second *DiffImage, pPayload *imageDiffPayload) {
+	if !first.isInitialized() || !second.isInitialized() {
+		return
+	}
+
+	clusterSize := int(first.PFs.ClusterSize)
+	if clusterSize == 0 || second.PFs.ClusterSize != first.PFs.ClusterSize {
+		// the clusters do not correspond (the superblock difference is reported)
+		return
+	}
+
+	clusterCount := min(len(first.Data), len(second.Data)) / clusterSize
+	differing := make([]uint32, 0)
+	for cluster := range clusterCount {
+		start := cluster * clusterSize
+		if !bytes.Equal(first.Data[start:start+clusterSize], second.Data[start:start+clusterSize]) {
+			differing = append(differing, uint32(cluster))
+		}
+	}
+
+	// the byte offsets are within the first filesystem file
+	for _, run := range utils.GetClusterRuns(differing) {
+		printTextf(consts.ImageDiffClustersFormat, run.Start, run.Start+run.Count-1)
+		pPayload.Clusters = append(pPayload.Clusters, clusterRunPayload{
+			StartCluster: run.Start,
+			Count:        run.Count,
+			StartOffset:  utils.GetClusterOffset(first.PFs.DataStartAddr, first.PFs.ClusterSize, run.Start),
+			EndOffset:    utils.GetClusterOffset(first.PFs.DataStartAddr, first.PFs.ClusterSize, run.Start+run.Count),
+		})
+	}
+}
+
+// DiffImages compares the two filesystem files and prints the differing superblock fields,
+// the added, removed and modified paths, the differing FAT entries and (with listClusters)
+// the runs of the differing data clusters. In the JSON output mode one result is printed.
+//
+// It returns ErrFilesDiffer if the filesystems are not the same.
+func DiffImages(first *DiffImage, second *DiffImage, listClusters bool) error {
+	// sanity check
+	if first == nil || second == nil || first.PFs == nil || second.PFs == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	payload := imageDiffPayload{
+		Superblock: []superblockDiffPayload{},
+		Added:      []string{},
+		Removed:    []string{},
+		Modified:   []string{},
+		Fats:       []fatDiffPayload{},
+	}
+	input := strings.Join([]string{consts.ImageDiffMode, first.Path, second.Path}, " ")
+
+	firstFields, secondFields := getSuperblockFields(first.PFs), getSuperblockFields(second.PFs)
+	for i := range firstFields {
+		if firstFields[i][1] == secondFields[i][1] {
+			continue
+		}
+
+		printTextf(consts.ImageDiffFieldFormat, firstFields[i][0], firstFields[i][1], secondFields[i][1])
+		payload.Superblock = append(payload.Superblock, superblockDiffPayload{
+			Field:  firstFields[i][0],
+			First:  firstFields[i][1],
+			Second: secondFields[i][1],
+		})
+	}
+
+	err := diffImagePaths(first, second, &payload)
+	if err != nil {
+		PrintResult(NewCommandResult(input, nil, err))
+		return err
+	}
+
+	diffImageFats(first, second, &payload)
+	if listClusters {
+		payload.Clusters = []clusterRunPayload{}
+		diffImageClusters(first, second, &payload)
+	}
+
+	if len(payload.Superblock)+len(payload.Added)+len(payload.Removed)+len(payload.Modified)+
+		len(payload.Fats)+len(payload.Clusters) > 0 {
+
+		PrintResult(NewCommandResult(input, payload, custom_errors.ErrFilesDiffer))
+		return custom_errors.ErrFilesDiffer
+	}
+
+	printText(consts.CmdSuccessMsg)
+	PrintResult(NewCommandResult(input, payload, nil))
+	return nil
+}
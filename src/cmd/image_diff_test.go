@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newDiffImage returns the copy of the filesystem of the test as the compared image.
+func newDiffImage(f *cmdTestFS, path string) *DiffImage {
+	fats := make([][]int32, len(f.fats))
+	for i := range f.fats {
+		fats[i] = slices.Clone(f.fats[i])
+	}
+	pFs := *f.pFs
+	return &DiffImage{Path: path, PFs: &pFs, Fats: fats, Data: slices.Clone(f.data)}
+}
+
+func TestDiffImages(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	f.run("mkdir /d")
+	f.writeFile("/d/a", []byte("first"))
+	f.writeFile("/b", []byte("kept"))
+	first := newDiffImage(f, "first.img")
+
+	// the same file size with the other content, the bad cluster and the other signature
+	second := newDiffImage(f, "second.img")
+	chain := f.getChain("/d/a")
+	clusterSize := int(f.pFs.ClusterSize)
+	copy(second.Data[int(chain[1])*clusterSize:], "FIRST")
+	for _, fat := range second.Fats {
+		fat[200] = consts.FatBadCluster
+	}
+	copy(second.PFs.Signature[:], "OTHER0000")
+
+	var err error
+	text := captureStdout(t, func() {
+		err = DiffImages(first, newDiffImage(f, "copy.img"), true)
+	})
+	if err != nil || text != consts.CmdSuccessMsg+"\n" {
+		t.Fatalf("identical images: printed %q, error %v", text, err)
+	}
+
+	setJSONOutput(t)
+	text = captureStdout(t, func() {
+		err = DiffImages(first, second, true)
+	})
+	if !errors.Is(err, custom_errors.ErrFilesDiffer) {
+		t.Errorf("error %v, want %v", err, custom_errors.ErrFilesDiffer)
+	}
+
+	clusterOffset := uint64(f.pFs.DataStartAddr) + uint64(chain[1])*uint64(clusterSize)
+	want := `{"command":"--diff first.img second.img","status":"error","error_code":"FILES_DIFFER",` +
+		`"error":"` + custom_errors.GetUserMsg(custom_errors.ErrFilesDiffer) + `","payload":{` +
+		`"superblock":[{"field":"Signature","first":"` + consts.AuthorID + `","second":"OTHER0000"}],` +
+		`"added":[],"removed":[],"modified":["/d/a"],` +
+		`"fats":[{"fat":0,"cluster":200,"first":-1,"second":-3},{"fat":1,"cluster":200,"first":-1,"second":-3}],` +
+		fmt.Sprintf(`"clusters":[{"start_cluster":%d,"count":1,"start_offset":%d,"end_offset":%d}]}}`,
+			chain[1], clusterOffset, clusterOffset+uint64(clusterSize)) + "\n"
+	if text != want {
+		t.Errorf("printed\n%s\nwant\n%s", text, want)
+	}
+
+	// the added and removed paths, the clusters are listed only on request
+	f.writeFile("/c", []byte("new"))
+	f.run("rm /b")
+	text = captureStdout(t, func() {
+		err = DiffImages(first, newDiffImage(f, "third.img"), false)
+	})
+	results := decodeResults(t, text)
+	payload, _ := results[0]["payload"].(map[string]any)
+	if !errors.Is(err, custom_errors.ErrFilesDiffer) || fmt.Sprint(payload["added"]) != "[/c]" ||
+		fmt.Sprint(payload["removed"]) != "[/b]" || payload["clusters"] != nil || strings.Count(text, "\n") != 1 {
+		t.Errorf("error %v, printed %s", err, text)
+	}
+}
@@ -0,0 +1,709 @@
+// script_interpreter.go contains the interpreter of the script files executed by the load command.
+//
+// On top of the plain commands, the scripts support:
+//
+//	set -e | set +e              - stop / do not stop on the first failed command
+//	set VAR value...             - set the variable (used as $VAR or ${VAR})
+//	if [!] exists PATH ... [else ...] end
+//	for VAR in WORD... ... end   - words with glob characters are matched in the filesystem
+//	include FILE                 - execute the script file with the same variables
+//
+// $? expands to the status of the last command (0 on success, 1 on failure).
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// activeScripts is a stack of absolute paths of the scripts being executed (to detect cycles)
+var activeScripts = make([]string, 0)
+
+// scriptOptions holds the options of the script execution
+type scriptOptions struct {
+	// stopOnError is a flag indicating if the script stops on the first failed command ("set -e")
+	stopOnError bool
+}
+
+// scriptLine is a single non-empty line of a script
+type scriptLine struct {
+	// input is the raw line
+	input string
+	// lineNum is the line number in the script file (starting at 1)
+	lineNum int
+	// heredoc is the here-document following the line, nil if none
+	heredoc []byte
+}
+
+// scriptNodeKind is the kind of the script node
+type scriptNodeKind uint8
+
+const (
+	// cmdNode is a plain command or a set directive
+	cmdNode scriptNodeKind = iota
+	// ifNode is an if block
+	ifNode
+	// forNode is a for loop
+	forNode
+	// includeNode is an include of another script
+	includeNode
+)
+
+// scriptNode is a single statement of the parsed script
+type scriptNode struct {
+	// kind is the kind of the node
+	kind scriptNodeKind
+	// line is the line where the statement starts
+	line scriptLine
+	// words are the words of the statement line without the keyword
+	words []string
+	// body are the nested statements (if and for)
+	body []*scriptNode
+	// elseBody are the statements of the else branch (if)
+	elseBody []*scriptNode
+}
+
+// scriptStats holds the statistics of the script execution
+type scriptStats struct {
+	// succeeded is the number of succeeded commands
+	succeeded int
+	// failed is the number of failed commands
+	failed int
+}
+
+// scriptContext holds the state of the script execution
+type scriptContext struct {
+	// scriptPath is the path of the script being executed
+	scriptPath string
+	// opts are the current options
+	opts scriptOptions
+	// vars are the script variables
+	vars map[string]string
+	// lastStatus is the status of the last command ($?)
+	lastStatus int
+	// stats are the statistics of the execution
+	stats scriptStats
+	// fsChanged is a flag indicating if any command changed the filesystem
+	fsChanged bool
+	// stopped is a flag indicating if the execution was stopped
+	stopped bool
+
+	pFs      *pseudo_fat.FileSystem
+	pFatsRef *[][]int32
+	pDataRef *[]byte
+	endFlag  chan struct{}
+}
+
+// getLoadArgs splits the load command arguments into the options and the script path.
+//
+// No sanity checks are performed here, because the data should
+// already come validated from the command validator.
+func getLoadArgs(pCommand *Command) (scriptOptions, string) {
+	opts := scriptOptions{}
+	for _, arg := range pCommand.Args[:len(pCommand.Args)-1] {
+		switch arg {
+		case consts.ScriptStopOnErrorOpt:
+			opts.stopOnError = true
+		case consts.ScriptContinueOnErrorOpt:
+			opts.stopOnError = false
+		}
+	}
+
+	return opts, pCommand.Args[len(pCommand.Args)-1]
+}
+
+// splitHeredocOp splits the line into the command and the delimiter of the here-document
+// ("cmd ... <<DELIM" or "cmd ... << DELIM").
+//
+// It returns false if the line does not start a here-document.
+func splitHeredocOp(line string) (string, string, bool) {
+	words := strings.Fields(line)
+	last := words[len(words)-1]
+	switch {
+	case len(words) > 2 && words[len(words)-2] == consts.HeredocOp:
+		return strings.Join(words[:len(words)-2], " "), last, true
+	case len(words) > 1 && strings.HasPrefix(last, consts.HeredocOp) && len(last) > len(consts.HeredocOp):
+		return strings.Join(words[:len(words)-1], " "), last[len(consts.HeredocOp):], true
+	default:
+		return line, "", false
+	}
+}
+
+// readScriptLines reads the script file and returns its non-empty lines without comments.
+//
+// The lines of a here-document are kept as they are (including the empty ones) and attached
+// to the line starting it. It returns scriptSyntaxError if the here-document is not terminated
+// or a variable reference "${" is not closed.
+func readScriptLines(scriptPath string) ([]scriptLine, error) {
+	scriptData, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]scriptLine, 0)
+	rawLines := strings.Split(string(scriptData), consts.ScriptDelimiter)
+	for i := 0; i < len(rawLines); i++ {
+		line := strings.TrimSpace(rawLines[i])
+		if line == "" || strings.HasPrefix(line, consts.CommentSymbol) {
+			continue
+		}
+
+		pLine := &scriptLine{input: line, lineNum: i + 1}
+		if hasUnterminatedVarRef(line) {
+			return nil, &scriptSyntaxError{*pLine, "missing \"}\" of the variable"}
+		}
+		input, delimiter, isHeredoc := splitHeredocOp(line)
+		if isHeredoc {
+			pLine.input = input
+			pLine.heredoc = make([]byte, 0)
+
+			start := i
+			for i++; i < len(rawLines) && strings.TrimSpace(rawLines[i]) != delimiter; i++ {
+				// the here-document is expanded as well
+				if hasUnterminatedVarRef(rawLines[i]) {
+					return nil, &scriptSyntaxError{scriptLine{input: rawLines[i], lineNum: i + 1}, "missing \"}\" of the variable"}
+				}
+				pLine.heredoc = append(pLine.heredoc, strings.TrimSuffix(rawLines[i], "\r")+consts.ScriptDelimiter...)
+			}
+			if i == len(rawLines) {
+				return nil, &scriptSyntaxError{scriptLine{input: line, lineNum: start + 1}, fmt.Sprintf("missing \"%s\" of the here-document", delimiter)}
+			}
+		}
+		res = append(res, *pLine)
+	}
+
+	return res, nil
+}
+
+// hasUnterminatedVarRef returns true if the input contains "${" without the closing '}' ("$$" is a literal '$').
+func hasUnterminatedVarRef(input string) bool {
+	for i := 0; i < len(input)-1; i++ {
+		if input[i] != consts.ScriptVarSymbol[0] {
+			continue
+		}
+
+		switch input[i+1] {
+		case consts.ScriptVarSymbol[0]:
+			i++
+		case '{':
+			end := strings.IndexByte(input[i+2:], '}')
+			if end < 0 {
+				return true
+			}
+			i += end + 2
+		}
+	}
+
+	return false
+}
+
+// scriptSyntaxError is a syntax error of the script at the given line
+type scriptSyntaxError struct {
+	line scriptLine
+	msg  string
+}
+
+// Error returns the error message
+func (e *scriptSyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line.lineNum, e.msg)
+}
+
+// parseScriptBlock parses the lines starting at index start into nodes until
+// one of the terminators (or the end of the lines if none) is found.
+//
+// It returns the nodes, the index of the terminating line and the terminator found.
+func parseScriptBlock(lines []scriptLine, start int, terminators ...string) ([]*scriptNode, int, string, error) {
+	nodes := make([]*scriptNode, 0)
+
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		words := strings.Fields(line.input)
+		keyword := words[0]
+
+		for _, terminator := range terminators {
+			if keyword == terminator {
+				if len(words) != 1 {
+					return nil, i, "", &scriptSyntaxError{line, fmt.Sprintf("unexpected words after \"%s\"", keyword)}
+				}
+				return nodes, i, terminator, nil
+			}
+		}
+
+		switch keyword {
+		case consts.ScriptIfKeyword:
+			pNode := &scriptNode{kind: ifNode, line: line, words: words[1:]}
+			if !isValidIfCondition(pNode.words) {
+				return nil, i, "", &scriptSyntaxError{line, "expected \"if [!] exists PATH\""}
+			}
+
+			body, end, terminator, err := parseScriptBlock(lines, i+1, consts.ScriptElseKeyword, consts.ScriptEndKeyword)
+			if err != nil {
+				return nil, end, "", err
+			}
+			pNode.body = body
+
+			if terminator == consts.ScriptElseKeyword {
+				pNode.elseBody, end, terminator, err = parseScriptBlock(lines, end+1, consts.ScriptEndKeyword)
+				if err != nil {
+					return nil, end, "", err
+				}
+			}
+			if terminator == "" {
+				return nil, end, "", &scriptSyntaxError{line, "missing \"end\" of \"if\""}
+			}
+
+			nodes = append(nodes, pNode)
+			i = end
+
+		case consts.ScriptForKeyword:
+			pNode := &scriptNode{kind: forNode, line: line, words: words[1:]}
+			if len(pNode.words) < 2 || pNode.words[1] != consts.ScriptInKeyword || !isValidVarName(pNode.words[0]) {
+				return nil, i, "", &scriptSyntaxError{line, "expected \"for VAR in WORD...\""}
+			}
+
+			body, end, terminator, err := parseScriptBlock(lines, i+1, consts.ScriptEndKeyword)
+			if err != nil {
+				return nil, end, "", err
+			}
+			if terminator == "" {
+				return nil, end, "", &scriptSyntaxError{line, "missing \"end\" of \"for\""}
+			}
+			pNode.body = body
+
+			nodes = append(nodes, pNode)
+			i = end
+
+		case consts.ScriptIncludeKeyword:
+			if len(words) != 2 {
+				return nil, i, "", &scriptSyntaxError{line, "expected \"include FILE\""}
+			}
+			nodes = append(nodes, &scriptNode{kind: includeNode, line: line, words: words[1:]})
+
+		case consts.ScriptElseKeyword, consts.ScriptEndKeyword:
+			return nil, i, "", &scriptSyntaxError{line, fmt.Sprintf("unexpected \"%s\"", keyword)}
+
+		default:
+			nodes = append(nodes, &scriptNode{kind: cmdNode, line: line})
+		}
+	}
+
+	return nodes, len(lines), "", nil
+}
+
+// isValidVarName returns true if the name is a valid script variable name.
+func isValidVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, c := range name {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !(isDigit && i > 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isValidIfCondition returns true if the words form a valid if condition.
+func isValidIfCondition(words []string) bool {
+	if len(words) > 0 && words[0] == consts.ScriptNotKeyword {
+		words = words[1:]
+	}
+
+	return len(words) == 2 && words[0] == consts.ScriptExistsKeyword
+}
+
+// expandVars expands the variables ($VAR, ${VAR}, $? and $$ for a literal '$') in the input.
+//
+// It returns ErrUndefinedVariable if the variable is not set and ErrScriptSyntax
+// if "${" is not closed.
+func (c *scriptContext) expandVars(input string) (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < len(input); i++ {
+		if input[i] != consts.ScriptVarSymbol[0] || i == len(input)-1 {
+			sb.WriteByte(input[i])
+			continue
+		}
+
+		rest := input[i+1:]
+		var name string
+		switch {
+		case rest[0] == consts.ScriptVarSymbol[0]:
+			sb.WriteByte(rest[0])
+			i++
+			continue
+
+		case rest[0] == '?':
+			sb.WriteString(strconv.Itoa(c.lastStatus))
+			i++
+			continue
+
+		case rest[0] == '{':
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				// rejected when the script is read (see hasUnterminatedVarRef)
+				return "", custom_errors.ErrScriptSyntax
+			}
+			name = rest[1:end]
+			i += end + 1
+
+		default:
+			end := 0
+			for end < len(rest) && isValidVarName(rest[:end+1]) {
+				end++
+			}
+			if end == 0 {
+				// lone '$'
+				sb.WriteByte(input[i])
+				continue
+			}
+			name = rest[:end]
+			i += end
+		}
+
+		value, ok := c.vars[name]
+		if !ok {
+			logging.Info(fmt.Sprintf("Undefined script variable \"%s\"", name))
+			return "", custom_errors.ErrUndefinedVariable
+		}
+		sb.WriteString(value)
+	}
+
+	return sb.String(), nil
+}
+
+// applySetDirective applies the set directive - an option ("set -e" / "set +e")
+// or a variable ("set VAR value...").
+//
+// It returns false if the command is not a set directive.
+func (c *scriptContext) applySetDirective(pCommand *Command) bool {
+	if pCommand.Name != consts.ScriptSetDirective || len(pCommand.Args) < 1 {
+		return false
+	}
+
+	switch {
+	case len(pCommand.Args) == 1 && pCommand.Args[0] == consts.ScriptStopOnErrorOpt:
+		c.opts.stopOnError = true
+	case len(pCommand.Args) == 1 && pCommand.Args[0] == consts.ScriptNoStopOnErrorOpt:
+		c.opts.stopOnError = false
+	case isValidVarName(pCommand.Args[0]):
+		c.vars[pCommand.Args[0]] = strings.Join(pCommand.Args[1:], " ")
+	default:
+		return false
+	}
+
+	return true
+}
+
+// isEndFlagClosed returns true if the exit command was executed.
+func isEndFlagClosed(endFlag chan struct{}) bool {
+	select {
+	case <-endFlag:
+		return true
+	default:
+		return false
+	}
+}
+
+// runScriptCommand validates and executes a single script command.
+//
+// It returns whether the filesystem was changed and the payload of the command result.
+func runScriptCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, pFatsRef *[][]int32, pDataRef *[]byte, endFlag chan struct{}) (bool, any, error) {
+	err := ValidateCommand(pCommand)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if P_CurrDir == nil {
+		return handleUninitializedFSCmd(pFs, pFatsRef, pDataRef, pCommand, endFlag)
+	}
+	return handleInitializedFSCmd(pFs, pFatsRef, pDataRef, pCommand, endFlag)
+}
+
+// recordResult records the result of the statement and reports the failure.
+//
+// In the JSON output mode the result of the statement is printed as one JSON object.
+func (c *scriptContext) recordResult(line scriptLine, input string, payload any, err error) {
+	pResult := NewCommandResult(input, payload, err)
+	pResult.Location = fmt.Sprintf("%s:%d", c.scriptPath, line.lineNum)
+	PrintResult(pResult)
+
+	if err == nil {
+		c.stats.succeeded++
+		c.lastStatus = 0
+		return
+	}
+
+	c.stats.failed++
+	c.lastStatus = 1
+	printTextf(consts.ScriptCmdFailedMsg, c.scriptPath, line.lineNum, input, custom_errors.GetUserMsg(err))
+	if c.opts.stopOnError {
+		c.stopped = true
+	}
+}
+
+// runCmdNode executes the command (or set directive) node.
+func (c *scriptContext) runCmdNode(pNode *scriptNode) {
+	input, err := c.expandVars(pNode.line.input)
+	if err != nil {
+		c.recordResult(pNode.line, pNode.line.input, nil, err)
+		return
+	}
+
+	pCommand, err := ParseCommand(input)
+	if err == nil && c.applySetDirective(pCommand) {
+		return
+	}
+	if err == nil && pNode.line.heredoc != nil {
+		var heredoc string
+		heredoc, err = c.expandVars(string(pNode.line.heredoc))
+		pCommand.Input = []byte(heredoc)
+	}
+
+	printText(input)
+	cmdChanged := false
+	var payload any
+	if err == nil {
+		cmdChanged, payload, err = runScriptCommand(pCommand, c.pFs, c.pFatsRef, c.pDataRef, c.endFlag)
+	}
+	c.fsChanged = c.fsChanged || cmdChanged
+	c.recordResult(pNode.line, input, payload, err)
+}
+
+// expandWords expands the variables and glob patterns in the words.
+//
+// Glob patterns are matched in the filesystem. Relative patterns produce paths
+// relative to the current directory. Like in the command arguments, it returns
+// ErrNoMatch if a pattern matches nothing.
+func (c *scriptContext) expandWords(words []string) ([]string, error) {
+	res := make([]string, 0, len(words))
+	for _, word := range words {
+		expanded, err := c.expandVars(word)
+		if err != nil {
+			return nil, err
+		}
+
+		if !utils.HasGlobMeta(expanded) {
+			res = append(res, expanded)
+			continue
+		}
+
+		matches, err := globImagePaths(expanded, c.pFs, *c.pFatsRef, *c.pDataRef)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, matches...)
+	}
+
+	return res, nil
+}
+
+// evalIfCondition evaluates the condition of the if node.
+func (c *scriptContext) evalIfCondition(pNode *scriptNode) (bool, error) {
+	negate := pNode.words[0] == consts.ScriptNotKeyword
+	path, err := c.expandVars(pNode.words[len(pNode.words)-1])
+	if err != nil {
+		return false, err
+	}
+
+	exists, err := pathExists(path, c.pFs, *c.pFatsRef, *c.pDataRef)
+	if err != nil {
+		return false, err
+	}
+
+	return exists != negate, nil
+}
+
+// runIncludeNode executes the included script with the same context.
+func (c *scriptContext) runIncludeNode(pNode *scriptNode) {
+	includePath, err := c.expandVars(pNode.words[0])
+	if err != nil {
+		c.recordResult(pNode.line, pNode.line.input, nil, err)
+		return
+	}
+
+	nodes, err := loadScript(includePath)
+	if err != nil {
+		c.recordResult(pNode.line, pNode.line.input, nil, err)
+		return
+	}
+	defer popActiveScript()
+
+	parentPath := c.scriptPath
+	c.scriptPath = includePath
+	c.runNodes(nodes)
+	c.scriptPath = parentPath
+}
+
+// runNodes executes the nodes until the end or until stopped.
+func (c *scriptContext) runNodes(nodes []*scriptNode) {
+	for _, pNode := range nodes {
+		if c.stopped {
+			return
+		}
+		if isEndFlagClosed(c.endFlag) {
+			logging.Debug("Exit command executed, stopping the script...")
+			c.stopped = true
+			return
+		}
+
+		switch pNode.kind {
+		case cmdNode:
+			c.runCmdNode(pNode)
+
+		case ifNode:
+			if P_CurrDir == nil {
+				c.recordResult(pNode.line, pNode.line.input, nil, custom_errors.ErrFSUninitialized)
+				continue
+			}
+
+			cond, err := c.evalIfCondition(pNode)
+			if err != nil {
+				c.recordResult(pNode.line, pNode.line.input, nil, err)
+			} else if cond {
+				c.runNodes(pNode.body)
+			} else {
+				c.runNodes(pNode.elseBody)
+			}
+
+		case forNode:
+			if P_CurrDir == nil {
+				c.recordResult(pNode.line, pNode.line.input, nil, custom_errors.ErrFSUninitialized)
+				continue
+			}
+
+			items, err := c.expandWords(pNode.words[2:])
+			if err != nil {
+				c.recordResult(pNode.line, pNode.line.input, nil, err)
+				continue
+			}
+
+			for _, item := range items {
+				if c.stopped {
+					break
+				}
+				c.vars[pNode.words[0]] = item
+				c.runNodes(pNode.body)
+			}
+
+		case includeNode:
+			c.runIncludeNode(pNode)
+		}
+	}
+}
+
+// pushActiveScript pushes the script to the stack of the scripts being executed.
+//
+// It returns ErrScriptCycle if the script is already being executed.
+func pushActiveScript(scriptPath string) error {
+	absPath, err := filepath.Abs(scriptPath)
+	if err != nil {
+		return err
+	}
+
+	for _, activePath := range activeScripts {
+		if activePath == absPath {
+			logging.Info(fmt.Sprintf("Script \"%s\" is already being executed", absPath))
+			return custom_errors.ErrScriptCycle
+		}
+	}
+
+	activeScripts = append(activeScripts, absPath)
+	return nil
+}
+
+// popActiveScript pops the last script from the stack of the scripts being executed.
+func popActiveScript() {
+	activeScripts = activeScripts[:len(activeScripts)-1]
+}
+
+// loadScript reads and parses the script and marks it as being executed.
+// popActiveScript must be called when the execution ends (only if no error is returned).
+func loadScript(scriptPath string) ([]*scriptNode, error) {
+	lines, err := readScriptLines(scriptPath)
+	var pSyntaxErr *scriptSyntaxError
+	if errors.As(err, &pSyntaxErr) {
+		printTextf(consts.ScriptSyntaxErrMsg, scriptPath, err)
+		return nil, custom_errors.ErrScriptSyntax
+	} else if err != nil {
+		logging.Info(fmt.Sprintf("Error reading script \"%s\": %s", scriptPath, err))
+		return nil, custom_errors.ErrInFileNotFound
+	}
+
+	nodes, _, _, err := parseScriptBlock(lines, 0)
+	if err != nil {
+		printTextf(consts.ScriptSyntaxErrMsg, scriptPath, err)
+		return nil, custom_errors.ErrScriptSyntax
+	}
+
+	err = pushActiveScript(scriptPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// interpretScriptCommand interprets the script command.
+//
+// Every command of the script is executed (nested scripts recursively) and its
+// failure is reported with the script file and line number. The script stops on
+// the first failure if the "-e" option or the "set -e" directive is used.
+// A summary of succeeded and failed commands is printed at the end.
+//
+// The payload of the result is the summary.
+//
+// Returns ErrScriptFailed if any of the commands failed and ErrScriptCycle
+// if the script is already being executed.
+func interpretScriptCommand(pCommand *Command, pFs *pseudo_fat.FileSystem, pFatsRef *[][]int32, pDataRef *[]byte, endFlag chan struct{}) (bool, any, error) {
+	// sanity checks
+	if pCommand == nil || pFs == nil || pFatsRef == nil || pDataRef == nil {
+		return false, nil, custom_errors.ErrNilPointer
+	}
+	if len(pCommand.Args) < 1 {
+		return false, nil, custom_errors.ErrInvalArgsCount
+	}
+
+	opts, scriptPath := getLoadArgs(pCommand)
+	nodes, err := loadScript(scriptPath)
+	if err != nil {
+		return false, nil, err
+	}
+	defer popActiveScript()
+
+	c := &scriptContext{
+		scriptPath: scriptPath,
+		opts:       opts,
+		vars:       make(map[string]string),
+		pFs:        pFs,
+		pFatsRef:   pFatsRef,
+		pDataRef:   pDataRef,
+		endFlag:    endFlag,
+	}
+	c.runNodes(nodes)
+
+	printTextf(consts.ScriptSummaryMsg, scriptPath, c.stats.succeeded, c.stats.failed)
+	stopped := c.stopped && c.stats.failed > 0
+	if stopped {
+		printText(consts.ScriptStoppedMsg)
+	}
+
+	payload := scriptPayload{Script: scriptPath, Succeeded: c.stats.succeeded, Failed: c.stats.failed, Stopped: stopped}
+	if c.stats.failed > 0 {
+		return c.fsChanged, payload, custom_errors.ErrScriptFailed
+	}
+	return c.fsChanged, payload, nil
+}
@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"strings"
+	"testing"
+)
+
+// describeNodes returns the compact description of the parsed nodes used by the tests
+// ("cmd" for the commands, the blocks in brackets).
+func describeNodes(nodes []*scriptNode) string {
+	parts := make([]string, 0, len(nodes))
+	for _, pNode := range nodes {
+		switch pNode.kind {
+		case cmdNode:
+			part := fmt.Sprintf("cmd(%s)", pNode.line.input)
+			if pNode.line.heredoc != nil {
+				part += fmt.Sprintf("<<%q", string(pNode.line.heredoc))
+			}
+			parts = append(parts, part)
+		case ifNode:
+			part := fmt.Sprintf("if(%s)[%s]", strings.Join(pNode.words, " "), describeNodes(pNode.body))
+			if pNode.elseBody != nil {
+				part += fmt.Sprintf("else[%s]", describeNodes(pNode.elseBody))
+			}
+			parts = append(parts, part)
+		case forNode:
+			parts = append(parts, fmt.Sprintf("for(%s)[%s]", strings.Join(pNode.words, " "), describeNodes(pNode.body)))
+		case includeNode:
+			parts = append(parts, fmt.Sprintf("include(%s)", pNode.words[0]))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    string
+		wantErr string
+	}{
+		{"commands", "ls\n\n# comment\n  mkdir a  \r\ncd a", "cmd(ls) cmd(mkdir a) cmd(cd a)", ""},
+		{"set", "set -e\nset D dir\nmkdir $D", "cmd(set -e) cmd(set D dir) cmd(mkdir $D)", ""},
+		{"if", "if exists /a\nls\nend", "if(exists /a)[cmd(ls)]", ""},
+		{"if not", "if ! exists $D\nmkdir $D\nend", "if(! exists $D)[cmd(mkdir $D)]", ""},
+		{"if else", "if exists a\nls a\nelse\nmkdir a\nend", "if(exists a)[cmd(ls a)]else[cmd(mkdir a)]", ""},
+		{"empty if", "if exists a\nend", "if(exists a)[]", ""},
+		{"empty else", "if exists a\nelse\nend", "if(exists a)[]else[]", ""},
+		{"for", "for f in a b *.txt\ncat $f\nend", "for(f in a b *.txt)[cmd(cat $f)]", ""},
+		{"for without words", "for f in\nend", "for(f in)[]", ""},
+		{"nested", "for d in a b\nif ! exists $d\nmkdir $d\nend\nfor f in $d/*\nrm $f\nend\nend",
+			"for(d in a b)[if(! exists $d)[cmd(mkdir $d)] for(f in $d/*)[cmd(rm $f)]]", ""},
+		{"include", "include other.txt\nls", "include(other.txt) cmd(ls)", ""},
+		{"heredoc", "write f <<EOF\nline 1\n\n# not a comment\nend\nEOF\nls", `cmd(write f)<<"line 1\n\n# not a comment\nend\n" cmd(ls)`, ""},
+		{"heredoc with space", "write f << END\n  indented\n  END\nls", `cmd(write f)<<"  indented\n" cmd(ls)`, ""},
+		{"empty heredoc", "write f <<EOF\nEOF", `cmd(write f)<<""`, ""},
+		{"heredoc in for", "for f in a b\nwrite $f <<EOF\n$f\nEOF\nend", `for(f in a b)[cmd(write $f)<<"$f\n"]`, ""},
+		{"heredoc operator only", "echo <<", "cmd(echo <<)", ""},
+		{"escaped variable brace", "echo $${A", "cmd(echo $${A)", ""},
+
+		{"missing end of if", "ls\nif exists a\nls", "", "line 2: missing \"end\" of \"if\""},
+		{"missing end of else", "if exists a\nelse\nls", "", "line 1: missing \"end\" of \"if\""},
+		{"missing end of for", "for f in a\nls", "", "line 1: missing \"end\" of \"for\""},
+		{"unexpected end", "ls\nend", "", "line 2: unexpected \"end\""},
+		{"unexpected else", "else", "", "line 1: unexpected \"else\""},
+		{"else in for", "for f in a\nelse\nend", "", "line 2: unexpected \"else\""},
+		{"words after end", "if exists a\nend now", "", "line 2: unexpected words after \"end\""},
+		{"if without exists", "if a\nend", "", "line 1: expected \"if [!] exists PATH\""},
+		{"if with more paths", "if exists a b\nend", "", "line 1: expected \"if [!] exists PATH\""},
+		{"for without in", "for f a b\nend", "", "line 1: expected \"for VAR in WORD...\""},
+		{"for invalid variable", "for 1f in a\nend", "", "line 1: expected \"for VAR in WORD...\""},
+		{"include without file", "include", "", "line 1: expected \"include FILE\""},
+		{"include with more files", "include a b", "", "line 1: expected \"include FILE\""},
+		{"unterminated heredoc", "ls\nwrite f <<EOF\ntext", "", "line 2: missing \"EOF\" of the here-document"},
+		{"unterminated variable", "ls\nmkdir ${A", "", "line 2: missing \"}\" of the variable"},
+		{"unterminated second variable", "echo ${A} ${B", "", "line 1: missing \"}\" of the variable"},
+		{"unterminated variable in heredoc", "write f <<EOF\n${A}\n${A\nEOF", "", "line 3: missing \"}\" of the variable"},
+		{"unterminated variable in for", "for f in a\necho ${f\nend", "", "line 2: missing \"}\" of the variable"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptPath := writeHostFile(t, dir, "script.txt", tt.script)
+
+			lines, err := readScriptLines(scriptPath)
+			var nodes []*scriptNode
+			if err == nil {
+				nodes, _, _, err = parseScriptBlock(lines, 0)
+			}
+
+			if tt.wantErr != "" {
+				var pSyntaxErr *scriptSyntaxError
+				if !errors.As(err, &pSyntaxErr) || err.Error() != tt.wantErr {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeNodes(nodes); got != tt.want {
+				t.Errorf("parsed\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+	c := &scriptContext{vars: map[string]string{"A": "x", "A_1": "y", "EMPTY": "", "P": "/dir"}, lastStatus: 1}
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"ls", "ls", nil},
+		{"mkdir $A", "mkdir x", nil},
+		{"mkdir $A/b", "mkdir x/b", nil},
+		{"mkdir $A_1", "mkdir y", nil},
+		{"mkdir ${A}_1", "mkdir x_1", nil},
+		{"cd $P$A", "cd /dirx", nil},
+		{"echo [$EMPTY]", "echo []", nil},
+		{"echo $?", "echo 1", nil},
+		{"echo $?$A", "echo 1x", nil},
+		{"echo $$A", "echo $A", nil},
+		{"echo $", "echo $", nil},
+		{"echo $ a", "echo $ a", nil},
+		{"echo $-", "echo $-", nil},
+		{"echo $B", "", custom_errors.ErrUndefinedVariable},
+		{"echo ${B}", "", custom_errors.ErrUndefinedVariable},
+		{"echo ${A", "", custom_errors.ErrScriptSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := c.expandVars(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expandVars(%q) error %v, want %v", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("expandVars(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySetDirective(t *testing.T) {
+	tests := []struct {
+		input       string
+		applied     bool
+		stopOnError bool
+		vars        string
+	}{
+		{"set -e", true, true, ""},
+		{"set +e", true, false, ""},
+		{"set D a b  c", true, false, "D=a b c"},
+		{"set D", true, false, "D="},
+		{"set", false, false, ""},
+		{"set 1D a", false, false, ""},
+		{"set -x", false, false, ""},
+		{"mkdir D", false, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			c := &scriptContext{vars: make(map[string]string), opts: scriptOptions{stopOnError: tt.input == "set +e"}}
+			pCommand, _ := ParseCommand(tt.input)
+
+			if got := c.applySetDirective(pCommand); got != tt.applied {
+				t.Fatalf("applied %v, want %v", got, tt.applied)
+			}
+			if c.opts.stopOnError != tt.stopOnError {
+				t.Errorf("stop on error %v, want %v", c.opts.stopOnError, tt.stopOnError)
+			}
+
+			vars := make([]string, 0)
+			for name, value := range c.vars {
+				vars = append(vars, name+"="+value)
+			}
+			if got := strings.Join(vars, ","); got != tt.vars {
+				t.Errorf("variables %q, want %q", got, tt.vars)
+			}
+		})
+	}
+}
+
+func TestInterpretScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		scripts map[string]string
+		opts    string
+		want    scriptPayload
+		files   map[string]string
+		missing []string
+	}{
+		{"variables", map[string]string{"main": "set D dir\nmkdir $D\nmkdir ${D}2\necho $D > /$D/f"},
+			"", scriptPayload{Succeeded: 3}, map[string]string{"/dir/f": "dir\n"}, nil},
+		{"if", map[string]string{"main": "mkdir a\nif exists a\necho yes > /r1\nelse\necho no > /r1\nend\n" +
+			"if ! exists /a\necho yes > /r2\nelse\necho no > /r2\nend\nif exists /b\necho yes > /r3\nend"},
+			"", scriptPayload{Succeeded: 3}, map[string]string{"/r1": "yes\n", "/r2": "no\n"}, []string{"/r3"}},
+		{"for words", map[string]string{"main": "for d in a b c\nmkdir /$d\necho $d > /$d/f\nend"},
+			"", scriptPayload{Succeeded: 6}, map[string]string{"/a/f": "a\n", "/b/f": "b\n", "/c/f": "c\n"}, nil},
+		{"for glob", map[string]string{"main": "mkdir src\necho 1 > src/x1\necho 2 > src/x2\necho 3 > src/y3\n" +
+			"for f in src/x*\necho $f >> /rel\nend\nfor f in /src/*\necho $f >> /abs\nend"},
+			"", scriptPayload{Succeeded: 9}, map[string]string{"/rel": "src/x1\nsrc/x2\n", "/abs": "/src/x1\n/src/x2\n/src/y3\n"}, nil},
+		{"for glob without match", map[string]string{"main": "mkdir src\nfor f in /src/none* a\nmkdir /$f\nend\nmkdir /b"},
+			"", scriptPayload{Succeeded: 2, Failed: 1}, nil, []string{"/a"}},
+		{"nested", map[string]string{"main": "for d in a b\nif ! exists /$d\nmkdir /$d\nend\nfor n in 1 2\necho $n > /$d/f$n\nend\nend\n" +
+			"for d in a b\nif exists /$d\necho $d >> /seen\nend\nend"},
+			"", scriptPayload{Succeeded: 8}, map[string]string{"/a/f2": "2\n", "/b/f1": "1\n", "/seen": "a\nb\n"}, nil},
+		{"last status", map[string]string{"main": "echo $? > /s0\ncd /missing\necho $? > /s1\necho $? > /s2"},
+			"", scriptPayload{Succeeded: 3, Failed: 1}, map[string]string{"/s0": "0\n", "/s1": "1\n", "/s2": "0\n"}, nil},
+		{"undefined variable", map[string]string{"main": "mkdir $X\nmkdir ok"},
+			"", scriptPayload{Succeeded: 1, Failed: 1}, nil, []string{"/$X"}},
+		{"stop on error", map[string]string{"main": "mkdir a\nset -e\ncd /missing\nmkdir b"},
+			"", scriptPayload{Succeeded: 1, Failed: 1, Stopped: true}, nil, []string{"/b"}},
+		{"stop on error option", map[string]string{"main": "mkdir a\ncd /missing\nmkdir b"},
+			"-e", scriptPayload{Succeeded: 1, Failed: 1, Stopped: true}, nil, []string{"/b"}},
+		{"continue on error", map[string]string{"main": "set -e\nset +e\ncd /missing\nmkdir b"},
+			"", scriptPayload{Succeeded: 1, Failed: 1}, nil, nil},
+		{"stop in for", map[string]string{"main": "set -e\nfor d in a a b\nmkdir /$d\nend"},
+			"", scriptPayload{Succeeded: 1, Failed: 1, Stopped: true}, nil, []string{"/b"}},
+		{"include", map[string]string{"main": "set D a\ninclude {inc}\nmkdir /$D/$E", "inc": "mkdir /$D\nset E b"},
+			"", scriptPayload{Succeeded: 2}, nil, nil},
+		{"include stops", map[string]string{"main": "set -e\ninclude {inc}\nmkdir /c", "inc": "cd /missing\nmkdir /b"},
+			"", scriptPayload{Failed: 1, Stopped: true}, nil, []string{"/b", "/c"}},
+		{"include missing", map[string]string{"main": "include /missing/script\nmkdir a"},
+			"", scriptPayload{Succeeded: 1, Failed: 1}, nil, nil},
+		{"include cycle", map[string]string{"main": "mkdir a\ninclude {inc}", "inc": "mkdir b\ninclude {main}"},
+			"", scriptPayload{Succeeded: 2, Failed: 1}, nil, nil},
+		{"heredoc", map[string]string{"main": "set N name\nwrite /f <<EOF\nhello $N\n\n  # kept\nEOF\nwrite /g << END\nEND"},
+			"", scriptPayload{Succeeded: 2}, map[string]string{"/f": "hello name\n\n  # kept\n", "/g": ""}, nil},
+		{"heredoc in for", map[string]string{"main": "for f in a b\nwrite /$f <<EOF\n<$f>\nEOF\nend"},
+			"", scriptPayload{Succeeded: 2}, map[string]string{"/a": "<a>\n", "/b": "<b>\n"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newCmdTestFS(t, "1MB")
+			dir := chdirTemp(t)
+
+			// the placeholders {name} are replaced by the (relative) host paths of the scripts
+			for name, script := range tt.scripts {
+				for other := range tt.scripts {
+					script = strings.ReplaceAll(script, "{"+other+"}", other+".txt")
+				}
+				writeHostFile(t, dir, name+".txt", script)
+			}
+
+			input := strings.TrimSpace("load " + tt.opts + " main.txt")
+			payload, _, err := f.exec(input)
+			if (tt.want.Failed > 0) != errors.Is(err, custom_errors.ErrScriptFailed) {
+				t.Errorf("error %v with %d failed commands", err, tt.want.Failed)
+			}
+
+			want := tt.want
+			want.Script = "main.txt"
+			if got, ok := payload.(scriptPayload); !ok || got != want {
+				t.Errorf("payload %+v, want %+v", payload, want)
+			}
+
+			for path, content := range tt.files {
+				if got := string(f.readFile(path)); got != content {
+					t.Errorf("%s: %q, want %q", path, got, content)
+				}
+			}
+			for _, path := range tt.missing {
+				if _, _, err := f.exec("stat " + path); err == nil {
+					t.Errorf("%s exists", path)
+				}
+			}
+			if len(activeScripts) != 0 {
+				t.Errorf("active scripts %v after the execution", activeScripts)
+			}
+		})
+	}
+}
+
+func TestInterpretScriptSyntaxError(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	writeHostFile(t, chdirTemp(t), "main.txt", "mkdir a\nif exists a\nmkdir b")
+
+	_, text, err := f.exec("load main.txt")
+	if !errors.Is(err, custom_errors.ErrScriptSyntax) {
+		t.Fatalf("error %v, want ErrScriptSyntax", err)
+	}
+	if !strings.Contains(text, "line 2") {
+		t.Errorf("output %q does not name the line", text)
+	}
+
+	// nothing is executed
+	if _, _, err = f.exec("stat /a"); err == nil {
+		t.Error("/a created by the script with a syntax error")
+	}
+	if len(activeScripts) != 0 {
+		t.Errorf("active scripts %v after the syntax error", activeScripts)
+	}
+}
+
+func TestInterpretScriptReportsFailedLines(t *testing.T) {
+	f := newCmdTestFS(t, "1MB")
+	writeHostFile(t, chdirTemp(t), "main.txt", "mkdir a\n\n# comment\nmkdir a\nmkdir b\ncd /missing\nmkdir c")
+
+	payload, text, err := f.exec("load main.txt")
+	if !errors.Is(err, custom_errors.ErrScriptFailed) {
+		t.Errorf("error %v, want %v", err, custom_errors.ErrScriptFailed)
+	}
+	if want := (scriptPayload{Script: "main.txt", Succeeded: 3, Failed: 2}); payload != want {
+		t.Errorf("payload %+v, want %+v", payload, want)
+	}
+
+	// the empty and comment lines are counted as well
+	for _, want := range []string{
+		fmt.Sprintf(consts.ScriptCmdFailedMsg, "main.txt", 4, "mkdir a", custom_errors.GetUserMsg(custom_errors.ErrEntryExists)),
+		fmt.Sprintf(consts.ScriptCmdFailedMsg, "main.txt", 6, "cd /missing", custom_errors.GetUserMsg(custom_errors.ErrPathNotFound)),
+		fmt.Sprintf(consts.ScriptSummaryMsg, "main.txt", 3, 2),
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("output %q does not contain %q", text, want)
+		}
+	}
+	if strings.Count(text, "main.txt:") != 2 {
+		t.Errorf("output %q reports other lines", text)
+	}
+}
@@ -15,6 +15,8 @@ const (
 	CheckCommand = "check"
 	// DebugCommand represents the format of the debug command. This command is used for debugging purposes.
 	DebugCommand = "debug"
+	// DiskFreeCommand represents the format of the disk free command
+	DiskFreeCommand = "df"
 
 	// TWO WORD COMMANDS //
 
@@ -24,12 +26,16 @@ const (
 	MakeDirCommand = "mkdir"
 	// RemoveDirCommand represents the format of the remove directory command
 	RemoveDirCommand = "rmdir"
+	// WriteCommand represents the format of the write command
+	WriteCommand = "write"
 	// ConcatCommand represents the format of the concatenate command
 	ConcatCommand = "cat"
 	// ChangeDirCommand represents the format of the change directory command
 	ChangeDirCommand = "cd"
 	// InfoCommand represents the format of the info command
 	InfoCommand = "info"
+	// StatCommand represents the format of the stat command
+	StatCommand = "stat"
 	// LoadInterpretScriptCommand represents the format of the load interpret script command
 	InterpretScriptCommand = "load"
 	// FormatCommand represents the format of the format command
@@ -52,4 +58,42 @@ const (
 
 	// ListCommand represents the format of the list command
 	ListCommand = "ls"
+	// FindCommand represents the format of the find command
+	FindCommand = "find"
+	// TreeCommand represents the format of the tree command
+	TreeCommand = "tree"
+	// DiskUsageCommand represents the format of the disk usage command
+	DiskUsageCommand = "du"
+	// HeadCommand represents the format of the head command
+	HeadCommand = "head"
+	// TailCommand represents the format of the tail command
+	TailCommand = "tail"
+	// WordCountCommand represents the format of the word count command
+	WordCountCommand = "wc"
+	// GrepCommand represents the format of the grep command
+	GrepCommand = "grep"
+	// HexdumpCommand represents the format of the hexdump command
+	HexdumpCommand = "hexdump"
+	// XxdCommand represents the format of the xxd command (alias of the hexdump command)
+	XxdCommand = "xxd"
+	// EchoCommand represents the format of the echo command
+	EchoCommand = "echo"
+	// TruncateCommand represents the format of the truncate command
+	TruncateCommand = "truncate"
+	// Sha256sumCommand represents the format of the SHA-256 checksum command
+	Sha256sumCommand = "sha256sum"
+	// Md5sumCommand represents the format of the MD5 checksum command
+	Md5sumCommand = "md5sum"
+	// Crc32Command represents the format of the CRC-32 checksum command
+	Crc32Command = "crc32"
+	// CompareCommand represents the format of the cmp command
+	CompareCommand = "cmp"
+	// DiffCommand represents the format of the diff command
+	DiffCommand = "diff"
+	// DefragCommand represents the format of the defragmentation command
+	DefragCommand = "defrag"
+	// ResizeCommand represents the format of the resize command
+	ResizeCommand = "resize"
+	// CompactCommand represents the format of the compact command
+	CompactCommand = "compact"
 )
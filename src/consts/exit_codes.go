@@ -5,3 +5,7 @@ const ExitSuccess = 0
 
 // ExitFailure is the exit code for failed execution
 const ExitFailure = 1
+
+// ExitTrouble is the exit code of the diff mode for the filesystems that could not be compared
+// (ExitFailure means that the filesystems differ)
+const ExitTrouble = 2
@@ -25,6 +25,9 @@ var AllowedFilesizeUnits = []string{UnitKb, UnitMb, UnitGb, UnitB}
 // AuthorID is the ID of the author of the file system
 const AuthorID = "A21B0318P"
 
+// DirIndexSignature marks the directory index header in the self reference cluster of a directory
+const DirIndexSignature = "DIDX"
+
 // RootDirName is the name of the root directory
 const PathDelimiter = "/"
 
@@ -37,8 +40,267 @@ const ParentDirSymbol = ".."
 // ScriptDelimiter is a delimiter used for separating scripts when loading from a file
 const ScriptDelimiter = "\n"
 
+// CmdDelimiter is a delimiter used for separating commands passed with the -c option
+const CmdDelimiter = ";"
+
+// ScriptSetDirective is the name of the script directive setting the script options
+const ScriptSetDirective = "set"
+
+// ScriptStopOnErrorOpt is the option (and "set" directive argument) stopping the script on the first failed command
+const ScriptStopOnErrorOpt = "-e"
+
+// ScriptNoStopOnErrorOpt is the "set" directive argument disabling ScriptStopOnErrorOpt
+const ScriptNoStopOnErrorOpt = "+e"
+
+// ScriptContinueOnErrorOpt is the option making the script continue after a failed command (default)
+const ScriptContinueOnErrorOpt = "--continue-on-error"
+
+// ScriptIfKeyword is the script keyword starting a conditional block
+const ScriptIfKeyword = "if"
+
+// ScriptElseKeyword is the script keyword starting the alternative branch of a conditional block
+const ScriptElseKeyword = "else"
+
+// ScriptEndKeyword is the script keyword ending a block
+const ScriptEndKeyword = "end"
+
+// ScriptForKeyword is the script keyword starting a loop
+const ScriptForKeyword = "for"
+
+// ScriptInKeyword is the script keyword separating the loop variable from the loop items
+const ScriptInKeyword = "in"
+
+// ScriptIncludeKeyword is the script keyword executing another script with the same variables
+const ScriptIncludeKeyword = "include"
+
+// ScriptExistsKeyword is the script condition testing existence of a path
+const ScriptExistsKeyword = "exists"
+
+// ScriptNotKeyword is the script symbol negating a condition
+const ScriptNotKeyword = "!"
+
+// ScriptVarSymbol is the symbol starting a variable reference in a script
+const ScriptVarSymbol = "$"
+
+// GlobCharacters is a string containing the characters starting a glob pattern
+const GlobCharacters = "*?["
+
+// GlobPatternCharacters is a string containing the characters allowed in a glob pattern on top of AllowedPathCharacters
+const GlobPatternCharacters = "*?[]^-"
+
+// GlobRecursiveSegment is the glob path segment matching any number of directories
+const GlobRecursiveSegment = "**"
+
 // CommentSymbol is the symbol for a comment
 const CommentSymbol = "#"
 
 // NewFilePermissions is the default permissions for a new file
 const NewFilePermissions = 0644
+
+// HistoryFilePermissions is the permissions for the command history file (only for the user)
+const HistoryFilePermissions = 0600
+
+// HistoryFileName is the name of the command history file in the user's home directory
+const HistoryFileName = ".myfs_history"
+
+// PromptFormat is the format of the interactive prompt (with the current directory)
+const PromptFormat = "myfs:%s> "
+
+// PromptUninitialized is the interactive prompt if the filesystem is not formatted
+const PromptUninitialized = "myfs> "
+
+// OutputFormatText is the output format printing the command results as plain text
+const OutputFormatText = "text"
+
+// OutputFormatJSON is the output format printing each command result as one JSON object
+const OutputFormatJSON = "json"
+
+// EncodingUTF8 is the encoding of the file content printed as it is in the JSON output
+const EncodingUTF8 = "utf-8"
+
+// EncodingBase64 is the encoding of the file content (not valid UTF-8) printed in base64 in the JSON output
+const EncodingBase64 = "base64"
+
+// ImageDiffMode is the program option comparing two filesystem files instead of opening one
+const ImageDiffMode = "--diff"
+
+// StatusOK is the status of a successful command in the JSON output
+const StatusOK = "ok"
+
+// StatusError is the status of a failed command in the JSON output
+const StatusError = "error"
+
+// EntryTypeFile is the type of a file entry in the JSON output
+const EntryTypeFile = "file"
+
+// EntryTypeDir is the type of a directory entry in the JSON output
+const EntryTypeDir = "dir"
+
+// FindNameOpt is the find option filtering the entries by the name pattern
+const FindNameOpt = "-name"
+
+// FindTypeOpt is the find option filtering the entries by the type
+const FindTypeOpt = "-type"
+
+// FindSizeOpt is the find option filtering the entries by the size
+const FindSizeOpt = "-size"
+
+// FindMaxDepthOpt is the find option limiting the depth of the search
+const FindMaxDepthOpt = "-maxdepth"
+
+// FindExecOpt is the find option executing the rest of the line as a command for each match
+const FindExecOpt = "-exec"
+
+// FindExecPlaceholder is replaced by the matched path in the executed command
+const FindExecPlaceholder = "{}"
+
+// FindExecTerminators are the optional words terminating the executed command
+var FindExecTerminators = []string{";", "\\;"}
+
+// FindTypeFile is the find type value of a file
+const FindTypeFile = "f"
+
+// FindTypeDir is the find type value of a directory
+const FindTypeDir = "d"
+
+// SizeGreaterPrefix is the prefix of the size value meaning "greater than"
+const SizeGreaterPrefix = "+"
+
+// SizeLessPrefix is the prefix of the size value meaning "less than"
+const SizeLessPrefix = "-"
+
+// TreeLevelOpt is the tree option limiting the depth of the printed tree
+const TreeLevelOpt = "-L"
+
+// TreeBranch is the prefix of a tree entry followed by its siblings
+const TreeBranch = "├── "
+
+// TreeLastBranch is the prefix of the last tree entry in its directory
+const TreeLastBranch = "└── "
+
+// TreeIndent is the indentation below a tree entry followed by its siblings
+const TreeIndent = "│   "
+
+// TreeLastIndent is the indentation below the last tree entry in its directory
+const TreeLastIndent = "    "
+
+// DiskUsageSummaryOpt is the du option printing only the total of the path
+const DiskUsageSummaryOpt = "-s"
+
+// SelfRefMatch is the stat status of the self reference equal to the parent directory copy
+const SelfRefMatch = "match"
+
+// SelfRefMismatch is the stat status of the self reference different from the parent directory copy
+const SelfRefMismatch = "mismatch"
+
+// SelfRefNone is the stat status of root (it has no parent directory copy)
+const SelfRefNone = "none"
+
+// LineCountOpt is the head and tail option setting the number of the printed lines
+// (the number of the printed bytes for hexdump)
+const LineCountOpt = "-n"
+
+// GrepIgnoreCaseOpt is the grep option matching case insensitively
+const GrepIgnoreCaseOpt = "-i"
+
+// GrepLineNumberOpt is the grep option printing the line numbers
+const GrepLineNumberOpt = "-n"
+
+// HexdumpClusterOpt is the hexdump option printing the raw cluster instead of a file
+const HexdumpClusterOpt = "--cluster"
+
+// RegexpIgnoreCaseFlag is the regular expression flag matching case insensitively
+const RegexpIgnoreCaseFlag = "(?i)"
+
+// TextFileHeaderFormat is the header printed before each file by head and tail if more files are printed
+const TextFileHeaderFormat = "==> %s <==\n"
+
+// WordCountTotalName is the name of the total line printed by wc for more files
+const WordCountTotalName = "total"
+
+// HexdumpSqueezeLine replaces the repeated lines of the hex dump
+const HexdumpSqueezeLine = "*"
+
+// RedirectWriteOp is the echo operator writing the text to the file (replacing its content)
+const RedirectWriteOp = ">"
+
+// RedirectAppendOp is the echo operator appending the text to the file
+const RedirectAppendOp = ">>"
+
+// HeredocOp is the script operator starting the here-document ("<<DELIM" or "<< DELIM")
+const HeredocOp = "<<"
+
+// TruncateSizeOpt is the truncate option setting the new size of the file
+const TruncateSizeOpt = "-s"
+
+// CompactHeadroomOpt is the compact option setting the free space kept after the used clusters
+const CompactHeadroomOpt = "--headroom"
+
+// CompactSparseOpt is the compact option discarding the content of the free clusters
+const CompactSparseOpt = "--sparse"
+
+// ChecksumCheckOpt is the checksum option verifying the checksums listed in the manifest
+const ChecksumCheckOpt = "-c"
+
+// ChecksumHostOpt is the checksum option reading the manifest from the host filesystem
+const ChecksumHostOpt = "--host"
+
+// ChecksumLineFormat is the format of the checksum line (the same as the manifest line)
+const ChecksumLineFormat = "%s  %s\n"
+
+// ChecksumBinaryMark is the optional mark of the binary mode before the path in the manifest line
+const ChecksumBinaryMark = "*"
+
+// ChecksumOKStatus is the status of the file matching its checksum
+const ChecksumOKStatus = "OK"
+
+// ChecksumFailedStatus is the status of the file not matching its checksum
+const ChecksumFailedStatus = "FAILED"
+
+// ChecksumUnreadableStatus is the status of the file that cannot be read
+const ChecksumUnreadableStatus = "FAILED open or read"
+
+// CompareHostOpt is the cmp and diff option reading the second path from the host filesystem
+const CompareHostOpt = "--host"
+
+// DiffRecursiveOpt is the diff option comparing the directories recursively
+const DiffRecursiveOpt = "-r"
+
+// CompareDifferFormat is the format of the first difference printed by cmp (the byte and the line are 1-based)
+const CompareDifferFormat = "%s %s differ: byte %d, line %d\n"
+
+// CompareEOFFormat is the format printed by cmp if the file is the prefix of the other one
+const CompareEOFFormat = "EOF on %s after byte %d\n"
+
+// DiffBinaryFormat is the format printed by diff for the differing binary files
+const DiffBinaryFormat = "Binary files %s and %s differ: byte %d\n"
+
+// DiffFirstFileHeader is the unified diff header of the first file
+const DiffFirstFileHeader = "--- %s\n"
+
+// DiffSecondFileHeader is the unified diff header of the second file
+const DiffSecondFileHeader = "+++ %s\n"
+
+// DiffAddedStatus is the status of the entry present only in the second directory
+const DiffAddedStatus = "added"
+
+// DiffRemovedStatus is the status of the entry present only in the first directory
+const DiffRemovedStatus = "removed"
+
+// DiffChangedStatus is the status of the entry differing in the directories
+const DiffChangedStatus = "changed"
+
+// DiffModifiedStatus is the status of the file whose size or content differs in the filesystems
+const DiffModifiedStatus = "modified"
+
+// ImageDiffFieldFormat is the format of the differing superblock field (name, first and second value)
+const ImageDiffFieldFormat = "superblock %s: %s -> %s\n"
+
+// ImageDiffFatFormat is the format of the differing FAT entry (FAT index, cluster, first and second value)
+const ImageDiffFatFormat = "fat%d[%d]: %d -> %d\n"
+
+// ImageDiffClustersFormat is the format of the run of the differing data clusters (first and last cluster)
+const ImageDiffClustersFormat = "clusters %d-%d\n"
+
+// FragmentationFormat is the format of the fragmentation score (label, score, fragmented and all chains)
+const FragmentationFormat = "%s %.1f%% (%d of %d chains fragmented)\n"
@@ -49,3 +49,33 @@ const FATableCount uint8 = 2
 
 // ByteSizeInt is the size of a byte
 const ByteSizeInt = 256
+
+// MaxHistoryLength is the maximum number of lines kept in the command history
+const MaxHistoryLength = 1000
+
+// DefaultLineCount is the number of the lines printed by head and tail if not specified
+const DefaultLineCount = 10
+
+// HexdumpBytesPerLine is the number of the bytes printed on one hex dump line
+const HexdumpBytesPerLine = 16
+
+// DiffContextLines is the number of the unchanged lines printed around the changes by diff
+const DiffContextLines = 3
+
+// DiffMaxEdits is the maximum number of the inserted and deleted lines computed by diff
+const DiffMaxEdits = 5000
+
+// BinaryProbeSize is the number of the leading bytes searched for a NUL byte to detect binary content
+const BinaryProbeSize = 8000
+
+// DefaultCompactHeadroom is the free space in bytes kept after the used clusters by compact if not specified
+const DefaultCompactHeadroom uint32 = 0
+
+// MaxDirCachePaths is the maximum number of the resolved paths kept in the directory cache
+const MaxDirCachePaths = 4096
+
+// DirListingIndexMinEntries is the minimum number of the entries of a cached directory listing indexed by name
+const DirListingIndexMinEntries = 32
+
+// DirIndexThreshold is the number of the entries a directory has to exceed to get the on-disk directory index
+const DirIndexThreshold = 256
@@ -1,9 +1,30 @@
 // consts package contains all the constants used in the project
 package consts
 
-const HelpMsg = `Usage: myfilesystem <filesystem_path>
+const HelpMsg = `Usage: myfilesystem <filesystem_path> [options]
 A simplified filesystem program based on pseudoFAT. The <filesystem_path> must be a valid path to a pseudoFAT filesystem file.
 
+Options:
+  -r, --read-only  - Open the filesystem read-only. The file is locked only while it is loaded,
+                     so a writing session can be started while a read-only session is running.
+                     Opening fails with "Image in use" while a writing session has the file opened.
+  -c "c1; c2"      - Execute the ';' separated commands and exit. A ';' inside quotes or escaped ("\;")
+                     does not separate the commands, nor does the standalone ';' ending "find -exec".
+  -f s1            - Execute the commands from the host file "s1" (one command per line) and exit.
+  --keep-going     - With -c or -f, continue after a failed command instead of stopping.
+                     The exit status is non-zero if any command failed.
+  --output fmt     - Output format of the commands: "text" (default) or "json". In the JSON mode every
+                     command prints one JSON object per line with "command", "status" ("ok" or "error"),
+                     "error_code", "error" and "payload" (e.g. "ls" entries, "info" clusters) and the
+                     logging is written to stderr. The "cat" content is base64 encoded if it is not
+                     valid UTF-8 (the payload "encoding" is "base64" instead of "utf-8").
+
+Usage: myfilesystem --diff <filesystem_path> <filesystem_path> [--clusters] [--output fmt]
+Compare two filesystem files (opened read-only): the differing superblock fields, the paths added,
+removed or modified (by size and SHA-256 of the content) and the differing FAT entries.
+  --clusters       - Also list the data clusters whose content differs.
+The exit status is 0 if the filesystems are the same, 1 if they differ and 2 if they could not be compared.
+
 Commands:
   help           - Display this help message.
   exit           - Exit the program.
@@ -16,14 +37,99 @@ Commands:
   cat s1         - Display contents of file "s1".
   cd a1          - Change current directory to "a1".
   pwd            - Print the current working directory.
+  head [-n N] s1 ...
+                 - Display the first "N" (default 10) lines of the files.
+  tail [-n N] s1 ...
+                 - Display the last "N" (default 10) lines of the files.
+  wc s1 ...      - Display the number of lines, words and bytes of the files.
+  grep [-i] [-n] p s1 ...
+                 - Display the lines of the files matching the regular expression "p"
+                   ("-i" ignores the case, "-n" prints the line numbers).
+  hexdump [-n N] s1
+                 - Display the (first "N") bytes of file "s1" in hex and ASCII ("xxd" is an alias).
+  hexdump --cluster N
+                 - Display the raw content of cluster "N" (offsets within the filesystem file).
+  echo [text...] [>|>> s1]
+                 - Display the text, or write it to file "s1" with ">" (replacing the content)
+                   or append it with ">>" (the file is created if it does not exist).
+                   The operator can be attached ("echo hi >f"), a quoted ">" is the text.
+  truncate -s size s1
+                 - Shrink or extend (with zeros) file "s1" to the size in bytes or with a unit.
+  write s1 <<DELIM
+                 - In a script loaded by "load", replace the content of file "s1" with the
+                   following lines up to the line "DELIM" (variables are expanded).
+  sha256sum s1 ...
+                 - Display the SHA-256 checksums of the files ("md5sum" and "crc32" for MD5 and CRC-32).
+  sha256sum -c s1 [--host]
+                 - Verify the checksums listed in file "s1" (lines "CHECKSUM  path" as printed above),
+                   "s1" is in the filesystem or on the disk with "--host".
+  cmp a1 a2 [--host]
+                 - Compare files "a1" and "a2" byte by byte and display the first difference
+                   ("a2" is on the disk with "--host").
+  diff [-r] a1 a2 [--host]
+                 - Display the unified diff of text files "a1" and "a2" (the first differing byte
+                   of binary files). With "-r" compare directories "a1" and "a2" recursively and
+                   list the added, removed and changed entries ("a2" is on the disk with "--host").
+  defrag [a1]    - Move the cluster chains of "a1" (the whole filesystem by default) and of all entries
+                   below it into contiguous runs and display the fragmentation score before and after
+                   (the percentage of the chain links to a non-adjacent cluster). It can be interrupted,
+                   the chains moved so far are kept.
   info s1        - Display cluster information of file "s1".
+  stat a1        - Display metadata of file or directory "a1": type, size, start and parent cluster,
+                   the clusters and their contiguous runs (with byte offsets in the filesystem file)
+                   and whether the self reference matches the copy in the parent directory.
   incp s1 s2     - Import file "s1" from disk to location "s2" in the filesystem.
   outcp s1 s2    - Export file "s1" from filesystem to "s2" on the disk.
-  load s1        - Load and execute commands from file "s1" sequentially (one command per line).
+  load [-e|--continue-on-error] s1
+                 - Load and execute commands from file "s1" sequentially (one command per line).
+                   Failed commands are reported with their line number and a summary is printed.
+                   With "-e" (or "set -e" inside the script) the script stops on the first failure,
+                   "set +e" or "--continue-on-error" continues after failures (default).
+                   Scripts can also use:
+                     set VAR value            - set variable used as $VAR or ${VAR} ($? is the last status)
+                     if [!] exists a1 ... [else ...] end
+                     for VAR in w1 w2 ... end - glob patterns (*, ?, [abc]) are matched in the filesystem,
+                                                a pattern matching nothing fails (as in the commands)
+                     include s2               - execute script "s2" with the same variables
   format <size>  - Format the filesystem to the specified size, overwriting existing data.
+  resize <size>  - Resize the filesystem to the specified size keeping its data. When shrinking,
+                   the used clusters beyond the new size are moved to the free clusters before it
+                   (it fails without changes if the data does not fit).
+  compact [--headroom size] [--sparse]
+                 - Move all used clusters to the front and shrink the filesystem to them plus "size"
+                   of free space (e.g. "1MB", none by default). With "--sparse" the content of the free
+                   clusters is discarded, so they are not stored in the filesystem file (empty
+                   clusters are deallocated if the host filesystem supports sparse files).
+  find [a1] [-name p] [-type f|d] [-size [+|-]n] [-maxdepth n] [-exec cmd ...]
+                 - Find the entries below "a1" (or current directory) and print their absolute paths.
+                   "-name" matches the name with the glob pattern "p", "-size" compares the size
+                   in bytes or with a unit (e.g. "+10KB" larger, "-1MB" smaller), "-maxdepth" limits
+                   the depth below "a1". "-exec" executes the rest of the line for each entry with
+                   "{}" replaced by its path (e.g. "find logs -name *.log -exec rm {}").
+  tree [-L n] [a1]
+                 - Print the directory tree below "a1" (or current directory), "n" levels deep.
+  du [-s] [a1]   - Print the clusters and bytes consumed by "a1" (or current directory) and each
+                   directory below it (only "a1" with "-s"), including the self reference clusters,
+                   the entry clusters in the parent directories and the directory index clusters.
+  df             - Print the total, used, free and bad clusters (and bytes) of the filesystem and
+                   the overhead of the self reference and parent entry clusters.
   check          - Check the filesystem for errors.
   bug s1         - Simulate a bug in the filesystem for file "s1".
 
+Path arguments can be glob patterns matched in the filesystem ("incp" source and "outcp"
+destination on the disk): "*" matches any characters, "?" one character, "[abc]" one of
+the characters and "**" any number of directories (e.g. "rm *.txt", "outcp logs/*.log out").
+The command is executed for each matched path. If the source matches more paths, the destination
+is treated as a directory. The compared paths ("cmp", "diff"), the "cd" directory and the written file
+("echo >", "write") have to match one path. Sizes, option values and the "echo" text are not expanded.
+A pattern without a match fails with "NO MATCH" and nothing is executed.
+
+The single or double quotes group the words with spaces into one argument (e.g. grep "a b" f)
+and are removed; a quote that is not closed fails with "UNTERMINATED QUOTE".
+
+If the input is a terminal, the line can be edited (arrows, Home/End, Ctrl+A/E/K/U/W), Up/Down browse
+the command history (saved to "~/.myfs_history") and Tab completes command names and filesystem paths.
+
 Example:
   To create a filesystem, format it, and perform operations:
     $ myfilesystem myfs.pseudo
@@ -49,9 +155,30 @@ const InvalFSPathChars = "The path to the filesystem contains invalid characters
 // InvalProgArgsCount is the message displayed when the program arguments are invalid
 const InvalProgArgsCount = "Invalid number of program arguments"
 
+// UnknownProgOption is the message displayed when an unknown program option is provided
+const UnknownProgOption = "Unknown program option"
+
+// ConflictingProgOptions is the message displayed when the program options cannot be combined
+const ConflictingProgOptions = "Options '-c' and '-f' cannot be combined, '--keep-going' requires '-c' or '-f' and '--clusters' is accepted only by '--diff'"
+
+// InvalidOutputFormat is the message displayed when an unsupported output format is provided
+const InvalidOutputFormat = "Unsupported output format (use 'text' or 'json')"
+
+// ScriptNotFound is the message displayed when the script file for the -f option cannot be read
+const ScriptNotFound = "The script file cannot be read."
+
+// CmdFailedMsg is the message format displayed when a command fails in non-interactive mode (origin, command)
+const CmdFailedMsg = "%s: command \"%s\" failed\n"
+
 // FSPathTooLong is the message displayed when the filesystem path is too long
 const FSPathIsDir = "The chosen file is a directory."
 
+// FSInUse is the message displayed when the filesystem file is locked by another process
+const FSInUse = "Image in use: the filesystem file is opened for writing (or is being loaded) by another process."
+
+// FSReadOnlyNotExists is the message displayed when a non-existing filesystem file is opened read-only
+const FSReadOnlyNotExists = "The filesystem file does not exist and cannot be created in read-only mode."
+
 // FileNotFilesys is the message displayed when the file is not a pseudoFAT filesystem file
 const FileNotFilesys = "Warning: The file is not a pseudoFAT filesystem file. It may be corrupted. It can only be formatted which will ERASE ALL DATA. Proceed with caution."
 
@@ -73,5 +200,20 @@ const NotEmpty = "NOT EMPTY"
 // InvalidPath is the message displayed when the path is invalid
 const InvalidPath = "INVALID PATH CHOICE FOR SELECTED OPERATION"
 
+// ScriptCmdFailedMsg is the message format displayed when a script command fails (script, line, command, error)
+const ScriptCmdFailedMsg = "%s:%d: %s: %s\n"
+
+// ScriptSummaryMsg is the message format displayed after the script execution (script, succeeded, failed)
+const ScriptSummaryMsg = "Script \"%s\" finished: %d succeeded, %d failed\n"
+
+// ScriptStoppedMsg is the message displayed when the script was stopped on a failure
+const ScriptStoppedMsg = "Script stopped on the first failure."
+
+// ScriptSyntaxErrMsg is the message format displayed when the script contains a syntax error (script, error)
+const ScriptSyntaxErrMsg = "%s: syntax error at %s\n"
+
 // CmdSuccessMsg is the message displayed when the command is successful
 const CmdSuccessMsg = "OK"
+
+// ChecksumMismatchMsg is the summary of the failed checksum verification
+const ChecksumMismatchMsg = "WARNING: %d of %d computed checksums did NOT match\n"
@@ -0,0 +1,309 @@
+// error_codes.go contains the stable error codes and the messages for the user.
+package custom_errors
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode is a stable code identifying the kind of the error
+type ErrorCode string
+
+// Error codes of the defined errors
+const (
+	CodeInternal            ErrorCode = "INTERNAL_ERROR"
+	CodeInvalArgsCount      ErrorCode = "INVALID_ARGS_COUNT"
+	CodeEmptyPath           ErrorCode = "EMPTY_PATH"
+	CodePathTooLong         ErrorCode = "PATH_TOO_LONG"
+	CodeInvalidPathChar     ErrorCode = "INVALID_PATH_CHARACTER"
+	CodeUnknownPathsCount   ErrorCode = "UNKNOWN_PATHS_COUNT"
+	CodeInvalFormatUnits    ErrorCode = "INVALID_FORMAT_UNITS"
+	CodeParsingUnits        ErrorCode = "PARSING_UNITS"
+	CodeInvalidFilesize     ErrorCode = "INVALID_FILESIZE_FORMAT"
+	CodeNilCmd              ErrorCode = "NIL_COMMAND"
+	CodeEmptyCmdName        ErrorCode = "EMPTY_COMMAND_NAME"
+	CodeUnknownCmd          ErrorCode = "UNKNOWN_COMMAND"
+	CodeHelpWanted          ErrorCode = "HELP_WANTED"
+	CodeIsDir               ErrorCode = "IS_DIRECTORY"
+	CodeIsFile              ErrorCode = "IS_FILE"
+	CodeNilPointer          ErrorCode = "NIL_POINTER"
+	CodeStructToBytes       ErrorCode = "STRUCT_TO_BYTES"
+	CodeBytesToStruct       ErrorCode = "BYTES_TO_STRUCT"
+	CodeInvalidFileSys      ErrorCode = "INVALID_FILESYSTEM"
+	CodeCreatingFile        ErrorCode = "CREATING_FILE"
+	CodeOpeningFile         ErrorCode = "OPENING_FILE"
+	CodeFSUninitialized     ErrorCode = "FILESYSTEM_UNINITIALIZED"
+	CodeDiskTooSmall        ErrorCode = "DISK_TOO_SMALL"
+	CodeInvalidFatCount     ErrorCode = "INVALID_FAT_COUNT"
+	CodeReadingFat          ErrorCode = "READING_FAT"
+	CodeConvertingFat       ErrorCode = "CONVERTING_FAT"
+	CodeDataTooSmall        ErrorCode = "DATA_TOO_SMALL"
+	CodeInvalStartCluster   ErrorCode = "INVALID_START_CLUSTER"
+	CodeNoFreeCluster       ErrorCode = "NO_FREE_CLUSTER"
+	CodeDirNotFound         ErrorCode = "DIRECTORY_NOT_FOUND"
+	CodeInvalidPath         ErrorCode = "INVALID_PATH"
+	CodePathNotFound        ErrorCode = "PATH_NOT_FOUND"
+	CodeDirNotEmpty         ErrorCode = "DIRECTORY_NOT_EMPTY"
+	CodeInvalidDirEntryName ErrorCode = "INVALID_ENTRY_NAME"
+	CodeDirAlreadyExists    ErrorCode = "DIRECTORY_EXISTS"
+	CodeEntryExists         ErrorCode = "ENTRY_EXISTS"
+	CodeDirInUse            ErrorCode = "DIRECTORY_IN_USE"
+	CodeInFileNotFound      ErrorCode = "INPUT_FILE_NOT_FOUND"
+	CodeEntryNotFound       ErrorCode = "ENTRY_NOT_FOUND"
+	CodeBadCluster          ErrorCode = "BAD_CLUSTER"
+	CodeImageInUse          ErrorCode = "IMAGE_IN_USE"
+	CodeReadOnly            ErrorCode = "READ_ONLY"
+	CodeUnknownOption       ErrorCode = "UNKNOWN_OPTION"
+	CodeConflictingOptions  ErrorCode = "CONFLICTING_OPTIONS"
+	CodeInvalidOutputFormat ErrorCode = "INVALID_OUTPUT_FORMAT"
+	CodeFileNotFound        ErrorCode = "FILE_NOT_FOUND"
+	CodeScriptFailed        ErrorCode = "SCRIPT_FAILED"
+	CodeScriptSyntax        ErrorCode = "SCRIPT_SYNTAX"
+	CodeScriptCycle         ErrorCode = "SCRIPT_CYCLE"
+	CodeUndefinedVariable   ErrorCode = "UNDEFINED_VARIABLE"
+	CodeInvalidPattern      ErrorCode = "INVALID_PATTERN"
+	CodeNoMatch             ErrorCode = "NO_MATCH"
+	CodeAmbiguousPattern    ErrorCode = "AMBIGUOUS_PATTERN"
+	CodePartialFailure      ErrorCode = "PARTIAL_FAILURE"
+	CodeInvalidOptionValue  ErrorCode = "INVALID_OPTION_VALUE"
+	CodeInvalidClusterChain ErrorCode = "CLUSTER_CHAIN_MISMATCH"
+	CodeInvalidSeek         ErrorCode = "INVALID_SEEK"
+	CodeClusterOutOfRange   ErrorCode = "CLUSTER_OUT_OF_RANGE"
+	CodeMissingInput        ErrorCode = "MISSING_INPUT"
+	CodeChecksumMismatch    ErrorCode = "CHECKSUM_MISMATCH"
+	CodeInvalidManifest     ErrorCode = "INVALID_MANIFEST"
+	CodeDiffTooLarge        ErrorCode = "DIFF_TOO_LARGE"
+	CodeFilesDiffer         ErrorCode = "FILES_DIFFER"
+	CodeInterrupted         ErrorCode = "INTERRUPTED"
+	CodeResizeNoSpace       ErrorCode = "RESIZE_NO_SPACE"
+	CodeSparseUnsupported   ErrorCode = "SPARSE_UNSUPPORTED"
+	CodeDirIndexCorrupted   ErrorCode = "DIR_INDEX_CORRUPTED"
+	CodeUnterminatedQuote   ErrorCode = "UNTERMINATED_QUOTE"
+)
+
+// codedError binds the defined error to its code
+type codedError struct {
+	err  error
+	code ErrorCode
+}
+
+// codedErrors are the defined errors with their codes.
+//
+// The code is the one of the first error of this list matching the error (by errors.Is),
+// not the first one found in the error chain.
+var codedErrors = []codedError{
+	{ErrInvalArgsCount, CodeInvalArgsCount},
+	{ErrEmptyPath, CodeEmptyPath},
+	{ErrPathTooLong, CodePathTooLong},
+	{ErrInvalidPathCharacter, CodeInvalidPathChar},
+	{ErrUnknownPathsCount, CodeUnknownPathsCount},
+	{ErrInvalFormatUnits, CodeInvalFormatUnits},
+	{ErrParsingUnits, CodeParsingUnits},
+	{ErrInvalidFilesizeFormat, CodeInvalidFilesize},
+	{ErrNilCmd, CodeNilCmd},
+	{ErrEmptyCmdName, CodeEmptyCmdName},
+	{ErrUnknownCmd, CodeUnknownCmd},
+	{ErrHelpWanted, CodeHelpWanted},
+	{ErrIsDir, CodeIsDir},
+	{ErrIsFile, CodeIsFile},
+	{ErrNilPointer, CodeNilPointer},
+	{ErrStructToBytes, CodeStructToBytes},
+	{ErrBytesToStruct, CodeBytesToStruct},
+	{ErrInvalidFileSys, CodeInvalidFileSys},
+	{ErrCreatingFile, CodeCreatingFile},
+	{ErrOpeningFile, CodeOpeningFile},
+	{ErrFSUninitialized, CodeFSUninitialized},
+	{ErrDiskTooSmall, CodeDiskTooSmall},
+	{ErrInvalidFatCount, CodeInvalidFatCount},
+	{ErrReadingFat, CodeReadingFat},
+	{ErrConvertingFat, CodeConvertingFat},
+	{ErrDataTooSmall, CodeDataTooSmall},
+	{ErrInvalStartCluster, CodeInvalStartCluster},
+	{ErrNoFreeCluster, CodeNoFreeCluster},
+	{ErrDirNotFound, CodeDirNotFound},
+	{ErrInvalidPath, CodeInvalidPath},
+	{ErrPathNotFound, CodePathNotFound},
+	{ErrDirNotEmpty, CodeDirNotEmpty},
+	{ErrInvalidDirEntryName, CodeInvalidDirEntryName},
+	{ErrDirAlreadyExists, CodeDirAlreadyExists},
+	{ErrEntryExists, CodeEntryExists},
+	{ErrDirInUse, CodeDirInUse},
+	{ErrInFileNotFound, CodeInFileNotFound},
+	{ErrEntryNotFound, CodeEntryNotFound},
+	{ErrBadCluster, CodeBadCluster},
+	{ErrImageInUse, CodeImageInUse},
+	{ErrReadOnly, CodeReadOnly},
+	{ErrUnknownOption, CodeUnknownOption},
+	{ErrConflictingOptions, CodeConflictingOptions},
+	{ErrInvalidOutputFormat, CodeInvalidOutputFormat},
+	{ErrFileNotFound, CodeFileNotFound},
+	{ErrScriptFailed, CodeScriptFailed},
+	{ErrScriptSyntax, CodeScriptSyntax},
+	{ErrScriptCycle, CodeScriptCycle},
+	{ErrUndefinedVariable, CodeUndefinedVariable},
+	{ErrInvalidPattern, CodeInvalidPattern},
+	{ErrNoMatch, CodeNoMatch},
+	{ErrAmbiguousPattern, CodeAmbiguousPattern},
+	{ErrPartialFailure, CodePartialFailure},
+	{ErrInvalidOptionValue, CodeInvalidOptionValue},
+	{ErrInvalidClusterChain, CodeInvalidClusterChain},
+	{ErrInvalidSeek, CodeInvalidSeek},
+	{ErrClusterOutOfRange, CodeClusterOutOfRange},
+	{ErrMissingInput, CodeMissingInput},
+	{ErrChecksumMismatch, CodeChecksumMismatch},
+	{ErrInvalidManifest, CodeInvalidManifest},
+	{ErrDiffTooLarge, CodeDiffTooLarge},
+	{ErrFilesDiffer, CodeFilesDiffer},
+	{ErrInterrupted, CodeInterrupted},
+	{ErrResizeNoSpace, CodeResizeNoSpace},
+	{ErrSparseUnsupported, CodeSparseUnsupported},
+	{ErrDirIndexCorrupted, CodeDirIndexCorrupted},
+	{ErrUnterminatedQuote, CodeUnterminatedQuote},
+}
+
+// userMessages maps the codes of the errors reported to the user to their messages
+var userMessages = map[ErrorCode]string{
+	CodeInvalArgsCount:      "INVALID NUMBER OF ARGUMENTS",
+	CodeEmptyPath:           "EMPTY PATH",
+	CodePathTooLong:         "PATH TOO LONG",
+	CodeInvalidPathChar:     "INVALID PATH CHARACTER",
+	CodeUnknownPathsCount:   "UNKNOWN COUNT OF PATHS FOR COMMAND (LOGIC ERROR)",
+	CodeInvalFormatUnits:    "INVALID FORMAT UNITS",
+	CodeParsingUnits:        "ERROR PARSING UNITS",
+	CodeInvalidFilesize:     "INVALID FILE SIZE FORMAT",
+	CodeNilCmd:              "NIL COMMAND",
+	CodeEmptyCmdName:        "EMPTY COMMAND NAME",
+	CodeUnknownCmd:          "UNKNOWN COMMAND",
+	CodeIsDir:               "CHOSEN ENTRY IS A DIRECTORY",
+	CodeIsFile:              "CHOSEN ENTRY IS A FILE",
+	CodeInvalidFileSys:      "INVALID FILE SYSTEM",
+	CodeCreatingFile:        "ERROR CREATING FILE",
+	CodePathNotFound:        "PATH NOT FOUND",
+	CodeOpeningFile:         "ERROR OPENING FILE",
+	CodeFSUninitialized:     "FILE SYSTEM IS UNINITIALIZED",
+	CodeDiskTooSmall:        "CHOSEN DISK SIZE IS TOO SMALL FOR THE FILESYSTEM",
+	CodeNoFreeCluster:       "NO FREE CLUSTER",
+	CodeDirNotFound:         "DIRECTORY NOT FOUND",
+	CodeInvalidPath:         "INVALID PATH",
+	CodeDirNotEmpty:         "DIRECTORY NOT EMPTY",
+	CodeInvalidDirEntryName: "INVALID DIRECTORY ENTRY NAME",
+	CodeDirAlreadyExists:    "DIRECTORY ALREADY EXISTS",
+	CodeEntryExists:         "ENTRY ALREADY EXISTS",
+	CodeDirInUse:            "DIRECTORY IS CURRENTLY IN USE (TRY CHANGING CURRENT DIRECTORY)",
+	CodeInFileNotFound:      "INPUT FILE NOT FOUND",
+	CodeEntryNotFound:       "ENTRY NOT FOUND",
+	CodeBadCluster:          "BAD CLUSTER",
+	CodeReadOnly:            "FILESYSTEM IS OPENED READ-ONLY",
+	CodeFileNotFound:        "FILE NOT FOUND",
+	CodeScriptFailed:        "SCRIPT FAILED",
+	CodeScriptSyntax:        "SCRIPT SYNTAX ERROR",
+	CodeScriptCycle:         "RECURSIVE SCRIPT LOAD",
+	CodeUndefinedVariable:   "UNDEFINED VARIABLE",
+	CodeInvalidPattern:      "INVALID PATTERN",
+	CodeNoMatch:             "NO MATCH",
+	CodeAmbiguousPattern:    "AMBIGUOUS PATTERN",
+	CodePartialFailure:      "SOME TARGETS FAILED",
+	CodeUnknownOption:       "UNKNOWN OPTION",
+	CodeInvalidOptionValue:  "INVALID OPTION VALUE",
+	CodeInvalidClusterChain: "CLUSTER CHAIN DOES NOT MATCH FILE SIZE",
+	CodeClusterOutOfRange:   "CLUSTER OUT OF RANGE",
+	CodeMissingInput:        "MISSING HERE-DOCUMENT",
+	CodeChecksumMismatch:    "CHECKSUM MISMATCH",
+	CodeInvalidManifest:     "INVALID CHECKSUM MANIFEST",
+	CodeDiffTooLarge:        "TOO MANY DIFFERENCES FOR LINE DIFF",
+	CodeFilesDiffer:         "FILES DIFFER",
+	CodeInterrupted:         "INTERRUPTED (CHANGES MADE SO FAR ARE KEPT)",
+	CodeResizeNoSpace:       "NOT ENOUGH SPACE FOR THE DATA IN THE RESIZED FILESYSTEM",
+	CodeSparseUnsupported:   "SPARSE FILES ARE NOT SUPPORTED BY THE HOST FILESYSTEM",
+	CodeDirIndexCorrupted:   "DIRECTORY INDEX CORRUPTED",
+	CodeUnterminatedQuote:   "UNTERMINATED QUOTE",
+}
+
+// FSError is an error carrying a stable code, the offending path and the cause
+type FSError struct {
+	// Code identifies the kind of the error
+	Code ErrorCode
+	// Path is the offending path, empty if the error is not related to a path
+	Path string
+	// Cause is the underlying error
+	Cause error
+}
+
+// Error returns the path followed by the cause.
+func (e *FSError) Error() string {
+	if e.Path == "" {
+		return e.Cause.Error()
+	}
+
+	return fmt.Sprintf("%s: %s", e.Path, e.Cause)
+}
+
+// Unwrap returns the cause, so errors.Is and errors.As see through the FSError.
+func (e *FSError) Unwrap() error {
+	return e.Cause
+}
+
+// WithPath annotates the error with the offending path.
+//
+// The path of an already annotated error is kept (the innermost path
+// is the most specific one). Returns nil for nil error.
+func WithPath(err error, path string) error {
+	if err == nil {
+		return nil
+	}
+
+	var pFSErr *FSError
+	if errors.As(err, &pFSErr) && pFSErr.Path != "" {
+		return err
+	}
+
+	return &FSError{Code: GetCode(err), Path: path, Cause: err}
+}
+
+// GetCode returns the code of the error (CodeInternal if the error is not defined).
+func GetCode(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+
+	var pFSErr *FSError
+	if errors.As(err, &pFSErr) && pFSErr.Code != CodeInternal {
+		return pFSErr.Code
+	}
+
+	for _, coded := range codedErrors {
+		if errors.Is(err, coded.err) {
+			return coded.code
+		}
+	}
+
+	return CodeInternal
+}
+
+// GetPath returns the offending path of the error (empty if unknown).
+func GetPath(err error) string {
+	var pFSErr *FSError
+	if errors.As(err, &pFSErr) {
+		return pFSErr.Path
+	}
+
+	return ""
+}
+
+// GetUserMsg returns the message for the user describing the error.
+//
+// Errors not reported to the user are described by their text.
+func GetUserMsg(err error) string {
+	if msg, ok := userMessages[GetCode(err)]; ok {
+		return msg
+	}
+
+	return err.Error()
+}
+
+// IsErrDefined returns true if the error (or any error it wraps) is custom and
+// defined with message for user
+func IsErrDefined(err error) bool {
+	_, ok := userMessages[GetCode(err)]
+	return ok
+}
@@ -0,0 +1,33 @@
+package custom_errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestGetCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"nil", nil, ""},
+		{"defined", ErrPathNotFound, CodePathNotFound},
+		{"wrapped", fmt.Errorf("reading: %w", ErrPathNotFound), CodePathNotFound},
+		{"with path", WithPath(ErrPathNotFound, "/a"), CodePathNotFound},
+		{"undefined", errors.New("x"), CodeInternal},
+		// the order of codedErrors decides, not the order in the chain
+		{"joined", errors.Join(ErrPathNotFound, ErrInvalArgsCount), CodeInvalArgsCount},
+		{"nested", fmt.Errorf("%w: %w", ErrPathNotFound, fmt.Errorf("inner: %w", ErrInvalArgsCount)), CodeInvalArgsCount},
+		{"path error code kept", WithPath(fmt.Errorf("%w", errors.Join(ErrPathNotFound, ErrInvalArgsCount)), "/a"), CodeInvalArgsCount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetCode(tt.err); got != tt.want {
+				t.Errorf("GetCode(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 // ErrInvalArgsCount is an error for invalid number of arguments
-var ErrInvalArgsCount = errors.New("invalid number of arguments)")
+var ErrInvalArgsCount = errors.New("invalid number of arguments")
 
 // ErrEmptyPath is an error for empty path
 var ErrEmptyPath = errors.New("empty path")
@@ -122,25 +122,89 @@ var ErrEntryNotFound = errors.New("entry not found")
 // ErrBadCluster is an error for bad cluster
 var ErrBadCluster = errors.New("bad cluster")
 
-// IsErrDefined returns true if the error is custom and
-// defined with message for user
-func IsErrDefined(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	switch err {
-	case ErrInvalArgsCount, ErrEmptyPath, ErrPathTooLong, ErrInvalidPathCharacter,
-		ErrUnknownPathsCount, ErrInvalFormatUnits, ErrParsingUnits, ErrInvalidFilesizeFormat,
-		ErrNilCmd, ErrEmptyCmdName, ErrUnknownCmd, ErrIsDir, ErrIsFile,
-		ErrInvalidFileSys, ErrCreatingFile, ErrPathNotFound,
-		ErrOpeningFile, ErrFSUninitialized, ErrDiskTooSmall,
-		ErrNoFreeCluster, ErrDirNotFound,
-		ErrInvalidPath, ErrDirNotEmpty, ErrInvalidDirEntryName, ErrDirAlreadyExists,
-		ErrEntryExists, ErrDirInUse, ErrInFileNotFound, ErrEntryNotFound, ErrBadCluster:
-		return true
-
-	default:
-		return false
-	}
-}
+// ErrImageInUse is an error for filesystem file locked by another process
+var ErrImageInUse = errors.New("image in use")
+
+// ErrReadOnly is an error for modifying command in read-only session
+var ErrReadOnly = errors.New("filesystem is opened read-only")
+
+// ErrUnknownOption is an error for unknown program option
+var ErrUnknownOption = errors.New("unknown program option")
+
+// ErrConflictingOptions is an error for program options that cannot be combined
+var ErrConflictingOptions = errors.New("conflicting program options")
+
+// ErrInvalidOutputFormat is an error for unsupported output format
+var ErrInvalidOutputFormat = errors.New("invalid output format")
+
+// ErrFileNotFound is an error for file not found
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrCmdFailed is an error for a command that failed and was already reported to the user
+var ErrCmdFailed = errors.New("command failed")
+
+// ErrScriptFailed is an error for script with at least one failed command
+var ErrScriptFailed = errors.New("script failed")
+
+// ErrScriptSyntax is an error for script with invalid syntax
+var ErrScriptSyntax = errors.New("script syntax error")
+
+// ErrScriptCycle is an error for script loading itself (directly or indirectly)
+var ErrScriptCycle = errors.New("recursive script load")
+
+// ErrUndefinedVariable is an error for undefined script variable
+var ErrUndefinedVariable = errors.New("undefined variable")
+
+// ErrInvalidPattern is an error for malformed glob pattern
+var ErrInvalidPattern = errors.New("invalid pattern")
+
+// ErrNoMatch is an error for glob pattern not matching any path
+var ErrNoMatch = errors.New("no match")
+
+// ErrAmbiguousPattern is an error for glob pattern matching more paths where only one is expected
+var ErrAmbiguousPattern = errors.New("ambiguous pattern")
+
+// ErrPartialFailure is an error for command failing on some of the matched paths
+var ErrPartialFailure = errors.New("some targets failed")
+
+// ErrInvalidOptionValue is an error for invalid value of a command option
+var ErrInvalidOptionValue = errors.New("invalid option value")
+
+// ErrInvalidClusterChain is an error for cluster chain shorter than the file size
+var ErrInvalidClusterChain = errors.New("cluster chain does not match the file size")
+
+// ErrInvalidSeek is an error for seek before the start of the file or with unknown whence
+var ErrInvalidSeek = errors.New("invalid seek")
+
+// ErrClusterOutOfRange is an error for cluster index outside of the data region
+var ErrClusterOutOfRange = errors.New("cluster out of range")
+
+// ErrMissingInput is an error for command expecting a here-document without one
+var ErrMissingInput = errors.New("missing here-document")
+
+// ErrChecksumMismatch is an error for files not matching the checksums of the manifest
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrInvalidManifest is an error for malformed line of the checksum manifest
+var ErrInvalidManifest = errors.New("invalid checksum manifest")
+
+// ErrDiffTooLarge is an error for texts differing in too many lines for the line diff
+var ErrDiffTooLarge = errors.New("diff too large")
+
+// ErrFilesDiffer is an error for compared files or directories that are not the same
+var ErrFilesDiffer = errors.New("files differ")
+
+// ErrInterrupted is an error for operations stopped by the interrupt signal (the filesystem is consistent)
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrResizeNoSpace is an error for not enough space for the data in the resized filesystem
+var ErrResizeNoSpace = errors.New("not enough space for the data in the resized filesystem")
+
+// ErrSparseUnsupported is an error for sparse files not supported by the host filesystem
+var ErrSparseUnsupported = errors.New("sparse files are not supported by the host filesystem")
+
+// ErrDirIndexCorrupted is an error for the directory index not matching the directory
+var ErrDirIndexCorrupted = errors.New("directory index corrupted")
+
+// ErrUnterminatedQuote is an error for command line with a quote that is not closed
+var ErrUnterminatedQuote = errors.New("unterminated quote")
@@ -0,0 +1,99 @@
+// line_editor package provides an interactive line editor for the terminal
+package line_editor
+
+import (
+	"bufio"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/logging"
+	"os"
+	"strings"
+)
+
+// history holds the previously entered lines
+type history struct {
+	// entries are the lines from the oldest to the newest
+	entries []string
+	// path is the path to the history file, empty if the history is not persistent
+	path string
+}
+
+// loadHistory loads the history from the file at the path.
+//
+// Only the last consts.MaxHistoryLength lines are kept (the file is
+// shortened if needed). A missing file means an empty history.
+func loadHistory(path string) *history {
+	pHistory := &history{entries: make([]string, 0), path: path}
+	if path == "" {
+		return pHistory
+	}
+
+	pFile, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return pHistory
+	} else if err != nil {
+		logging.Warn(fmt.Sprintf("Error opening the history file \"%s\": %s", path, err))
+		return pHistory
+	}
+	defer pFile.Close()
+
+	scanner := bufio.NewScanner(pFile)
+	scanner.Buffer(nil, int(consts.MaxInputBufferSize))
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			pHistory.entries = append(pHistory.entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logging.Warn(fmt.Sprintf("Error reading the history file \"%s\": %s", path, err))
+	}
+
+	if len(pHistory.entries) > consts.MaxHistoryLength {
+		pHistory.entries = pHistory.entries[len(pHistory.entries)-consts.MaxHistoryLength:]
+		pHistory.save()
+	}
+
+	return pHistory
+}
+
+// save rewrites the history file with the current entries.
+func (h *history) save() {
+	content := strings.Join(h.entries, "\n") + "\n"
+	err := os.WriteFile(h.path, []byte(content), consts.HistoryFilePermissions)
+	if err != nil {
+		logging.Warn(fmt.Sprintf("Error writing the history file \"%s\": %s", h.path, err))
+	}
+}
+
+// add appends the line to the history (and to the history file).
+//
+// Empty lines and repetitions of the last line are skipped.
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > consts.MaxHistoryLength {
+		h.entries = h.entries[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+
+	pFile, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, consts.HistoryFilePermissions)
+	if err != nil {
+		logging.Warn(fmt.Sprintf("Error opening the history file \"%s\": %s", h.path, err))
+		return
+	}
+	defer pFile.Close()
+
+	_, err = pFile.WriteString(line + "\n")
+	if err != nil {
+		logging.Warn(fmt.Sprintf("Error writing the history file \"%s\": %s", h.path, err))
+	}
+}
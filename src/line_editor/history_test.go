@@ -0,0 +1,98 @@
+package line_editor
+
+import (
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// readHistoryFile returns the lines of the history file.
+func readHistoryFile(t *testing.T, path string) []string {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestLoadHistory(t *testing.T) {
+	dir := t.TempDir()
+
+	if pHistory := loadHistory(filepath.Join(dir, "missing")); len(pHistory.entries) != 0 {
+		t.Errorf("missing file: entries %v", pHistory.entries)
+	}
+	if pHistory := loadHistory(""); len(pHistory.entries) != 0 || pHistory.path != "" {
+		t.Errorf("no file: %+v", pHistory)
+	}
+
+	// the empty lines are skipped
+	path := filepath.Join(dir, "history")
+	if err := os.WriteFile(path, []byte("ls\n\ncd /a\n  \nls\n"), consts.HistoryFilePermissions); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ls", "cd /a", "  ", "ls"}; !slices.Equal(loadHistory(path).entries, want) {
+		t.Errorf("entries %v, want %v", loadHistory(path).entries, want)
+	}
+}
+
+func TestLoadHistoryShortensFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	lines := make([]string, consts.MaxHistoryLength+10)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("cmd %d", i)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), consts.HistoryFilePermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	want := lines[10:]
+	if pHistory := loadHistory(path); !slices.Equal(pHistory.entries, want) {
+		t.Errorf("%d entries from %q", len(pHistory.entries), pHistory.entries[0])
+	}
+	if got := readHistoryFile(t, path); !slices.Equal(got, want) {
+		t.Errorf("history file of %d lines from %q", len(got), got[0])
+	}
+}
+
+func TestHistoryAdd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	pHistory := loadHistory(path)
+
+	// the empty lines and the repetitions of the last line are skipped
+	for _, line := range []string{"ls", "ls", "", "  ", "cd /a", "ls", "ls", "cd /a"} {
+		pHistory.add(line)
+	}
+	want := []string{"ls", "cd /a", "ls", "cd /a"}
+	if !slices.Equal(pHistory.entries, want) {
+		t.Errorf("entries %v, want %v", pHistory.entries, want)
+	}
+	if got := readHistoryFile(t, path); !slices.Equal(got, want) {
+		t.Errorf("history file %v, want %v", got, want)
+	}
+
+	// the history is kept between the sessions
+	pHistory = loadHistory(path)
+	pHistory.add("cd /a")
+	pHistory.add("pwd")
+	want = append(want, "pwd")
+	if got := loadHistory(path).entries; !slices.Equal(got, want) {
+		t.Errorf("reloaded entries %v, want %v", got, want)
+	}
+}
+
+func TestHistoryAddDropsOldest(t *testing.T) {
+	pHistory := loadHistory("")
+	for i := range consts.MaxHistoryLength + 5 {
+		pHistory.add(fmt.Sprintf("cmd %d", i))
+	}
+
+	if len(pHistory.entries) != consts.MaxHistoryLength || pHistory.entries[0] != "cmd 5" {
+		t.Errorf("%d entries from %q", len(pHistory.entries), pHistory.entries[0])
+	}
+}
@@ -0,0 +1,446 @@
+// line_editor package provides an interactive line editor for the terminal
+package line_editor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"kiv-zos-semestral-work/consts"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Key codes handled by the editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// Terminal control sequences written by the editor
+const (
+	seqClearLineEnd = "\x1b[K"
+	seqClearScreen  = "\x1b[H\x1b[2J"
+	seqCursorLeft   = "\x1b[%dD"
+	seqBell         = "\a"
+	seqNewLine      = "\r\n"
+)
+
+// Completer returns the candidates replacing the last word of the line
+// (the line is the text before the cursor).
+type Completer func(line string) []string
+
+// LineEditor reads the lines from the input.
+//
+// If the input is a terminal, the line can be edited (arrows, Home/End,
+// Ctrl+A/E/K/U/W, ...), the history can be browsed (Up/Down) and the last
+// word can be completed (Tab). Otherwise the lines are read as they are.
+type LineEditor struct {
+	// pIn is the input file
+	pIn *os.File
+	// out is the output for the prompt and the echo
+	out io.Writer
+	// isTerminal is true if the input is a terminal
+	isTerminal bool
+	// scanner reads the lines if the input is not a terminal
+	scanner *bufio.Scanner
+	// reader reads the keys if the input is a terminal
+	reader *bufio.Reader
+	// pHistory holds the previously entered lines
+	pHistory *history
+	// completer returns the completion candidates, nil disables the completion
+	completer Completer
+
+	// mutex guards the raw mode state
+	mutex sync.Mutex
+	// pRawState is the terminal state before entering the raw mode, nil if not in the raw mode
+	pRawState *termState
+}
+
+// NewLineEditor creates a line editor reading from the input.
+//
+// The history is loaded from and stored to the historyPath
+// (no persistent history if empty).
+func NewLineEditor(pIn *os.File, out io.Writer, historyPath string, completer Completer) *LineEditor {
+	pEditor := &LineEditor{
+		pIn:        pIn,
+		out:        out,
+		isTerminal: isTerminal(pIn),
+		completer:  completer,
+	}
+
+	if pEditor.isTerminal {
+		pEditor.reader = bufio.NewReader(pIn)
+		pEditor.pHistory = loadHistory(historyPath)
+	} else {
+		pEditor.scanner = bufio.NewScanner(pIn)
+		pEditor.scanner.Buffer(nil, int(consts.MaxInputBufferSize))
+	}
+
+	return pEditor
+}
+
+// IsInteractive returns true if the lines are edited in the terminal.
+func (e *LineEditor) IsInteractive() bool {
+	return e.isTerminal
+}
+
+// ReadLine reads the next line.
+//
+// The prompt is displayed only if the input is a terminal.
+// It returns io.EOF if the input is closed (or Ctrl+D is pressed on an empty line).
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	if !e.isTerminal {
+		if e.scanner.Scan() {
+			return e.scanner.Text(), nil
+		} else if err := e.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	err := e.enterRawMode()
+	if err != nil {
+		return "", err
+	}
+	defer e.Close()
+
+	line, err := e.editLine(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	e.pHistory.add(line)
+	return line, nil
+}
+
+// Close puts the terminal back into the original mode.
+//
+// It is safe to call it from another goroutine (e.g. on program termination)
+// and more than once.
+func (e *LineEditor) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.pRawState == nil {
+		return nil
+	}
+
+	err := restore(e.pIn, e.pRawState)
+	e.pRawState = nil
+	return err
+}
+
+// enterRawMode puts the terminal into the raw mode.
+func (e *LineEditor) enterRawMode() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	pState, err := makeRaw(e.pIn)
+	if err != nil {
+		return err
+	}
+	e.pRawState = pState
+
+	return nil
+}
+
+// lineState is the state of the edited line
+type lineState struct {
+	// prompt is displayed before the line
+	prompt string
+	// buf holds the characters of the line
+	buf []rune
+	// pos is the cursor position in the buf
+	pos int
+	// historyIdx is the index of the displayed history entry (len(entries) for the edited line)
+	historyIdx int
+	// edited is the edited line saved while browsing the history
+	edited []rune
+}
+
+// refresh redraws the line and places the cursor.
+func (e *LineEditor) refresh(pState *lineState) {
+	var sb strings.Builder
+	sb.WriteString("\r")
+	sb.WriteString(pState.prompt)
+	sb.WriteString(string(pState.buf))
+	sb.WriteString(seqClearLineEnd)
+	if pState.pos < len(pState.buf) {
+		sb.WriteString(fmt.Sprintf(seqCursorLeft, len(pState.buf)-pState.pos))
+	}
+
+	io.WriteString(e.out, sb.String())
+}
+
+// insert inserts the characters at the cursor.
+func (pState *lineState) insert(runes []rune) {
+	if len(pState.buf)+len(runes) > int(consts.MaxInputBufferSize) {
+		return
+	}
+
+	newBuf := make([]rune, 0, len(pState.buf)+len(runes))
+	newBuf = append(newBuf, pState.buf[:pState.pos]...)
+	newBuf = append(newBuf, runes...)
+	newBuf = append(newBuf, pState.buf[pState.pos:]...)
+	pState.buf = newBuf
+	pState.pos += len(runes)
+}
+
+// delete removes the characters in the range [from, to) and moves the cursor to from.
+func (pState *lineState) delete(from int, to int) {
+	if from < 0 || to > len(pState.buf) || from >= to {
+		return
+	}
+
+	pState.buf = append(pState.buf[:from], pState.buf[to:]...)
+	pState.pos = from
+}
+
+// showHistory replaces the line with the history entry at the index.
+func (e *LineEditor) showHistory(pState *lineState, idx int) {
+	entries := e.pHistory.entries
+	if idx < 0 || idx > len(entries) || idx == pState.historyIdx {
+		io.WriteString(e.out, seqBell)
+		return
+	}
+
+	if pState.historyIdx == len(entries) {
+		pState.edited = pState.buf
+	}
+
+	if idx == len(entries) {
+		pState.buf = pState.edited
+	} else {
+		pState.buf = []rune(entries[idx])
+	}
+	pState.historyIdx = idx
+	pState.pos = len(pState.buf)
+}
+
+// getCommonPrefix returns the longest common prefix of the words.
+func getCommonPrefix(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
+
+// complete completes the word before the cursor.
+//
+// The word is extended by the common prefix of the candidates. If it cannot
+// be extended and showAll is true, the candidates are listed.
+func (e *LineEditor) complete(pState *lineState, showAll bool) {
+	if e.completer == nil {
+		io.WriteString(e.out, seqBell)
+		return
+	}
+
+	before := string(pState.buf[:pState.pos])
+	wordStart := strings.LastIndex(before, " ") + 1
+	word := before[wordStart:]
+
+	candidates := e.completer(before)
+	if len(candidates) == 0 {
+		io.WriteString(e.out, seqBell)
+		return
+	}
+
+	common := getCommonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(common, consts.PathDelimiter) {
+		common += " "
+	}
+
+	if len(common) > len(word) {
+		pState.delete(pState.pos-len([]rune(word)), pState.pos)
+		pState.insert([]rune(common))
+		return
+	}
+
+	if !showAll {
+		io.WriteString(e.out, seqBell)
+		return
+	}
+
+	// list the candidates without the directory part of the word
+	dirPart := word[:strings.LastIndex(word, consts.PathDelimiter)+1]
+	names := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		names = append(names, strings.TrimPrefix(candidate, dirPart))
+	}
+	io.WriteString(e.out, seqNewLine+strings.Join(names, "  ")+seqNewLine)
+}
+
+// readEscapeSeq reads the rest of the escape sequence and returns its final
+// character together with the numeric parameter (e.g. "3" of "ESC [ 3 ~").
+func (e *LineEditor) readEscapeSeq() (rune, string, error) {
+	r, _, err := e.reader.ReadRune()
+	if err != nil {
+		return 0, "", err
+	}
+	if r != '[' && r != 'O' {
+		return r, "", nil
+	}
+
+	param := ""
+	for {
+		r, _, err = e.reader.ReadRune()
+		if err != nil {
+			return 0, "", err
+		}
+		if r < '0' || r > '9' {
+			return r, param, nil
+		}
+		param += string(r)
+	}
+}
+
+// handleEscapeSeq handles the escape sequence (arrows, Home, End, Delete).
+func (e *LineEditor) handleEscapeSeq(pState *lineState) error {
+	final, param, err := e.readEscapeSeq()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case final == 'A':
+		e.showHistory(pState, pState.historyIdx-1)
+	case final == 'B':
+		e.showHistory(pState, pState.historyIdx+1)
+	case final == 'C' && pState.pos < len(pState.buf):
+		pState.pos++
+	case final == 'D' && pState.pos > 0:
+		pState.pos--
+	case final == 'H', final == '~' && (param == "1" || param == "7"):
+		pState.pos = 0
+	case final == 'F', final == '~' && (param == "4" || param == "8"):
+		pState.pos = len(pState.buf)
+	case final == '~' && param == "3":
+		pState.delete(pState.pos, pState.pos+1)
+	}
+
+	return nil
+}
+
+// editLine reads the keys until the line is finished.
+//
+// Expects the terminal to be in the raw mode.
+func (e *LineEditor) editLine(prompt string) (string, error) {
+	pState := &lineState{
+		prompt:     prompt,
+		buf:        make([]rune, 0),
+		historyIdx: len(e.pHistory.entries),
+	}
+	e.refresh(pState)
+
+	lastKey := rune(0)
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			io.WriteString(e.out, seqNewLine)
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyLineFeed:
+			pState.pos = len(pState.buf)
+			e.refresh(pState)
+			io.WriteString(e.out, seqNewLine)
+			return string(pState.buf), nil
+
+		case keyCtrlD:
+			if len(pState.buf) == 0 {
+				io.WriteString(e.out, seqNewLine)
+				return "", io.EOF
+			}
+			pState.delete(pState.pos, pState.pos+1)
+
+		case keyBackspace, keyCtrlH:
+			pState.delete(pState.pos-1, pState.pos)
+
+		case keyTab:
+			e.complete(pState, lastKey == keyTab)
+
+		case keyCtrlA:
+			pState.pos = 0
+
+		case keyCtrlE:
+			pState.pos = len(pState.buf)
+
+		case keyCtrlB:
+			if pState.pos > 0 {
+				pState.pos--
+			}
+
+		case keyCtrlF:
+			if pState.pos < len(pState.buf) {
+				pState.pos++
+			}
+
+		case keyCtrlK:
+			pState.delete(pState.pos, len(pState.buf))
+
+		case keyCtrlU:
+			pState.delete(0, pState.pos)
+
+		case keyCtrlW:
+			// delete the word before the cursor (with the spaces after it)
+			start := pState.pos
+			for start > 0 && pState.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && pState.buf[start-1] != ' ' {
+				start--
+			}
+			pState.delete(start, pState.pos)
+
+		case keyCtrlL:
+			io.WriteString(e.out, seqClearScreen)
+
+		case keyCtrlP:
+			e.showHistory(pState, pState.historyIdx-1)
+
+		case keyCtrlN:
+			e.showHistory(pState, pState.historyIdx+1)
+
+		case keyEscape:
+			err = e.handleEscapeSeq(pState)
+			if err != nil {
+				io.WriteString(e.out, seqNewLine)
+				return "", err
+			}
+
+		default:
+			// ignore the other control characters
+			if r >= ' ' {
+				pState.insert([]rune{r})
+			}
+		}
+
+		lastKey = r
+		e.refresh(pState)
+	}
+}
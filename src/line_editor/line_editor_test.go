@@ -0,0 +1,209 @@
+package line_editor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newScriptedEditor returns the editor reading the keys from the string (as if the terminal was in the raw mode).
+func newScriptedEditor(keys string, entries []string, completer Completer) (*LineEditor, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	pEditor := &LineEditor{
+		out:        out,
+		isTerminal: true,
+		reader:     bufio.NewReader(strings.NewReader(keys)),
+		pHistory:   &history{entries: entries},
+		completer:  completer,
+	}
+	return pEditor, out
+}
+
+func TestEditLine(t *testing.T) {
+	const (
+		up        = "\x1b[A"
+		down      = "\x1b[B"
+		right     = "\x1b[C"
+		left      = "\x1b[D"
+		home      = "\x1b[H"
+		end       = "\x1b[F"
+		homeTilde = "\x1b[1~"
+		del       = "\x1b[3~"
+	)
+
+	tests := []struct {
+		name    string
+		keys    string
+		want    string
+		wantErr error
+	}{
+		{"plain", "ls /a\r", "ls /a", nil},
+		{"line feed", "ls\n", "ls", nil},
+		{"backspace", "lx\x7fs\r", "ls", nil},
+		{"ctrl h", "lx\x08s\r", "ls", nil},
+		{"backspace at start", "\x7fls\r", "ls", nil},
+		{"multibyte", "čřx\x7f\r", "čř", nil},
+		{"control characters ignored", "l\x07s\r", "ls", nil},
+
+		{"arrows", "ac" + left + "b" + right + "d\r", "abcd", nil},
+		{"home and end", "bc" + home + "a" + end + "d\r", "abcd", nil},
+		{"home tilde", "bc" + homeTilde + "a\r", "abc", nil},
+		{"ctrl a and e", "bc\x01a\x05d\r", "abcd", nil},
+		{"ctrl b and f", "ac\x02b\x06d\r", "abcd", nil},
+		{"left at start", left + "a\r", "a", nil},
+		{"delete", "abc" + home + del + "\r", "bc", nil},
+		{"ctrl k", "abcd" + left + left + "\x0b\r", "ab", nil},
+		{"ctrl u", "abcd" + left + "\x15\r", "d", nil},
+		{"ctrl w", "cat /a  \x17\r", "cat ", nil},
+		{"ctrl w in word", "cat abc" + left + "\x17\r", "cat c", nil},
+
+		{"history up", up + "\r", "cd /a", nil},
+		{"history up twice", up + up + "\r", "ls", nil},
+		{"history beyond oldest", up + up + up + "\r", "ls", nil},
+		{"history back to edited", "new" + up + up + down + down + "\r", "new", nil},
+		{"history edit entry", "\x10 /b\r", "cd /a /b", nil},
+		{"history ctrl n", "\x10\x10\x0e\r", "cd /a", nil},
+
+		{"ctrl d on empty line", "\x04", "", io.EOF},
+		{"ctrl d deletes", "ab\x01\x04\r", "b", nil},
+		{"end of input", "ls", "", io.EOF},
+		{"end of input in escape", "ls\x1b[", "", io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pEditor, _ := newScriptedEditor(tt.keys, []string{"ls", "cd /a"}, nil)
+			line, err := pEditor.editLine("> ")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			if line != tt.want {
+				t.Errorf("line %q, want %q", line, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditLineRedraw(t *testing.T) {
+	pEditor, out := newScriptedEditor("ab"+"\x1b[D"+"\r", nil, nil)
+	if _, err := pEditor.editLine("> "); err != nil {
+		t.Fatal(err)
+	}
+
+	// the line is redrawn after each key with the cursor moved back from the end
+	for _, want := range []string{"\r> " + seqClearLineEnd, "\r> ab" + seqClearLineEnd + "\x1b[1D", "\r> ab" + seqClearLineEnd + seqNewLine} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q does not contain %q", out.String(), want)
+		}
+	}
+}
+
+func TestEditLineCompletion(t *testing.T) {
+	candidates := map[string][]string{
+		"cat /d":   {"/dir/"},
+		"cat /f":   {"/file"},
+		"cat /a":   {"/alpha", "/alps"},
+		"cat /alp": {"/alpha", "/alps"},
+	}
+	var requested []string
+	completer := func(line string) []string {
+		requested = append(requested, line)
+		return candidates[line]
+	}
+
+	tests := []struct {
+		name     string
+		keys     string
+		want     string
+		wantList string
+	}{
+		{"directory", "cat /d\t\r", "cat /dir/", ""},
+		{"file", "cat /f\t\r", "cat /file ", ""},
+		{"common prefix", "cat /a\t\r", "cat /alp", ""},
+		{"no candidates", "cat /x\t\r", "cat /x", ""},
+		{"list on second tab", "cat /alp\t\t\r", "cat /alp", "alpha  alps"},
+		{"before cursor", "cat /d x\x1b[D\x1b[D\t\r", "cat /dir/ x", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested = nil
+			pEditor, out := newScriptedEditor(tt.keys, nil, completer)
+			line, err := pEditor.editLine("> ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line != tt.want {
+				t.Errorf("line %q, want %q", line, tt.want)
+			}
+			if tt.wantList != "" && !strings.Contains(out.String(), seqNewLine+tt.wantList+seqNewLine) {
+				t.Errorf("output %q does not list %q", out.String(), tt.wantList)
+			}
+			if len(requested) == 0 {
+				t.Error("completer not called")
+			}
+		})
+	}
+
+	// without a completer only the bell is rung
+	pEditor, out := newScriptedEditor("ls\t\r", nil, nil)
+	if line, err := pEditor.editLine("> "); err != nil || line != "ls" {
+		t.Errorf("line %q, error %v", line, err)
+	}
+	if !strings.Contains(out.String(), seqBell) {
+		t.Errorf("output %q without the bell", out.String())
+	}
+}
+
+func TestGetCommonPrefix(t *testing.T) {
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"abc"}, "abc"},
+		{[]string{"abc", "abd", "ab"}, "ab"},
+		{[]string{"abc", "xyz"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := getCommonPrefix(tt.words); got != tt.want {
+			t.Errorf("getCommonPrefix(%q) = %q, want %q", tt.words, got, tt.want)
+		}
+	}
+}
+
+func TestReadLineNotTerminal(t *testing.T) {
+	pRead, pWrite, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pRead.Close()
+	if _, err = pWrite.WriteString("ls\n\ncd /a\x1b[A\npwd"); err != nil {
+		t.Fatal(err)
+	}
+	pWrite.Close()
+
+	// the lines are read as they are, without the prompt
+	out := &bytes.Buffer{}
+	pEditor := NewLineEditor(pRead, out, "", nil)
+	if pEditor.IsInteractive() {
+		t.Fatal("pipe is interactive")
+	}
+	for _, want := range []string{"ls", "", "cd /a\x1b[A", "pwd"} {
+		line, err := pEditor.ReadLine("> ")
+		if err != nil || line != want {
+			t.Errorf("line %q, error %v, want %q", line, err, want)
+		}
+	}
+	if _, err = pEditor.ReadLine("> "); !errors.Is(err, io.EOF) {
+		t.Errorf("error %v after the last line, want EOF", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("output %q", out.String())
+	}
+}
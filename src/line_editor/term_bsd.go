@@ -0,0 +1,12 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+// line_editor package provides an interactive line editor for the terminal
+package line_editor
+
+import "syscall"
+
+// ioctlGetTermios is the ioctl request reading the terminal attributes
+const ioctlGetTermios = syscall.TIOCGETA
+
+// ioctlSetTermios is the ioctl request setting the terminal attributes
+const ioctlSetTermios = syscall.TIOCSETA
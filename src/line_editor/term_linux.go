@@ -0,0 +1,12 @@
+//go:build linux
+
+// line_editor package provides an interactive line editor for the terminal
+package line_editor
+
+import "syscall"
+
+// ioctlGetTermios is the ioctl request reading the terminal attributes
+const ioctlGetTermios = syscall.TCGETS
+
+// ioctlSetTermios is the ioctl request setting the terminal attributes
+const ioctlSetTermios = syscall.TCSETS
@@ -0,0 +1,30 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+// line_editor package provides an interactive line editor for the terminal
+package line_editor
+
+import (
+	"errors"
+	"os"
+)
+
+// errRawModeUnsupported is returned if the terminal raw mode is not supported on the platform
+var errRawModeUnsupported = errors.New("terminal raw mode is not supported")
+
+// termState is the saved state of the terminal
+type termState struct{}
+
+// isTerminal always returns false, so the plain line reading is used.
+func isTerminal(pFile *os.File) bool {
+	return false
+}
+
+// makeRaw is not supported on this platform.
+func makeRaw(pFile *os.File) (*termState, error) {
+	return nil, errRawModeUnsupported
+}
+
+// restore is not supported on this platform.
+func restore(pFile *os.File, pState *termState) error {
+	return errRawModeUnsupported
+}
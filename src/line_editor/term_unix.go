@@ -0,0 +1,72 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+// line_editor package provides an interactive line editor for the terminal
+package line_editor
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// termState is the saved state of the terminal
+type termState struct {
+	termios syscall.Termios
+}
+
+// getTermios reads the terminal attributes of the file descriptor.
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	termios := &syscall.Termios{}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(ioctlGetTermios), uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return termios, nil
+}
+
+// setTermios sets the terminal attributes of the file descriptor.
+func setTermios(fd uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(ioctlSetTermios), uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// isTerminal returns true if the file is a terminal.
+func isTerminal(pFile *os.File) bool {
+	_, err := getTermios(pFile.Fd())
+	return err == nil
+}
+
+// makeRaw puts the terminal into the raw mode and returns its previous state.
+//
+// The signal generating keys (Ctrl+C) and the output processing
+// are kept, so the program can still be interrupted.
+func makeRaw(pFile *os.File) (*termState, error) {
+	termios, err := getTermios(pFile.Fd())
+	if err != nil {
+		return nil, err
+	}
+
+	pOldState := &termState{termios: *termios}
+
+	termios.Iflag &^= syscall.ICRNL | syscall.IXON | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR
+	termios.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.IEXTEN
+	termios.Cc[syscall.VMIN] = 1
+	termios.Cc[syscall.VTIME] = 0
+
+	err = setTermios(pFile.Fd(), termios)
+	if err != nil {
+		return nil, err
+	}
+
+	return pOldState, nil
+}
+
+// restore puts the terminal back into the saved state.
+func restore(pFile *os.File, pState *termState) error {
+	return setTermios(pFile.Fd(), &pState.termios)
+}
@@ -177,6 +177,11 @@ func (l *Logger) Critical(message string) {
 	l.logMessage(CRITICAL, message)
 }
 
+// SetOutput sets the output stream of the global logger
+func SetOutput(stream *os.File) {
+	getGlobalLogger().Output.SetOutput(stream)
+}
+
 // Debug logs a message at the CRITICAL level
 func Debug(message string) {
 	getGlobalLogger().logMessage(DEBUG, message)
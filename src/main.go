@@ -2,72 +2,168 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"kiv-zos-semestral-work/arg_parser"
 	"kiv-zos-semestral-work/cmd"
 	"kiv-zos-semestral-work/consts"
 	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/line_editor"
 	"kiv-zos-semestral-work/logging"
 	"kiv-zos-semestral-work/pseudo_fat"
 	"kiv-zos-semestral-work/utils"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"syscall"
+	"unicode"
 )
 
+// getValidCmd parses the input into a command and validates it.
+//
+// Invalid commands are reported to the user (in the JSON output mode as the
+// result of the command) and the error is returned.
+func getValidCmd(input string) (*cmd.Command, error) {
+	pCommand, err := cmd.ParseCommand(input)
+	if err != nil {
+		logging.Error(fmt.Sprintf("Error parsing command: %s", err))
+		cmd.PrintResult(cmd.NewCommandResult(strings.TrimSpace(input), nil, err))
+		return nil, err
+	}
+
+	err = cmd.ValidateCommand(pCommand)
+	if err != nil {
+		if cmd.IsJSONOutput() {
+			cmd.PrintResult(cmd.NewCommandResult(strings.TrimSpace(input), nil, err))
+			return nil, err
+		}
+
+		switch {
+		case errors.Is(err, custom_errors.ErrUnknownCmd):
+			logging.Info(fmt.Sprintf("Unknown command: \"%s\"", pCommand.Name))
+			fmt.Println(consts.UnknownCmdMsg)
+			fmt.Println(consts.HintMsg)
+		case custom_errors.IsErrDefined(err):
+			logging.Info(fmt.Sprintf("Invalid command \"%s\": %s", input, err))
+			fmt.Println(custom_errors.GetUserMsg(err))
+		default:
+			logging.Error(fmt.Sprintf("Not specified err: %s", err))
+		}
+		return nil, err
+	}
+
+	logging.Debug(fmt.Sprintf("Parsed command: %s", pCommand.ToString()))
+	return pCommand, nil
+}
+
+// handleExecuteErr handles the errors returned by the command execution.
+func handleExecuteErr(err error) {
+	switch {
+	case errors.Is(err, custom_errors.ErrCmdFailed):
+		// already reported to the user
+		logging.Debug(fmt.Sprintf("Command failed: %s", err))
+	case errors.Is(err, custom_errors.ErrNilPointer):
+		logging.Error("Nil pointer provided to ExecuteCommand")
+	case errors.Is(err, custom_errors.ErrFSUninitialized):
+		logging.Info("File system is uninitialized (command requires initialized file system)")
+		// the JSON result is already printed
+		if !cmd.IsJSONOutput() {
+			fmt.Println(consts.FSUninitializedMsg)
+			fmt.Println(consts.HintMsg)
+		}
+	default:
+		logging.Error(fmt.Sprintf("Not specified err: %s", err))
+	}
+}
+
+// getPrompt returns the interactive prompt with the current directory.
+func getPrompt(pFs *pseudo_fat.FileSystem, pFatsRef *[][]int32, pDataRef *[]byte) string {
+	if cmd.P_CurrDir == nil || *pFatsRef == nil || *pDataRef == nil {
+		return consts.PromptUninitialized
+	}
+
+	pwd, err := utils.GetAbsolutePathFromPwd(pFs, cmd.P_CurrDir, *pFatsRef, *pDataRef)
+	if err != nil {
+		return consts.PromptUninitialized
+	}
+
+	return fmt.Sprintf(consts.PromptFormat, pwd)
+}
+
+// getHistoryPath returns the path to the command history file
+// (empty if the home directory is unknown).
+func getHistoryPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		logging.Warn(fmt.Sprintf("Home directory not found, the command history is not saved: %s", err))
+		return ""
+	}
+
+	return filepath.Join(homeDir, consts.HistoryFileName)
+}
+
 // acceptCmds reads from stdin and parses the input
 // into a command. It sends the command to the cmdIn
-// channel.
+// channel and waits on the cmdDone channel for the
+// command to finish (so the prompt shows the current
+// directory).
 //
 // Its goroutine is closed by program termination, because
-// the scanner.Scan() is blocking so it was too complicated
+// the reading is blocking so it was too complicated
 // to try to synchronize its termination with the main
 // goroutine.
-func acceptCmds(scanner *bufio.Scanner, cmdIn chan *cmd.Command, endFlagChan chan struct{}) {
+func acceptCmds(pEditor *line_editor.LineEditor,
+	getPrompt func() string,
+	cmdIn chan *cmd.Command,
+	cmdDone chan struct{},
+	endFlagChan chan struct{}) {
+
 	defer logging.Debug("acceptCmds goroutine finished")
 
 	for {
-		if scanner.Scan() {
-			input := scanner.Text()
-			logging.Debug(fmt.Sprintf("Read from stdin: \"%s\"", input))
-			pCommand, err := cmd.ParseCommand(input)
-			if err != nil {
-				logging.Error(fmt.Sprintf("Error parsing command: %s", err))
-			} else if err := cmd.ValidateCommand(pCommand); err != nil {
-				switch err {
-				case custom_errors.ErrUnknownCmd:
-					logging.Info(fmt.Sprintf("Unknown command: \"%s\"", pCommand.Name))
-					fmt.Println(consts.UnknownCmdMsg)
-					fmt.Println(consts.HintMsg)
-				default:
-					logging.Error(fmt.Sprintf("Not specified err: %s", err))
-				}
-			} else {
-				logging.Debug(fmt.Sprintf("Parsed command: %s", pCommand))
-				cmdIn <- pCommand
-			}
+		input, err := pEditor.ReadLine(getPrompt())
+		if err == io.EOF {
+			// the input is closed (EOF), break the loop
+			logging.Debug("EOF reached, sending end flag...")
+			endFlagChan <- struct{}{}
+			return
 
-		} else if err := scanner.Err(); err != nil {
+		} else if err != nil {
 			// there was an error reading from stdin
 			logging.Error(fmt.Sprintf("Error reading from stdin: %s", err))
 			endFlagChan <- struct{}{}
 			return
+		}
 
-		} else {
-			// the input is closed (EOF), break the loop
-			logging.Debug("EOF reached, sending end flag...")
-			endFlagChan <- struct{}{}
-			return
+		logging.Debug(fmt.Sprintf("Read from stdin: \"%s\"", input))
+		// empty lines are only re-prompted when editing in the terminal
+		if pEditor.IsInteractive() && strings.TrimSpace(input) == "" {
+			continue
+		}
+
+		pCommand, err := getValidCmd(input)
+		if err == nil {
+			cmdIn <- pCommand
+			<-cmdDone
+
+			// do not prompt again, the program is terminating
+			if pCommand.Name == consts.ExitCommand {
+				return
+			}
 		}
 	}
 }
 
 // interpretCmds reads the commands from the cmdIn channel
-// and interprets them. It sends the result to the stdout.
+// and interprets them. It sends the result to the stdout
+// and signals the cmdDone channel after each command.
 func interpretCmds(cmdOut chan *cmd.Command,
+	cmdDone chan struct{},
 	endFlagChan chan struct{},
 	fsPath string,
 	wg *sync.WaitGroup,
@@ -85,37 +181,195 @@ func interpretCmds(cmdOut chan *cmd.Command,
 			break
 		}
 
-		logging.Debug(fmt.Sprintf("Interpreting command: %s", pCommand))
+		logging.Debug(fmt.Sprintf("Interpreting command: %s", pCommand.ToString()))
 		err := cmd.ExecuteCommand(pCommand, endFlagChan, pFile, pFs, pFatsRef, pDataRef)
 		if err != nil {
-			switch err {
-			case custom_errors.ErrNilPointer:
-				logging.Error("Nil pointer provided to ExecuteCommand")
-			case custom_errors.ErrFSUninitialized:
-				logging.Info("File system is uninitialized (command requires initialized file system)")
-				fmt.Println(consts.FSUninitializedMsg)
-				fmt.Println(consts.HintMsg)
-			default:
-				logging.Error(fmt.Sprintf("Not specified err: %s", err))
+			handleExecuteErr(err)
+		}
+		cmdDone <- struct{}{}
+	}
+}
+
+// nonInteractiveCmd is a command input passed by the program arguments
+type nonInteractiveCmd struct {
+	// input is the raw command input
+	input string
+	// origin describes where the command comes from (for error reporting)
+	origin string
+}
+
+// endsFindExec returns true if the ';' at the position i of the input terminates the -exec command of find
+// (the command is find with the -exec option and the ';' is a standalone word).
+func endsFindExec(input string, i int, cmdInput string) bool {
+	if (i > 0 && !unicode.IsSpace(rune(input[i-1]))) || (i+1 < len(input) && !unicode.IsSpace(rune(input[i+1]))) {
+		return false
+	}
+
+	// the -exec command already terminated by the escaped delimiter is separated by this one
+	words := strings.Fields(cmdInput)
+	if len(words) == 0 || slices.Contains(consts.FindExecTerminators, words[len(words)-1]) {
+		return false
+	}
+	return words[0] == consts.FindCommand && slices.Contains(words[1:], consts.FindExecOpt)
+}
+
+// splitCommands splits the input of the -c option into the commands.
+//
+// The commands are separated by consts.CmdDelimiter outside the quotes. An escaped delimiter ("\;")
+// does not separate the commands (it is passed unescaped), and the standalone delimiter terminating
+// the -exec command of find is kept at the end of the find command.
+func splitCommands(input string) []string {
+	res := make([]string, 0)
+	var sb strings.Builder
+	var quote byte
+
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '\\' && i+1 < len(input) && input[i+1] == consts.CmdDelimiter[0]:
+			// the escaped delimiter is passed to the command unescaped
+			i++
+			c = input[i]
+		case c == consts.CmdDelimiter[0]:
+			if endsFindExec(input, i, sb.String()) {
+				sb.WriteByte(c)
+			}
+			res = append(res, sb.String())
+			sb.Reset()
+			continue
+		}
+		sb.WriteByte(c)
+	}
+
+	return append(res, sb.String())
+}
+
+// getNonInteractiveCmds returns the commands passed with the -c or -f option.
+func getNonInteractiveCmds(pArgs *arg_parser.ProgramArgs) ([]nonInteractiveCmd, error) {
+	res := make([]nonInteractiveCmd, 0)
+
+	if pArgs.Commands != "" {
+		for i, input := range splitCommands(pArgs.Commands) {
+			input = strings.TrimSpace(input)
+			if input == "" {
+				continue
+			}
+			res = append(res, nonInteractiveCmd{input: input, origin: fmt.Sprintf("-c:%d", i+1)})
+		}
+
+		return res, nil
+	}
+
+	scriptData, err := os.ReadFile(pArgs.ScriptPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, line := range strings.Split(string(scriptData), consts.ScriptDelimiter) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, consts.CommentSymbol) {
+			continue
+		}
+		res = append(res, nonInteractiveCmd{input: line, origin: fmt.Sprintf("%s:%d", pArgs.ScriptPath, i+1)})
+	}
+
+	return res, nil
+}
+
+// runNonInteractive executes the commands one by one and returns the exit code.
+//
+// The execution stops on the first failed command unless keepGoing is set.
+// It also stops on the 'exit' command or when the program is interrupted.
+func runNonInteractive(ctx context.Context,
+	cmds []nonInteractiveCmd,
+	keepGoing bool,
+	pFile *os.File,
+	pFs *pseudo_fat.FileSystem,
+	pFatsRef *[][]int32,
+	pDataRef *[]byte) int {
+
+	exitCode := consts.ExitSuccess
+	endFlagChan := make(chan struct{})
+
+	for _, c := range cmds {
+		// stop if interrupted or the exit command was executed
+		select {
+		case <-ctx.Done():
+			logging.Info("Interrupted, skipping the remaining commands...")
+			return consts.ExitFailure
+		case <-endFlagChan:
+			return exitCode
+		default:
+		}
+
+		logging.Debug(fmt.Sprintf("Executing command from %s: \"%s\"", c.origin, c.input))
+		pCommand, err := getValidCmd(c.input)
+		if err == nil {
+			err = cmd.ExecuteCommand(pCommand, endFlagChan, pFile, pFs, pFatsRef, pDataRef)
+			if err != nil {
+				handleExecuteErr(err)
+			}
+		}
+
+		if err != nil {
+			printStatus(fmt.Sprintf(consts.CmdFailedMsg, c.origin, c.input))
+			exitCode = consts.ExitFailure
+			if !keepGoing {
+				return exitCode
 			}
 		}
 	}
+
+	return exitCode
+}
+
+// printStatus prints the session status message (to the log in the JSON output mode,
+// so the standard output holds only the command results).
+func printStatus(msg string) {
+	msg = strings.TrimSuffix(msg, "\n")
+	if cmd.IsJSONOutput() {
+		logging.Info(msg)
+		return
+	}
+
+	fmt.Println(msg)
 }
 
 // handleArgsParserErrAndQuit handles the errors returned by the argument parser.
 func handleArgsParserErrAndQuit(err error) {
-	switch err {
-	case custom_errors.ErrInvalArgsCount:
+	switch {
+	case errors.Is(err, custom_errors.ErrInvalArgsCount):
 		logging.Info("User provided invalid number of arguments")
 		fmt.Printf("%s\n\n%s\n", consts.InvalProgArgsCount, consts.LaunchHintMsg)
 		os.Exit(consts.ExitFailure)
 
-	case custom_errors.ErrHelpWanted:
+	case errors.Is(err, custom_errors.ErrUnknownOption):
+		logging.Info("User provided unknown program option")
+		fmt.Printf("%s\n\n%s\n", consts.UnknownProgOption, consts.LaunchHintMsg)
+		os.Exit(consts.ExitFailure)
+
+	case errors.Is(err, custom_errors.ErrConflictingOptions):
+		logging.Info("User provided conflicting program options")
+		fmt.Printf("%s\n\n%s\n", consts.ConflictingProgOptions, consts.LaunchHintMsg)
+		os.Exit(consts.ExitFailure)
+
+	case errors.Is(err, custom_errors.ErrInvalidOutputFormat):
+		logging.Info("User provided unsupported output format")
+		fmt.Printf("%s\n\n%s\n", consts.InvalidOutputFormat, consts.LaunchHintMsg)
+		os.Exit(consts.ExitFailure)
+
+	case errors.Is(err, custom_errors.ErrHelpWanted):
 		logging.Info("Help requested")
 		fmt.Print(consts.HelpMsg)
 		os.Exit(consts.ExitSuccess)
 
-	case custom_errors.ErrInvalidPathCharacter:
+	case errors.Is(err, custom_errors.ErrInvalidPathCharacter):
 		logging.Info("User provided invalid path for the file system file")
 		fmt.Printf("%s\n\n%s\n", consts.InvalFSPathChars, consts.LaunchHintMsg)
 		os.Exit(consts.ExitFailure)
@@ -126,20 +380,64 @@ func handleArgsParserErrAndQuit(err error) {
 	}
 }
 
-// handleFileErr handles the errors returned by the filesystem path validation.
+// runImageDiff compares the two filesystem files of the diff mode (opened read-only)
+// and returns the exit code (ExitFailure if the filesystems differ, ExitTrouble if
+// they could not be opened, loaded or compared).
+func runImageDiff(pArgs *arg_parser.ProgramArgs) int {
+	images := make([]*cmd.DiffImage, 0, len(pArgs.DiffPaths))
+	for _, path := range pArgs.DiffPaths {
+		pFile, err := getFileFromPath(path, true)
+		if err != nil {
+			printFileErr(err, path)
+			return consts.ExitTrouble
+		}
+		defer pFile.Close()
+
+		pFs, pFats, pData, err := utils.GetFileSystem(pFile)
+		if err != nil {
+			logging.Error(fmt.Sprintf("Error getting the filesystem \"%s\": %s", path, err))
+			return consts.ExitTrouble
+		}
+		releaseReadLock(pFile, path)
+		images = append(images, &cmd.DiffImage{Path: path, PFs: pFs, Fats: *pFats, Data: *pData})
+	}
+
+	err := cmd.DiffImages(images[0], images[1], pArgs.DiffClusters)
+	if errors.Is(err, custom_errors.ErrFilesDiffer) {
+		return consts.ExitFailure
+	} else if err != nil {
+		logging.Error(fmt.Sprintf("Error comparing the filesystems: %s", err))
+		return consts.ExitTrouble
+	}
+
+	return consts.ExitSuccess
+}
+
+// handleFileErr handles the errors returned by the filesystem path validation and exits.
 func handleFileErr(err error, fsPath string) {
-	switch err {
-	case custom_errors.ErrIsDir:
+	printFileErr(err, fsPath)
+	os.Exit(consts.ExitFailure)
+}
+
+// printFileErr logs and prints the errors returned by the filesystem path validation.
+func printFileErr(err error, fsPath string) {
+	switch {
+	case errors.Is(err, custom_errors.ErrIsDir):
 		logging.Info(fmt.Sprintf("Filesystem file \"%s\" is a directory", fsPath))
 		fmt.Printf("%s\n\n%s\n", consts.FSPathIsDir, consts.LaunchHintMsg)
-	case custom_errors.ErrCreatingFile:
+	case errors.Is(err, custom_errors.ErrCreatingFile):
 		logging.Error(fmt.Sprintf("Error creating filesystem file \"%s\"", fsPath))
-	case custom_errors.ErrOpeningFile:
+	case errors.Is(err, custom_errors.ErrOpeningFile):
 		logging.Error(fmt.Sprintf("Error opening filesystem file \"%s\"", fsPath))
+	case errors.Is(err, custom_errors.ErrImageInUse):
+		logging.Info(fmt.Sprintf("Filesystem file \"%s\" is locked by another process", fsPath))
+		fmt.Println(consts.FSInUse)
+	case errors.Is(err, custom_errors.ErrPathNotFound):
+		logging.Info(fmt.Sprintf("Filesystem file \"%s\" does not exist (read-only mode)", fsPath))
+		fmt.Println(consts.FSReadOnlyNotExists)
 	default:
 		logging.Error(fmt.Sprintf("Not specified err: %s", err))
 	}
-	os.Exit(consts.ExitFailure)
 }
 
 // handleProgramTermination handles the program termination
@@ -177,15 +475,28 @@ func handleProgramTermination(
 	logging.Info("Exiting...")
 }
 
-// getFileFromPath returns the file from the path
-func getFileFromPath(fsPath string) (*os.File, error) {
+// getFileFromPath returns the file from the path.
+//
+// The file is locked exclusively for the lifetime of the process if it is opened
+// for writing. A read-only file is locked shared only until it is loaded (see releaseReadLock).
+// Returns ErrImageInUse if the lock cannot be acquired.
+func getFileFromPath(fsPath string, readOnly bool) (*os.File, error) {
 	fileExists, err := utils.FilepathValid(fsPath)
 	if err != nil {
 		return nil, err
 	}
 
 	var pFile *os.File
-	if !fileExists {
+	if readOnly {
+		if !fileExists {
+			return nil, custom_errors.ErrPathNotFound
+		}
+
+		pFile, err = os.Open(fsPath)
+		if err != nil {
+			return nil, custom_errors.ErrOpeningFile
+		}
+	} else if !fileExists {
 		logging.Info(fmt.Sprintf("Filesystem file \"%s\" does not exist, creating it...", fsPath))
 		pFile, err = os.Create(fsPath)
 		if err != nil {
@@ -198,21 +509,40 @@ func getFileFromPath(fsPath string) (*os.File, error) {
 		}
 	}
 
+	// prevent other processes from writing to the file while it is in use
+	// (a reader fails as well, it would read the file half-written)
+	err = utils.LockFile(pFile, !readOnly)
+	if err != nil {
+		pFile.Close()
+		if errors.Is(err, custom_errors.ErrImageInUse) {
+			return nil, err
+		}
+		logging.Error(fmt.Sprintf("Error locking filesystem file \"%s\": %s", fsPath, err))
+		return nil, custom_errors.ErrOpeningFile
+	}
+
 	return pFile, nil
 }
 
+// releaseReadLock releases the shared lock of the filesystem file opened read-only once it is loaded.
+// The filesystem is kept in memory, so the writers do not have to wait for the end of the session.
+func releaseReadLock(pFile *os.File, fsPath string) {
+	if err := utils.UnlockFile(pFile); err != nil {
+		logging.Warn(fmt.Sprintf("Error unlocking filesystem file \"%s\": %s", fsPath, err))
+	}
+}
+
 func main() {
 	// INITIALIZATION OF CONTROL VARIABLES //
 	// to handle signals
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	// scanner is used to read from stdin
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Buffer(nil, int(consts.MaxInputBufferSize))
-
 	// cmdBufferChan is a channel to send the command to the interpreter
 	cmdBufferChan := make(chan *cmd.Command)
+	// cmdDoneChan is a channel to signal the end of the command execution
+	// (buffered so the interpreter never blocks on the finished reader)
+	cmdDoneChan := make(chan struct{}, 1)
 
 	// interpretEndChan is a channel to signal the end of the interpreter
 	interpreterEndChan := make(chan struct{})
@@ -225,18 +555,42 @@ func main() {
 
 	// INITIALIZATION OF THE FILE SYSTEM //
 	// get the filesystem path from the arguments
-	fsPath, err := arg_parser.GetFilenameFromArgs(os.Args)
+	pArgs, err := arg_parser.GetProgramArgs(os.Args)
 	if err != nil {
 		handleArgsParserErrAndQuit(err)
 	}
+	fsPath := pArgs.FsPath
 	logging.Debug(fmt.Sprintf("Filesystem path: %s", fsPath))
+	cmd.IsReadOnly = pArgs.ReadOnly
+	cmd.OutputFormat = pArgs.Output
+	cmd.InterruptChan = ctx.Done()
+	// keep the standard output only for the command results
+	if cmd.IsJSONOutput() {
+		logging.SetOutput(os.Stderr)
+	}
+
+	// DIFF MODE //
+	if pArgs.IsImageDiff() {
+		os.Exit(runImageDiff(pArgs))
+	}
+
+	// get the commands for the non-interactive execution
+	var nonInteractiveCmds []nonInteractiveCmd
+	if !pArgs.IsInteractive() {
+		nonInteractiveCmds, err = getNonInteractiveCmds(pArgs)
+		if err != nil {
+			logging.Error(fmt.Sprintf("Error reading the script file \"%s\": %s", pArgs.ScriptPath, err))
+			fmt.Printf("%s\n\n%s\n", consts.ScriptNotFound, consts.LaunchHintMsg)
+			os.Exit(consts.ExitFailure)
+		}
+	}
 
 	// get the pFile from the path
-	pFile, err := getFileFromPath(fsPath)
+	pFile, err := getFileFromPath(fsPath, pArgs.ReadOnly)
 	if err != nil {
 		handleFileErr(err, fsPath)
 	}
-	defer fmt.Println("Closing file...")
+	defer printStatus("Closing file...")
 	defer pFile.Close()
 
 	// load the filesystem from the file
@@ -245,6 +599,9 @@ func main() {
 		logging.Error(fmt.Sprintf("Error getting the filesystem: %s", err))
 		os.Exit(consts.ExitFailure)
 	}
+	if pArgs.ReadOnly {
+		releaseReadLock(pFile, fsPath)
+	}
 
 	// set the current directory to the root directory
 	if (*pFats != nil) && (*pData != nil) {
@@ -255,9 +612,25 @@ func main() {
 		}
 	}
 
+	// NON-INTERACTIVE EXECUTION //
+	if !pArgs.IsInteractive() {
+		exitCode := runNonInteractive(ctx, nonInteractiveCmds, pArgs.KeepGoing, pFile, pFs, pFats, pData)
+		// deferred calls are skipped by os.Exit
+		printStatus("Closing file...")
+		pFile.Close()
+		os.Exit(exitCode)
+	}
+
 	// USER INTERACTION HANDLING //
-	go acceptCmds(scanner, cmdBufferChan, scannerEndChan)
-	go interpretCmds(cmdBufferChan, interpreterEndChan, fsPath, &wg, pFile, pFs, pFats, pData)
+	// the line editor is used only if stdin is a terminal, otherwise the lines are read as they are
+	pEditor := line_editor.NewLineEditor(os.Stdin, os.Stdout, getHistoryPath(), func(line string) []string {
+		return cmd.GetCompletions(line, pFs, *pFats, *pData)
+	})
+	// the terminal mode has to be restored even if the program is interrupted while reading
+	defer pEditor.Close()
+
+	go acceptCmds(pEditor, func() string { return getPrompt(pFs, pFats, pData) }, cmdBufferChan, cmdDoneChan, scannerEndChan)
+	go interpretCmds(cmdBufferChan, cmdDoneChan, interpreterEndChan, fsPath, &wg, pFile, pFs, pFats, pData)
 
 	// PROGRAM TERMINATION HANDLING //
 	handleProgramTermination(ctx, cmdBufferChan, &wg, scannerEndChan, interpreterEndChan)
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"kiv-zos-semestral-work/arg_parser"
+	"kiv-zos-semestral-work/cmd"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"kiv-zos-semestral-work/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSplitCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"single", "ls", []string{"ls"}},
+		{"two", "mkdir a; ls", []string{"mkdir a", " ls"}},
+		{"empty parts", ";ls;;", []string{"", "ls", "", ""}},
+		{"double quotes", `echo "a;b" > f; ls`, []string{`echo "a;b" > f`, " ls"}},
+		{"single quotes", `echo 'a;b'; ls`, []string{`echo 'a;b'`, " ls"}},
+		{"quote inside other quotes", `echo "it's;x"; ls`, []string{`echo "it's;x"`, " ls"}},
+		{"escaped", `echo a\;b; ls`, []string{"echo a;b", " ls"}},
+		{"find exec terminator", "find / -exec rm {} ; ls", []string{"find / -exec rm {} ;", " ls"}},
+		{"find exec terminator at end", "find / -name x -exec cat {} ;", []string{"find / -name x -exec cat {} ;", ""}},
+		{"find exec escaped terminator", `find / -exec rm {} \; ; ls`, []string{"find / -exec rm {} ; ", " ls"}},
+		{"escaped in quotes", `echo "a\;b"`, []string{`echo "a\;b"`}},
+		{"find without exec", "find / -name x ; ls", []string{"find / -name x ", " ls"}},
+		{"attached delimiter after exec", "find / -exec rm {}; ls", []string{"find / -exec rm {}", " ls"}},
+		{"exec word in other command", "echo -exec ; ls", []string{"echo -exec ", " ls"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitCommands(tt.input)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitCommands(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// captureStdout returns what the function prints to the standard output.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.Bytes()
+	}()
+
+	fn()
+	os.Stdout = stdout
+	w.Close()
+	text := <-done
+	r.Close()
+
+	return string(text)
+}
+
+func TestGetValidCmdJSON(t *testing.T) {
+	// the logging is written to stderr in the JSON output mode
+	cmd.OutputFormat = consts.OutputFormatJSON
+	logging.SetOutput(os.Stderr)
+	defer func() {
+		cmd.OutputFormat = consts.OutputFormatText
+	}()
+
+	tests := []struct {
+		input   string
+		wantErr error
+		code    custom_errors.ErrorCode
+	}{
+		{"   ", custom_errors.ErrEmptyCmdName, custom_errors.CodeEmptyCmdName},
+		{"unknown a", custom_errors.ErrUnknownCmd, custom_errors.CodeUnknownCmd},
+		{"cp a", custom_errors.ErrInvalArgsCount, custom_errors.CodeInvalArgsCount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var err error
+			text := captureStdout(t, func() {
+				_, err = getValidCmd(tt.input)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+
+			// the invalid command is reported as one result
+			var result cmd.CommandResult
+			if jsonErr := json.Unmarshal([]byte(text), &result); jsonErr != nil {
+				t.Fatalf("printed %q: %v", text, jsonErr)
+			}
+			if result.Status != consts.StatusError || result.ErrorCode != string(tt.code) {
+				t.Errorf("result %+v, want the error %s", result, tt.code)
+			}
+		})
+	}
+}
+
+// formatImage creates the filesystem file of the size at the path.
+func formatImage(t *testing.T, path string, size string) {
+	t.Helper()
+
+	pFile, err := getFileFromPath(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pFile.Close()
+
+	pFs := &pseudo_fat.FileSystem{}
+	var fats [][]int32
+	var data []byte
+	pCommand, err := cmd.ParseCommand("format " + size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	captureStdout(t, func() {
+		err = cmd.ExecuteCommand(pCommand, make(chan struct{}), pFile, pFs, &fats, &data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunImageDiffExitCodes(t *testing.T) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	logging.SetOutput(devNull)
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.img")
+	formatImage(t, first, "1MB")
+
+	content, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same := filepath.Join(dir, "same.img")
+	if err = os.WriteFile(same, content, consts.NewFilePermissions); err != nil {
+		t.Fatal(err)
+	}
+	// the cluster 200 is marked bad in both FATs (the entries are little-endian, FatFree is -1)
+	pFile, err := os.Open(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pFs, _, _, err := utils.GetFileSystem(pFile)
+	pFile.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fatStart := range []uint32{pFs.Fat01StartAddr, pFs.Fat02StartAddr} {
+		content[fatStart+200*4] = byte(consts.FatBadCluster & 0xff)
+	}
+	other := filepath.Join(dir, "other.img")
+	if err = os.WriteFile(other, content, consts.NewFilePermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  int
+	}{
+		{"identical", []string{first, same}, consts.ExitSuccess},
+		{"differ", []string{first, other}, consts.ExitFailure},
+		{"missing", []string{first, filepath.Join(dir, "none.img")}, consts.ExitTrouble},
+		{"directory", []string{dir, first}, consts.ExitTrouble},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got int
+			captureStdout(t, func() {
+				got = runImageDiff(&arg_parser.ProgramArgs{DiffPaths: tt.paths})
+			})
+			if got != tt.want {
+				t.Errorf("exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
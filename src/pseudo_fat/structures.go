@@ -95,3 +95,25 @@ func (d *DirectoryEntry) ToStringLS() string {
 		return fmt.Sprintf("DIR:\t%s", string(d.Name[:]))
 	}
 }
+
+// DirIndexHeader is the header of the hash table index of a large directory. It is stored
+// in the self reference cluster of the directory right after the directory entry.
+type DirIndexHeader struct {
+	// Signature marks the valid header (see consts.DirIndexSignature)
+	Signature [len(consts.DirIndexSignature)]byte
+	// StartCluster is the first cluster of the chain of the index slots
+	StartCluster uint32
+	// SlotCount is the number of the slots of the hash table (a power of two)
+	SlotCount uint32
+	// EntryCount is the number of the used slots
+	EntryCount uint32
+}
+
+// DirIndexSlot is a slot of the directory index mapping the name of a child to its start cluster.
+// The slot is empty if the start cluster is 0 (the root directory is never a child).
+type DirIndexSlot struct {
+	// Name is the name of the child
+	Name [consts.MaxFileNameLength]byte
+	// StartCluster is the start cluster of the child
+	StartCluster uint32
+}
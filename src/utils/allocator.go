@@ -0,0 +1,294 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"math/bits"
+	"sort"
+)
+
+// ClusterAllocator finds the free clusters for the new entries and data.
+//
+// The found clusters are not marked in the FAT, the caller links them (see addToFat)
+// and every change of the FAT is reported back through ClusterChanged.
+type ClusterAllocator interface {
+	// FindFreeClusters returns count free clusters of the FAT (in the order they should be chained).
+	// It returns ErrNoFreeCluster if there are not enough free clusters.
+	FindFreeClusters(fat []int32, count int) ([]uint32, error)
+	// ClusterChanged is called after the FAT entry of the cluster was changed.
+	ClusterChanged(fat []int32, cluster uint32)
+}
+
+// clusterAllocator is the allocator used by the filesystem operations
+var clusterAllocator ClusterAllocator = NewExtentAllocator()
+
+// SetClusterAllocator replaces the allocator used by the filesystem operations.
+func SetClusterAllocator(allocator ClusterAllocator) {
+	clusterAllocator = allocator
+}
+
+// NotifyFatChanged reports the clusters whose FAT entries were changed outside of the filesystem
+// operations to the allocator (the FATs written directly, e.g. by the bug command).
+func NotifyFatChanged(fats [][]int32, clusters ...uint32) {
+	if len(fats) == 0 {
+		return
+	}
+
+	// the chains of the directories could have been changed
+	dirCache.clustersChanged(clusters...)
+	for _, cluster := range clusters {
+		usageTracker.clusterChanged(fats[0], cluster)
+		clusterAllocator.ClusterChanged(fats[0], cluster)
+	}
+}
+
+// FirstFitAllocator takes the first free clusters from the start of the FAT (linear scan on every call)
+type FirstFitAllocator struct{}
+
+// FindFreeClusters returns the first count free clusters of the FAT.
+func (FirstFitAllocator) FindFreeClusters(fat []int32, count int) ([]uint32, error) {
+	freeClusters := make([]uint32, 0, count)
+	for i, entry := range fat {
+		if len(freeClusters) == count {
+			break
+		}
+
+		if entry == consts.FatFree {
+			freeClusters = append(freeClusters, uint32(i))
+		}
+	}
+
+	if len(freeClusters) < count {
+		return nil, custom_errors.ErrNoFreeCluster
+	}
+
+	return freeClusters, nil
+}
+
+// ClusterChanged does nothing, the FAT is scanned on every call.
+func (FirstFitAllocator) ClusterChanged(fat []int32, cluster uint32) {}
+
+// ExtentAllocator keeps the index of the free extents (runs of the free clusters) of the FAT:
+// a bitmap of the free clusters and a run-length tree of the extents.
+//
+// A single extent long enough for all the clusters is preferred (the shortest one, the first one
+// after the next-fit cursor if more of them have the same length). Otherwise the longest extents
+// are used. The index is built on the first use and rebuilt if a different FAT is used.
+type ExtentAllocator struct {
+	// pFatHead is the first entry of the indexed FAT (identifies it), nil if the index is not built
+	pFatHead *int32
+	// fatLen is the number of the entries of the indexed FAT
+	fatLen int
+	// free is the bitmap of the free clusters
+	free clusterBitmap
+	// extentLens maps the first cluster of each free extent to its length
+	extentLens map[uint32]uint32
+	// extents is the run-length tree of the free extents
+	extents extentTree
+	// cursor is the cluster after the last allocation
+	cursor uint32
+}
+
+// NewExtentAllocator returns the allocator with an empty index.
+func NewExtentAllocator() *ExtentAllocator {
+	return &ExtentAllocator{}
+}
+
+// isIndexed returns true if the index is built for the FAT.
+func (a *ExtentAllocator) isIndexed(fat []int32) bool {
+	return len(fat) > 0 && a.pFatHead == &fat[0] && a.fatLen == len(fat)
+}
+
+// getFreeIndex returns the allocator itself, its bitmap counts the free clusters (see clusterUsage).
+func (a *ExtentAllocator) getFreeIndex() *ExtentAllocator {
+	return a
+}
+
+// isFree returns true if the cluster is free in the bitmap.
+func (a *ExtentAllocator) isFree(cluster uint32) bool {
+	return a.free.get(cluster)
+}
+
+// setFree sets the state of the cluster in the bitmap.
+func (a *ExtentAllocator) setFree(cluster uint32, free bool) {
+	a.free.set(cluster, free)
+}
+
+// addExtent adds the free extent to the index.
+func (a *ExtentAllocator) addExtent(start uint32, length uint32) {
+	a.extentLens[start] = length
+	a.extents.insert(extentKey{length: length, start: start})
+}
+
+// removeExtent removes the free extent starting at the cluster from the index and returns its length.
+func (a *ExtentAllocator) removeExtent(start uint32) uint32 {
+	length := a.extentLens[start]
+	delete(a.extentLens, start)
+	a.extents.remove(extentKey{length: length, start: start})
+
+	return length
+}
+
+// findExtentStart returns the first cluster of the free extent containing the free cluster.
+func (a *ExtentAllocator) findExtentStart(cluster uint32) uint32 {
+	for cluster > 0 && a.isFree(cluster-1) {
+		// the whole preceding word is free
+		if cluster%64 == 0 && a.free.words[cluster/64-1] == ^uint64(0) {
+			cluster -= 64
+			continue
+		}
+
+		// skip the free bits below the cluster in its word
+		word := a.free.words[(cluster-1)/64]
+		bitIndex := (cluster - 1) % 64
+		usedBelow := ^word & ((2 << bitIndex) - 1)
+		if usedBelow == 0 {
+			cluster -= bitIndex + 1
+			continue
+		}
+
+		return (cluster-1)/64*64 + uint32(64-bits.LeadingZeros64(usedBelow))
+	}
+
+	return cluster
+}
+
+// rebuild builds the index of the free extents of the FAT.
+func (a *ExtentAllocator) rebuild(fat []int32) {
+	a.pFatHead = nil
+	a.fatLen = len(fat)
+	a.free = newClusterBitmap(len(fat))
+	a.extentLens = make(map[uint32]uint32)
+	a.extents = extentTree{}
+	a.cursor = 0
+	if len(fat) == 0 {
+		return
+	}
+	a.pFatHead = &fat[0]
+
+	runStart := -1
+	for i, entry := range fat {
+		if entry == consts.FatFree {
+			a.setFree(uint32(i), true)
+			if runStart < 0 {
+				runStart = i
+			}
+		} else if runStart >= 0 {
+			a.addExtent(uint32(runStart), uint32(i-runStart))
+			runStart = -1
+		}
+	}
+	if runStart >= 0 {
+		a.addExtent(uint32(runStart), uint32(len(fat)-runStart))
+	}
+}
+
+// markUsed removes the cluster from its free extent (the rest of the extent is split).
+func (a *ExtentAllocator) markUsed(cluster uint32) {
+	start := a.findExtentStart(cluster)
+	length := a.removeExtent(start)
+	a.setFree(cluster, false)
+
+	if cluster > start {
+		a.addExtent(start, cluster-start)
+	}
+	if start+length > cluster+1 {
+		a.addExtent(cluster+1, start+length-cluster-1)
+	}
+}
+
+// markFree adds the cluster to the index (merged with the neighbouring free extents).
+func (a *ExtentAllocator) markFree(cluster uint32) {
+	a.setFree(cluster, true)
+	start, length := cluster, uint32(1)
+
+	if cluster > 0 && a.isFree(cluster-1) {
+		start = a.findExtentStart(cluster - 1)
+		length += a.removeExtent(start)
+	}
+	if int(cluster)+1 < a.fatLen && a.isFree(cluster+1) {
+		length += a.removeExtent(cluster + 1)
+	}
+
+	a.addExtent(start, length)
+}
+
+// ClusterChanged updates the index if the cluster became free or used.
+func (a *ExtentAllocator) ClusterChanged(fat []int32, cluster uint32) {
+	if !a.isIndexed(fat) {
+		// rebuilt on the next use
+		a.pFatHead = nil
+		return
+	}
+	if int(cluster) >= a.fatLen {
+		return
+	}
+
+	isFree := fat[cluster] == consts.FatFree
+	if isFree == a.isFree(cluster) {
+		return
+	}
+
+	if isFree {
+		a.markFree(cluster)
+	} else {
+		a.markUsed(cluster)
+	}
+}
+
+// FindFreeClusters returns count free clusters, preferably one contiguous run (see ExtentAllocator).
+func (a *ExtentAllocator) FindFreeClusters(fat []int32, count int) ([]uint32, error) {
+	if !a.isIndexed(fat) {
+		a.rebuild(fat)
+	}
+	if count <= 0 {
+		return []uint32{}, nil
+	}
+
+	// the shortest extent long enough, the first one after the cursor if more have the same length
+	bestFit, found := a.extents.lowerBound(extentKey{length: uint32(count)})
+	if found {
+		pick, found := a.extents.lowerBound(extentKey{length: bestFit.length, start: a.cursor})
+		if !found || pick.length != bestFit.length {
+			pick = bestFit
+		}
+
+		return a.takeClusters([]extentKey{{length: uint32(count), start: pick.start}}), nil
+	}
+
+	// the longest extents (the fewest fragments), chained in the order of the clusters
+	pieces := make([]extentKey, 0)
+	remaining := uint32(count)
+	a.extents.descending(func(key extentKey) bool {
+		length := min(key.length, remaining)
+		pieces = append(pieces, extentKey{length: length, start: key.start})
+		remaining -= length
+		return remaining > 0
+	})
+	if remaining > 0 {
+		return nil, custom_errors.ErrNoFreeCluster
+	}
+	sort.Slice(pieces, func(i, j int) bool {
+		return pieces[i].start < pieces[j].start
+	})
+
+	return a.takeClusters(pieces), nil
+}
+
+// takeClusters returns the clusters of the pieces of the extents and moves the cursor after the last one.
+func (a *ExtentAllocator) takeClusters(pieces []extentKey) []uint32 {
+	res := make([]uint32, 0)
+	for _, piece := range pieces {
+		for i := range piece.length {
+			res = append(res, piece.start+i)
+		}
+	}
+
+	a.cursor = res[len(res)-1] + 1
+	if int(a.cursor) >= a.fatLen {
+		a.cursor = 0
+	}
+
+	return res
+}
@@ -0,0 +1,432 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// newTestFat returns the FAT of the length with the free clusters of the extents ([start, end) pairs).
+func newTestFat(length int, freeExtents ...[2]int) []int32 {
+	fat := make([]int32, length)
+	for i := range fat {
+		fat[i] = consts.FatFileEnd
+	}
+	for _, extent := range freeExtents {
+		for i := extent[0]; i < extent[1]; i++ {
+			fat[i] = consts.FatFree
+		}
+	}
+	return fat
+}
+
+// setCluster changes the FAT entry of the cluster and reports it to the allocator.
+func setCluster(a ClusterAllocator, fat []int32, cluster uint32, value int32) {
+	fat[cluster] = value
+	a.ClusterChanged(fat, cluster)
+}
+
+// collectExtents returns the extents of the tree from the longest one.
+func collectExtents(tree *extentTree) []extentKey {
+	res := make([]extentKey, 0)
+	tree.descending(func(key extentKey) bool {
+		res = append(res, key)
+		return true
+	})
+	return res
+}
+
+// checkExtentIndex fails the test if the index of the allocator differs from the one built from the FAT.
+func checkExtentIndex(t *testing.T, a *ExtentAllocator, fat []int32) {
+	t.Helper()
+
+	if !a.isIndexed(fat) {
+		t.Fatal("the FAT is not indexed")
+	}
+
+	expected := NewExtentAllocator()
+	expected.rebuild(fat)
+	if !slices.Equal(a.free.words, expected.free.words) || a.free.count != expected.free.count {
+		t.Fatalf("free bitmap (%d free) differs from the rebuilt one (%d free)", a.free.count, expected.free.count)
+	}
+	if got, want := collectExtents(&a.extents), collectExtents(&expected.extents); !slices.Equal(got, want) {
+		t.Fatalf("extents %v, rebuilt %v", got, want)
+	}
+	if a.extents.size != len(expected.extentLens) || len(a.extentLens) != len(expected.extentLens) {
+		t.Fatalf("%d extents in the tree, %d in the map, %d rebuilt", a.extents.size, len(a.extentLens), len(expected.extentLens))
+	}
+	for start, length := range expected.extentLens {
+		if a.extentLens[start] != length {
+			t.Fatalf("extent at %d has length %d, rebuilt %d", start, a.extentLens[start], length)
+		}
+	}
+}
+
+func TestExtentTree(t *testing.T) {
+	tree := extentTree{}
+	reference := make([]extentKey, 0)
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 5000; i++ {
+		key := extentKey{length: uint32(rng.Intn(20) + 1), start: uint32(rng.Intn(200))}
+		idx, found := slices.BinarySearchFunc(reference, key, func(a extentKey, b extentKey) int {
+			switch {
+			case a.less(b):
+				return -1
+			case b.less(a):
+				return 1
+			}
+			return 0
+		})
+
+		if rng.Intn(3) == 0 || found {
+			tree.remove(key)
+			if found {
+				reference = slices.Delete(reference, idx, idx+1)
+			}
+		} else {
+			tree.insert(key)
+			reference = slices.Insert(reference, idx, key)
+		}
+
+		if tree.size != len(reference) {
+			t.Fatalf("step %d: size %d, expected %d", i, tree.size, len(reference))
+		}
+
+		probe := extentKey{length: uint32(rng.Intn(22)), start: uint32(rng.Intn(200))}
+		got, gotFound := tree.lowerBound(probe)
+		idx = sort.Search(len(reference), func(j int) bool { return !reference[j].less(probe) })
+		if gotFound != (idx < len(reference)) || (gotFound && got != reference[idx]) {
+			t.Fatalf("step %d: lowerBound(%v) = %v %v", i, probe, got, gotFound)
+		}
+	}
+
+	descending := slices.Clone(reference)
+	slices.Reverse(descending)
+	if got := collectExtents(&tree); !slices.Equal(got, descending) {
+		t.Fatalf("descending order %v, expected %v", got, descending)
+	}
+}
+
+func TestFindExtentStart(t *testing.T) {
+	tests := []struct {
+		name  string
+		start int
+		end   int
+	}{
+		{"inside a word", 3, 10},
+		{"from the word start", 64, 70},
+		{"to the word end", 60, 64},
+		{"across a boundary", 60, 70},
+		{"whole word", 64, 128},
+		{"more whole words", 0, 192},
+		{"from cluster 0", 0, 5},
+		{"to the FAT end", 190, 200},
+		{"across two boundaries", 63, 129},
+		{"single cluster at the boundary", 64, 65},
+		{"single cluster before the boundary", 63, 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fat := newTestFat(200, [2]int{tt.start, tt.end})
+			a := NewExtentAllocator()
+			a.rebuild(fat)
+
+			for cluster := tt.start; cluster < tt.end; cluster++ {
+				if got := a.findExtentStart(uint32(cluster)); got != uint32(tt.start) {
+					t.Errorf("findExtentStart(%d) = %d, expected %d", cluster, got, tt.start)
+				}
+			}
+		})
+	}
+}
+
+func TestExtentAllocatorSplitMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		free    [][2]int
+		changes []int // cluster to toggle (free <-> used)
+	}{
+		{"split at the word boundaries", [][2]int{{0, 256}}, []int{63, 64, 127, 128, 0, 255}},
+		{"merge at the word boundaries", [][2]int{{0, 63}, {65, 127}, {129, 256}}, []int{63, 64, 127, 128}},
+		{"split and merge back", [][2]int{{10, 200}}, []int{64, 64, 63, 65, 64, 63, 65}},
+		{"merge whole words", [][2]int{{0, 64}, {65, 192}}, []int{64}},
+		{"split the last cluster", [][2]int{{250, 256}}, []int{255, 250, 255, 250}},
+		{"single free clusters", nil, []int{1, 3, 2, 64, 62, 63, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fat := newTestFat(256, tt.free...)
+			a := NewExtentAllocator()
+			a.rebuild(fat)
+			checkExtentIndex(t, a, fat)
+
+			for _, cluster := range tt.changes {
+				value := int32(consts.FatFree)
+				if fat[cluster] == consts.FatFree {
+					value = consts.FatFileEnd
+				}
+				setCluster(a, fat, uint32(cluster), value)
+				checkExtentIndex(t, a, fat)
+			}
+		})
+	}
+}
+
+func TestExtentAllocatorRandomChanges(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	fat := newTestFat(1000, [2]int{0, 1000})
+	a := NewExtentAllocator()
+	a.rebuild(fat)
+
+	for i := 0; i < 3000; i++ {
+		cluster := uint32(rng.Intn(len(fat)))
+		value := []int32{consts.FatFree, consts.FatFileEnd, consts.FatBadCluster, int32(rng.Intn(len(fat)))}[rng.Intn(4)]
+		setCluster(a, fat, cluster, value)
+	}
+	checkExtentIndex(t, a, fat)
+}
+
+func TestExtentAllocatorBestFit(t *testing.T) {
+	// extents of the lengths 5 (10), 3 (30), 8 (50), 3 (70) and 3 (90)
+	free := [][2]int{{10, 15}, {30, 33}, {50, 58}, {70, 73}, {90, 93}}
+
+	tests := []struct {
+		name     string
+		cursor   uint32
+		count    int
+		expected []uint32
+	}{
+		{"shortest long enough", 0, 4, []uint32{10, 11, 12, 13}},
+		{"exact length", 0, 3, []uint32{30, 31, 32}},
+		{"same length after the cursor", 31, 3, []uint32{70, 71, 72}},
+		{"same length at the cursor", 90, 3, []uint32{90, 91, 92}},
+		{"wraps to the first of the length", 91, 3, []uint32{30, 31, 32}},
+		{"cursor does not prefer a longer extent", 50, 2, []uint32{70, 71}},
+		{"longest extent", 0, 8, []uint32{50, 51, 52, 53, 54, 55, 56, 57}},
+		{"single cluster", 0, 1, []uint32{30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fat := newTestFat(100, free...)
+			a := NewExtentAllocator()
+			a.rebuild(fat)
+			a.cursor = tt.cursor
+
+			got, err := a.FindFreeClusters(fat, tt.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("FindFreeClusters(%d) = %v, expected %v", tt.count, got, tt.expected)
+			}
+			if a.cursor != tt.expected[len(tt.expected)-1]+1 {
+				t.Errorf("cursor %d after the allocation", a.cursor)
+			}
+		})
+	}
+}
+
+func TestExtentAllocatorNextFit(t *testing.T) {
+	// three extents of the same length, each allocation moves the cursor to the next one
+	fat := newTestFat(64, [2]int{5, 7}, [2]int{20, 22}, [2]int{40, 42})
+	a := NewExtentAllocator()
+
+	starts := make([]uint32, 0)
+	for i := 0; i < 3; i++ {
+		clusters, err := a.FindFreeClusters(fat, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		starts = append(starts, clusters[0])
+		for _, cluster := range clusters {
+			setCluster(a, fat, cluster, consts.FatFileEnd)
+		}
+		checkExtentIndex(t, a, fat)
+	}
+	if !slices.Equal(starts, []uint32{5, 20, 40}) {
+		t.Errorf("allocated at %v", starts)
+	}
+
+	// freed clusters before the cursor are used after the wrap
+	setCluster(a, fat, 5, consts.FatFree)
+	setCluster(a, fat, 6, consts.FatFree)
+	setCluster(a, fat, 62, consts.FatFree)
+	setCluster(a, fat, 63, consts.FatFree)
+	clusters, err := a.FindFreeClusters(fat, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(clusters, []uint32{62, 63}) || a.cursor != 0 {
+		t.Errorf("allocated %v (cursor %d), expected the extent after the cursor", clusters, a.cursor)
+	}
+	clusters, err = a.FindFreeClusters(fat, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(clusters, []uint32{5, 6}) {
+		t.Errorf("allocated %v after the wrap", clusters)
+	}
+}
+
+func TestExtentAllocatorLongestExtents(t *testing.T) {
+	free := [][2]int{{10, 14}, {20, 26}, {40, 42}, {60, 61}}
+
+	tests := []struct {
+		name     string
+		count    int
+		expected []uint32
+		err      error
+	}{
+		{"two longest", 9, []uint32{10, 11, 12, 20, 21, 22, 23, 24, 25}, nil},
+		{"three longest", 11, []uint32{10, 11, 12, 13, 20, 21, 22, 23, 24, 25, 40}, nil},
+		{"all", 13, []uint32{10, 11, 12, 13, 20, 21, 22, 23, 24, 25, 40, 41, 60}, nil},
+		{"not enough", 14, nil, custom_errors.ErrNoFreeCluster},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fat := newTestFat(64, free...)
+			a := NewExtentAllocator()
+
+			got, err := a.FindFreeClusters(fat, tt.count)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, expected %v", err, tt.err)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("FindFreeClusters(%d) = %v, expected %v", tt.count, got, tt.expected)
+			}
+			// nothing is taken from the index until the clusters are linked
+			checkExtentIndex(t, a, fat)
+		})
+	}
+}
+
+func TestExtentAllocatorOtherFat(t *testing.T) {
+	fatA := newTestFat(128, [2]int{0, 10})
+	fatB := newTestFat(128, [2]int{100, 128})
+	a := NewExtentAllocator()
+
+	if _, err := a.FindFreeClusters(fatA, 1); err != nil {
+		t.Fatal(err)
+	}
+	checkExtentIndex(t, a, fatA)
+
+	// a change of another FAT drops the index, the changes of the indexed FAT made meanwhile are not lost
+	setCluster(a, fatB, 100, consts.FatFileEnd)
+	if a.isIndexed(fatA) {
+		t.Fatal("the index is kept after a change of another FAT")
+	}
+	fatA[0] = consts.FatFileEnd
+	fatA[50] = consts.FatFree
+	a.ClusterChanged(fatA, 0)
+
+	got, err := a.FindFreeClusters(fatA, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != 50 {
+		t.Errorf("allocated %v, expected the single free cluster 50", got)
+	}
+	checkExtentIndex(t, a, fatA)
+
+	got, err = a.FindFreeClusters(fatB, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []uint32{101, 102, 103}) {
+		t.Errorf("allocated %v from the other FAT", got)
+	}
+	checkExtentIndex(t, a, fatB)
+
+	// the same FAT resized in place is a different FAT as well
+	if _, err = a.FindFreeClusters(fatB[:64], 1); !errors.Is(err, custom_errors.ErrNoFreeCluster) {
+		t.Errorf("allocated from the stale index of the longer FAT (error %v)", err)
+	}
+}
+
+// newFragmentedFat returns the FAT of the length with 99 % of the clusters in used runs separated
+// by short free runs (or without the free runs if holes is false) and the rest free.
+func newFragmentedFat(length int, holes bool) []int32 {
+	rng := rand.New(rand.NewSource(3))
+	fat := make([]int32, length)
+	i := 0
+	for i < length*99/100 {
+		for used := rng.Intn(256) + 1; used > 0 && i < length; used-- {
+			fat[i] = consts.FatFileEnd
+			i++
+		}
+		if !holes {
+			continue
+		}
+		for free := rng.Intn(8) + 1; free > 0 && i < length; free-- {
+			fat[i] = consts.FatFree
+			i++
+		}
+	}
+	for ; i < length; i++ {
+		fat[i] = consts.FatFree
+	}
+	return fat
+}
+
+// BenchmarkFindFreeClusters compares the allocators on the FATs of 1M clusters: "holes" has short free runs
+// between the used ones, "filled" has all free clusters at the end. With "link" the found clusters
+// are linked and freed again (the index of ExtentAllocator is updated for every cluster).
+func BenchmarkFindFreeClusters(b *testing.B) {
+	for _, shape := range []string{"holes", "filled"} {
+		fat := newFragmentedFat(1<<20, shape == "holes")
+		allocators := []struct {
+			name      string
+			allocator ClusterAllocator
+		}{
+			{"FirstFit", FirstFitAllocator{}},
+			{"Extent", NewExtentAllocator()},
+		}
+
+		for _, link := range []bool{false, true} {
+			mode := "find"
+			if link {
+				mode = "link"
+			}
+
+			for _, count := range []int{1, 8, 64, 1024} {
+				for _, alloc := range allocators {
+					b.Run(fmt.Sprintf("%s/%s/%s/count=%d", shape, mode, alloc.name, count), func(b *testing.B) {
+						// the index is built outside of the measured loop
+						if _, err := alloc.allocator.FindFreeClusters(fat, count); err != nil {
+							b.Fatal(err)
+						}
+
+						b.ResetTimer()
+						for i := 0; i < b.N; i++ {
+							clusters, err := alloc.allocator.FindFreeClusters(fat, count)
+							if err != nil {
+								b.Fatal(err)
+							}
+							if !link {
+								continue
+							}
+
+							// link and free the clusters again, so the FAT stays the same
+							for _, cluster := range clusters {
+								setCluster(alloc.allocator, fat, cluster, consts.FatFileEnd)
+							}
+							for _, cluster := range clusters {
+								setCluster(alloc.allocator, fat, cluster, consts.FatFree)
+							}
+						}
+					})
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// utils package contains utility functions for the project
+package utils
+
+// ClusterRun is a sequence of contiguous clusters of a cluster chain
+type ClusterRun struct {
+	// Start is the first cluster of the run
+	Start uint32
+	// Count is the number of the clusters in the run
+	Count uint32
+}
+
+// GetClusterRuns splits the cluster chain into the runs of contiguous clusters.
+//
+// The number of the runs is the fragmentation of the chain (1 for a contiguous chain).
+func GetClusterRuns(chain []uint32) []ClusterRun {
+	runs := make([]ClusterRun, 0)
+	for _, cluster := range chain {
+		if len(runs) > 0 {
+			pLast := &runs[len(runs)-1]
+			if pLast.Start+pLast.Count == cluster {
+				pLast.Count++
+				continue
+			}
+		}
+
+		runs = append(runs, ClusterRun{Start: cluster, Count: 1})
+	}
+
+	return runs
+}
+
+// GetClusterOffset returns the byte offset of the cluster within the filesystem file.
+func GetClusterOffset(dataStartAddr uint32, clusterSize uint16, cluster uint32) uint64 {
+	return uint64(dataStartAddr) + uint64(cluster)*uint64(clusterSize)
+}
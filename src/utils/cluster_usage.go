@@ -0,0 +1,147 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+)
+
+// clusterBitmap is a bitmap of the clusters with the number of the set bits
+type clusterBitmap struct {
+	// words are the bits of the clusters (cluster i is bit i%64 of word i/64)
+	words []uint64
+	// count is the number of the set bits
+	count uint32
+}
+
+// newClusterBitmap returns the bitmap of the number of clusters with no bit set.
+func newClusterBitmap(clusterCount int) clusterBitmap {
+	return clusterBitmap{words: make([]uint64, (clusterCount+63)/64)}
+}
+
+// get returns true if the bit of the cluster is set.
+func (b *clusterBitmap) get(cluster uint32) bool {
+	return b.words[cluster/64]&(1<<(cluster%64)) != 0
+}
+
+// set sets the bit of the cluster to the value.
+func (b *clusterBitmap) set(cluster uint32, value bool) {
+	if b.get(cluster) == value {
+		return
+	}
+
+	if value {
+		b.words[cluster/64] |= 1 << (cluster % 64)
+		b.count++
+	} else {
+		b.words[cluster/64] &^= 1 << (cluster % 64)
+		b.count--
+	}
+}
+
+// clusterUsage keeps the bitmap of the bad clusters of the FAT, the free clusters are counted
+// by the index of the free extents (see ExtentAllocator), so the usage counters are available
+// without scanning the FAT
+type clusterUsage struct {
+	// pFatHead is the first entry of the tracked FAT (identifies it), nil if nothing is tracked
+	pFatHead *int32
+	// fatLen is the number of the entries of the tracked FAT
+	fatLen int
+	// bad is the bitmap of the bad clusters
+	bad clusterBitmap
+	// pOwnFreeIndex is the index of the free clusters used if the allocator does not keep one
+	pOwnFreeIndex *ExtentAllocator
+}
+
+// freeIndexHolder is implemented by the allocators keeping the index of the free clusters
+type freeIndexHolder interface {
+	// getFreeIndex returns the index of the free clusters
+	getFreeIndex() *ExtentAllocator
+}
+
+// usageTracker is the cluster usage of the FAT used by the filesystem operations
+var usageTracker = &clusterUsage{}
+
+// getFreeIndex returns the index of the free clusters: the one of the allocator
+// if it keeps one, otherwise the own one of the tracker.
+func (u *clusterUsage) getFreeIndex() *ExtentAllocator {
+	if holder, ok := clusterAllocator.(freeIndexHolder); ok {
+		return holder.getFreeIndex()
+	}
+
+	if u.pOwnFreeIndex == nil {
+		u.pOwnFreeIndex = NewExtentAllocator()
+	}
+	return u.pOwnFreeIndex
+}
+
+// isTracked returns true if the bitmap is built for the FAT.
+func (u *clusterUsage) isTracked(fat []int32) bool {
+	return len(fat) > 0 && u.pFatHead == &fat[0] && u.fatLen == len(fat)
+}
+
+// rebuild builds the bitmap and the index of the free clusters from the FAT.
+func (u *clusterUsage) rebuild(fat []int32) {
+	u.pFatHead = nil
+	u.fatLen = len(fat)
+	u.bad = newClusterBitmap(len(fat))
+	pFreeIndex := u.getFreeIndex()
+	pFreeIndex.rebuild(fat)
+	if len(fat) == 0 {
+		return
+	}
+	u.pFatHead = &fat[0]
+
+	for i := range fat {
+		u.bad.set(uint32(i), fat[i] == consts.FatBadCluster)
+	}
+	logging.Debug(fmt.Sprintf("Cluster usage rebuilt (clusters: %d, free: %d, bad: %d)", len(fat), pFreeIndex.free.count, u.bad.count))
+}
+
+// clusterChanged updates the bitmap and the index of the free clusters with the current FAT entry of the cluster.
+func (u *clusterUsage) clusterChanged(fat []int32, cluster uint32) {
+	u.getFreeIndex().ClusterChanged(fat, cluster)
+	if !u.isTracked(fat) {
+		// rebuilt on the next use
+		u.pFatHead = nil
+		return
+	}
+	if int(cluster) >= u.fatLen {
+		return
+	}
+
+	u.bad.set(cluster, fat[cluster] == consts.FatBadCluster)
+}
+
+// getFreeCount returns the number of the free clusters of the FAT (the index is built if needed).
+func (u *clusterUsage) getFreeCount(fat []int32) uint32 {
+	pFreeIndex := u.getFreeIndex()
+	if !pFreeIndex.isIndexed(fat) {
+		pFreeIndex.rebuild(fat)
+	}
+
+	return pFreeIndex.free.count
+}
+
+// RebuildClusterUsage builds the bad cluster bitmap and the free cluster index from the FAT
+// (called when the filesystem is loaded, they are maintained by the FAT changes afterwards).
+func RebuildClusterUsage(fat []int32) {
+	usageTracker.rebuild(fat)
+}
+
+// ensureFreeClusters returns ErrNoFreeCluster if the FAT has fewer free clusters than the count,
+// so the operations fail before anything is written.
+func ensureFreeClusters(fat []int32, count int) error {
+	if count <= 0 {
+		return nil
+	}
+
+	if free := GetFatUsage(fat).Free; uint64(free) < uint64(count) {
+		logging.Info(fmt.Sprintf("Not enough free clusters (needed: %d, free: %d)", count, free))
+		return custom_errors.ErrNoFreeCluster
+	}
+
+	return nil
+}
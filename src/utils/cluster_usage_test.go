@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"math/rand"
+	"testing"
+)
+
+func TestClusterBitmap(t *testing.T) {
+	b := newClusterBitmap(130)
+	if len(b.words) != 3 || b.count != 0 {
+		t.Fatalf("%d words, %d set", len(b.words), b.count)
+	}
+
+	for _, cluster := range []uint32{0, 63, 64, 129} {
+		b.set(cluster, true)
+		b.set(cluster, true)
+	}
+	if b.count != 4 {
+		t.Errorf("%d bits set, want 4", b.count)
+	}
+	for cluster := range uint32(130) {
+		want := cluster == 0 || cluster == 63 || cluster == 64 || cluster == 129
+		if b.get(cluster) != want {
+			t.Errorf("bit %d is %v", cluster, !want)
+		}
+	}
+
+	b.set(63, false)
+	b.set(63, false)
+	b.set(1, false)
+	if b.count != 3 || b.get(63) {
+		t.Errorf("%d bits set after clearing bit 63", b.count)
+	}
+}
+
+// checkTrackedUsage fails the test if the tracked usage of the FAT does not match a rescan.
+func checkTrackedUsage(t *testing.T, fat []int32) {
+	t.Helper()
+
+	expected := FatUsage{Total: uint32(len(fat))}
+	for _, value := range fat {
+		switch value {
+		case consts.FatFree:
+			expected.Free++
+		case consts.FatBadCluster:
+			expected.Bad++
+		default:
+			expected.Used++
+		}
+	}
+
+	if got := GetFatUsage(fat); got != expected {
+		t.Fatalf("usage counters %+v, rescan %+v", got, expected)
+	}
+}
+
+func TestClusterUsageTracksChanges(t *testing.T) {
+	fat := newTestFat(300, [2]int{10, 200})
+	RebuildClusterUsage(fat)
+	checkTrackedUsage(t, fat)
+
+	rng := rand.New(rand.NewSource(1))
+	values := []int32{consts.FatFree, consts.FatFree, consts.FatFileEnd, consts.FatBadCluster, 5}
+	for range 2000 {
+		cluster := uint32(rng.Intn(len(fat)))
+		fat[cluster] = values[rng.Intn(len(values))]
+		usageTracker.clusterChanged(fat, cluster)
+		checkTrackedUsage(t, fat)
+	}
+
+	// the clusters outside of the FAT are ignored
+	usageTracker.clusterChanged(fat, uint32(len(fat)))
+	checkTrackedUsage(t, fat)
+}
+
+func TestClusterUsageOtherFat(t *testing.T) {
+	fat := newTestFat(200, [2]int{0, 100})
+	RebuildClusterUsage(fat)
+	checkTrackedUsage(t, fat)
+
+	// a different FAT (or a part of the tracked one) is scanned again
+	other := newTestFat(100, [2]int{50, 60})
+	checkTrackedUsage(t, other)
+	checkTrackedUsage(t, fat[:150])
+
+	// the change of an untracked FAT is not counted, the tracked one is rebuilt on the next use
+	checkTrackedUsage(t, fat)
+	other[0] = consts.FatFree
+	NotifyFatChanged([][]int32{other}, 0)
+	fat[150] = consts.FatFree
+	checkTrackedUsage(t, fat)
+	checkTrackedUsage(t, other)
+}
+
+func TestClusterUsageFreeIndex(t *testing.T) {
+	defer SetClusterAllocator(clusterAllocator)
+
+	fat := newTestFat(200, [2]int{10, 120})
+	extent := NewExtentAllocator()
+	allocators := []struct {
+		name      string
+		allocator ClusterAllocator
+		want      *ExtentAllocator
+	}{
+		{"extent", extent, extent},
+		{"embedded extent", &failingAllocator{ExtentAllocator: extent}, extent},
+		{"first fit", FirstFitAllocator{}, nil},
+	}
+
+	for _, tt := range allocators {
+		t.Run(tt.name, func(t *testing.T) {
+			SetClusterAllocator(tt.allocator)
+			RebuildClusterUsage(fat)
+
+			// the free clusters are counted by the bitmap of the allocator (the own index without it)
+			pFreeIndex := usageTracker.getFreeIndex()
+			if tt.want != nil && pFreeIndex != tt.want {
+				t.Fatal("free clusters are not counted by the index of the allocator")
+			}
+			if tt.want == nil && pFreeIndex != usageTracker.pOwnFreeIndex {
+				t.Fatal("free clusters are not counted by the own index")
+			}
+
+			for _, cluster := range []uint32{0, 50, 150, 199} {
+				fat[cluster] = consts.FatFree
+				NotifyFatChanged([][]int32{fat}, cluster)
+				checkTrackedUsage(t, fat)
+				if GetFatUsage(fat).Free != pFreeIndex.free.count {
+					t.Fatalf("free count %d, bitmap count %d", GetFatUsage(fat).Free, pFreeIndex.free.count)
+				}
+
+				fat[cluster] = consts.FatFileEnd
+				NotifyFatChanged([][]int32{fat}, cluster)
+				checkTrackedUsage(t, fat)
+			}
+		})
+	}
+}
+
+func TestEnsureFreeClusters(t *testing.T) {
+	fat := newTestFat(100, [2]int{20, 30}, [2]int{90, 95})
+	RebuildClusterUsage(fat)
+
+	tests := []struct {
+		count   int
+		wantErr error
+	}{
+		{0, nil},
+		{-1, nil},
+		{1, nil},
+		{15, nil},
+		{16, custom_errors.ErrNoFreeCluster},
+		{1000, custom_errors.ErrNoFreeCluster},
+	}
+	for _, tt := range tests {
+		if err := ensureFreeClusters(fat, tt.count); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%d clusters: error %v, want %v", tt.count, err, tt.wantErr)
+		}
+	}
+}
+
+// TestUsageAfterOperations checks the usage counters after each filesystem operation.
+func TestUsageAfterOperations(t *testing.T) {
+	f := newTestFS(t, 400)
+	pRoot, err := GetRootDirEntry(f.pFs, f.fats, f.data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		op   func() error
+	}{
+		{"mkdir", func() error { return Mkdir(f.pFs, f.fats, f.data, "/d") }},
+		{"write", func() error { return WriteFile(f.pFs, f.fats, f.data, "/d/f", testPattern(1, 9000)) }},
+		{"append", func() error { return AppendFile(f.pFs, f.fats, f.data, "/d/f", testPattern(2, 5000)) }},
+		{"shrink", func() error { return TruncateFile(f.pFs, f.fats, f.data, "/d/f", 10) }},
+		{"extend", func() error { return TruncateFile(f.pFs, f.fats, f.data, "/d/g", 12000) }},
+		{"rewrite", func() error { return WriteFile(f.pFs, f.fats, f.data, "/d/g", []byte("short")) }},
+		{"move", func() error { return MoveFile(f.pFs, f.fats, f.data, "/d/g", "/g") }},
+		{"copy", func() error { return CopyFile(f.pFs, f.fats, f.data, "/g", "/d/h") }},
+		{"copy in", func() error { return CopyInsideFS(f.pFs, f.fats, f.data, "/d/i", testPattern(3, 4001)) }},
+		{"remove", func() error { return RemoveFile(f.pFs, f.fats, f.data, "/d/f") }},
+		{"remove copies", func() error {
+			if err := RemoveFile(f.pFs, f.fats, f.data, "/d/h"); err != nil {
+				return err
+			}
+			return RemoveFile(f.pFs, f.fats, f.data, "/d/i")
+		}},
+		{"rmdir", func() error { return Rmdir(f.pFs, f.fats, f.data, pRoot, "/d") }},
+	}
+	for _, step := range steps {
+		if err := step.op(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		f.checkConsistency()
+	}
+
+	// nothing is written if the content does not fit
+	if err := WriteFile(f.pFs, f.fats, f.data, "/full", make([]byte, 400*4000)); !errors.Is(err, custom_errors.ErrNoFreeCluster) {
+		t.Errorf("full: error %v, want %v", err, custom_errors.ErrNoFreeCluster)
+	}
+	f.checkConsistency()
+}
+
+// TestMkdirFailsFast checks that mkdir fails before anything is written even without the transaction.
+func TestMkdirFailsFast(t *testing.T) {
+	f := newTestFS(t, 20)
+
+	// the self reference and the entry cluster in the root directory leave one free cluster
+	f.writeFile("/fill", make([]byte, 16*int(consts.ClusterSize)))
+	if free := GetFatUsage(f.fats[0]).Free; free != 1 {
+		t.Fatalf("%d free clusters, want 1", free)
+	}
+
+	s := f.snapshot()
+	if err := mkdir(f.pFs, f.fats, f.data, "/d"); !errors.Is(err, custom_errors.ErrNoFreeCluster) {
+		t.Errorf("error %v, want %v", err, custom_errors.ErrNoFreeCluster)
+	}
+	f.checkSnapshot(s)
+}
@@ -0,0 +1,87 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"unsafe"
+)
+
+// GetFSSizeForClusters returns the smallest disk size of the filesystem with the number of clusters.
+func GetFSSizeForClusters(clusterCount uint32) uint64 {
+	fatSize := uint64(clusterCount) * uint64(unsafe.Sizeof(int32(0)))
+	return uint64(pseudo_fat.GetSizeOfFileSystem()) +
+		uint64(consts.FATableCount)*fatSize +
+		uint64(clusterCount)*uint64(consts.ClusterSize)
+}
+
+// getFreeClusters returns the free clusters of the FAT.
+func getFreeClusters(fat []int32) []uint32 {
+	res := make([]uint32, 0)
+	for cluster, value := range fat {
+		if value == consts.FatFree {
+			res = append(res, uint32(cluster))
+		}
+	}
+
+	return res
+}
+
+// zeroFreeClusters overwrites the content of the free clusters with zeros.
+func zeroFreeClusters(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte) {
+	clusterSize := int(pFs.ClusterSize)
+	for _, run := range GetClusterRuns(getFreeClusters(fats[0])) {
+		start := int(run.Start) * clusterSize
+		clear(data[start : start+int(run.Count)*clusterSize])
+	}
+}
+
+// CompactFileSystem moves all used clusters to the front of the data region and shrinks
+// the filesystem to the used clusters plus the headroom (in bytes, rounded up to whole clusters).
+// The bad clusters are not moved, the ones between the used clusters stay bad and the rest are dropped.
+// The filesystem never grows. If discardFree is true, the content of the free clusters is zeroed,
+// so they are not stored in the filesystem file (see WriteFileSystem).
+func CompactFileSystem(pFs *pseudo_fat.FileSystem, pFatsRef *[][]int32, pDataRef *[]byte, headroom uint32, discardFree bool) (*ResizeResult, error) {
+	// sanity checks
+	if pFs == nil || pFatsRef == nil || *pFatsRef == nil || pDataRef == nil || *pDataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	fats := *pFatsRef
+	oldCount := uint32(len(fats[0]))
+	// the used clusters are moved below the limit (the bad clusters are skipped)
+	limit := getUsedClustersLimit(fats[0])
+
+	headroomClusters := (uint64(headroom) + uint64(pFs.ClusterSize) - 1) / uint64(pFs.ClusterSize)
+	newCount := uint32(min(uint64(limit)+headroomClusters, uint64(oldCount)))
+	logging.Debug(fmt.Sprintf("Compacting filesystem to %d clusters (used clusters limit: %d, headroom: %d)", newCount, limit, headroomClusters))
+
+	// the relocation is rolled back if the resize fails
+	var res *ResizeResult
+	err := runInTransaction(pFs, fats, *pDataRef, func() error {
+		relocated, err := relocateClustersBelow(pFs, fats, *pDataRef, limit)
+		if err != nil {
+			return err
+		}
+
+		res, err = ResizeFileSystem(pFs, pFatsRef, pDataRef, uint32(GetFSSizeForClusters(newCount)))
+		if err != nil {
+			return err
+		}
+		res.Relocated += relocated
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if discardFree {
+		zeroFreeClusters(pFs, *pFatsRef, *pDataRef)
+	}
+
+	return res, nil
+}
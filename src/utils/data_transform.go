@@ -4,6 +4,7 @@ package utils
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"kiv-zos-semestral-work/consts"
@@ -45,6 +46,20 @@ func BytesToStruct(data []byte, pResult interface{}) error {
 // No sanity checks are performed here, because the data should
 // already come validated from the command parser.
 func ParseFSSize(pSize string) (uint32, error) {
+	size, err := ParseSize(pSize)
+	if err != nil {
+		return 0, err
+	}
+
+	if size < uint32(consts.ClusterSize)+uint32(pseudo_fat.GetSizeOfFileSystem())+uint32(2*unsafe.Sizeof(uint32(0))) {
+		return 0, custom_errors.ErrDiskTooSmall
+	}
+
+	return size, nil
+}
+
+// ParseSize parses the size with a unit (600MB, 10KB, 5B, ...) to bytes.
+func ParseSize(pSize string) (uint32, error) {
 	// find the unit
 	var unit string
 	var parsedSize int
@@ -73,10 +88,6 @@ func ParseFSSize(pSize string) (uint32, error) {
 		return 0, custom_errors.ErrInvalFormatUnits
 	}
 
-	if size < uint32(consts.ClusterSize)+uint32(pseudo_fat.GetSizeOfFileSystem())+uint32(2*unsafe.Sizeof(uint32(0))) {
-		return 0, custom_errors.ErrDiskTooSmall
-	}
-
 	return size, nil
 }
 
@@ -127,16 +138,63 @@ func CalculateFSSizes(size uint32) (uint32, uint32, uint32) {
 	return clusterCount, fatsSize, allocatableSpace
 }
 
+// writeSparse writes the data at the offset of the file skipping the runs of all-zero clusters
+// (see IsClusterEmpty). The file already reads as zeros from the zeroedFrom offset (it was extended
+// by a truncate), so the zero runs are skipped there. Below it the skipped ranges are deallocated
+// (see PunchHole), so they read as zeros and do not occupy the host disk. If the host filesystem
+// does not support it, the zeros are written over the old content and *pSparse is set to false,
+// so the following calls do not try again.
+func writeSparse(pFile *os.File, offset int64, data []byte, clusterSize int, zeroedFrom int64, pSparse *bool) error {
+	for start := 0; start < len(data); {
+		end := min(start+clusterSize, len(data))
+		isZero := IsClusterEmpty(data[start:end])
+		for end < len(data) && IsClusterEmpty(data[end:min(end+clusterSize, len(data))]) == isZero {
+			end = min(end+clusterSize, len(data))
+		}
+
+		writeEnd := end
+		if isZero {
+			// only the old content below the zeroedFrom offset has to be overwritten
+			writeEnd = int(max(int64(start), min(int64(end), zeroedFrom-offset)))
+		}
+
+		if isZero && writeEnd > start && *pSparse {
+			err := PunchHole(pFile, offset+int64(start), int64(writeEnd-start))
+			if err == nil {
+				start = end
+				continue
+			} else if !errors.Is(err, custom_errors.ErrSparseUnsupported) {
+				return err
+			}
+
+			logging.Info("Sparse files are not supported by the host filesystem, writing the zeros")
+			*pSparse = false
+		}
+
+		if writeEnd > start {
+			_, err := pFile.WriteAt(data[start:writeEnd], offset+int64(start))
+			if err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+
+	return nil
+}
+
 // WriteFileSystem writes the file system to the file.
+//
+// The all-zero clusters of the data region and the padding are not written,
+// they are deallocated in the file instead (see writeSparse).
 func WriteFileSystem(pFile *os.File, pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte) error {
-	// rewind the file
-	_, err := pFile.Seek(0, 0)
+	info, err := pFile.Stat()
 	if err != nil {
-		logging.Critical(fmt.Sprintf("Error rewinding the file: %s", err))
 		return err
 	}
+	oldSize := info.Size()
 
-	// if new size is smaller than the old size, truncate the file
+	// if new size is smaller than the old size, truncate the file (the extended part reads as zeros)
 	err = pFile.Truncate(int64(pFs.DiskSize))
 	if err != nil {
 		return err
@@ -149,7 +207,7 @@ func WriteFileSystem(pFile *os.File, pFs *pseudo_fat.FileSystem, fatsRef [][]int
 	if err != nil {
 		return err
 	}
-	_, err = pFile.Write(fsBytes)
+	_, err = pFile.WriteAt(fsBytes, 0)
 	if err != nil {
 		logging.Critical(fmt.Sprintf("Error writing the file system structure: %s", err))
 		return err
@@ -163,7 +221,7 @@ func WriteFileSystem(pFile *os.File, pFs *pseudo_fat.FileSystem, fatsRef [][]int
 			return err
 		}
 
-		_, err = pFile.Write(fatBytes)
+		_, err = pFile.WriteAt(fatBytes, int64(writtenBytes))
 		if err != nil {
 			logging.Critical(fmt.Sprintf("Error writing the FATs: %s", err))
 			return err
@@ -172,7 +230,8 @@ func WriteFileSystem(pFile *os.File, pFs *pseudo_fat.FileSystem, fatsRef [][]int
 	}
 
 	// write the data region
-	_, err = pFile.Write(dataRef)
+	sparse := true
+	err = writeSparse(pFile, int64(writtenBytes), dataRef, int(pFs.ClusterSize), oldSize, &sparse)
 	if err != nil {
 		logging.Critical(fmt.Sprintf("Error writing the data region: %s", err))
 		return err
@@ -183,7 +242,7 @@ func WriteFileSystem(pFile *os.File, pFs *pseudo_fat.FileSystem, fatsRef [][]int
 	if writtenBytes < pFs.DiskSize {
 		logging.Info(fmt.Sprintf("Not all bytes were written to the file (written: %d, expected: %d). Padding the rest with '\\0'.", writtenBytes, pFs.DiskSize))
 		padding := make([]byte, pFs.DiskSize-writtenBytes)
-		_, err = pFile.Write(padding)
+		err = writeSparse(pFile, int64(writtenBytes), padding, int(pFs.ClusterSize), oldSize, &sparse)
 		if err != nil {
 			logging.Critical(fmt.Sprintf("Error writing the padding: %s", err))
 			return err
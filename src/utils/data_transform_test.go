@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// getImageBytes returns the expected content of the filesystem file.
+func getImageBytes(f *testFS) []byte {
+	f.tb.Helper()
+
+	res, err := StructToBytes(f.pFs)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	for _, fat := range f.fats {
+		fatBytes, err := StructToBytes(fat)
+		if err != nil {
+			f.tb.Fatal(err)
+		}
+		res = append(res, fatBytes...)
+	}
+	res = append(res, f.data...)
+	return append(res, make([]byte, int(f.pFs.DiskSize)-len(res))...)
+}
+
+func TestWriteFileSystem(t *testing.T) {
+	f := newTestFS(t, 20)
+	clusterSize := int(f.pFs.ClusterSize)
+	f.mkdir("/d")
+	f.writeFile("/d/a", testPattern(1, 2*clusterSize+10))
+	// the empty clusters between the written ones
+	f.writeFile("/zeros", make([]byte, 3*clusterSize))
+	f.writeFile("/b", testPattern(2, 100))
+	want := getImageBytes(f)
+
+	tests := []struct {
+		name       string
+		oldContent []byte
+	}{
+		{"new file", nil},
+		{"smaller file", bytes.Repeat([]byte{0xff}, len(want)/2)},
+		{"larger file", bytes.Repeat([]byte{0xff}, len(want)+3*clusterSize)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image")
+			if err := os.WriteFile(path, tt.oldContent, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			pFile, err := os.OpenFile(path, os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pFile.Close()
+
+			if err = WriteFileSystem(pFile, f.pFs, f.fats, f.data); err != nil {
+				t.Fatal(err)
+			}
+
+			// the old content of the empty clusters is overwritten
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				idx := 0
+				for idx < min(len(got), len(want)) && got[idx] == want[idx] {
+					idx++
+				}
+				t.Fatalf("file of %d bytes (want %d) differs at the byte %d", len(got), len(want), idx)
+			}
+
+			pFs, pFats, pData, err := GetFileSystem(pFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *pFs != *f.pFs || !equalFats(*pFats, f.fats) || !bytes.Equal(*pData, f.data) {
+				t.Error("loaded filesystem differs from the written one")
+			}
+		})
+	}
+}
+
+func TestWriteSparseWithoutHoles(t *testing.T) {
+	const clusterSize = 100
+	path := filepath.Join(t.TempDir(), "image")
+	oldContent := bytes.Repeat([]byte{0xff}, 3*clusterSize)
+	if err := os.WriteFile(path, oldContent, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is written to the read-only file if the zeros are only past the zeroed offset
+	pReadOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pReadOnly.Close()
+	zeros := make([]byte, 5*clusterSize)
+	sparse := false
+	if err = writeSparse(pReadOnly, clusterSize, zeros, clusterSize, clusterSize, &sparse); err != nil {
+		t.Errorf("zeros past the zeroed offset: error %v", err)
+	}
+	if err = writeSparse(pReadOnly, clusterSize, zeros, clusterSize, 2*clusterSize, &sparse); err == nil {
+		t.Error("zeros over the old content were not written")
+	}
+
+	// the zeros overwrite the old content below the zeroed offset only, the data is written everywhere
+	pFile, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pFile.Close()
+	if err = pFile.Truncate(6 * clusterSize); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 5*clusterSize)
+	copy(data[3*clusterSize:], "data")
+	if err = writeSparse(pFile, clusterSize, data, clusterSize, 3*clusterSize, &sparse); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(bytes.Repeat([]byte{0xff}, clusterSize), data...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("file content %v, want %v", got, want)
+	}
+	if sparse {
+		t.Error("sparse writing enabled")
+	}
+}
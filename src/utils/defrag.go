@@ -0,0 +1,390 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+)
+
+// Fragmentation is the fragmentation of the cluster chains of the entries
+type Fragmentation struct {
+	// Chains is the number of the cluster chains
+	Chains int
+	// FragmentedChains is the number of the chains split into more than one run
+	FragmentedChains int
+	// Links is the number of the links between the consecutive clusters of the chains
+	Links int
+	// BrokenLinks is the number of the links to a non-adjacent cluster
+	BrokenLinks int
+}
+
+// Score returns the percentage of the links to a non-adjacent cluster (0 if all chains are contiguous).
+func (f Fragmentation) Score() float64 {
+	if f.Links == 0 {
+		return 0
+	}
+
+	return float64(f.BrokenLinks) * 100 / float64(f.Links)
+}
+
+// DefragResult is the result of the defragmentation
+type DefragResult struct {
+	// Before is the fragmentation before the defragmentation
+	Before Fragmentation
+	// After is the fragmentation after the defragmentation
+	After Fragmentation
+	// Relocated is the number of the chains moved into a contiguous run
+	Relocated int
+	// Skipped is the number of the fragmented chains without a contiguous free run to move to
+	Skipped int
+}
+
+// relocateStatus is the result of the relocation of one chain
+type relocateStatus uint8
+
+const (
+	// chainContiguous is the status of the chain that is already contiguous
+	chainContiguous relocateStatus = iota
+	// chainRelocated is the status of the chain moved into a contiguous run
+	chainRelocated
+	// chainNoSpace is the status of the chain without a contiguous run to move to
+	chainNoSpace
+)
+
+// subtreeEntry is an entry below the defragmented path
+type subtreeEntry struct {
+	// absPath is the absolute path of the entry
+	absPath string
+	// pEntry is the entry
+	pEntry *pseudo_fat.DirectoryEntry
+}
+
+// getSubtreeEntries returns the entry on the path and all entries below it (parents before children).
+func getSubtreeEntries(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPath string) ([]subtreeEntry, error) {
+	branchDirEntries, err := GetBranchDirEntriesFromRoot(pFs, fats, data, absNormPath)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]subtreeEntry, 0)
+	stack := []subtreeEntry{{absPath: absNormPath, pEntry: branchDirEntries[len(branchDirEntries)-1]}}
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		res = append(res, curr)
+
+		if curr.pEntry.IsFile {
+			continue
+		}
+
+		children, err := GetDirEntries(pFs, curr.pEntry, fats, data)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(children) - 1; i >= 0; i-- {
+			childPath := JoinAbsPath(curr.absPath, GetNormalizedStrFromMem(children[i].Name[:]))
+			stack = append(stack, subtreeEntry{absPath: childPath, pEntry: children[i]})
+		}
+	}
+
+	return res, nil
+}
+
+// GetFragmentation returns the fragmentation of the chains of the entry on the path and all entries below it.
+func GetFragmentation(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPath string) (Fragmentation, error) {
+	res := Fragmentation{}
+	entries, err := getSubtreeEntries(pFs, fats, data, absNormPath)
+	if err != nil {
+		return res, err
+	}
+
+	for _, entry := range entries {
+		chain, err := GetClusterChain(entry.pEntry.StartCluster, fats[0])
+		if err != nil {
+			return res, fmt.Errorf("failed to get cluster chain: %w", err)
+		}
+
+		runs := GetClusterRuns(chain)
+		res.Chains++
+		res.Links += len(chain) - 1
+		res.BrokenLinks += len(runs) - 1
+		if len(runs) > 1 {
+			res.FragmentedChains++
+		}
+	}
+
+	return res, nil
+}
+
+// findContiguousRun returns the first run of clusterCount clusters that are free or belong to the chain
+// (starting at cluster 0 if fromRoot, otherwise anywhere after the root cluster). It returns nil if there is none.
+func findContiguousRun(fat []int32, chain []uint32, clusterCount int, fromRoot bool) []uint32 {
+	own := make(map[uint32]bool, len(chain))
+	for _, cluster := range chain {
+		own[cluster] = true
+	}
+
+	start := -1
+	runLen := 0
+	for i := range fat {
+		if i == 0 && !fromRoot {
+			continue
+		}
+
+		if fat[i] == consts.FatFree || own[uint32(i)] {
+			runLen++
+		} else if fromRoot {
+			return nil
+		} else {
+			runLen = 0
+		}
+
+		if runLen == clusterCount {
+			start = i - clusterCount + 1
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	res := make([]uint32, 0, clusterCount)
+	for i := range clusterCount {
+		res = append(res, uint32(start+i))
+	}
+
+	return res
+}
+
+// readEntryAt reads the directory entry stored in the cluster.
+func readEntryAt(pFs *pseudo_fat.FileSystem, data []byte, cluster uint32) (*pseudo_fat.DirectoryEntry, error) {
+	byteOffset := int(cluster) * int(pFs.ClusterSize)
+	return ReadDirectoryEntryFromCluster(data[byteOffset : byteOffset+int(pFs.ClusterSize)])
+}
+
+// writeEntryAt replaces the directory entry stored in the cluster. The rest of the cluster
+// is kept (the self reference of a directory can hold the header of its index after the entry).
+func writeEntryAt(pFs *pseudo_fat.FileSystem, data []byte, cluster uint32, pEntry *pseudo_fat.DirectoryEntry) error {
+	entryBytes, err := StructToBytes(pEntry)
+	if err != nil {
+		return fmt.Errorf("failed to serialize directory entry: %w", err)
+	}
+
+	writeToCluster(pFs, data, cluster, entryBytes)
+
+	return nil
+}
+
+// updateStartCluster updates the references to the moved start cluster of the entry:
+// the self reference, the entry in the parent directory (and in its index) and (for directories)
+// the parent cluster of the children (both their entries in the directory and their self references).
+func updateStartCluster(pFs *pseudo_fat.FileSystem,
+	fats [][]int32,
+	data []byte,
+	pParentDirEntry *pseudo_fat.DirectoryEntry,
+	oldStart uint32,
+	newChain []uint32) error {
+
+	newStart := newChain[0]
+	pSelfEntry, err := readEntryAt(pFs, data, newStart)
+	if err != nil {
+		return fmt.Errorf("failed to read directory entry: %w", err)
+	}
+	pSelfEntry.StartCluster = newStart
+	err = writeEntryAt(pFs, data, newStart, pSelfEntry)
+	if err != nil {
+		return err
+	}
+
+	parentChain, err := GetClusterChain(pParentDirEntry.StartCluster, fats[0])
+	if err != nil {
+		return fmt.Errorf("failed to get cluster chain: %w", err)
+	}
+	// skip the self reference of the parent directory
+	for _, cluster := range parentChain[1:] {
+		pEntry, err := readEntryAt(pFs, data, cluster)
+		if err != nil {
+			return fmt.Errorf("failed to read directory entry: %w", err)
+		}
+
+		if pEntry.StartCluster == oldStart {
+			pEntry.StartCluster = newStart
+			err = writeEntryAt(pFs, data, cluster, pEntry)
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	err = updateDirIndex(pFs, fats, data, pParentDirEntry.StartCluster, GetNormalizedStrFromMem(pSelfEntry.Name[:]), newStart)
+	if err != nil {
+		return err
+	}
+
+	if pSelfEntry.IsFile {
+		return nil
+	}
+
+	for _, cluster := range newChain[1:] {
+		byteOffset := int(cluster) * int(pFs.ClusterSize)
+		if IsClusterEmpty(data[byteOffset : byteOffset+int(pFs.ClusterSize)]) {
+			continue
+		}
+
+		pChildEntry, err := readEntryAt(pFs, data, cluster)
+		if err != nil {
+			return fmt.Errorf("failed to read directory entry: %w", err)
+		}
+		pChildEntry.ParentCluster = newStart
+		err = writeEntryAt(pFs, data, cluster, pChildEntry)
+		if err != nil {
+			return err
+		}
+
+		pChildSelfEntry, err := readEntryAt(pFs, data, pChildEntry.StartCluster)
+		if err != nil {
+			return fmt.Errorf("failed to read directory entry: %w", err)
+		}
+		pChildSelfEntry.ParentCluster = newStart
+		err = writeEntryAt(pFs, data, pChildEntry.StartCluster, pChildSelfEntry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// relocateChain moves the cluster chain of the entry on the path into a contiguous run of clusters
+// and updates the references to its start cluster (see updateStartCluster). The chain of the root
+// directory keeps its start at cluster 0 (only the rest of it is moved if the whole chain does not fit there).
+//
+// The filesystem is consistent after every call.
+func relocateChain(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPath string) (relocateStatus, error) {
+	branchDirEntries, err := GetBranchDirEntriesFromRoot(pFs, fats, data, absNormPath)
+	if err != nil {
+		return chainNoSpace, err
+	}
+	pEntry := branchDirEntries[len(branchDirEntries)-1]
+	isRoot := len(branchDirEntries) == 1
+
+	chain, err := GetClusterChain(pEntry.StartCluster, fats[0])
+	if err != nil {
+		return chainNoSpace, fmt.Errorf("failed to get cluster chain: %w", err)
+	}
+	if len(GetClusterRuns(chain)) == 1 {
+		return chainContiguous, nil
+	}
+
+	var target []uint32
+	if isRoot {
+		target = findContiguousRun(fats[0], chain, len(chain), true)
+		if target == nil && len(GetClusterRuns(chain[1:])) > 1 {
+			tail := findContiguousRun(fats[0], chain[1:], len(chain)-1, false)
+			if tail != nil {
+				target = append([]uint32{chain[0]}, tail...)
+			}
+		}
+	} else {
+		target = findContiguousRun(fats[0], chain, len(chain), false)
+	}
+	if target == nil {
+		return chainNoSpace, nil
+	}
+
+	logging.Debug(fmt.Sprintf("Relocating chain of \"%s\": %v -> %v", absNormPath, chain, target))
+
+	// the clusters are buffered, because the target run can overlap the chain
+	clusterSize := int(pFs.ClusterSize)
+	buffer := make([]byte, len(chain)*clusterSize)
+	for i, cluster := range chain {
+		byteOffset := int(cluster) * clusterSize
+		copy(buffer[i*clusterSize:], data[byteOffset:byteOffset+clusterSize])
+	}
+	for _, cluster := range chain {
+		markFreeCluster(fats, cluster)
+		clearCluster(pFs, data, cluster)
+	}
+
+	markEndOfChain(fats, target[0])
+	for i := 1; i < len(target); i++ {
+		addToFat(fats, target[i-1], target[i])
+	}
+	for i, cluster := range target {
+		writeToCluster(pFs, data, cluster, buffer[i*clusterSize:(i+1)*clusterSize])
+	}
+
+	if target[0] != chain[0] {
+		err = updateStartCluster(pFs, fats, data, branchDirEntries[len(branchDirEntries)-2], chain[0], target)
+		if err != nil {
+			return chainNoSpace, err
+		}
+	}
+
+	return chainRelocated, nil
+}
+
+// Defragment moves the cluster chains of the entry on the path and all entries below it
+// into contiguous runs (parents before children, each to the first run it fits into).
+//
+// Each chain is moved as a whole in its own transaction, so the filesystem is consistent between the moves.
+// If the stop channel is closed, the defragmentation stops before the next move and
+// ErrInterrupted is returned with the result of the moves done so far.
+func Defragment(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPath string, stop <-chan struct{}) (*DefragResult, error) {
+	// sanity checks
+	if pFs == nil || fats == nil || data == nil || absNormPath == "" {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	before, err := GetFragmentation(pFs, fats, data, absNormPath)
+	if err != nil {
+		return nil, err
+	}
+	res := &DefragResult{Before: before}
+
+	entries, err := getSubtreeEntries(pFs, fats, data, absNormPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var stopErr error
+	for _, entry := range entries {
+		select {
+		case <-stop:
+			logging.Info("Defragmentation interrupted")
+			stopErr = custom_errors.ErrInterrupted
+		default:
+		}
+		if stopErr != nil {
+			break
+		}
+
+		var status relocateStatus
+		err := runInTransaction(pFs, fats, data, func() error {
+			var err error
+			status, err = relocateChain(pFs, fats, data, entry.absPath)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		switch status {
+		case chainRelocated:
+			res.Relocated++
+		case chainNoSpace:
+			res.Skipped++
+		}
+	}
+
+	res.After, err = GetFragmentation(pFs, fats, data, absNormPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, stopErr
+}
@@ -0,0 +1,197 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"fmt"
+	"kiv-zos-semestral-work/custom_errors"
+)
+
+// DiffOpKind is the kind of the line diff operation
+type DiffOpKind uint8
+
+const (
+	// DiffEqual is the line present in both texts
+	DiffEqual DiffOpKind = iota
+	// DiffDelete is the line present only in the first text
+	DiffDelete
+	// DiffInsert is the line present only in the second text
+	DiffInsert
+)
+
+// DiffOp is a single line of the edit script turning the first text into the second
+type DiffOp struct {
+	// Kind is the kind of the operation
+	Kind DiffOpKind
+	// Line is the text of the line
+	Line string
+}
+
+// getDiffWindowVal returns the furthest x of the diagonal k stored in the window of the step d.
+func getDiffWindowVal(window []int, d int, k int) int {
+	return window[k+d]
+}
+
+// DiffLines returns the shortest edit script turning the lines a into the lines b
+// (Myers' algorithm). Only the window of the diagonals reached in each step is kept.
+//
+// It returns ErrDiffTooLarge if more than maxEdits lines are inserted or deleted.
+func DiffLines(a []string, b []string, maxEdits int) ([]DiffOp, error) {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	trace := make([][]int, 0)
+
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		if d > maxEdits {
+			return nil, custom_errors.ErrDiffTooLarge
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down (insertion)
+			} else {
+				x = v[offset+k-1] + 1 // right (deletion)
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+
+		window := make([]int, 2*d+1)
+		copy(window, v[offset-d:offset+d+1])
+		trace = append(trace, window)
+	}
+
+	// walk the trace back from the end
+	reversed := make([]DiffOp, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prevWindow := trace[d-1]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && getDiffWindowVal(prevWindow, d-1, k-1) < getDiffWindowVal(prevWindow, d-1, k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := getDiffWindowVal(prevWindow, d-1, prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, DiffOp{Kind: DiffEqual, Line: a[x-1]})
+			x--
+			y--
+		}
+
+		if x == prevX {
+			reversed = append(reversed, DiffOp{Kind: DiffInsert, Line: b[y-1]})
+			y--
+		} else {
+			reversed = append(reversed, DiffOp{Kind: DiffDelete, Line: a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, DiffOp{Kind: DiffEqual, Line: a[x-1]})
+		x--
+		y--
+	}
+
+	ops := make([]DiffOp, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		ops = append(ops, reversed[i])
+	}
+
+	return ops, nil
+}
+
+// formatHunkRange returns the range of the unified diff hunk header ("start,count" or "start" for one line).
+func formatHunkRange(start int, count int) string {
+	if count == 0 {
+		// the empty range refers to the line before
+		return fmt.Sprintf("%d,0", start)
+	} else if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// UnifiedDiffHunks returns the lines of the unified diff hunks of the edit script
+// with the given number of the context lines (without the file headers).
+func UnifiedDiffHunks(ops []DiffOp, context int) []string {
+	// the positions in the both texts before each operation
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.Kind != DiffInsert {
+			aPos[i+1]++
+		}
+		if op.Kind != DiffDelete {
+			bPos[i+1]++
+		}
+	}
+
+	res := make([]string, 0)
+	i := 0
+	for i < len(ops) {
+		for i < len(ops) && ops[i].Kind == DiffEqual {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// extend the hunk while the equal runs between the changes are short enough to merge
+		start := max(0, i-context)
+		end := len(ops)
+		for j := i; j < len(ops); {
+			if ops[j].Kind != DiffEqual {
+				j++
+				continue
+			}
+
+			runEnd := j
+			for runEnd < len(ops) && ops[runEnd].Kind == DiffEqual {
+				runEnd++
+			}
+			if runEnd == len(ops) || runEnd-j > 2*context {
+				end = min(j+context, len(ops))
+				break
+			}
+			j = runEnd
+		}
+
+		res = append(res, fmt.Sprintf("@@ -%s +%s @@",
+			formatHunkRange(aPos[start], aPos[end]-aPos[start]),
+			formatHunkRange(bPos[start], bPos[end]-bPos[start])))
+		for _, op := range ops[start:end] {
+			switch op.Kind {
+			case DiffEqual:
+				res = append(res, " "+op.Line)
+			case DiffDelete:
+				res = append(res, "-"+op.Line)
+			case DiffInsert:
+				res = append(res, "+"+op.Line)
+			}
+		}
+
+		i = end
+	}
+
+	return res
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/custom_errors"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns the lines "1" to "n".
+func numberedLines(n int) []string {
+	res := make([]string, n)
+	for i := range res {
+		res[i] = fmt.Sprint(i + 1)
+	}
+	return res
+}
+
+// getLCSLength returns the length of the longest common subsequence of the lines.
+func getLCSLength(a []string, b []string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				curr[j+1] = prev[j] + 1
+			} else {
+				curr[j+1] = max(prev[j+1], curr[j])
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// checkEditScript fails the test if the edit script does not turn a into b or it is not the shortest one.
+func checkEditScript(t *testing.T, a []string, b []string, ops []DiffOp) {
+	t.Helper()
+
+	first, second := make([]string, 0), make([]string, 0)
+	edits := 0
+	for _, op := range ops {
+		if op.Kind != DiffInsert {
+			first = append(first, op.Line)
+		}
+		if op.Kind != DiffDelete {
+			second = append(second, op.Line)
+		}
+		if op.Kind != DiffEqual {
+			edits++
+		}
+	}
+
+	if !slices.Equal(first, a) || !slices.Equal(second, b) {
+		t.Fatalf("edit script %v does not turn %q into %q", ops, a, b)
+	}
+	if want := len(a) + len(b) - 2*getLCSLength(a, b); edits != want {
+		t.Fatalf("%d edits turning %q into %q, want %d", edits, a, b, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := [][2][]string{
+		{{}, {}},
+		{{}, {"a"}},
+		{{"a", "b"}, {}},
+		{{"a", "b", "c"}, {"a", "b", "c"}},
+		{{"a", "b", "c"}, {"a", "x", "c"}},
+		{{"a", "b", "c", "a", "b", "b", "a"}, {"c", "b", "a", "b", "a", "c"}},
+		{{"x", "a", "b"}, {"a", "b", "x"}},
+	}
+	for _, tt := range tests {
+		ops, err := DiffLines(tt[0], tt[1], 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEditScript(t, tt[0], tt[1], ops)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		res := make([]string, rng.Intn(30))
+		for i := range res {
+			res[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return res
+	}
+	for range 500 {
+		a, b := randomLines(), randomLines()
+		ops, err := DiffLines(a, b, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEditScript(t, a, b, ops)
+	}
+}
+
+func TestDiffLinesTooLarge(t *testing.T) {
+	a, b := numberedLines(10), numberedLines(14)
+	if _, err := DiffLines(a, b, 3); !errors.Is(err, custom_errors.ErrDiffTooLarge) {
+		t.Errorf("error %v, want %v", err, custom_errors.ErrDiffTooLarge)
+	}
+	if _, err := DiffLines(a, b, 4); err != nil {
+		t.Errorf("4 edits allowed: %v", err)
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	// replace returns the numbered lines with the lines replaced by "x"
+	replace := func(n int, lines ...int) []string {
+		res := numberedLines(n)
+		for _, line := range lines {
+			res[line-1] = "x"
+		}
+		return res
+	}
+
+	tests := []struct {
+		name string
+		a    []string
+		b    []string
+		want string
+	}{
+		{"identical", numberedLines(5), numberedLines(5), ""},
+		{"insert into empty", []string{}, []string{"a"}, "@@ -0,0 +1 @@|+a"},
+		{"delete all", []string{"a", "b"}, []string{}, "@@ -1,2 +0,0 @@|-a|-b"},
+		{"change in the middle", numberedLines(10), replace(10, 5),
+			"@@ -2,7 +2,7 @@| 2| 3| 4|-5|+x| 6| 7| 8"},
+		{"change at the start", numberedLines(10), replace(10, 1),
+			"@@ -1,4 +1,4 @@|-1|+x| 2| 3| 4"},
+		{"change at the end", numberedLines(10), replace(10, 10),
+			"@@ -7,4 +7,4 @@| 7| 8| 9|-10|+x"},
+		{"append", numberedLines(5), append(numberedLines(5), "6"),
+			"@@ -3,3 +3,4 @@| 3| 4| 5|+6"},
+		{"merged hunks", numberedLines(12), replace(12, 1, 8),
+			"@@ -1,11 +1,11 @@|-1|+x| 2| 3| 4| 5| 6| 7|-8|+x| 9| 10| 11"},
+		{"separate hunks", numberedLines(20), replace(20, 1, 9),
+			"@@ -1,4 +1,4 @@|-1|+x| 2| 3| 4|@@ -6,7 +6,7 @@| 6| 7| 8|-9|+x| 10| 11| 12"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := DiffLines(tt.a, tt.b, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.Join(UnifiedDiffHunks(ops, 3), "|"); got != tt.want {
+				t.Errorf("hunks %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/pseudo_fat"
+)
+
+// dirListing is the deserialized content of a directory
+type dirListing struct {
+	// entries are the child entries in the order of the directory chain (without the self reference)
+	entries []pseudo_fat.DirectoryEntry
+	// names are the normalized names of the entries
+	names []string
+	// byName maps the names to the indexes of the entries (only for the large directories, see consts.DirListingIndexMinEntries)
+	byName map[string][]int
+}
+
+// newDirListing creates the listing of the entries and indexes it if the directory is large.
+func newDirListing(entries []pseudo_fat.DirectoryEntry) *dirListing {
+	pListing := &dirListing{entries: entries, names: make([]string, len(entries))}
+	for i := range entries {
+		pListing.names[i] = GetNormalizedStrFromMem(entries[i].Name[:])
+	}
+
+	if len(entries) >= consts.DirListingIndexMinEntries {
+		pListing.byName = make(map[string][]int, len(entries))
+		for i, name := range pListing.names {
+			pListing.byName[name] = append(pListing.byName[name], i)
+		}
+	}
+
+	return pListing
+}
+
+// lookup returns the first child with the name. If dirOnly is true, the files are skipped.
+func (pListing *dirListing) lookup(name string, dirOnly bool) (pseudo_fat.DirectoryEntry, bool) {
+	if pListing.byName != nil {
+		for _, idx := range pListing.byName[name] {
+			if !dirOnly || !pListing.entries[idx].IsFile {
+				return pListing.entries[idx], true
+			}
+		}
+		return pseudo_fat.DirectoryEntry{}, false
+	}
+
+	for i, entryName := range pListing.names {
+		if entryName == name && (!dirOnly || !pListing.entries[i].IsFile) {
+			return pListing.entries[i], true
+		}
+	}
+	return pseudo_fat.DirectoryEntry{}, false
+}
+
+// copyEntryPointers returns pointers to the copies of the entries, so the callers are free
+// to change them (nil if there are none).
+func copyEntryPointers(entries []pseudo_fat.DirectoryEntry) [](*pseudo_fat.DirectoryEntry) {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	copied := make([]pseudo_fat.DirectoryEntry, len(entries))
+	copy(copied, entries)
+
+	res := make([](*pseudo_fat.DirectoryEntry), len(copied))
+	for i := range copied {
+		res[i] = &copied[i]
+	}
+
+	return res
+}
+
+// dirEntryCache keeps the directory entries read from one filesystem, so the paths are not resolved
+// by deserializing every directory from the root again. All cached entries are dropped
+// whenever the FAT entry or the content of a cluster they were read from is changed.
+type dirEntryCache struct {
+	// pFatHead is the first entry of the FAT of the cached filesystem (identifies the filesystem)
+	pFatHead *int32
+	// pDataHead is the first byte of the data region of the cached filesystem (identifies the filesystem)
+	pDataHead *byte
+	// listings maps the start clusters of the directories to their listings
+	listings map[uint32]*dirListing
+	// branches maps the absolute paths to the entries on them (see GetBranchDirEntriesFromRoot)
+	branches map[string][]pseudo_fat.DirectoryEntry
+	// absPaths maps the directory entries to their absolute paths (see GetAbsolutePathFromPwd)
+	absPaths map[pseudo_fat.DirectoryEntry]string
+	// indexes maps the start clusters of the directories to their indexes (nil if there is none)
+	indexes map[uint32]*dirIndex
+	// sources are the clusters the cached entries were read from (the directory chains, the self references
+	// and the index clusters)
+	sources map[uint32]bool
+}
+
+// dirCache is the directory entry cache of the loaded filesystem
+var dirCache = &dirEntryCache{
+	listings: make(map[uint32]*dirListing),
+	branches: make(map[string][]pseudo_fat.DirectoryEntry),
+	absPaths: make(map[pseudo_fat.DirectoryEntry]string),
+	indexes:  make(map[uint32]*dirIndex),
+	sources:  make(map[uint32]bool),
+}
+
+// use binds the cache to the filesystem, the entries of another filesystem are dropped.
+func (pCache *dirEntryCache) use(fats [][]int32, data []byte) {
+	if len(fats) == 0 || len(fats[0]) == 0 || len(data) == 0 {
+		pCache.pFatHead, pCache.pDataHead = nil, nil
+		pCache.invalidate()
+		return
+	}
+
+	if pCache.pFatHead != &fats[0][0] || pCache.pDataHead != &data[0] {
+		pCache.pFatHead, pCache.pDataHead = &fats[0][0], &data[0]
+		pCache.invalidate()
+	}
+}
+
+// invalidate drops all cached entries.
+func (pCache *dirEntryCache) invalidate() {
+	clear(pCache.listings)
+	clear(pCache.branches)
+	clear(pCache.absPaths)
+	clear(pCache.indexes)
+	clear(pCache.sources)
+}
+
+// watch records the clusters the cached entries were read from.
+func (pCache *dirEntryCache) watch(clusters ...uint32) {
+	for _, cluster := range clusters {
+		pCache.sources[cluster] = true
+	}
+}
+
+// clustersChanged drops all cached entries if any of the changed clusters is one they were read from.
+// The changes of the other clusters (e.g. the file content) keep the cache.
+func (pCache *dirEntryCache) clustersChanged(clusters ...uint32) {
+	for _, cluster := range clusters {
+		if pCache.sources[cluster] {
+			pCache.invalidate()
+			return
+		}
+	}
+}
+
+// addBranch caches the entries on the path (the cached paths are dropped when there are too many of them).
+func (pCache *dirEntryCache) addBranch(absPath string, branch [](*pseudo_fat.DirectoryEntry)) {
+	if len(pCache.branches) >= consts.MaxDirCachePaths {
+		clear(pCache.branches)
+	}
+
+	entries := make([]pseudo_fat.DirectoryEntry, len(branch))
+	for i, pEntry := range branch {
+		entries[i] = *pEntry
+	}
+	pCache.branches[absPath] = entries
+}
+
+// addAbsPath caches the absolute path of the directory (the cached paths are dropped when there are too many of them).
+func (pCache *dirEntryCache) addAbsPath(dir pseudo_fat.DirectoryEntry, absPath string) {
+	if len(pCache.absPaths) >= consts.MaxDirCachePaths {
+		clear(pCache.absPaths)
+	}
+
+	pCache.absPaths[dir] = absPath
+}
+
+// InvalidateDirCache drops the cached directory entries. It has to be called after the data region
+// is changed directly (the filesystem operations do it themselves).
+func InvalidateDirCache() {
+	dirCache.invalidate()
+}
@@ -0,0 +1,370 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// warmDirCache lists the directories and looks up their children, so they are cached.
+func warmDirCache(f *testFS, dirs ...string) {
+	f.tb.Helper()
+	for _, dir := range dirs {
+		for _, name := range f.list(dir) {
+			f.exists(JoinAbsPath(dir, name))
+		}
+	}
+}
+
+// checkFresh fails the test if the listing of the directory (cached) differs from the expected names
+// or from the listing read without the cache.
+func checkFresh(t *testing.T, f *testFS, dir string, expected []string) {
+	t.Helper()
+
+	cached := f.list(dir)
+	slices.Sort(cached)
+	InvalidateDirCache()
+	uncached := f.list(dir)
+	slices.Sort(uncached)
+	slices.Sort(expected)
+
+	if !slices.Equal(cached, expected) || !slices.Equal(uncached, expected) {
+		t.Fatalf("ls %s: cached %v, uncached %v, expected %v", dir, cached, uncached, expected)
+	}
+}
+
+func TestDirCacheFreshAfterChanges(t *testing.T) {
+	bigNames := make([]string, 0)
+	for i := 0; i <= consts.DirIndexThreshold; i++ {
+		bigNames = append(bigNames, fmt.Sprintf("x%d", i))
+	}
+	without := func(names []string, removed string) []string {
+		return slices.DeleteFunc(slices.Clone(names), func(name string) bool { return name == removed })
+	}
+
+	tests := []struct {
+		name    string
+		op      func(f *testFS) error
+		dirs    map[string][]string
+		found   []string
+		missing []string
+	}{
+		{"mkdir", func(f *testFS) error { return Mkdir(f.pFs, f.fats, f.data, "/a/new") },
+			map[string][]string{"/a": {"b", "f", "new"}}, []string{"/a/new"}, nil},
+		{"mkdir in indexed dir", func(f *testFS) error { return Mkdir(f.pFs, f.fats, f.data, "/big/new") },
+			map[string][]string{"/big": append(slices.Clone(bigNames), "new")}, []string{"/big/new"}, nil},
+		{"rm", func(f *testFS) error { return RemoveFile(f.pFs, f.fats, f.data, "/a/f") },
+			map[string][]string{"/a": {"b"}}, nil, []string{"/a/f"}},
+		{"rm from indexed dir", func(f *testFS) error { return RemoveFile(f.pFs, f.fats, f.data, "/big/x7") },
+			map[string][]string{"/big": without(bigNames, "x7")}, []string{"/big/x8"}, []string{"/big/x7"}},
+		{"rmdir", func(f *testFS) error { return rmdirTest(f, "/a/b") },
+			map[string][]string{"/a": {"f"}}, nil, []string{"/a/b"}},
+		{"mv rename", func(f *testFS) error { return MoveFile(f.pFs, f.fats, f.data, "/a/f", "/a/g") },
+			map[string][]string{"/a": {"b", "g"}}, []string{"/a/g"}, []string{"/a/f"}},
+		{"mv rename in indexed dir", func(f *testFS) error { return MoveFile(f.pFs, f.fats, f.data, "/big/x3", "/big/y3") },
+			map[string][]string{"/big": append(without(bigNames, "x3"), "y3")}, []string{"/big/y3"}, []string{"/big/x3"}},
+		{"mv across dirs", func(f *testFS) error { return MoveFile(f.pFs, f.fats, f.data, "/a/f", "/a/b/f") },
+			map[string][]string{"/a": {"b"}, "/a/b": {"f"}}, []string{"/a/b/f"}, []string{"/a/f"}},
+		{"mv to indexed dir", func(f *testFS) error { return MoveFile(f.pFs, f.fats, f.data, "/a/f", "/big/f") },
+			map[string][]string{"/a": {"b"}, "/big": append(slices.Clone(bigNames), "f")}, []string{"/big/f"}, []string{"/a/f"}},
+		{"write new", func(f *testFS) error { return WriteFile(f.pFs, f.fats, f.data, "/a/b/n", []byte("n")) },
+			map[string][]string{"/a/b": {"n"}}, []string{"/a/b/n"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFS(t, 1000)
+			f.mkdir("/a")
+			f.mkdir("/a/b")
+			f.writeFile("/a/f", []byte("f"))
+			f.mkdir("/big")
+			for _, name := range bigNames {
+				f.writeFile("/big/"+name, []byte(name))
+			}
+			warmDirCache(f, "/", "/a", "/a/b", "/big")
+
+			if err := tt.op(f); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, path := range tt.found {
+				if !f.exists(path) {
+					t.Errorf("%s not found", path)
+				}
+			}
+			for _, path := range tt.missing {
+				if f.exists(path) {
+					t.Errorf("%s still found", path)
+				}
+			}
+			for dir, expected := range tt.dirs {
+				warmDirCache(f, dir)
+				checkFresh(t, f, dir, expected)
+			}
+			f.checkConsistency()
+		})
+	}
+}
+
+// newRollbackTestFS returns a filesystem with the file /a/f and the indexed directory /big.
+func newRollbackTestFS(t *testing.T) *testFS {
+	f := newTestFS(t, 1000)
+	f.mkdir("/a")
+	f.writeFile("/a/f", []byte("f"))
+	f.mkdir("/big")
+	for i := 0; i <= consts.DirIndexThreshold; i++ {
+		f.writeFile(fmt.Sprintf("/big/x%d", i), []byte{byte(i)})
+	}
+	return f
+}
+
+func TestDirCacheFreshAfterRollback(t *testing.T) {
+	ops := []failureCase{
+		{name: "mkdir", op: func(f *testFS) error { return Mkdir(f.pFs, f.fats, f.data, "/big/new") }},
+		{name: "rm", op: func(f *testFS) error { return RemoveFile(f.pFs, f.fats, f.data, "/big/x1") }},
+		{name: "mv", op: func(f *testFS) error { return MoveFile(f.pFs, f.fats, f.data, "/a/f", "/big/f") }},
+	}
+
+	for _, tc := range ops {
+		for _, byFind := range []bool{true, false} {
+			name := tc.name + "/change"
+			if byFind {
+				name = tc.name + "/find"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				f := newRollbackTestFS(t)
+
+				// fail at every allocation (or FAT change) of the operation until it succeeds
+				step := 1
+				for ; ; step++ {
+					lsA, lsBig := f.list("/a"), f.list("/big")
+					warmDirCache(f, "/", "/a", "/big")
+
+					failFindAt, failChangeAt := 0, step
+					if byFind {
+						failFindAt, failChangeAt = step, 0
+					}
+					err, failed := runWithFailure(f, tc, failFindAt, failChangeAt)
+					if !failed {
+						if err != nil {
+							t.Fatal(err)
+						}
+						break
+					}
+					if !errors.Is(err, errInjected) {
+						t.Fatalf("step %d: %v", step, err)
+					}
+
+					// the listings and lookups cached during the operation are dropped with the rollback
+					for _, path := range []string{"/big/new", "/big/f"} {
+						if f.exists(path) {
+							t.Fatalf("step %d: %s found after the rollback", step, path)
+						}
+					}
+					for _, path := range []string{"/big/x1", "/a/f"} {
+						if !f.exists(path) {
+							t.Fatalf("step %d: %s not found after the rollback", step, path)
+						}
+					}
+					checkFresh(t, f, "/a", lsA)
+					checkFresh(t, f, "/big", lsBig)
+				}
+				if !byFind && step <= 2 {
+					t.Errorf("the operation succeeded after %d steps", step)
+				}
+				f.checkConsistency()
+			})
+		}
+	}
+}
+
+func TestDirCacheOtherFileSystem(t *testing.T) {
+	first := newTestFS(t, 100)
+	first.mkdir("/only_first")
+	warmDirCache(first, "/")
+
+	second := newTestFS(t, 100)
+	second.mkdir("/only_second")
+
+	// the same paths of another filesystem are not answered from the cache
+	if got := second.list("/"); !slices.Equal(got, []string{"only_second"}) {
+		t.Errorf("ls / of the second filesystem: %v", got)
+	}
+	if second.exists("/only_first") {
+		t.Error("/only_first found in the second filesystem")
+	}
+	if got := first.list("/"); !slices.Equal(got, []string{"only_first"}) {
+		t.Errorf("ls / of the first filesystem: %v", got)
+	}
+}
+
+func TestDirCacheKeptAfterFileChanges(t *testing.T) {
+	f := newRollbackTestFS(t)
+	branch, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, "/a/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pDir, pFile := branch[1], branch[2]
+	dirChain, err := GetClusterChain(pDir.StartCluster, f.fats[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	bigBranch, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, "/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexChain, err := GetDirIndexClusters(f.pFs, f.fats, f.data, bigBranch[1])
+	if err != nil || len(indexChain) == 0 {
+		t.Fatalf("/big has no index (error %v)", err)
+	}
+
+	// /big is not listed, so its child is found by the index
+	warm := func() {
+		InvalidateDirCache()
+		warmDirCache(f, "/", "/a")
+		f.exists("/big/x1")
+	}
+	isCached := func() (bool, bool) {
+		_, listed := dirCache.listings[pDir.StartCluster]
+		pIdx, indexed := dirCache.indexes[bigBranch[1].StartCluster]
+		return listed, indexed && pIdx != nil
+	}
+
+	// the content and the FAT entry of the file cluster are not read into the cache
+	warm()
+	stageCluster(f.pFs, f.data, pFile.StartCluster)
+	NotifyFatChanged(f.fats, pFile.StartCluster)
+	if listed, indexed := isCached(); !listed || !indexed {
+		t.Fatalf("the cache is dropped after the change of the file cluster (listing %v, index %v)", listed, indexed)
+	}
+
+	changed := []struct {
+		name    string
+		cluster uint32
+	}{
+		{"self reference", dirChain[0]},
+		{"entry cluster", dirChain[len(dirChain)-1]},
+		{"index cluster", indexChain[0]},
+		{"root", 0},
+	}
+	for _, tt := range changed {
+		for _, byFat := range []bool{false, true} {
+			warm()
+			if byFat {
+				NotifyFatChanged(f.fats, tt.cluster)
+			} else {
+				stageCluster(f.pFs, f.data, tt.cluster)
+			}
+			if listed, indexed := isCached(); listed || indexed {
+				t.Errorf("%s (FAT %v): the cache is kept (listing %v, index %v)", tt.name, byFat, listed, indexed)
+			}
+		}
+	}
+}
+
+// deepTreeFS is the filesystem shared by the benchmarks: a chain of deepTreeDepth directories
+// with deepTreeEntries files in the deepest one
+var deepTreeFS *testFS
+
+const (
+	deepTreeDepth   = 30
+	deepTreeEntries = 2000
+)
+
+// getDeepTreeFS returns the shared filesystem with the path of the deepest directory.
+func getDeepTreeFS(b *testing.B) (*testFS, string) {
+	b.Helper()
+
+	segments := make([]string, deepTreeDepth)
+	for i := range segments {
+		segments[i] = fmt.Sprintf("d%d", i)
+	}
+	deepPath := consts.PathDelimiter + strings.Join(segments, consts.PathDelimiter)
+
+	if deepTreeFS == nil {
+		f := newTestFS(b, 3*deepTreeEntries+2*deepTreeDepth+1000)
+		path := ""
+		for _, segment := range segments {
+			path += consts.PathDelimiter + segment
+			f.mkdir(path)
+		}
+		for i := 0; i < deepTreeEntries; i++ {
+			f.writeFile(fmt.Sprintf("%s/f%d", deepPath, i), testPattern(byte(i), 100))
+		}
+		deepTreeFS = f
+	}
+
+	SetClusterAllocator(deepTreeFS.allocator)
+	RebuildClusterUsage(deepTreeFS.fats[0])
+	InvalidateDirCache()
+	return deepTreeFS, deepPath
+}
+
+// BenchmarkDirCache measures ls, cd and cat in the deepest directory of a deep tree with thousands
+// of entries, with the cache kept between the calls and with the cache dropped before each of them.
+func BenchmarkDirCache(b *testing.B) {
+	ops := []struct {
+		name string
+		op   func(f *testFS, deepPath string) error
+	}{
+		{"ls", func(f *testFS, deepPath string) error {
+			branch, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, deepPath)
+			if err != nil {
+				return err
+			}
+			_, err = GetDirEntries(f.pFs, branch[len(branch)-1], f.fats, f.data)
+			return err
+		}},
+		{"cd", func(f *testFS, deepPath string) error {
+			branch, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, deepPath)
+			if err != nil {
+				return err
+			}
+			// the prompt shows the absolute path of the current directory
+			_, err = GetAbsolutePathFromPwd(f.pFs, branch[len(branch)-1], f.fats, f.data)
+			return err
+		}},
+		{"cat", func(f *testFS, deepPath string) error {
+			_, err := GetFileBytes(f.pFs, f.fats, f.data, deepPath+"/f1999")
+			return err
+		}},
+		{"lookup missing", func(f *testFS, deepPath string) error {
+			_, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, deepPath+"/missing")
+			if !errors.Is(err, custom_errors.ErrEntryNotFound) {
+				return fmt.Errorf("unexpected error %v", err)
+			}
+			return nil
+		}},
+	}
+
+	for _, op := range ops {
+		for _, cached := range []bool{true, false} {
+			name := op.name + "/cached"
+			if !cached {
+				name = op.name + "/uncached"
+			}
+
+			b.Run(name, func(b *testing.B) {
+				f, deepPath := getDeepTreeFS(b)
+				if err := op.op(f, deepPath); err != nil {
+					b.Fatal(err)
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if !cached {
+						InvalidateDirCache()
+					}
+					if err := op.op(f, deepPath); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
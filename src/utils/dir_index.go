@@ -0,0 +1,433 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"slices"
+)
+
+var (
+	// dirIndexHeaderOffset is the offset of the index header in the self reference cluster of the directory
+	dirIndexHeaderOffset = binary.Size(pseudo_fat.DirectoryEntry{})
+	// dirIndexHeaderSize is the size of the serialized index header
+	dirIndexHeaderSize = binary.Size(pseudo_fat.DirIndexHeader{})
+	// dirIndexSlotSize is the size of the serialized index slot
+	dirIndexSlotSize = binary.Size(pseudo_fat.DirIndexSlot{})
+)
+
+// dirIndex is the on-disk hash table index of a large directory mapping the names of the children
+// to their start clusters, so a child is found without reading the whole directory.
+// The collisions are resolved by linear probing, the table is kept at most half full.
+type dirIndex struct {
+	// dirCluster is the self reference cluster of the directory (it holds the header)
+	dirCluster uint32
+	// header is the header of the index
+	header pseudo_fat.DirIndexHeader
+	// chain is the cluster chain of the slots
+	chain []uint32
+}
+
+// hashName returns the hash of the name of a child.
+func hashName(name string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	return hash.Sum32()
+}
+
+// readDirIndexHeader reads the index header of the directory. It returns false if the directory has no index.
+func readDirIndexHeader(pFs *pseudo_fat.FileSystem, data []byte, dirCluster uint32) (pseudo_fat.DirIndexHeader, bool, error) {
+	header := pseudo_fat.DirIndexHeader{}
+	byteOffset := int(dirCluster)*int(pFs.ClusterSize) + dirIndexHeaderOffset
+	err := BytesToStruct(data[byteOffset:byteOffset+dirIndexHeaderSize], &header)
+	if err != nil {
+		return header, false, err
+	}
+
+	return header, string(header.Signature[:]) == consts.DirIndexSignature, nil
+}
+
+// readDirIndex returns the index of the directory (nil if the directory has no index).
+//
+// It returns ErrDirIndexCorrupted if the header does not match the chain of the slots.
+func readDirIndex(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, dirCluster uint32) (*dirIndex, error) {
+	dirCache.use(fats, data)
+	if pIdx, found := dirCache.indexes[dirCluster]; found {
+		return pIdx, nil
+	}
+
+	header, hasIndex, err := readDirIndexHeader(pFs, data, dirCluster)
+	if err != nil {
+		return nil, err
+	}
+	if !hasIndex {
+		dirCache.indexes[dirCluster] = nil
+		dirCache.watch(dirCluster)
+		return nil, nil
+	}
+
+	slotCount := header.SlotCount
+	if header.StartCluster == 0 || slotCount == 0 || slotCount&(slotCount-1) != 0 || header.EntryCount > slotCount/2 {
+		return nil, fmt.Errorf("%w: invalid header (start cluster: %d, slots: %d, entries: %d)",
+			custom_errors.ErrDirIndexCorrupted, header.StartCluster, slotCount, header.EntryCount)
+	}
+
+	chain, err := GetClusterChain(header.StartCluster, fats[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", custom_errors.ErrDirIndexCorrupted, err)
+	}
+	if len(chain) != getIndexClusterCount(pFs, slotCount) {
+		return nil, fmt.Errorf("%w: %d clusters for %d slots", custom_errors.ErrDirIndexCorrupted, len(chain), slotCount)
+	}
+
+	pIdx := &dirIndex{dirCluster: dirCluster, header: header, chain: chain}
+	dirCache.indexes[dirCluster] = pIdx
+	dirCache.watch(dirCluster)
+	dirCache.watch(chain...)
+	return pIdx, nil
+}
+
+// getIndexClusterCount returns the number of the clusters holding the slots.
+func getIndexClusterCount(pFs *pseudo_fat.FileSystem, slotCount uint32) int {
+	slotsPerCluster := int(pFs.ClusterSize) / dirIndexSlotSize
+	return (int(slotCount) + slotsPerCluster - 1) / slotsPerCluster
+}
+
+// slotLocation returns the cluster of the slot and the offset of the slot within it.
+func (pIdx *dirIndex) slotLocation(pFs *pseudo_fat.FileSystem, slot uint32) (uint32, int) {
+	slotsPerCluster := uint32(int(pFs.ClusterSize) / dirIndexSlotSize)
+	return pIdx.chain[slot/slotsPerCluster], int(slot%slotsPerCluster) * dirIndexSlotSize
+}
+
+// readSlot returns the name and the start cluster stored in the slot (0 if the slot is empty).
+func (pIdx *dirIndex) readSlot(pFs *pseudo_fat.FileSystem, data []byte, slot uint32) (string, uint32) {
+	cluster, offset := pIdx.slotLocation(pFs, slot)
+	byteOffset := int(cluster)*int(pFs.ClusterSize) + offset
+	slotData := data[byteOffset : byteOffset+dirIndexSlotSize]
+
+	return GetNormalizedStrFromMem(slotData[:consts.MaxFileNameLength]), binary.LittleEndian.Uint32(slotData[consts.MaxFileNameLength:])
+}
+
+// writeSlot stores the name and the start cluster to the slot.
+func (pIdx *dirIndex) writeSlot(pFs *pseudo_fat.FileSystem, data []byte, slot uint32, name string, startCluster uint32) error {
+	slotEntry := pseudo_fat.DirIndexSlot{StartCluster: startCluster}
+	copy(slotEntry.Name[:], []byte(name))
+	slotBytes, err := StructToBytes(&slotEntry)
+	if err != nil {
+		return fmt.Errorf("failed to serialize directory index slot: %w", err)
+	}
+
+	cluster, offset := pIdx.slotLocation(pFs, slot)
+	writeToClusterAt(pFs, data, cluster, offset, slotBytes)
+	return nil
+}
+
+// writeHeader stores the header to the self reference cluster of the directory.
+func (pIdx *dirIndex) writeHeader(pFs *pseudo_fat.FileSystem, data []byte) error {
+	headerBytes, err := StructToBytes(&pIdx.header)
+	if err != nil {
+		return fmt.Errorf("failed to serialize directory index header: %w", err)
+	}
+
+	writeToClusterAt(pFs, data, pIdx.dirCluster, dirIndexHeaderOffset, headerBytes)
+	return nil
+}
+
+// find returns the slot of the name and the start cluster stored in it. If the name is not found,
+// the returned slot is the empty slot where the name belongs.
+func (pIdx *dirIndex) find(pFs *pseudo_fat.FileSystem, data []byte, name string) (uint32, uint32, bool) {
+	mask := pIdx.header.SlotCount - 1
+	slot := hashName(name) & mask
+	for i := uint32(0); i < pIdx.header.SlotCount; i++ {
+		slotName, startCluster := pIdx.readSlot(pFs, data, slot)
+		if startCluster == 0 {
+			return slot, 0, false
+		}
+		if slotName == name {
+			return slot, startCluster, true
+		}
+		slot = (slot + 1) & mask
+	}
+
+	return 0, 0, false
+}
+
+// insert stores the start cluster of the name (the name is added if it is not indexed yet).
+// The caller is responsible for keeping the table at most half full and for writing the header.
+func (pIdx *dirIndex) insert(pFs *pseudo_fat.FileSystem, data []byte, name string, startCluster uint32) error {
+	slot, _, found := pIdx.find(pFs, data, name)
+	err := pIdx.writeSlot(pFs, data, slot, name, startCluster)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		pIdx.header.EntryCount++
+	}
+	return nil
+}
+
+// remove removes the name from the index. The following slots of the probe sequence are shifted back,
+// so no slot on the way to an indexed name is ever empty.
+func (pIdx *dirIndex) remove(pFs *pseudo_fat.FileSystem, data []byte, name string) error {
+	hole, _, found := pIdx.find(pFs, data, name)
+	if !found {
+		return fmt.Errorf("%w: \"%s\" is not indexed", custom_errors.ErrDirIndexCorrupted, name)
+	}
+
+	mask := pIdx.header.SlotCount - 1
+	for slot := (hole + 1) & mask; slot != hole; slot = (slot + 1) & mask {
+		slotName, startCluster := pIdx.readSlot(pFs, data, slot)
+		if startCluster == 0 {
+			break
+		}
+
+		// the name can fill the hole if its home slot is not between the hole and its slot
+		home := hashName(slotName) & mask
+		if (slot > hole && (home <= hole || home > slot)) || (slot < hole && home <= hole && home > slot) {
+			err := pIdx.writeSlot(pFs, data, hole, slotName, startCluster)
+			if err != nil {
+				return err
+			}
+			hole = slot
+		}
+	}
+
+	err := pIdx.writeSlot(pFs, data, hole, "", 0)
+	if err != nil {
+		return err
+	}
+
+	pIdx.header.EntryCount--
+	return pIdx.writeHeader(pFs, data)
+}
+
+// buildDirIndex creates the index of the directory with the entries (a quarter of the slots is used).
+func buildDirIndex(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, dirCluster uint32, entries []pseudo_fat.DirectoryEntry) error {
+	slotCount := uint32(1)
+	for slotCount < uint32(4*len(entries)) {
+		slotCount <<= 1
+	}
+
+	clusters, err := findFreeClustersForFile(getIndexClusterCount(pFs, slotCount), fats[0])
+	if err != nil {
+		return err
+	}
+
+	markEndOfChain(fats, clusters[0])
+	clearCluster(pFs, data, clusters[0])
+	for i := 1; i < len(clusters); i++ {
+		addToFat(fats, clusters[i-1], clusters[i])
+		clearCluster(pFs, data, clusters[i])
+	}
+
+	pIdx := &dirIndex{dirCluster: dirCluster, chain: clusters}
+	copy(pIdx.header.Signature[:], []byte(consts.DirIndexSignature))
+	pIdx.header.StartCluster = clusters[0]
+	pIdx.header.SlotCount = slotCount
+	for _, entry := range entries {
+		err = pIdx.insert(pFs, data, GetNormalizedStrFromMem(entry.Name[:]), entry.StartCluster)
+		if err != nil {
+			return err
+		}
+	}
+
+	return pIdx.writeHeader(pFs, data)
+}
+
+// freeDirIndex frees the clusters of the index and removes its header.
+func freeDirIndex(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, pIdx *dirIndex) {
+	for _, cluster := range pIdx.chain {
+		markFreeCluster(fats, cluster)
+		clearCluster(pFs, data, cluster)
+	}
+
+	writeToClusterAt(pFs, data, pIdx.dirCluster, dirIndexHeaderOffset, make([]byte, dirIndexHeaderSize))
+}
+
+// addToDirIndex adds the entry written to the directory to its index. The index is created once
+// the directory exceeds consts.DirIndexThreshold entries and rebuilt larger when it gets half full.
+func addToDirIndex(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, pDir *pseudo_fat.DirectoryEntry, pEntry *pseudo_fat.DirectoryEntry) error {
+	pIdx, err := readDirIndex(pFs, fats, data, pDir.StartCluster)
+	if err != nil {
+		return err
+	}
+
+	if pIdx != nil && (pIdx.header.EntryCount+1)*2 <= pIdx.header.SlotCount {
+		err = pIdx.insert(pFs, data, GetNormalizedStrFromMem(pEntry.Name[:]), pEntry.StartCluster)
+		if err != nil {
+			return err
+		}
+		return pIdx.writeHeader(pFs, data)
+	}
+
+	if pIdx == nil {
+		chain, err := GetClusterChain(pDir.StartCluster, fats[0])
+		if err != nil {
+			return fmt.Errorf("failed to get cluster chain: %w", err)
+		}
+		// the self reference is not an entry
+		if len(chain)-1 <= consts.DirIndexThreshold {
+			return nil
+		}
+	}
+
+	entries, _, err := readDirEntries(pFs, pDir, fats, data)
+	if err != nil {
+		return err
+	}
+	if pIdx != nil {
+		freeDirIndex(pFs, fats, data, pIdx)
+	}
+
+	return buildDirIndex(pFs, fats, data, pDir.StartCluster, entries)
+}
+
+// removeFromDirIndex removes the name from the index of the directory (if it has one).
+func removeFromDirIndex(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, pDir *pseudo_fat.DirectoryEntry, name string) error {
+	pIdx, err := readDirIndex(pFs, fats, data, pDir.StartCluster)
+	if err != nil || pIdx == nil {
+		return err
+	}
+
+	return pIdx.remove(pFs, data, name)
+}
+
+// updateDirIndex changes the start cluster of the indexed name (if the directory has an index).
+func updateDirIndex(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, dirCluster uint32, name string, startCluster uint32) error {
+	pIdx, err := readDirIndex(pFs, fats, data, dirCluster)
+	if err != nil || pIdx == nil {
+		return err
+	}
+
+	slot, _, found := pIdx.find(pFs, data, name)
+	if !found {
+		return fmt.Errorf("%w: \"%s\" is not indexed", custom_errors.ErrDirIndexCorrupted, name)
+	}
+
+	return pIdx.writeSlot(pFs, data, slot, name, startCluster)
+}
+
+// dropDirIndex frees the index of the directory (if it has one).
+func dropDirIndex(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, dirCluster uint32) error {
+	pIdx, err := readDirIndex(pFs, fats, data, dirCluster)
+	if err != nil || pIdx == nil {
+		return err
+	}
+
+	freeDirIndex(pFs, fats, data, pIdx)
+	return nil
+}
+
+// moveDirIndexStart updates the first cluster of the index in the header if it was moved.
+// Only the header is read, the chain of the slots can be relinked later.
+func moveDirIndexStart(pFs *pseudo_fat.FileSystem, data []byte, dirCluster uint32, moved map[uint32]uint32) error {
+	header, hasIndex, err := readDirIndexHeader(pFs, data, dirCluster)
+	if err != nil || !hasIndex {
+		return err
+	}
+
+	newStart, found := moved[header.StartCluster]
+	if !found {
+		return nil
+	}
+
+	pIdx := &dirIndex{dirCluster: dirCluster, header: header}
+	pIdx.header.StartCluster = newStart
+	return pIdx.writeHeader(pFs, data)
+}
+
+// lookupDirIndex finds the child of the directory in its index and reads it from its self reference.
+// It returns false if the directory has no index (nil entry if the child is not indexed).
+func lookupDirIndex(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, dirCluster uint32, name string) (*pseudo_fat.DirectoryEntry, bool, error) {
+	pIdx, err := readDirIndex(pFs, fats, data, dirCluster)
+	if err != nil || pIdx == nil {
+		return nil, false, err
+	}
+
+	_, startCluster, found := pIdx.find(pFs, data, name)
+	if !found {
+		return nil, true, nil
+	}
+
+	pEntry, err := readEntryAt(pFs, data, startCluster)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read directory entry: %w", err)
+	}
+	// the entry can be cached on a path (see GetBranchDirEntriesFromRoot)
+	dirCache.watch(startCluster)
+	if GetNormalizedStrFromMem(pEntry.Name[:]) != name {
+		return nil, true, fmt.Errorf("%w: \"%s\" points to another entry", custom_errors.ErrDirIndexCorrupted, name)
+	}
+
+	return pEntry, true, nil
+}
+
+// GetDirIndexClusters returns the clusters holding the index of the directory (nil if it has none).
+func GetDirIndexClusters(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, pDir *pseudo_fat.DirectoryEntry) ([]uint32, error) {
+	// sanity checks
+	if pFs == nil || fats == nil || data == nil || pDir == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	pIdx, err := readDirIndex(pFs, fats, data, pDir.StartCluster)
+	if err != nil || pIdx == nil {
+		return nil, err
+	}
+
+	return slices.Clone(pIdx.chain), nil
+}
+
+// VerifyDirIndex checks that the index of the directory (if it has one) contains exactly the children
+// and that its chain is the same in all FATs.
+//
+// It returns ErrDirIndexCorrupted describing the first found problem.
+func VerifyDirIndex(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, pDir *pseudo_fat.DirectoryEntry, children [](*pseudo_fat.DirectoryEntry)) error {
+	// sanity checks
+	if pFs == nil || fats == nil || data == nil || pDir == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	pIdx, err := readDirIndex(pFs, fats, data, pDir.StartCluster)
+	if err != nil || pIdx == nil {
+		return err
+	}
+
+	for i := 1; i < len(fats); i++ {
+		chain, err := GetClusterChain(pIdx.header.StartCluster, fats[i])
+		if err != nil || !slices.Equal(chain, pIdx.chain) {
+			return fmt.Errorf("%w: chain differs in FAT%d", custom_errors.ErrDirIndexCorrupted, i)
+		}
+	}
+
+	if int(pIdx.header.EntryCount) != len(children) {
+		return fmt.Errorf("%w: %d entries indexed, %d in the directory", custom_errors.ErrDirIndexCorrupted, pIdx.header.EntryCount, len(children))
+	}
+
+	for _, pChild := range children {
+		name := GetNormalizedStrFromMem(pChild.Name[:])
+		_, startCluster, found := pIdx.find(pFs, data, name)
+		if !found {
+			return fmt.Errorf("%w: \"%s\" is not indexed", custom_errors.ErrDirIndexCorrupted, name)
+		}
+		if startCluster != pChild.StartCluster {
+			return fmt.Errorf("%w: \"%s\" indexed with start cluster %d instead of %d", custom_errors.ErrDirIndexCorrupted, name, startCluster, pChild.StartCluster)
+		}
+	}
+
+	used := uint32(0)
+	for slot := uint32(0); slot < pIdx.header.SlotCount; slot++ {
+		if _, startCluster := pIdx.readSlot(pFs, data, slot); startCluster != 0 {
+			used++
+		}
+	}
+	if used != pIdx.header.EntryCount {
+		return fmt.Errorf("%w: %d slots used, %d entries indexed", custom_errors.ErrDirIndexCorrupted, used, pIdx.header.EntryCount)
+	}
+
+	return nil
+}
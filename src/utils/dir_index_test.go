@@ -0,0 +1,552 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"math/rand"
+	"testing"
+)
+
+// addTestEntries creates the count of the one byte files named with the prefix in the directory.
+func addTestEntries(f *testFS, dir string, prefix string, from int, count int) {
+	f.tb.Helper()
+	for i := from; i < from+count; i++ {
+		f.writeFile(JoinAbsPath(dir, fmt.Sprintf("%s%d", prefix, i)), []byte{byte(i)})
+	}
+}
+
+// getTestDirEntry returns the entry of the directory or fails the test.
+func getTestDirEntry(f *testFS, path string) *pseudo_fat.DirectoryEntry {
+	f.tb.Helper()
+	branch, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, path)
+	if err != nil {
+		f.tb.Fatalf("lookup %s: %v", path, err)
+	}
+	return branch[len(branch)-1]
+}
+
+// checkIndexed fails the test if the name is not indexed in the directory with the start cluster of its entry.
+func checkIndexed(f *testFS, dir string, name string) {
+	f.tb.Helper()
+
+	pDir := getTestDirEntry(f, dir)
+	pEntry, indexed, err := lookupDirIndex(f.pFs, f.fats, f.data, pDir.StartCluster, name)
+	if err != nil || !indexed || pEntry == nil {
+		f.tb.Fatalf("%s/%s: indexed %v, entry %v, error %v", dir, name, indexed, pEntry, err)
+	}
+	if expected := getTestDirEntry(f, JoinAbsPath(dir, name)); expected.StartCluster != pEntry.StartCluster {
+		f.tb.Fatalf("%s/%s: indexed start cluster %d, entry start cluster %d", dir, name, pEntry.StartCluster, expected.StartCluster)
+	}
+}
+
+// checkNotIndexed fails the test if the name is indexed in the directory.
+func checkNotIndexed(f *testFS, dir string, name string) {
+	f.tb.Helper()
+
+	pDir := getTestDirEntry(f, dir)
+	pEntry, indexed, err := lookupDirIndex(f.pFs, f.fats, f.data, pDir.StartCluster, name)
+	if err != nil || !indexed || pEntry != nil {
+		f.tb.Fatalf("%s/%s: indexed %v, entry %v, error %v", dir, name, indexed, pEntry, err)
+	}
+}
+
+func TestDirIndexBuiltOverThreshold(t *testing.T) {
+	f := newTestFS(t, 1000)
+	f.mkdir("/d")
+	addTestEntries(f, "/d", "x", 0, consts.DirIndexThreshold-1)
+	f.mkdir("/d/sub")
+
+	// a directory with the threshold entries has no index
+	if _, found := readTestDirIndexHeader(f, getTestDirEntry(f, "/d")); found {
+		t.Fatalf("index built for %d entries", consts.DirIndexThreshold)
+	}
+	used := GetFatUsage(f.fats[0]).Used
+
+	addTestEntries(f, "/d", "y", 0, 1)
+	header, found := readTestDirIndexHeader(f, getTestDirEntry(f, "/d"))
+	if !found {
+		t.Fatalf("no index built for %d entries", consts.DirIndexThreshold+1)
+	}
+
+	entryCount := uint32(consts.DirIndexThreshold + 1)
+	slotCount := uint32(1)
+	for slotCount < 4*entryCount {
+		slotCount <<= 1
+	}
+	if header.EntryCount != entryCount || header.SlotCount != slotCount {
+		t.Errorf("header %+v, expected %d entries in %d slots", header, entryCount, slotCount)
+	}
+
+	// the new file takes an entry cluster, its self reference and a data cluster, the rest is the index
+	indexClusters := getIndexClusterCount(f.pFs, slotCount)
+	if got := GetFatUsage(f.fats[0]).Used - used; got != uint32(3+indexClusters) {
+		t.Errorf("%d clusters used by the file and the index, expected %d", got, 3+indexClusters)
+	}
+
+	checkIndexed(f, "/d", "x0")
+	checkIndexed(f, "/d", "y0")
+	checkIndexed(f, "/d", "sub")
+	checkNotIndexed(f, "/d", "missing")
+	f.checkConsistency()
+
+	// the other directories are not indexed
+	if _, found := readTestDirIndexHeader(f, getTestDirEntry(f, "/d/sub")); found {
+		t.Error("index built for an empty directory")
+	}
+}
+
+func TestDirIndexGrowsWhenHalfFull(t *testing.T) {
+	f := newTestFS(t, 4000)
+	f.mkdir("/d")
+	addTestEntries(f, "/d", "x", 0, consts.DirIndexThreshold+1)
+
+	header, _ := readTestDirIndexHeader(f, getTestDirEntry(f, "/d"))
+	slotCount := header.SlotCount
+
+	// the index is kept until it is half full
+	count := int(slotCount / 2)
+	addTestEntries(f, "/d", "x", consts.DirIndexThreshold+1, count-consts.DirIndexThreshold-1)
+	header, _ = readTestDirIndexHeader(f, getTestDirEntry(f, "/d"))
+	if header.SlotCount != slotCount || header.EntryCount != uint32(count) {
+		t.Fatalf("header %+v, expected %d entries in %d slots", header, count, slotCount)
+	}
+	oldStart := header.StartCluster
+	used := GetFatUsage(f.fats[0]).Used
+
+	// the next entry rebuilds it with a quarter of the slots used
+	addTestEntries(f, "/d", "x", count, 1)
+	header, _ = readTestDirIndexHeader(f, getTestDirEntry(f, "/d"))
+	if header.SlotCount != 4*slotCount || header.EntryCount != uint32(count+1) {
+		t.Fatalf("header %+v after the rebuild, expected %d entries in %d slots", header, count+1, 4*slotCount)
+	}
+
+	// the old chain is freed
+	grown := getIndexClusterCount(f.pFs, 4*slotCount) - getIndexClusterCount(f.pFs, slotCount)
+	if got := GetFatUsage(f.fats[0]).Used - used; got != uint32(3+grown) {
+		t.Errorf("%d clusters used by the file and the rebuild, expected %d (old start %d, new start %d)",
+			got, 3+grown, oldStart, header.StartCluster)
+	}
+
+	for i := 0; i <= count; i++ {
+		checkIndexed(f, "/d", fmt.Sprintf("x%d", i))
+	}
+	f.checkConsistency()
+}
+
+// newTestDirIndex builds the index of the names (with the fake start clusters) in the new directory
+// and returns it with the start clusters of the names.
+func newTestDirIndex(f *testFS, names []string) (*dirIndex, map[string]uint32) {
+	f.tb.Helper()
+
+	f.mkdir("/d")
+	pDir := getTestDirEntry(f, "/d")
+
+	starts := make(map[string]uint32, len(names))
+	entries := make([]pseudo_fat.DirectoryEntry, len(names))
+	for i, name := range names {
+		entries[i] = NewDirectoryEntry(true, 0, uint32(1000+i), 0, name)
+		starts[name] = uint32(1000 + i)
+	}
+	if err := buildDirIndex(f.pFs, f.fats, f.data, pDir.StartCluster, entries); err != nil {
+		f.tb.Fatal(err)
+	}
+
+	pIdx, err := readDirIndex(f.pFs, f.fats, f.data, pDir.StartCluster)
+	if err != nil || pIdx == nil {
+		f.tb.Fatalf("index %v, error %v", pIdx, err)
+	}
+	return pIdx, starts
+}
+
+// checkProbeRuns fails the test if the index does not contain exactly the names or if an empty slot
+// is between the home slot of a name and the slot holding it.
+func checkProbeRuns(f *testFS, pIdx *dirIndex, starts map[string]uint32) {
+	f.tb.Helper()
+
+	mask := pIdx.header.SlotCount - 1
+	used := 0
+	for slot := uint32(0); slot < pIdx.header.SlotCount; slot++ {
+		name, startCluster := pIdx.readSlot(f.pFs, f.data, slot)
+		if startCluster == 0 {
+			continue
+		}
+		used++
+
+		if starts[name] != startCluster {
+			f.tb.Fatalf("slot %d: \"%s\" with start cluster %d, expected %d", slot, name, startCluster, starts[name])
+		}
+		for probe := hashName(name) & mask; probe != slot; probe = (probe + 1) & mask {
+			if _, probeStart := pIdx.readSlot(f.pFs, f.data, probe); probeStart == 0 {
+				f.tb.Fatalf("\"%s\" in slot %d is behind the empty slot %d", name, slot, probe)
+			}
+		}
+	}
+
+	if used != len(starts) || pIdx.header.EntryCount != uint32(len(starts)) {
+		f.tb.Fatalf("%d slots used, %d entries in the header, %d names", used, pIdx.header.EntryCount, len(starts))
+	}
+	for name, startCluster := range starts {
+		if _, got, found := pIdx.find(f.pFs, f.data, name); !found || got != startCluster {
+			f.tb.Fatalf("\"%s\": found %v with start cluster %d, expected %d", name, found, got, startCluster)
+		}
+	}
+}
+
+// collidingNames returns the names (in the order of the homes) whose home slots in the table
+// of the slot count are the homes.
+func collidingNames(slotCount uint32, homes []uint32) []string {
+	res := make([]string, 0, len(homes))
+	used := make(map[string]bool)
+	for _, home := range homes {
+		for i := 0; ; i++ {
+			name := fmt.Sprintf("n%d", i)
+			if !used[name] && hashName(name)&(slotCount-1) == home {
+				used[name] = true
+				res = append(res, name)
+				break
+			}
+		}
+	}
+	return res
+}
+
+func TestDirIndexRemoveFromProbeRun(t *testing.T) {
+	// 8 names are indexed in 32 slots: the runs 30..1 (wrapping around) and 10..15 (two homes)
+	const slotCount = 32
+	homes := []uint32{30, 30, 31, 30, 10, 10, 11, 10}
+
+	tests := []struct {
+		name    string
+		removed []int
+	}{
+		{"middle of the run", []int{5}},
+		{"start of the run", []int{4}},
+		{"end of the run", []int{7}},
+		{"middle of the wrapped run", []int{1}},
+		{"before the wrap", []int{0, 2}},
+		{"after the wrap", []int{3}},
+		{"other home in the run", []int{6}},
+		{"whole run", []int{5, 4, 7, 6}},
+		{"all", []int{3, 1, 2, 0, 6, 7, 4, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFS(t, 100)
+			names := collidingNames(slotCount, homes)
+			pIdx, starts := newTestDirIndex(f, names)
+			if pIdx.header.SlotCount != slotCount {
+				t.Fatalf("%d slots, expected %d", pIdx.header.SlotCount, slotCount)
+			}
+			checkProbeRuns(f, pIdx, starts)
+
+			for _, idx := range tt.removed {
+				if err := pIdx.remove(f.pFs, f.data, names[idx]); err != nil {
+					t.Fatal(err)
+				}
+				delete(starts, names[idx])
+				checkProbeRuns(f, pIdx, starts)
+			}
+
+			if err := pIdx.remove(f.pFs, f.data, names[tt.removed[0]]); !errors.Is(err, custom_errors.ErrDirIndexCorrupted) {
+				t.Errorf("removing the removed name: %v", err)
+			}
+
+			// the header is written with every removal
+			header, _ := readTestDirIndexHeader(f, getTestDirEntry(f, "/d"))
+			if header != pIdx.header {
+				t.Errorf("header %+v written, %+v in memory", header, pIdx.header)
+			}
+		})
+	}
+}
+
+func TestDirIndexRandomRemovals(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for round := 0; round < 50; round++ {
+		f := newTestFS(t, 100)
+		homes := make([]uint32, 16)
+		for i := range homes {
+			// the homes are crowded in a few places to get long runs
+			homes[i] = []uint32{0, 1, 62, 63, 20}[rnd.Intn(5)]
+		}
+		names := collidingNames(64, homes)
+		pIdx, starts := newTestDirIndex(f, names)
+
+		for _, idx := range rnd.Perm(len(names)) {
+			if err := pIdx.remove(f.pFs, f.data, names[idx]); err != nil {
+				t.Fatal(err)
+			}
+			delete(starts, names[idx])
+			checkProbeRuns(f, pIdx, starts)
+
+			// the names are added back sometimes, so the runs change between the removals
+			if rnd.Intn(4) == 0 {
+				if err := pIdx.insert(f.pFs, f.data, names[idx], uint32(2000+round)); err != nil {
+					t.Fatal(err)
+				}
+				starts[names[idx]] = uint32(2000 + round)
+				checkProbeRuns(f, pIdx, starts)
+
+				if err := pIdx.remove(f.pFs, f.data, names[idx]); err != nil {
+					t.Fatal(err)
+				}
+				delete(starts, names[idx])
+				checkProbeRuns(f, pIdx, starts)
+			}
+		}
+	}
+}
+
+func TestDirIndexMoves(t *testing.T) {
+	f := newTestFS(t, 2500)
+	f.mkdir("/big")
+	addTestEntries(f, "/big", "x", 0, consts.DirIndexThreshold+1)
+	f.mkdir("/big2")
+	addTestEntries(f, "/big2", "z", 0, consts.DirIndexThreshold+1)
+	f.mkdir("/at")
+	addTestEntries(f, "/at", "a", 0, consts.DirIndexThreshold)
+	f.mkdir("/small")
+	addTestEntries(f, "/small", "s", 0, 3)
+
+	entryCount := func(dir string) uint32 {
+		t.Helper()
+		header, found := readTestDirIndexHeader(f, getTestDirEntry(f, dir))
+		if !found {
+			t.Fatalf("%s has no index", dir)
+		}
+		return header.EntryCount
+	}
+	move := func(src string, dest string) {
+		t.Helper()
+		if err := MoveFile(f.pFs, f.fats, f.data, src, dest); err != nil {
+			t.Fatalf("mv %s %s: %v", src, dest, err)
+		}
+		f.checkConsistency()
+	}
+	count := uint32(consts.DirIndexThreshold + 1)
+
+	// rename within the indexed directory
+	move("/big/x1", "/big/y1")
+	checkIndexed(f, "/big", "y1")
+	checkNotIndexed(f, "/big", "x1")
+	if got := entryCount("/big"); got != count {
+		t.Errorf("%d entries indexed after the rename, expected %d", got, count)
+	}
+
+	// out of the indexed directory
+	move("/big/x2", "/small/x2")
+	checkNotIndexed(f, "/big", "x2")
+	if got := entryCount("/big"); got != count-1 {
+		t.Errorf("%d entries indexed after the move out, expected %d", got, count-1)
+	}
+
+	// into the indexed directory
+	move("/small/s0", "/big/s0")
+	checkIndexed(f, "/big", "s0")
+	if got := entryCount("/big"); got != count {
+		t.Errorf("%d entries indexed after the move in, expected %d", got, count)
+	}
+
+	// between two indexed directories with a rename
+	move("/big/x3", "/big2/w3")
+	checkNotIndexed(f, "/big", "x3")
+	checkIndexed(f, "/big2", "w3")
+	if got := entryCount("/big"); got != count-1 {
+		t.Errorf("%d entries indexed in the source, expected %d", got, count-1)
+	}
+	if got := entryCount("/big2"); got != count+1 {
+		t.Errorf("%d entries indexed in the destination, expected %d", got, count+1)
+	}
+
+	// the move over the threshold builds the index
+	if _, found := readTestDirIndexHeader(f, getTestDirEntry(f, "/at")); found {
+		t.Fatal("index built at the threshold")
+	}
+	move("/small/s1", "/at/s1")
+	if got := entryCount("/at"); got != count {
+		t.Errorf("%d entries indexed after the move over the threshold, expected %d", got, count)
+	}
+	checkIndexed(f, "/at", "s1")
+	checkIndexed(f, "/at", "a0")
+
+	// the names moved back are found again
+	move("/big2/w3", "/big/x3")
+	checkIndexed(f, "/big", "x3")
+	checkNotIndexed(f, "/big2", "w3")
+}
+
+func TestMoveDirIndexStart(t *testing.T) {
+	f := newTestFS(t, 1000)
+	f.mkdir("/big")
+	addTestEntries(f, "/big", "x", 0, consts.DirIndexThreshold+1)
+	f.mkdir("/small")
+	pBig, pSmall := getTestDirEntry(f, "/big"), getTestDirEntry(f, "/small")
+	header, _ := readTestDirIndexHeader(f, pBig)
+
+	// the start not moved and the directory without an index are left alone
+	dataBefore := append([]byte(nil), f.data...)
+	moved := map[uint32]uint32{header.StartCluster + 1: 3, pSmall.StartCluster: 4}
+	for _, dirCluster := range []uint32{pBig.StartCluster, pSmall.StartCluster} {
+		if err := moveDirIndexStart(f.pFs, f.data, dirCluster, moved); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(dataBefore) != string(f.data) {
+		t.Error("data changed without a moved index start")
+	}
+
+	// only the start is changed
+	moved[header.StartCluster] = 3
+	if err := moveDirIndexStart(f.pFs, f.data, pBig.StartCluster, moved); err != nil {
+		t.Fatal(err)
+	}
+	got, found := readTestDirIndexHeader(f, pBig)
+	expected := header
+	expected.StartCluster = 3
+	if !found || got != expected {
+		t.Errorf("header %+v, expected %+v", got, expected)
+	}
+}
+
+func TestDirIndexRelocatedByShrink(t *testing.T) {
+	tests := []struct {
+		name   string
+		shrink func(f *testFS) error
+	}{
+		{"resize", func(f *testFS) error {
+			_, err := ResizeFileSystem(f.pFs, &f.fats, &f.data, uint32(GetFSSizeForClusters(getUsedClustersLimit(f.fats[0])+5)))
+			return err
+		}},
+		{"compact", func(f *testFS) error {
+			_, err := CompactFileSystem(f.pFs, &f.fats, &f.data, 0, false)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFS(t, 2000)
+
+			// the directory and its index are created above the filler
+			f.writeFile("/filler", make([]byte, 900*int(consts.ClusterSize)))
+			f.mkdir("/big")
+			addTestEntries(f, "/big", "x", 0, consts.DirIndexThreshold+1)
+			if err := RemoveFile(f.pFs, f.fats, f.data, "/filler"); err != nil {
+				t.Fatal(err)
+			}
+
+			pBig := getTestDirEntry(f, "/big")
+			header, _ := readTestDirIndexHeader(f, pBig)
+			oldStart, oldDirStart := header.StartCluster, pBig.StartCluster
+
+			if err := tt.shrink(f); err != nil {
+				t.Fatal(err)
+			}
+
+			pBig = getTestDirEntry(f, "/big")
+			header, found := readTestDirIndexHeader(f, pBig)
+			if !found {
+				t.Fatal("index lost by the shrink")
+			}
+			if header.StartCluster == oldStart || pBig.StartCluster == oldDirStart {
+				t.Fatalf("index start %d, directory start %d not moved", header.StartCluster, pBig.StartCluster)
+			}
+			if header.StartCluster >= uint32(len(f.fats[0])) {
+				t.Fatalf("index start %d above the %d clusters", header.StartCluster, len(f.fats[0]))
+			}
+
+			f.checkConsistency()
+			for i := 0; i <= consts.DirIndexThreshold; i++ {
+				checkIndexed(f, "/big", fmt.Sprintf("x%d", i))
+			}
+		})
+	}
+}
+
+func TestVerifyDirIndexCorruption(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(f *testFS, pIdx *dirIndex) error
+	}{
+		{"slot start cluster", func(f *testFS, pIdx *dirIndex) error {
+			slot, startCluster, _ := pIdx.find(f.pFs, f.data, "x5")
+			return pIdx.writeSlot(f.pFs, f.data, slot, "x5", startCluster+1)
+		}},
+		{"slot name", func(f *testFS, pIdx *dirIndex) error {
+			slot, startCluster, _ := pIdx.find(f.pFs, f.data, "x5")
+			return pIdx.writeSlot(f.pFs, f.data, slot, "y5", startCluster)
+		}},
+		{"cleared slot", func(f *testFS, pIdx *dirIndex) error {
+			slot, _, _ := pIdx.find(f.pFs, f.data, "x5")
+			return pIdx.writeSlot(f.pFs, f.data, slot, "", 0)
+		}},
+		{"extra slot", func(f *testFS, pIdx *dirIndex) error {
+			slot, _, _ := pIdx.find(f.pFs, f.data, "extra")
+			return pIdx.writeSlot(f.pFs, f.data, slot, "extra", 1)
+		}},
+		{"header entry count", func(f *testFS, pIdx *dirIndex) error {
+			pIdx.header.EntryCount--
+			return pIdx.writeHeader(f.pFs, f.data)
+		}},
+		{"header entry count over half", func(f *testFS, pIdx *dirIndex) error {
+			pIdx.header.EntryCount = pIdx.header.SlotCount/2 + 1
+			return pIdx.writeHeader(f.pFs, f.data)
+		}},
+		{"header slot count", func(f *testFS, pIdx *dirIndex) error {
+			pIdx.header.SlotCount--
+			return pIdx.writeHeader(f.pFs, f.data)
+		}},
+		{"header smaller slot count", func(f *testFS, pIdx *dirIndex) error {
+			pIdx.header.SlotCount /= 2
+			return pIdx.writeHeader(f.pFs, f.data)
+		}},
+		{"header start cluster", func(f *testFS, pIdx *dirIndex) error {
+			pIdx.header.StartCluster = 0
+			return pIdx.writeHeader(f.pFs, f.data)
+		}},
+		{"header start cluster of a file", func(f *testFS, pIdx *dirIndex) error {
+			pIdx.header.StartCluster = getTestDirEntry(f, "/big/x0").StartCluster
+			return pIdx.writeHeader(f.pFs, f.data)
+		}},
+		{"chain in the second FAT", func(f *testFS, pIdx *dirIndex) error {
+			f.fats[1][pIdx.chain[0]] = consts.FatFileEnd
+			return nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFS(t, 1000)
+			f.mkdir("/big")
+			addTestEntries(f, "/big", "x", 0, consts.DirIndexThreshold+1)
+
+			pBig := getTestDirEntry(f, "/big")
+			children, err := GetDirEntries(f.pFs, pBig, f.fats, f.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = VerifyDirIndex(f.pFs, f.fats, f.data, pBig, children); err != nil {
+				t.Fatal(err)
+			}
+
+			pIdx, err := readDirIndex(f.pFs, f.fats, f.data, pBig.StartCluster)
+			if err != nil || pIdx == nil {
+				t.Fatalf("index %v, error %v", pIdx, err)
+			}
+			if err = tt.corrupt(f, pIdx); err != nil {
+				t.Fatal(err)
+			}
+			InvalidateDirCache()
+
+			err = VerifyDirIndex(f.pFs, f.fats, f.data, pBig, children)
+			if !errors.Is(err, custom_errors.ErrDirIndexCorrupted) {
+				t.Errorf("verify after the corruption: %v", err)
+			}
+		})
+	}
+}
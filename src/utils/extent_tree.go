@@ -0,0 +1,138 @@
+// utils package contains utility functions for the project
+package utils
+
+// extentKey orders the free extents by their length and then by their first cluster
+type extentKey struct {
+	// length is the number of the clusters in the extent
+	length uint32
+	// start is the first cluster of the extent
+	start uint32
+}
+
+// less returns true if the key is ordered before the other key.
+func (k extentKey) less(other extentKey) bool {
+	if k.length != other.length {
+		return k.length < other.length
+	}
+
+	return k.start < other.start
+}
+
+// extentNode is a node of the extent tree
+type extentNode struct {
+	key      extentKey
+	priority uint32
+	left     *extentNode
+	right    *extentNode
+}
+
+// extentTree is the run-length tree of the free extents (a treap ordered by extentKey)
+type extentTree struct {
+	root *extentNode
+	// seed is the state of the generator of the node priorities
+	seed uint32
+	// size is the number of the extents in the tree
+	size int
+}
+
+// nextPriority returns the pseudo-random priority of a new node (xorshift).
+func (t *extentTree) nextPriority() uint32 {
+	if t.seed == 0 {
+		t.seed = 2463534242
+	}
+	t.seed ^= t.seed << 13
+	t.seed ^= t.seed >> 17
+	t.seed ^= t.seed << 5
+
+	return t.seed
+}
+
+// splitExtents splits the subtree into the keys ordered before the key and the rest.
+func splitExtents(pNode *extentNode, key extentKey) (*extentNode, *extentNode) {
+	if pNode == nil {
+		return nil, nil
+	}
+
+	if pNode.key.less(key) {
+		left, right := splitExtents(pNode.right, key)
+		pNode.right = left
+		return pNode, right
+	}
+
+	left, right := splitExtents(pNode.left, key)
+	pNode.left = right
+	return left, pNode
+}
+
+// mergeExtents merges the subtrees (all keys of the left one are ordered before the right one).
+func mergeExtents(pLeft *extentNode, pRight *extentNode) *extentNode {
+	if pLeft == nil {
+		return pRight
+	} else if pRight == nil {
+		return pLeft
+	}
+
+	if pLeft.priority > pRight.priority {
+		pLeft.right = mergeExtents(pLeft.right, pRight)
+		return pLeft
+	}
+
+	pRight.left = mergeExtents(pLeft, pRight.left)
+	return pRight
+}
+
+// insert adds the extent to the tree.
+func (t *extentTree) insert(key extentKey) {
+	left, right := splitExtents(t.root, key)
+	pNode := &extentNode{key: key, priority: t.nextPriority()}
+	t.root = mergeExtents(mergeExtents(left, pNode), right)
+	t.size++
+}
+
+// remove removes the extent from the tree (if present).
+func (t *extentTree) remove(key extentKey) {
+	left, right := splitExtents(t.root, key)
+	// the key is the smallest one of the right subtree
+	next := extentKey{length: key.length, start: key.start + 1}
+	middle, right := splitExtents(right, next)
+	if middle != nil {
+		t.size--
+	}
+	t.root = mergeExtents(left, right)
+}
+
+// lowerBound returns the smallest key that is not ordered before the key.
+func (t *extentTree) lowerBound(key extentKey) (extentKey, bool) {
+	var res extentKey
+	found := false
+	for pNode := t.root; pNode != nil; {
+		if pNode.key.less(key) {
+			pNode = pNode.right
+		} else {
+			res = pNode.key
+			found = true
+			pNode = pNode.left
+		}
+	}
+
+	return res, found
+}
+
+// descending calls the callback for the extents from the longest one until it returns false.
+func (t *extentTree) descending(callback func(key extentKey) bool) {
+	stack := make([]*extentNode, 0)
+	pNode := t.root
+	for pNode != nil || len(stack) > 0 {
+		for pNode != nil {
+			stack = append(stack, pNode)
+			pNode = pNode.right
+		}
+
+		pNode = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !callback(pNode.key) {
+			return
+		}
+		pNode = pNode.left
+	}
+}
@@ -0,0 +1,112 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"fmt"
+	"io"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+)
+
+// FileReader reads the file content directly from the data clusters of its chain
+// (without copying the whole file, see GetFileBytes). It implements io.ReadSeeker.
+type FileReader struct {
+	// clusterSize is the size of a cluster in bytes
+	clusterSize uint32
+	// dataRef is the data region of the filesystem
+	dataRef []byte
+	// dataChain is the cluster chain of the file without the self reference cluster
+	dataChain []uint32
+	// size is the size of the file in bytes
+	size int64
+	// offset is the current read position in the file
+	offset int64
+}
+
+// NewFileReader creates the reader of the file at the path.
+// Expects the absNormPath to be a valid normalized absolute path.
+//
+// It returns ErrIsDir if the path is a directory.
+func NewFileReader(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, absNormPath string) (*FileReader, error) {
+	// sanity checks
+	if pFs == nil || fatsRef == nil || dataRef == nil || absNormPath == "" {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	branchDirEntries, err := GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, absNormPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pEntry := branchDirEntries[len(branchDirEntries)-1]
+	if !pEntry.IsFile {
+		return nil, custom_errors.ErrIsDir
+	}
+
+	clusterChain, err := GetClusterChain(pEntry.StartCluster, fatsRef[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster chain: %w", err)
+	}
+
+	return &FileReader{
+		clusterSize: uint32(pFs.ClusterSize),
+		dataRef:     dataRef,
+		dataChain:   clusterChain[1:], // skip the first cluster (directory entry)
+		size:        int64(pEntry.Size),
+	}, nil
+}
+
+// Size returns the size of the file in bytes.
+func (r *FileReader) Size() int64 {
+	return r.size
+}
+
+// Read reads up to len(p) bytes from the current position (see io.Reader).
+func (r *FileReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	read := 0
+	for read < len(p) && r.offset < r.size {
+		clusterIdx := r.offset / int64(r.clusterSize)
+		if clusterIdx >= int64(len(r.dataChain)) {
+			return read, custom_errors.ErrInvalidClusterChain
+		}
+
+		inClusterOffset := r.offset % int64(r.clusterSize)
+		available := int64(r.clusterSize) - inClusterOffset
+		if remaining := r.size - r.offset; remaining < available {
+			available = remaining
+		}
+
+		byteOffset := int64(r.dataChain[clusterIdx])*int64(r.clusterSize) + inClusterOffset
+		n := copy(p[read:], r.dataRef[byteOffset:byteOffset+available])
+		read += n
+		r.offset += int64(n)
+	}
+
+	return read, nil
+}
+
+// Seek sets the position of the next Read (see io.Seeker).
+func (r *FileReader) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekStart:
+		newOffset = offset
+	case io.SeekCurrent:
+		newOffset = r.offset + offset
+	case io.SeekEnd:
+		newOffset = r.size + offset
+	default:
+		return r.offset, custom_errors.ErrInvalidSeek
+	}
+
+	if newOffset < 0 {
+		return r.offset, custom_errors.ErrInvalidSeek
+	}
+	r.offset = newOffset
+
+	return r.offset, nil
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"kiv-zos-semestral-work/custom_errors"
+	"testing"
+)
+
+// newReaderTestFS returns the filesystem with the fragmented file /f (the first two data clusters are
+// followed by the file /g, the rest of /f is appended after it) and the directory /d.
+func newReaderTestFS(t *testing.T) (*testFS, []byte) {
+	t.Helper()
+
+	f := newTestFS(t, 20)
+	clusterSize := int(f.pFs.ClusterSize)
+	content := testPattern(1, 2*clusterSize)
+	f.writeFile("/f", content)
+	f.writeFile("/g", []byte("g"))
+	appended := testPattern(7, clusterSize+100)
+	if err := AppendFile(f.pFs, f.fats, f.data, "/f", appended); err != nil {
+		t.Fatal(err)
+	}
+	f.mkdir("/d")
+
+	branch, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, "/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := GetClusterChain(branch[len(branch)-1].StartCluster, f.fats[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 5 || chain[3] == chain[2]+1 {
+		t.Fatalf("chain %v of /f is not fragmented", chain)
+	}
+
+	return f, append(content, appended...)
+}
+
+func TestFileReaderRead(t *testing.T) {
+	f, content := newReaderTestFS(t)
+	clusterSize := int(f.pFs.ClusterSize)
+
+	// the buffer sizes read across the cluster boundaries in different places
+	for _, bufSize := range []int{1, 7, clusterSize - 1, clusterSize, clusterSize + 1, len(content), len(content) + 10} {
+		pReader, err := NewFileReader(f.pFs, f.fats, f.data, "/f")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pReader.Size() != int64(len(content)) {
+			t.Fatalf("size %d, want %d", pReader.Size(), len(content))
+		}
+
+		var read []byte
+		buf := make([]byte, bufSize)
+		for {
+			n, err := pReader.Read(buf)
+			read = append(read, buf[:n]...)
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Fatalf("buffer %d: %v", bufSize, err)
+			}
+			if n == 0 {
+				t.Fatalf("buffer %d: no progress", bufSize)
+			}
+		}
+		if !bytes.Equal(read, content) {
+			t.Errorf("buffer %d: read %d bytes that differ from the content", bufSize, len(read))
+		}
+	}
+}
+
+func TestFileReaderSeek(t *testing.T) {
+	f, content := newReaderTestFS(t)
+	clusterSize := int64(f.pFs.ClusterSize)
+	size := int64(len(content))
+
+	pReader, err := NewFileReader(f.pFs, f.fats, f.data, "/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each case reads 6 bytes, the current position is moved by the read of the previous case
+	tests := []struct {
+		name       string
+		offset     int64
+		whence     int
+		wantOffset int64
+	}{
+		{"start", 0, io.SeekStart, 0},
+		{"before the boundary", clusterSize - 3, io.SeekStart, clusterSize - 3},
+		{"current over the fragment", clusterSize - 6, io.SeekCurrent, 2*clusterSize - 3},
+		{"current back", -clusterSize - 6, io.SeekCurrent, clusterSize - 3},
+		{"end", -5, io.SeekEnd, size - 5},
+		{"last cluster", 2*clusterSize + 50, io.SeekStart, 2*clusterSize + 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, err := pReader.Seek(tt.offset, tt.whence)
+			if err != nil || offset != tt.wantOffset {
+				t.Fatalf("offset %d, error %v, want %d", offset, err, tt.wantOffset)
+			}
+
+			buf := make([]byte, 6)
+			n, err := io.ReadFull(pReader, buf)
+			want := content[tt.wantOffset:min(tt.wantOffset+6, size)]
+			if !bytes.Equal(buf[:n], want) {
+				t.Errorf("read %v (%v), want %v", buf[:n], err, want)
+			}
+		})
+	}
+
+	// seeking beyond the end is allowed, the read returns EOF
+	if offset, err := pReader.Seek(10, io.SeekEnd); err != nil || offset != size+10 {
+		t.Fatalf("offset %d, error %v", offset, err)
+	}
+	if n, err := pReader.Read(make([]byte, 1)); n != 0 || !errors.Is(err, io.EOF) {
+		t.Errorf("read %d bytes beyond the end, error %v", n, err)
+	}
+
+	// the invalid seeks keep the position
+	for _, whence := range []int{io.SeekStart, io.SeekCurrent, io.SeekEnd} {
+		if offset, err := pReader.Seek(-size-20, whence); !errors.Is(err, custom_errors.ErrInvalidSeek) || offset != size+10 {
+			t.Errorf("whence %d: offset %d, error %v", whence, offset, err)
+		}
+	}
+	if _, err := pReader.Seek(0, 42); !errors.Is(err, custom_errors.ErrInvalidSeek) {
+		t.Errorf("unknown whence: error %v", err)
+	}
+}
+
+func TestNewFileReaderErrors(t *testing.T) {
+	f, _ := newReaderTestFS(t)
+
+	tests := []struct {
+		path    string
+		wantErr error
+	}{
+		{"/d", custom_errors.ErrIsDir},
+		{"/", custom_errors.ErrIsDir},
+		{"/none", custom_errors.ErrEntryNotFound},
+		{"", custom_errors.ErrNilPointer},
+	}
+	for _, tt := range tests {
+		if _, err := NewFileReader(f.pFs, f.fats, f.data, tt.path); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%q: error %v, want %v", tt.path, err, tt.wantErr)
+		}
+	}
+
+	// the empty file is read as EOF
+	f.writeFile("/empty", []byte{})
+	pReader, err := NewFileReader(f.pFs, f.fats, f.data, "/empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := pReader.Read(make([]byte, 4)); n != 0 || !errors.Is(err, io.EOF) {
+		t.Errorf("empty file: read %d bytes, error %v", n, err)
+	}
+}
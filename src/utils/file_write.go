@@ -0,0 +1,255 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+)
+
+// openedFile is an existing file with its location in the filesystem
+type openedFile struct {
+	// pEntry is the entry of the file (the copy in the parent directory)
+	pEntry *pseudo_fat.DirectoryEntry
+	// parentEntryCluster is the cluster of the parent directory holding the file entry
+	parentEntryCluster uint32
+	// chain is the cluster chain of the file (starting with the self reference cluster)
+	chain []uint32
+}
+
+// getClustersForSize returns the number of the data clusters needed for the size.
+func getClustersForSize(pFs *pseudo_fat.FileSystem, size uint64) int {
+	clusterSize := uint64(pFs.ClusterSize)
+	return int((size + clusterSize - 1) / clusterSize)
+}
+
+// openFile finds the file and the cluster of its entry in the parent directory.
+//
+// It returns ErrEntryNotFound if the file does not exist and ErrIsDir if the path is a directory.
+func openFile(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPath string) (*openedFile, error) {
+	branchDirEntries, err := GetBranchDirEntriesFromRoot(pFs, fats, data, absNormPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(branchDirEntries) < 2 {
+		return nil, custom_errors.ErrIsDir
+	}
+
+	pEntry := branchDirEntries[len(branchDirEntries)-1]
+	pParentDirEntry := branchDirEntries[len(branchDirEntries)-2]
+	if !pEntry.IsFile {
+		return nil, custom_errors.ErrIsDir
+	}
+
+	chain, err := GetClusterChain(pEntry.StartCluster, fats[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster chain: %w", err)
+	}
+
+	parentChain, err := GetClusterChain(pParentDirEntry.StartCluster, fats[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster chain: %w", err)
+	}
+
+	// skip the self reference of the parent directory
+	for _, cluster := range parentChain[1:] {
+		byteOffset := int(cluster) * int(pFs.ClusterSize)
+		pParentEntry, err := ReadDirectoryEntryFromCluster(data[byteOffset : byteOffset+int(pFs.ClusterSize)])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory entry: %w", err)
+		}
+
+		if pParentEntry.StartCluster == pEntry.StartCluster {
+			return &openedFile{pEntry: pEntry, parentEntryCluster: cluster, chain: chain}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("the file entry is missing in the parent directory - logic error")
+}
+
+// setFileSize writes the new size to both copies of the file entry
+// (the self reference and the entry in the parent directory).
+func setFileSize(pFs *pseudo_fat.FileSystem, data []byte, pFile *openedFile, size uint32) error {
+	pFile.pEntry.Size = size
+	entryBytes, err := StructToBytes(pFile.pEntry)
+	if err != nil {
+		return fmt.Errorf("failed to serialize directory entry: %w", err)
+	}
+
+	for _, cluster := range []uint32{pFile.chain[0], pFile.parentEntryCluster} {
+		clearCluster(pFs, data, cluster)
+		writeToCluster(pFs, data, cluster, entryBytes)
+	}
+
+	return nil
+}
+
+// appendToFile writes the content after the end of the file.
+//
+// The free space of the last data cluster is filled first, the rest is written to
+// new clusters linked to the end of the existing chain. The free clusters are found
+// before anything is written (ErrNoFreeCluster leaves the file unchanged).
+func appendToFile(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, pFile *openedFile, content []byte) error {
+	oldSize := uint64(pFile.pEntry.Size)
+	newSize := oldSize + uint64(len(content))
+	if newSize > uint64(consts.MaxFilesystemSize) {
+		return custom_errors.ErrNoFreeCluster
+	}
+
+	dataChain := pFile.chain[1:] // skip the first cluster (directory entry)
+	newClustersCount := getClustersForSize(pFs, newSize) - len(dataChain)
+	newClusters := make([]uint32, 0)
+	if newClustersCount > 0 {
+		var err error
+		newClusters, err = findFreeClustersForFile(newClustersCount, fats[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	// link the new clusters to the end of the chain
+	prevIndex := pFile.chain[len(pFile.chain)-1]
+	for _, clusterIndex := range newClusters {
+		addToFat(fats, prevIndex, clusterIndex)
+		clearCluster(pFs, data, clusterIndex)
+		prevIndex = clusterIndex
+	}
+	dataChain = append(dataChain, newClusters...)
+	pFile.chain = append(pFile.chain, newClusters...)
+
+	// write the content cluster by cluster
+	clusterSize := uint64(pFs.ClusterSize)
+	written := uint64(0)
+	for written < uint64(len(content)) {
+		offset := oldSize + written
+		clusterIndex := dataChain[offset/clusterSize]
+		byteOffset := uint64(clusterIndex)*clusterSize + offset%clusterSize
+		clusterEnd := (uint64(clusterIndex) + 1) * clusterSize
+		stageCluster(pFs, data, clusterIndex)
+		written += uint64(copy(data[byteOffset:clusterEnd], content[written:]))
+	}
+
+	return setFileSize(pFs, data, pFile, uint32(newSize))
+}
+
+// truncateFile shrinks the file to the size (the size has to be less or equal to the file size).
+//
+// The clusters after the size are freed and the rest of the last cluster is zeroed.
+func truncateFile(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, pFile *openedFile, size uint32) error {
+	keptDataClusters := getClustersForSize(pFs, uint64(size))
+
+	// the self reference cluster is always kept
+	lastKeptIndex := keptDataClusters
+	for _, clusterIndex := range pFile.chain[lastKeptIndex+1:] {
+		markFreeCluster(fats, clusterIndex)
+		clearCluster(pFs, data, clusterIndex)
+	}
+	markEndOfChain(fats, pFile.chain[lastKeptIndex])
+	pFile.chain = pFile.chain[:lastKeptIndex+1]
+
+	// zero the rest of the last data cluster, so the appended data do not reveal the old content
+	if inClusterSize := size % uint32(pFs.ClusterSize); keptDataClusters > 0 && inClusterSize != 0 {
+		clusterIndex := pFile.chain[lastKeptIndex]
+		byteOffset := int(clusterIndex)*int(pFs.ClusterSize) + int(inClusterSize)
+		clusterEnd := (int(clusterIndex) + 1) * int(pFs.ClusterSize)
+		stageCluster(pFs, data, clusterIndex)
+		clear(data[byteOffset:clusterEnd])
+	}
+
+	return setFileSize(pFs, data, pFile, size)
+}
+
+// AppendFile appends the content to the end of the file (the file is created if it does not exist).
+// Expects the absNormPath to be a valid normalized absolute path.
+//
+// The existing cluster chain is extended, the file is not reallocated.
+// It returns ErrNoFreeCluster if the content does not fit (nothing is written).
+// It returns ErrIsDir if the path is a directory.
+func AppendFile(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPath string, content []byte) error {
+	// sanity checks
+	if pFs == nil || fats == nil || data == nil || absNormPath == "" || content == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	logging.Debug(fmt.Sprintf("Appending %d bytes to file \"%s\"", len(content), absNormPath))
+
+	pFile, err := openFile(pFs, fats, data, absNormPath)
+	if errors.Is(err, custom_errors.ErrEntryNotFound) {
+		return CopyInsideFS(pFs, fats, data, absNormPath, content)
+	} else if err != nil {
+		return err
+	}
+
+	return runInTransaction(pFs, fats, data, func() error {
+		return appendToFile(pFs, fats, data, pFile, content)
+	})
+}
+
+// WriteFile replaces the content of the file (the file is created if it does not exist).
+// Expects the absNormPath to be a valid normalized absolute path.
+//
+// It returns ErrNoFreeCluster if the content does not fit (nothing is written).
+// It returns ErrIsDir if the path is a directory.
+func WriteFile(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPath string, content []byte) error {
+	// sanity checks
+	if pFs == nil || fats == nil || data == nil || absNormPath == "" || content == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	logging.Debug(fmt.Sprintf("Writing %d bytes to file \"%s\"", len(content), absNormPath))
+
+	pFile, err := openFile(pFs, fats, data, absNormPath)
+	if errors.Is(err, custom_errors.ErrEntryNotFound) {
+		return CopyInsideFS(pFs, fats, data, absNormPath, content)
+	} else if err != nil {
+		return err
+	}
+
+	// the data clusters of the file are reused
+	err = ensureFreeClusters(fats[0], getClustersForSize(pFs, uint64(len(content)))-(len(pFile.chain)-1))
+	if err != nil {
+		return err
+	}
+
+	return runInTransaction(pFs, fats, data, func() error {
+		err := truncateFile(pFs, fats, data, pFile, 0)
+		if err != nil {
+			return err
+		}
+
+		return appendToFile(pFs, fats, data, pFile, content)
+	})
+}
+
+// TruncateFile shrinks or extends the file to the size (the file is created if it does not exist).
+// Expects the absNormPath to be a valid normalized absolute path.
+//
+// The extended part is filled with zeros.
+// It returns ErrNoFreeCluster if the extension does not fit (nothing is written).
+// It returns ErrIsDir if the path is a directory.
+func TruncateFile(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPath string, size uint32) error {
+	// sanity checks
+	if pFs == nil || fats == nil || data == nil || absNormPath == "" {
+		return custom_errors.ErrNilPointer
+	}
+
+	logging.Debug(fmt.Sprintf("Truncating file \"%s\" to %d bytes", absNormPath, size))
+
+	pFile, err := openFile(pFs, fats, data, absNormPath)
+	if errors.Is(err, custom_errors.ErrEntryNotFound) {
+		return CopyInsideFS(pFs, fats, data, absNormPath, make([]byte, size))
+	} else if err != nil {
+		return err
+	}
+
+	return runInTransaction(pFs, fats, data, func() error {
+		if size <= pFile.pEntry.Size {
+			return truncateFile(pFs, fats, data, pFile, size)
+		}
+
+		return appendToFile(pFs, fats, data, pFile, make([]byte, size-pFile.pEntry.Size))
+	})
+}
@@ -0,0 +1,145 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"path"
+	"sort"
+	"strings"
+)
+
+// globMatch is a path matched by a glob pattern together with its entry
+type globMatch struct {
+	// absPath is the absolute path of the entry
+	absPath string
+	// pEntry is the matched entry
+	pEntry *pseudo_fat.DirectoryEntry
+}
+
+// HasGlobMeta returns true if the path contains any glob pattern characters.
+func HasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, consts.GlobCharacters)
+}
+
+// JoinAbsPath joins the absolute directory path with the entry name.
+func JoinAbsPath(absDirPath string, name string) string {
+	if absDirPath == consts.PathDelimiter {
+		return consts.PathDelimiter + name
+	}
+
+	return absDirPath + consts.PathDelimiter + name
+}
+
+// getDescendants returns all the entries under the matched directories (recursively).
+func getDescendants(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, matches []globMatch) ([]globMatch, error) {
+	res := make([]globMatch, 0)
+	queue := make([]globMatch, 0, len(matches))
+	queue = append(queue, matches...)
+
+	for len(queue) > 0 {
+		match := queue[0]
+		queue = queue[1:]
+		if match.pEntry.IsFile {
+			continue
+		}
+
+		children, err := GetDirEntries(pFs, match.pEntry, fats, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get directory entries: %w", err)
+		}
+
+		for _, pChild := range children {
+			childMatch := globMatch{absPath: JoinAbsPath(match.absPath, GetNormalizedStrFromMem(pChild.Name[:])), pEntry: pChild}
+			res = append(res, childMatch)
+			queue = append(queue, childMatch)
+		}
+	}
+
+	return res, nil
+}
+
+// Glob returns the sorted absolute paths of the entries matching the pattern.
+//
+// The pattern is matched segment by segment against the directory tree
+// ('*', '?' and '[abc]' are supported within a segment, see path.Match).
+// The "**" segment matches any number of directories - as the last segment
+// it matches every entry below (files and directories), otherwise it also
+// matches zero directories.
+// Expects the absNormPattern to be a normalized absolute path.
+//
+// It returns an empty slice if nothing matches.
+func Glob(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPattern string) ([]string, error) {
+	// sanity checks
+	if pFs == nil || fats == nil || data == nil || absNormPattern == "" {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	segments, err := GetNormalizedPathNodes(absNormPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	pRootDir, err := GetRootDirEntry(pFs, fats, data)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []globMatch{{absPath: consts.PathDelimiter, pEntry: pRootDir}}
+	for i, segment := range segments {
+		if segment == consts.GlobRecursiveSegment {
+			descendants, err := getDescendants(pFs, fats, data, matches)
+			if err != nil {
+				return nil, err
+			}
+
+			if i == len(segments)-1 {
+				matches = descendants
+			} else {
+				matches = append(matches, descendants...)
+			}
+			continue
+		}
+
+		_, err := path.Match(segment, "")
+		if err != nil {
+			return nil, custom_errors.ErrInvalidPattern
+		}
+
+		nextMatches := make([]globMatch, 0)
+		for _, match := range matches {
+			if match.pEntry.IsFile {
+				continue
+			}
+
+			children, err := GetDirEntries(pFs, match.pEntry, fats, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get directory entries: %w", err)
+			}
+
+			for _, pChild := range children {
+				name := GetNormalizedStrFromMem(pChild.Name[:])
+				if ok, _ := path.Match(segment, name); ok {
+					nextMatches = append(nextMatches, globMatch{absPath: JoinAbsPath(match.absPath, name), pEntry: pChild})
+				}
+			}
+		}
+
+		matches = nextMatches
+	}
+
+	// the same entry can be matched multiple times by the recursive segments
+	res := make([]string, 0, len(matches))
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		if !seen[match.absPath] {
+			seen[match.absPath] = true
+			res = append(res, match.absPath)
+		}
+	}
+	sort.Strings(res)
+
+	return res, nil
+}
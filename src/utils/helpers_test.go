@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	devNull, err := os.Open(os.DevNull)
+	if err == nil {
+		logging.SetOutput(devNull)
+	}
+
+	os.Exit(m.Run())
+}
+
+// testFS is an in-memory filesystem used by the tests
+type testFS struct {
+	pFs       *pseudo_fat.FileSystem
+	fats      [][]int32
+	data      []byte
+	tb        testing.TB
+	allocator *ExtentAllocator
+}
+
+// newTestFS formats an in-memory filesystem with the cluster count (the same way as the format command)
+// and sets a new allocator for it.
+func newTestFS(tb testing.TB, clusterCount uint32) *testFS {
+	tb.Helper()
+
+	count, fatSize, allocatableSize := CalculateFSSizes(uint32(GetFSSizeForClusters(clusterCount)))
+	if count != clusterCount {
+		tb.Fatalf("%d clusters formatted instead of %d", count, clusterCount)
+	}
+
+	pFs := &pseudo_fat.FileSystem{}
+	pFs.DiskSize = uint32(GetFSSizeForClusters(clusterCount))
+	pFs.FatCount = clusterCount
+	pFs.Fat01StartAddr = uint32(pseudo_fat.GetSizeOfFileSystem())
+	pFs.Fat02StartAddr = pFs.Fat01StartAddr + fatSize
+	pFs.DataStartAddr = pFs.Fat02StartAddr + fatSize
+	pFs.ClusterSize = consts.ClusterSize
+	copy(pFs.Signature[:], consts.AuthorID)
+
+	fats := make([][]int32, consts.FATableCount)
+	for i := range fats {
+		fats[i] = make([]int32, clusterCount)
+		for j := range fats[i] {
+			fats[i][j] = consts.FatFree
+		}
+		fats[i][0] = consts.FatFileEnd
+	}
+
+	data := make([]byte, allocatableSize)
+	rootDir := NewDirectoryEntry(false, 0, 0, 0, consts.PathDelimiter)
+	rootBytes, err := StructToBytes(rootDir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	copy(data, rootBytes)
+
+	allocator := NewExtentAllocator()
+	SetClusterAllocator(allocator)
+	RebuildClusterUsage(fats[0])
+	InvalidateDirCache()
+
+	return &testFS{pFs: pFs, fats: fats, data: data, tb: tb, allocator: allocator}
+}
+
+// mkdir creates the directory or fails the test.
+func (f *testFS) mkdir(path string) {
+	f.tb.Helper()
+	if err := Mkdir(f.pFs, f.fats, f.data, path); err != nil {
+		f.tb.Fatalf("mkdir %s: %v", path, err)
+	}
+}
+
+// writeFile writes the file or fails the test.
+func (f *testFS) writeFile(path string, content []byte) {
+	f.tb.Helper()
+	if err := WriteFile(f.pFs, f.fats, f.data, path, content); err != nil {
+		f.tb.Fatalf("write %s: %v", path, err)
+	}
+}
+
+// readFile returns the content of the file or fails the test.
+func (f *testFS) readFile(path string) []byte {
+	f.tb.Helper()
+	content, err := GetFileBytes(f.pFs, f.fats, f.data, path)
+	if err != nil {
+		f.tb.Fatalf("read %s: %v", path, err)
+	}
+	return content
+}
+
+// list returns the names of the children of the directory or fails the test.
+func (f *testFS) list(path string) []string {
+	f.tb.Helper()
+	branch, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, path)
+	if err != nil {
+		f.tb.Fatalf("lookup %s: %v", path, err)
+	}
+	children, err := GetDirEntries(f.pFs, branch[len(branch)-1], f.fats, f.data)
+	if err != nil {
+		f.tb.Fatalf("ls %s: %v", path, err)
+	}
+
+	names := make([]string, len(children))
+	for i, pChild := range children {
+		names[i] = GetNormalizedStrFromMem(pChild.Name[:])
+	}
+	return names
+}
+
+// exists returns true if the path is found.
+func (f *testFS) exists(path string) bool {
+	f.tb.Helper()
+	_, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, path)
+	if err != nil && !errors.Is(err, custom_errors.ErrEntryNotFound) {
+		f.tb.Fatalf("lookup %s: %v", path, err)
+	}
+	return err == nil
+}
+
+// testPattern returns the content of the length that differs in every cluster.
+func testPattern(seed byte, length int) []byte {
+	res := make([]byte, length)
+	for i := range res {
+		res[i] = seed + byte(i/int(consts.ClusterSize)) + byte(i%251)
+	}
+	return res
+}
+
+// checkUsage fails the test if the usage counters do not match a rescan of the FAT.
+func (f *testFS) checkUsage() {
+	f.tb.Helper()
+
+	expected := FatUsage{Total: uint32(len(f.fats[0]))}
+	for _, value := range f.fats[0] {
+		switch value {
+		case consts.FatFree:
+			expected.Free++
+		case consts.FatBadCluster:
+			expected.Bad++
+		default:
+			expected.Used++
+		}
+	}
+
+	if got := GetFatUsage(f.fats[0]); got != expected {
+		f.tb.Fatalf("usage counters %+v, rescan %+v", got, expected)
+	}
+}
+
+// checkConsistency fails the test if the FATs differ, a chain of an entry is broken, a cluster
+// is shared by more chains, a self reference does not match its entry or a used cluster is lost.
+// The usage counters and the directory indexes are checked as well.
+func (f *testFS) checkConsistency() {
+	f.tb.Helper()
+
+	for i := 1; i < len(f.fats); i++ {
+		for j := range f.fats[0] {
+			if f.fats[i][j] != f.fats[0][j] {
+				f.tb.Fatalf("FAT %d differs at cluster %d", i, j)
+			}
+		}
+	}
+
+	pRoot, err := GetRootDirEntry(f.pFs, f.fats, f.data)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+
+	owners := make(map[uint32]string)
+	var walk func(pEntry *pseudo_fat.DirectoryEntry, path string)
+	walk = func(pEntry *pseudo_fat.DirectoryEntry, path string) {
+		chain, err := GetClusterChain(pEntry.StartCluster, f.fats[0])
+		if err != nil {
+			f.tb.Fatalf("%s: chain: %v", path, err)
+		}
+		for _, cluster := range chain {
+			if owner, found := owners[cluster]; found {
+				f.tb.Fatalf("cluster %d is shared by %s and %s", cluster, owner, path)
+			}
+			owners[cluster] = path
+		}
+
+		clusterSize := int(f.pFs.ClusterSize)
+		selfRef, err := ReadDirectoryEntryFromCluster(f.data[int(pEntry.StartCluster)*clusterSize:])
+		if err != nil {
+			f.tb.Fatal(err)
+		}
+		if !bytes.Equal(selfRef.Name[:], pEntry.Name[:]) || selfRef.StartCluster != pEntry.StartCluster {
+			f.tb.Fatalf("%s: self reference %+v does not match the entry %+v", path, *selfRef, *pEntry)
+		}
+
+		if pEntry.IsFile {
+			if uint64(len(chain)-1)*uint64(clusterSize) < uint64(pEntry.Size) {
+				f.tb.Fatalf("%s: %d clusters for %d bytes", path, len(chain), pEntry.Size)
+			}
+			return
+		}
+
+		children, err := GetDirEntries(f.pFs, pEntry, f.fats, f.data)
+		if err != nil {
+			f.tb.Fatalf("%s: %v", path, err)
+		}
+		if err = VerifyDirIndex(f.pFs, f.fats, f.data, pEntry, children); err != nil {
+			f.tb.Fatalf("%s: %v", path, err)
+		}
+		if header, found := readTestDirIndexHeader(f, pEntry); found {
+			chain, err := GetClusterChain(header.StartCluster, f.fats[0])
+			if err != nil {
+				f.tb.Fatalf("%s: index chain: %v", path, err)
+			}
+			for _, cluster := range chain {
+				if owner, found := owners[cluster]; found {
+					f.tb.Fatalf("index cluster %d of %s is used by %s", cluster, path, owner)
+				}
+				owners[cluster] = path + " (index)"
+			}
+		}
+		for _, pChild := range children {
+			walk(pChild, JoinAbsPath(path, GetNormalizedStrFromMem(pChild.Name[:])))
+		}
+	}
+	walk(pRoot, consts.PathDelimiter)
+
+	for cluster, value := range f.fats[0] {
+		used := value != consts.FatFree && value != consts.FatBadCluster
+		if _, found := owners[uint32(cluster)]; used != found {
+			f.tb.Fatalf("cluster %d (FAT value %d) owned: %v", cluster, value, found)
+		}
+	}
+
+	f.checkUsage()
+}
+
+// readTestDirIndexHeader returns the header of the index of the directory (if it has one).
+func readTestDirIndexHeader(f *testFS, pDir *pseudo_fat.DirectoryEntry) (pseudo_fat.DirIndexHeader, bool) {
+	f.tb.Helper()
+
+	header, found, err := readDirIndexHeader(f.pFs, f.data, pDir.StartCluster)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	return header, found
+}
@@ -165,5 +165,8 @@ func GetFileSystem(file *os.File) (*pseudo_fat.FileSystem, *[][]int32, *[]byte,
 		return nil, nil, nil, err
 	}
 
+	// the free cluster bitmap and the usage counters are maintained from now on
+	RebuildClusterUsage(fats[0])
+
 	return &pFs, &fats, &data, nil
 }
@@ -0,0 +1,31 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"os"
+)
+
+// LockFile is a no-op on platforms without supported file locking.
+func LockFile(pFile *os.File, exclusive bool) error {
+	// sanity check
+	if pFile == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	logging.Warn("File locking is not supported on this platform, the filesystem file is not protected")
+	return nil
+}
+
+// UnlockFile is a no-op on platforms without supported file locking.
+func UnlockFile(pFile *os.File) error {
+	// sanity check
+	if pFile == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	return nil
+}
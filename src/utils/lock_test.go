@@ -0,0 +1,78 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows
+
+package utils
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/custom_errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openLockTestFile opens the file (each call returns a new handle, the locks of the handles conflict).
+func openLockTestFile(t *testing.T, path string) *os.File {
+	t.Helper()
+
+	pFile, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pFile.Close() })
+	return pFile
+}
+
+func TestLockFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		held      bool
+		requested bool
+		wantErr   error
+	}{
+		{"exclusive after exclusive", true, true, custom_errors.ErrImageInUse},
+		{"shared after exclusive", true, false, custom_errors.ErrImageInUse},
+		{"exclusive after shared", false, true, custom_errors.ErrImageInUse},
+		{"shared after shared", false, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image")
+			pHolder := openLockTestFile(t, path)
+			pOther := openLockTestFile(t, path)
+
+			if err := LockFile(pHolder, tt.held); err != nil {
+				t.Fatal(err)
+			}
+			if err := LockFile(pOther, tt.requested); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+
+			// the lock is available once the holder releases it
+			if err := UnlockFile(pHolder); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != nil {
+				if err := LockFile(pOther, tt.requested); err != nil {
+					t.Errorf("after unlock: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLockFileReleasedOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image")
+	pHolder := openLockTestFile(t, path)
+	if err := LockFile(pHolder, true); err != nil {
+		t.Fatal(err)
+	}
+	pHolder.Close()
+
+	if err := LockFile(openLockTestFile(t, path), true); err != nil {
+		t.Errorf("lock after close: %v", err)
+	}
+	if err := LockFile(nil, true); !errors.Is(err, custom_errors.ErrNilPointer) {
+		t.Errorf("nil file: error %v, want %v", err, custom_errors.ErrNilPointer)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/custom_errors"
+	"os"
+	"syscall"
+)
+
+// LockFile places an advisory lock on the filesystem file using flock.
+//
+// If exclusive is true, the lock is exclusive (writer), otherwise it is
+// shared (reader), so any number of readers can hold the lock at once
+// while no writer holds it. The lock is released when the file is closed.
+//
+// It returns ErrImageInUse if the lock is held by another process.
+func LockFile(pFile *os.File, exclusive bool) error {
+	// sanity check
+	if pFile == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err := syscall.Flock(int(pFile.Fd()), how|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return custom_errors.ErrImageInUse
+	}
+
+	return err
+}
+
+// UnlockFile releases the advisory lock placed by LockFile.
+func UnlockFile(pFile *os.File) error {
+	// sanity check
+	if pFile == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	return syscall.Flock(int(pFile.Fd()), syscall.LOCK_UN)
+}
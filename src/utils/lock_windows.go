@@ -0,0 +1,88 @@
+//go:build windows
+
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"kiv-zos-semestral-work/custom_errors"
+	"math"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// lockfileFailImmediately is the LOCKFILE_FAIL_IMMEDIATELY flag of LockFileEx
+const lockfileFailImmediately = 0x00000001
+
+// lockfileExclusiveLock is the LOCKFILE_EXCLUSIVE_LOCK flag of LockFileEx
+const lockfileExclusiveLock = 0x00000002
+
+// errorLockViolation is the ERROR_LOCK_VIOLATION error code
+const errorLockViolation syscall.Errno = 33
+
+var (
+	modKernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modKernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modKernel32.NewProc("UnlockFileEx")
+)
+
+// LockFile places a lock on the filesystem file using LockFileEx.
+//
+// If exclusive is true, the lock is exclusive (writer), otherwise it is
+// shared (reader), so any number of readers can hold the lock at once
+// while no writer holds it. Unlike flock, the lock is mandatory: the other
+// processes cannot read the file locked exclusively and nobody (not even
+// the holder) can write to the file locked shared. The lock is released
+// when the file is closed.
+//
+// It returns ErrImageInUse if the lock is held by another process.
+func LockFile(pFile *os.File, exclusive bool) error {
+	// sanity check
+	if pFile == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	flags := uintptr(lockfileFailImmediately)
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+
+	// lock the whole file (the range does not need to exist)
+	overlapped := syscall.Overlapped{}
+	r1, _, err := procLockFileEx.Call(
+		pFile.Fd(),
+		flags,
+		0,
+		math.MaxUint32,
+		math.MaxUint32,
+		uintptr(unsafe.Pointer(&overlapped)))
+	if r1 == 0 {
+		if err == errorLockViolation {
+			return custom_errors.ErrImageInUse
+		}
+		return err
+	}
+
+	return nil
+}
+
+// UnlockFile releases the lock placed by LockFile.
+func UnlockFile(pFile *os.File) error {
+	// sanity check
+	if pFile == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	overlapped := syscall.Overlapped{}
+	r1, _, err := procUnlockFileEx.Call(
+		pFile.Fd(),
+		0,
+		math.MaxUint32,
+		math.MaxUint32,
+		uintptr(unsafe.Pointer(&overlapped)))
+	if r1 == 0 {
+		return err
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"kiv-zos-semestral-work/consts"
 	"kiv-zos-semestral-work/custom_errors"
@@ -67,35 +68,25 @@ func ReadDirectoryEntryFromCluster(clusterData []byte) (*pseudo_fat.DirectoryEnt
 	return &entry, nil
 }
 
-// findFreeCluster finds the first free cluster in the FAT.
+// findFreeCluster finds a free cluster in the FAT (see ClusterAllocator).
 func findFreeCluster(fat []int32) (uint32, error) {
-	for i, entry := range fat {
-		if entry == consts.FatFree {
-			return uint32(i), nil
-		}
+	clusters, err := findFreeClustersForFile(1, fat)
+	if err != nil {
+		return 0, err
 	}
 
-	return 0, custom_errors.ErrNoFreeCluster
+	return clusters[0], nil
 }
 
-// findFreeClustersForFile tries to find enough free clusters for the file.
+// findFreeClustersForFile tries to find enough free clusters for the file (see ClusterAllocator).
+// It fails fast with ErrNoFreeCluster if the usage counters show there are not enough of them.
 func findFreeClustersForFile(clustersNeeded int, fat []int32) ([]uint32, error) {
-	freeClusters := make([]uint32, 0, clustersNeeded)
-	for i, entry := range fat {
-		if entry == consts.FatFree {
-			freeClusters = append(freeClusters, uint32(i))
-		}
-
-		if len(freeClusters) == clustersNeeded {
-			break
-		}
-	}
-
-	if len(freeClusters) < clustersNeeded {
-		return nil, custom_errors.ErrNoFreeCluster
+	err := ensureFreeClusters(fat, clustersNeeded)
+	if err != nil {
+		return nil, err
 	}
 
-	return freeClusters, nil
+	return clusterAllocator.FindFreeClusters(fat, clustersNeeded)
 }
 
 // GetRootDirEntry retrieves the root directory entry.
@@ -124,6 +115,7 @@ func GetRootDirEntry(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte) (*
 //
 // NOTE: It returns the directory entries of that are from the parent's cluster chain.
 // NOTE: It ommits the self reference entry.
+// NOTE: The entries are read from the directory cache if the directory was not changed since the last read.
 func GetDirEntries(pFs *pseudo_fat.FileSystem, pDir *pseudo_fat.DirectoryEntry, fats [][]int32, data []byte) ([](*pseudo_fat.DirectoryEntry), error) {
 	// sanity checks
 	if pFs == nil || pDir == nil || fats == nil || data == nil {
@@ -133,6 +125,61 @@ func GetDirEntries(pFs *pseudo_fat.FileSystem, pDir *pseudo_fat.DirectoryEntry,
 		return nil, custom_errors.ErrIsFile
 	}
 
+	pListing, err := getDirListing(pFs, pDir, fats, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyEntryPointers(pListing.entries), nil
+}
+
+// getDirListing returns the cached listing of the directory, the directory is read if it is not cached.
+func getDirListing(pFs *pseudo_fat.FileSystem, pDir *pseudo_fat.DirectoryEntry, fats [][]int32, data []byte) (*dirListing, error) {
+	dirCache.use(fats, data)
+	if pListing, found := dirCache.listings[pDir.StartCluster]; found {
+		return pListing, nil
+	}
+
+	entries, chain, err := readDirEntries(pFs, pDir, fats, data)
+	if err != nil {
+		return nil, err
+	}
+
+	pListing := newDirListing(entries)
+	dirCache.listings[pDir.StartCluster] = pListing
+	dirCache.watch(chain...)
+	return pListing, nil
+}
+
+// lookupDirChild finds the child of the directory by name. The cached listing of the directory is used
+// if there is one, then the directory index (so a large directory is not read whole) and the listing
+// read from the directory at last. If dirOnly is true, the files are skipped.
+func lookupDirChild(pFs *pseudo_fat.FileSystem, pDir *pseudo_fat.DirectoryEntry, fats [][]int32, data []byte, name string, dirOnly bool) (pseudo_fat.DirectoryEntry, bool, error) {
+	dirCache.use(fats, data)
+	if _, cached := dirCache.listings[pDir.StartCluster]; !cached {
+		pEntry, indexed, err := lookupDirIndex(pFs, fats, data, pDir.StartCluster, name)
+		if err != nil {
+			logging.Warn(fmt.Sprintf("Directory index of \"%s\" not used: %s", GetNormalizedStrFromMem(pDir.Name[:]), err))
+		} else if indexed {
+			if pEntry == nil || (dirOnly && pEntry.IsFile) {
+				return pseudo_fat.DirectoryEntry{}, false, nil
+			}
+			return *pEntry, true, nil
+		}
+	}
+
+	pListing, err := getDirListing(pFs, pDir, fats, data)
+	if err != nil {
+		return pseudo_fat.DirectoryEntry{}, false, err
+	}
+
+	entry, found := pListing.lookup(name, dirOnly)
+	return entry, found, nil
+}
+
+// readDirEntries deserializes the entries of the directory from its cluster chain (without the self reference)
+// and returns them with the chain.
+func readDirEntries(pFs *pseudo_fat.FileSystem, pDir *pseudo_fat.DirectoryEntry, fats [][]int32, data []byte) ([]pseudo_fat.DirectoryEntry, []uint32, error) {
 	fat := fats[0]
 
 	logging.Debug(fmt.Sprintf("Getting directory entries for directory: \"%s\"", GetNormalizedStrFromMem(pDir.Name[:])))
@@ -140,10 +187,10 @@ func GetDirEntries(pFs *pseudo_fat.FileSystem, pDir *pseudo_fat.DirectoryEntry,
 	// get the cluster chain for the directory
 	clusterChain, err := GetClusterChain(pDir.StartCluster, fat)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cluster chain: %w", err)
+		return nil, nil, fmt.Errorf("failed to get cluster chain: %w", err)
 	}
 
-	var entries [](*pseudo_fat.DirectoryEntry)
+	var entries []pseudo_fat.DirectoryEntry
 	var byteOffset int
 	for _, cluster := range clusterChain {
 		byteOffset = int(cluster) * int(pFs.ClusterSize)
@@ -165,10 +212,10 @@ func GetDirEntries(pFs *pseudo_fat.FileSystem, pDir *pseudo_fat.DirectoryEntry,
 			logging.Debug(fmt.Sprintf("Skipping parent directory entry: \"%s\"", pDirEntry.Name))
 			continue
 		}
-		entries = append(entries, pDirEntry)
+		entries = append(entries, *pDirEntry)
 	}
 
-	return entries, nil
+	return entries, clusterChain, nil
 }
 
 // GetAbsolutePathFromPwd retrieves the absolute path of the specified directory.
@@ -186,9 +233,16 @@ func GetAbsolutePathFromPwd(pFs *pseudo_fat.FileSystem, pDir *pseudo_fat.Directo
 		return consts.PathDelimiter, nil
 	}
 
+	dirCache.use(fats, data)
+	if absPath, found := dirCache.absPaths[*pDir]; found {
+		return absPath, nil
+	}
+
 	// traverse the directory tree through parent clusters
+	var parentClusters []uint32
 	pCurrDir := pDir
 	for {
+		parentClusters = append(parentClusters, pCurrDir.ParentCluster)
 		parentClusterDataIndex := int(pCurrDir.ParentCluster) * int(pFs.ClusterSize)
 		parentClusterData := data[parentClusterDataIndex : parentClusterDataIndex+int(pFs.ClusterSize)]
 		pParentDir, err := ReadDirectoryEntryFromCluster(parentClusterData)
@@ -212,6 +266,8 @@ func GetAbsolutePathFromPwd(pFs *pseudo_fat.FileSystem, pDir *pseudo_fat.Directo
 		pCurrDir = pParentDir
 	}
 
+	dirCache.addAbsPath(*pDir, res)
+	dirCache.watch(parentClusters...)
 	return res, nil
 }
 
@@ -225,6 +281,11 @@ func GetBranchDirEntriesFromRoot(pFs *pseudo_fat.FileSystem, fats [][]int32, dat
 		return nil, custom_errors.ErrNilPointer
 	}
 
+	dirCache.use(fats, data)
+	if branch, found := dirCache.branches[absPath]; found {
+		return copyEntryPointers(branch), nil
+	}
+
 	// get the root directory entry
 	pRootDirEntry, err := GetRootDirEntry(pFs, fats, data)
 	if err != nil {
@@ -249,31 +310,23 @@ func GetBranchDirEntriesFromRoot(pFs *pseudo_fat.FileSystem, fats [][]int32, dat
 	pCurrDirEntry := pRootDirEntry
 	resEntries = append(resEntries, pCurrDirEntry)
 	for i, dirName := range nodes {
-		entries, err := GetDirEntries(pFs, pCurrDirEntry, fats, data)
+		// skip potential file entries with same name as the last directory in the path (should still work correctly)
+		entry, nodeFound, err := lookupDirChild(pFs, pCurrDirEntry, fats, data, dirName, i < len(nodes)-1)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get directory entries: %w", err)
 		}
-
-		nodeFound := false
-		for _, pEntry := range entries {
-			if GetNormalizedStrFromMem(pEntry.Name[:]) == dirName {
-				// skip potential file entries with same name as the last directory in the path (should still work correctly)
-				if i < len(nodes)-1 && pEntry.IsFile {
-					continue
-				}
-				logging.Debug(fmt.Sprintf("Found node: \"%s\" on path: \"%s\"", dirName, absPath))
-				pCurrDirEntry = pEntry
-				nodeFound = true
-				resEntries = append(resEntries, pEntry)
-				break
-			}
-		}
-
 		if !nodeFound {
 			return nil, custom_errors.ErrEntryNotFound
 		}
+
+		logging.Debug(fmt.Sprintf("Found node: \"%s\" on path: \"%s\"", dirName, absPath))
+		pCurrDirEntry = &entry
+		resEntries = append(resEntries, pCurrDirEntry)
 	}
 
+	// the children were found in the watched listings or indexes, the root entry is read from its cluster
+	dirCache.addBranch(absPath, resEntries)
+	dirCache.watch(pRootDirEntry.StartCluster)
 	return resEntries, nil
 }
 
@@ -292,7 +345,7 @@ func entryExists(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, normAb
 	// try to get the directory entry
 	_, err := GetBranchDirEntriesFromRoot(pFs, fats, data, normAbsPath)
 	if err != nil {
-		if err == custom_errors.ErrEntryNotFound {
+		if errors.Is(err, custom_errors.ErrEntryNotFound) {
 			return false, nil
 		}
 		return false, err
@@ -303,36 +356,44 @@ func entryExists(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, normAb
 
 // addToFat adds a new cluster to the FAT chain.
 func addToFat(fats [][]int32, clusterIndex uint32, newClusterIndex uint32) {
+	stageFatEntries(fats, clusterIndex, newClusterIndex)
 	for i := 0; i < len(fats); i++ {
 		logging.Debug(fmt.Sprintf("Chain for FAT%d: %d -> from %d to %d", i, clusterIndex, fats[i][clusterIndex], newClusterIndex))
 		fats[i][clusterIndex] = int32(newClusterIndex)
 		logging.Debug(fmt.Sprintf("Chain for FAT%d: %d -> from %d to %d", i, newClusterIndex, fats[i][newClusterIndex], consts.FatFileEnd))
 		fats[i][newClusterIndex] = consts.FatFileEnd
 	}
+	NotifyFatChanged(fats, clusterIndex, newClusterIndex)
 }
 
 // markEndOfChain marks the end of the chain in the FAT.
 func markEndOfChain(fats [][]int32, clusterIndex uint32) {
+	stageFatEntries(fats, clusterIndex)
 	for i := 0; i < len(fats); i++ {
 		logging.Debug(fmt.Sprintf("Chain for FAT%d: %d -> from %d to %d", i, clusterIndex, fats[i][clusterIndex], consts.FatFileEnd))
 		fats[i][clusterIndex] = consts.FatFileEnd
 	}
+	NotifyFatChanged(fats, clusterIndex)
 }
 
 // markFreeCluster marks a cluster as free in the FAT.
 func markFreeCluster(fats [][]int32, clusterIndex uint32) {
+	stageFatEntries(fats, clusterIndex)
 	for i := 0; i < len(fats); i++ {
 		logging.Debug(fmt.Sprintf("Chain for FAT%d: %d -> from %d to %d", i, clusterIndex, fats[i][clusterIndex], consts.FatFree))
 		fats[i][clusterIndex] = consts.FatFree
 	}
+	NotifyFatChanged(fats, clusterIndex)
 }
 
 // inheritValOfCluster inherits the value of the target cluster to the specified cluster in the FAT.
 func inheritValOfCluster(fats [][]int32, receiverClusterIndex uint32, targetClusterIndex uint32) {
+	stageFatEntries(fats, receiverClusterIndex)
 	for i := 0; i < len(fats); i++ {
 		logging.Debug(fmt.Sprintf("Chain for FAT%d: %d -> from %d to %d", i, receiverClusterIndex, fats[i][receiverClusterIndex], fats[i][targetClusterIndex]))
 		fats[i][receiverClusterIndex] = fats[i][targetClusterIndex]
 	}
+	NotifyFatChanged(fats, receiverClusterIndex)
 }
 
 // Mkdir creates a new directory in the specified parent directory.
@@ -341,6 +402,13 @@ func inheritValOfCluster(fats [][]int32, receiverClusterIndex uint32, targetClus
 // It returns ErrNoFreeCluster if there are no free clusters in the FAT.
 // It returns ErrNilPointer if any of the pointers are nil.
 func Mkdir(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPathToDir string) error {
+	return runInTransaction(pFs, fats, data, func() error {
+		return mkdir(pFs, fats, data, absNormPathToDir)
+	})
+}
+
+// mkdir is the implementation of Mkdir.
+func mkdir(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPathToDir string) error {
 	// sanity checks
 	if pFs == nil || fats == nil || data == nil {
 		return custom_errors.ErrNilPointer
@@ -361,7 +429,7 @@ func Mkdir(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPathT
 	// sanity check for invalid ancestor path
 	ancestorEntriesRef, err := GetBranchDirEntriesFromRoot(pFs, fats, data, ancestorBranchPath)
 	if err != nil {
-		if err == custom_errors.ErrEntryNotFound {
+		if errors.Is(err, custom_errors.ErrEntryNotFound) {
 			return custom_errors.ErrPathNotFound
 		}
 		return err
@@ -395,21 +463,18 @@ func Mkdir(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPathT
 	}
 	clusterEndIndex := clusterChain[len(clusterChain)-1]
 
-	// find a free cluster for the parent directory new entry
-	freeClusterIndexParent, err := findFreeCluster(referencedFat)
+	// find the free clusters for the parent directory new entry and for the new directory
+	// entries (including reference to itself) before anything is written
+	clustersReady, err := findFreeClustersForFile(2, referencedFat)
 	if err != nil {
 		return err
 	}
+	freeClusterIndexParent := clustersReady[0]
+	freeClusterIndex := clustersReady[1]
 
 	// update the parent directory entry chain in the FAT
 	addToFat(fats, clusterEndIndex, freeClusterIndexParent)
 
-	// find a free cluster for the new directory entries (including reference to itself)
-	freeClusterIndex, err := findFreeCluster(referencedFat)
-	if err != nil {
-		return err
-	}
-
 	// write the new directory entry
 	pNewDirEntry := NewDirectoryEntry(false, 0, freeClusterIndex, pLastDir.StartCluster, targetDirName)
 	markEndOfChain(fats, freeClusterIndex)
@@ -421,13 +486,11 @@ func Mkdir(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, absNormPathT
 	}
 
 	// write the new directory entry to the parent directory cluster
-	byteOffset := int(freeClusterIndexParent) * int(pFs.ClusterSize)
-	copy(data[byteOffset:], newDirEntryBytes)
+	writeToCluster(pFs, data, freeClusterIndexParent, newDirEntryBytes)
 	// write the new directory entry to the its own cluster
-	byteOffset = int(freeClusterIndex) * int(pFs.ClusterSize)
-	copy(data[byteOffset:], newDirEntryBytes)
+	writeToCluster(pFs, data, freeClusterIndex, newDirEntryBytes)
 
-	return nil
+	return addToDirIndex(pFs, fats, data, pLastDir, &pNewDirEntry)
 }
 
 // removeParentTargetEntry removes the target entry from the parent directory entry chain.
@@ -492,10 +555,9 @@ func removeParentTargetEntry(
 			}
 
 			// free the target parent directory entry
-			bytesOffset := currentClusterIndex * int(pFs.ClusterSize)
-			copy(data[bytesOffset:], make([]byte, int(pFs.ClusterSize)))
+			clearCluster(pFs, data, uint32(currentClusterIndex))
 
-			break
+			return removeFromDirIndex(pFs, fats, data, pParentDirEntry, GetNormalizedStrFromMem(pTargetDirEntry.Name[:]))
 		}
 
 		prevClusterIndex = currentClusterIndex
@@ -512,6 +574,13 @@ func removeParentTargetEntry(
 // It returns ErrInvalidPath if the path is invalid or points to a file.
 // It returns ErrNilPointer if any of the pointers are nil.
 func Rmdir(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, p_pwd *pseudo_fat.DirectoryEntry, absNormPathToDir string) error {
+	return runInTransaction(pFs, fats, data, func() error {
+		return rmdir(pFs, fats, data, p_pwd, absNormPathToDir)
+	})
+}
+
+// rmdir is the implementation of Rmdir.
+func rmdir(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, p_pwd *pseudo_fat.DirectoryEntry, absNormPathToDir string) error {
 	// sanity checks
 	if pFs == nil || fats == nil || data == nil || absNormPathToDir == "" {
 		return custom_errors.ErrNilPointer
@@ -562,16 +631,28 @@ func Rmdir(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, p_pwd *pseud
 		return fmt.Errorf("failed to remove target entry from the parent directory: %w", err)
 	}
 
+	// remove the index of the target directory (it can be left after the directory got empty)
+	err = dropDirIndex(pFs, fats, data, pTargetDirEntry.StartCluster)
+	if err != nil {
+		return err
+	}
+
 	// remove the target directory entry
 	markFreeCluster(fats, pTargetDirEntry.StartCluster)
-	bytesOffset := int(pTargetDirEntry.StartCluster) * int(pFs.ClusterSize)
-	copy(data[bytesOffset:], make([]byte, int(pFs.ClusterSize)))
+	clearCluster(pFs, data, pTargetDirEntry.StartCluster)
 
 	return nil
 }
 
 // CopyInsideFS copies a file to a new location in the filesystem.
 func CopyInsideFS(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, absNormDestPath string, fileDataRef []byte) error {
+	return runInTransaction(pFs, fatsRef, dataRef, func() error {
+		return copyInsideFS(pFs, fatsRef, dataRef, absNormDestPath, fileDataRef)
+	})
+}
+
+// copyInsideFS is the implementation of CopyInsideFS.
+func copyInsideFS(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, absNormDestPath string, fileDataRef []byte) error {
 	// sanity checks
 	if pFs == nil || fatsRef == nil || dataRef == nil || absNormDestPath == "" || fileDataRef == nil {
 		return custom_errors.ErrNilPointer
@@ -600,7 +681,7 @@ func CopyInsideFS(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte,
 	ancestorBranchPath := strings.Join(pathSegments[:len(pathSegments)-1], consts.PathDelimiter)
 	ancestorEntriesRef, err := GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, ancestorBranchPath)
 	if err != nil {
-		if err == custom_errors.ErrEntryNotFound {
+		if errors.Is(err, custom_errors.ErrEntryNotFound) {
 			return custom_errors.ErrPathNotFound
 		}
 		return err
@@ -650,29 +731,26 @@ func CopyInsideFS(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte,
 
 	// write the new directory entry to the parent directory cluster
 	addToFat(fatsRef, clusterEndIndex, freeClusterIndexParent)
-	byteOffset := int(freeClusterIndexParent) * int(pFs.ClusterSize)
-	copy(dataRef[byteOffset:], newDirEntryBytes)
+	writeToCluster(pFs, dataRef, freeClusterIndexParent, newDirEntryBytes)
 
 	// write the new directory entry to the its own cluster
 	markEndOfChain(fatsRef, freeClusterIndex)
-	byteOffset = int(freeClusterIndex) * int(pFs.ClusterSize)
-	copy(dataRef[byteOffset:], newDirEntryBytes)
+	writeToCluster(pFs, dataRef, freeClusterIndex, newDirEntryBytes)
 
 	// write the file data to the filesystem
 	bytesRemaining := len(fileDataRef)
 	prevIndex := freeClusterIndex
 	for i, clusterIndex := range freeClusterIndicesData {
 		addToFat(fatsRef, prevIndex, clusterIndex)
-		byteOffset = int(clusterIndex) * int(pFs.ClusterSize)
 		fileDataRefStartOffset := i * int(pFs.ClusterSize)
 		fileDataRefEndOffset := min((i+1)*int(pFs.ClusterSize), fileDataRefStartOffset+bytesRemaining)
 		currentSourceBytes := fileDataRef[fileDataRefStartOffset:fileDataRefEndOffset]
-		copiedBytesCount := copy(dataRef[byteOffset:], currentSourceBytes)
+		copiedBytesCount := writeToCluster(pFs, dataRef, clusterIndex, currentSourceBytes)
 		bytesRemaining -= copiedBytesCount
 		prevIndex = clusterIndex
 	}
 
-	return nil
+	return addToDirIndex(pFs, fatsRef, dataRef, pParentDirEntry, &pNewDirEntry)
 }
 
 // GetFileBytes retrieves the content of the specified file.
@@ -728,6 +806,13 @@ func GetFileBytes(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte,
 // RemoveFile removes an existing file from the specified parent directory.
 // Expects the absNormPathToFile to be a valid normalized absolute path.
 func RemoveFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, absNormPathToFile string) error {
+	return runInTransaction(pFs, fatsRef, dataRef, func() error {
+		return removeFile(pFs, fatsRef, dataRef, absNormPathToFile)
+	})
+}
+
+// removeFile is the implementation of RemoveFile.
+func removeFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, absNormPathToFile string) error {
 	// sanity checks
 	if pFs == nil || fatsRef == nil || dataRef == nil || absNormPathToFile == "" {
 		return custom_errors.ErrNilPointer
@@ -765,8 +850,7 @@ func RemoveFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, a
 	// free the file clusters
 	for _, clusterIndex := range clusterChain {
 		markFreeCluster(fatsRef, clusterIndex)
-		bytesOffset := int(clusterIndex) * int(pFs.ClusterSize)
-		copy(dataRef[bytesOffset:], make([]byte, int(pFs.ClusterSize)))
+		clearCluster(pFs, dataRef, clusterIndex)
 	}
 
 	return nil
@@ -777,6 +861,13 @@ func RemoveFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, a
 //
 // Expects the absNormSrcPath and absNormDestPath to be valid normalized absolute paths.
 func MoveFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, absNormSrcPath string, absNormDestPath string) error {
+	return runInTransaction(pFs, fatsRef, dataRef, func() error {
+		return moveFile(pFs, fatsRef, dataRef, absNormSrcPath, absNormDestPath)
+	})
+}
+
+// moveFile is the implementation of MoveFile.
+func moveFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, absNormSrcPath string, absNormDestPath string) error {
 	// sanity checks
 	if pFs == nil || fatsRef == nil || dataRef == nil || absNormSrcPath == "" || absNormDestPath == "" {
 		return custom_errors.ErrNilPointer
@@ -839,23 +930,27 @@ func MoveFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, abs
 			}
 
 			if GetNormalizedStrFromMem(pEntry.Name[:]) == originalSrcName {
-				copy(dataRef[byteOffset:], newDirEntryBytes)
+				writeToCluster(pFs, dataRef, clusterIndex, newDirEntryBytes)
 				break
 			}
 		}
 
 		// write the new directory entry to the its own cluster
-		byteOffset := int(pNewDirEntry.StartCluster) * int(pFs.ClusterSize)
-		copy(dataRef[byteOffset:], newDirEntryBytes)
+		writeToCluster(pFs, dataRef, pNewDirEntry.StartCluster, newDirEntryBytes)
 
-		return nil
+		// the renamed entry is indexed under the new name
+		err = removeFromDirIndex(pFs, fatsRef, dataRef, pSrcParentEntry, originalSrcName)
+		if err != nil {
+			return err
+		}
+		return addToDirIndex(pFs, fatsRef, dataRef, pSrcParentEntry, &pNewDirEntry)
 
 		// if the source and destination are different, the file is moved
 	} else {
 		// get the branch for the destination directory
 		pDestEntries, err := GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, ancestorDest)
 		if err != nil {
-			if err == custom_errors.ErrEntryNotFound {
+			if errors.Is(err, custom_errors.ErrEntryNotFound) {
 				return custom_errors.ErrPathNotFound
 			}
 			return err
@@ -888,21 +983,26 @@ func MoveFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, abs
 		addToFat(fatsRef, pNewParentLastCluster, freeClusterIndexParent)
 
 		// write the new directory entry to the parent directory cluster
-		byteOffset := int(freeClusterIndexParent) * int(pFs.ClusterSize)
-		copy(dataRef[byteOffset:], newDirEntryBytes)
+		writeToCluster(pFs, dataRef, freeClusterIndexParent, newDirEntryBytes)
 
 		// write the new directory entry to the its own cluster
-		byteOffset = int(pNewDirEntry.StartCluster) * int(pFs.ClusterSize)
-		copy(dataRef[byteOffset:], newDirEntryBytes)
-	}
+		writeToCluster(pFs, dataRef, pNewDirEntry.StartCluster, newDirEntryBytes)
 
-	return nil
+		return addToDirIndex(pFs, fatsRef, dataRef, pNewParentEntry, &pNewDirEntry)
+	}
 }
 
 // CopyFile copies a file to a new location in the filesystem.
 //
 // Expects the absNormSrcPath and absNormDestPath to be valid normalized absolute paths.
 func CopyFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, absNormSrcPath string, absNormDestPath string) error {
+	return runInTransaction(pFs, fatsRef, dataRef, func() error {
+		return copyFile(pFs, fatsRef, dataRef, absNormSrcPath, absNormDestPath)
+	})
+}
+
+// copyFile is the implementation of CopyFile.
+func copyFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, absNormSrcPath string, absNormDestPath string) error {
 	// sanity checks
 	if pFs == nil || fatsRef == nil || dataRef == nil || absNormSrcPath == "" || absNormDestPath == "" {
 		return custom_errors.ErrNilPointer
@@ -957,7 +1057,7 @@ func CopyFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, abs
 	// get the branch for the destination directory
 	pDestEntries, err := GetBranchDirEntriesFromRoot(pFs, fatsRef, dataRef, ancestorDest)
 	if err != nil {
-		if err == custom_errors.ErrEntryNotFound {
+		if errors.Is(err, custom_errors.ErrEntryNotFound) {
 			return custom_errors.ErrPathNotFound
 		}
 		return err
@@ -983,13 +1083,11 @@ func CopyFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, abs
 
 	// write the new directory entry to the parent directory cluster
 	addToFat(fatsRef, lastParentClusterIndex, freeClusterIndexParRef)
-	byteOffset := int(freeClusterIndexParRef) * int(pFs.ClusterSize)
-	copy(dataRef[byteOffset:], newDirEntryBytes)
+	writeToCluster(pFs, dataRef, freeClusterIndexParRef, newDirEntryBytes)
 
 	// write the new directory entry to the its own cluster
 	markEndOfChain(fatsRef, freeClusterIndexSelfRef)
-	byteOffset = int(freeClusterIndexSelfRef) * int(pFs.ClusterSize)
-	copy(dataRef[byteOffset:], newDirEntryBytes)
+	writeToCluster(pFs, dataRef, freeClusterIndexSelfRef, newDirEntryBytes)
 
 	// get the file data
 	fileData, err := GetFileBytes(pFs, fatsRef, dataRef, absNormSrcPath)
@@ -1001,10 +1099,9 @@ func CopyFile(pFs *pseudo_fat.FileSystem, fatsRef [][]int32, dataRef []byte, abs
 	prevIndex := freeClusterIndexSelfRef
 	for i, clusterIndex := range freeClusterIndicesData {
 		addToFat(fatsRef, prevIndex, clusterIndex)
-		byteOffset = int(clusterIndex) * int(pFs.ClusterSize)
-		copy(dataRef[byteOffset:], fileData[i*int(pFs.ClusterSize):])
+		writeToCluster(pFs, dataRef, clusterIndex, fileData[i*int(pFs.ClusterSize):])
 		prevIndex = clusterIndex
 	}
 
-	return nil
+	return addToDirIndex(pFs, fatsRef, dataRef, pNewParentEntry, &pNewDirEntry)
 }
@@ -0,0 +1,269 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"kiv-zos-semestral-work/custom_errors"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+	"sort"
+)
+
+// ResizeResult is the result of the filesystem resize
+type ResizeResult struct {
+	// OldSize is the disk size before the resize
+	OldSize uint32
+	// OldClusterCount is the number of the clusters before the resize
+	OldClusterCount uint32
+	// Relocated is the number of the clusters moved below the new cluster count
+	Relocated int
+}
+
+// getResizedFileSystem returns the superblock of the filesystem resized to the size
+// (the layout is calculated the same way as by the format command).
+func getResizedFileSystem(pFs *pseudo_fat.FileSystem, newSize uint32) (*pseudo_fat.FileSystem, error) {
+	clusterCount, fatSize, _ := CalculateFSSizes(newSize)
+	if clusterCount == 0 {
+		return nil, custom_errors.ErrDiskTooSmall
+	}
+
+	resized := *pFs
+	resized.DiskSize = newSize
+	resized.FatCount = clusterCount
+	resized.Fat01StartAddr = uint32(pseudo_fat.GetSizeOfFileSystem())
+	resized.Fat02StartAddr = resized.Fat01StartAddr + fatSize
+	resized.DataStartAddr = resized.Fat02StartAddr + fatSize
+
+	err := validateFileSystem(&resized)
+	if err != nil {
+		return nil, fmt.Errorf("resized filesystem is invalid: %w", err)
+	}
+
+	return &resized, nil
+}
+
+// getStartClusterEntries maps the start clusters of all entries (except the root directory)
+// to their position in the list of the entries (parents are listed before children).
+func getStartClusterEntries(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte) ([]subtreeEntry, map[uint32]int, error) {
+	entries, err := getSubtreeEntries(pFs, fats, data, consts.PathDelimiter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	starts := make(map[uint32]int, len(entries))
+	for i, entry := range entries[1:] {
+		starts[entry.pEntry.StartCluster] = i + 1
+	}
+
+	return entries, starts, nil
+}
+
+// getUsedClustersLimit returns the least cluster count the used clusters of the FAT fit into
+// (the bad clusters are not counted as used, but the ones below the limit cannot hold the used clusters).
+func getUsedClustersLimit(fat []int32) uint32 {
+	used := GetFatUsage(fat).Used
+	if used == 0 {
+		return 0
+	}
+
+	good := uint32(0)
+	for cluster, value := range fat {
+		if value == consts.FatBadCluster {
+			continue
+		}
+		good++
+		if good == used {
+			return uint32(cluster) + 1
+		}
+	}
+
+	return uint32(len(fat))
+}
+
+// relocateClustersBelow moves the used clusters at or above the limit to the free clusters below it
+// and returns the number of the moved clusters. The links to the moved clusters are updated in every FAT,
+// the moved start clusters of the entries are updated in the directory entries (see updateStartCluster).
+//
+// The caller is responsible for checking that the clusters fit below the limit.
+func relocateClustersBelow(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, limit uint32) (int, error) {
+	entries, starts, err := getStartClusterEntries(pFs, fats, data)
+	if err != nil {
+		return 0, err
+	}
+
+	// the clusters linking to the moved clusters (in every FAT, the FATs do not have to be the same)
+	predecessors := make([]map[uint32]uint32, len(fats))
+	for i := range fats {
+		predecessors[i] = make(map[uint32]uint32)
+		for cluster, value := range fats[i] {
+			if value >= 0 && uint32(value) >= limit {
+				predecessors[i][uint32(value)] = uint32(cluster)
+			}
+		}
+	}
+
+	moved := make(map[uint32]uint32)
+	nextFree := uint32(0)
+	for cluster := limit; cluster < uint32(len(fats[0])); cluster++ {
+		// the bad clusters are not moved, they are dropped with the clusters above the limit
+		if fats[0][cluster] == consts.FatFree || fats[0][cluster] == consts.FatBadCluster {
+			continue
+		}
+
+		for nextFree < limit && fats[0][nextFree] != consts.FatFree {
+			nextFree++
+		}
+		if nextFree >= limit {
+			return len(moved), custom_errors.ErrResizeNoSpace
+		}
+
+		target := nextFree
+		stageFatEntries(fats, cluster, target)
+		for i := range fats {
+			fats[i][target] = fats[i][cluster]
+			fats[i][cluster] = consts.FatFree
+		}
+		NotifyFatChanged(fats, cluster, target)
+		// the start clusters of the entries are copied when their references are updated
+		// (the self references of the children are updated at the old location before that)
+		if _, isStart := starts[cluster]; !isStart {
+			copyCluster(pFs, data, cluster, target)
+		}
+		moved[cluster] = target
+	}
+
+	// relink the predecessors (they could have been moved as well)
+	for i := range fats {
+		for oldCluster, pred := range predecessors[i] {
+			if movedPred, found := moved[pred]; found {
+				pred = movedPred
+			}
+			if newCluster, found := moved[oldCluster]; found && fats[i][pred] == int32(oldCluster) {
+				stageFatEntries(fats, pred)
+				fats[i][pred] = int32(newCluster)
+				NotifyFatChanged(fats, pred)
+			}
+		}
+	}
+
+	// the headers of the directory indexes are still in the original self references
+	for _, entry := range entries {
+		if entry.pEntry.IsFile {
+			continue
+		}
+		err = moveDirIndexStart(pFs, data, entry.pEntry.StartCluster, moved)
+		if err != nil {
+			return len(moved), err
+		}
+	}
+
+	// update the moved start clusters (parents first, so their chains are already final)
+	for _, idx := range sortedEntryIndexes(starts, moved) {
+		entry := entries[idx]
+		oldStart := entry.pEntry.StartCluster
+		newStart := moved[oldStart]
+
+		// the parent directory is read again, its start cluster could have been moved
+		parentPath, _ := GetPathAndBasename(entry.absPath)
+		if parentPath == "" {
+			parentPath = consts.PathDelimiter
+		}
+		branchDirEntries, err := GetBranchDirEntriesFromRoot(pFs, fats, data, parentPath)
+		if err != nil {
+			return len(moved), err
+		}
+
+		newChain, err := GetClusterChain(newStart, fats[0])
+		if err != nil {
+			return len(moved), fmt.Errorf("failed to get cluster chain: %w", err)
+		}
+
+		copyCluster(pFs, data, oldStart, newStart)
+		err = updateStartCluster(pFs, fats, data, branchDirEntries[len(branchDirEntries)-1], oldStart, newChain)
+		if err != nil {
+			return len(moved), err
+		}
+	}
+
+	logging.Debug(fmt.Sprintf("Relocated %d clusters below cluster %d", len(moved), limit))
+	return len(moved), nil
+}
+
+// copyCluster copies the content of the cluster to the target cluster.
+func copyCluster(pFs *pseudo_fat.FileSystem, data []byte, cluster uint32, target uint32) {
+	clusterSize := int(pFs.ClusterSize)
+	writeToCluster(pFs, data, target, data[int(cluster)*clusterSize:int(cluster+1)*clusterSize])
+}
+
+// sortedEntryIndexes returns the ascending indexes of the entries whose start cluster was moved.
+func sortedEntryIndexes(starts map[uint32]int, moved map[uint32]uint32) []int {
+	res := make([]int, 0)
+	for oldStart := range moved {
+		if idx, found := starts[oldStart]; found {
+			res = append(res, idx)
+		}
+	}
+	sort.Ints(res)
+
+	return res
+}
+
+// ResizeFileSystem changes the size of the filesystem without losing its data.
+//
+// Growing extends the FATs with free clusters and moves the data region behind them.
+// Shrinking first moves the used clusters above the new cluster count to the free clusters
+// below it (the bad clusters are not moved, the ones above are dropped). If the used clusters do not fit
+// into the good clusters below the new cluster count, ErrResizeNoSpace is returned and nothing is changed.
+// The superblock is recalculated the same way as by the format command and validated.
+func ResizeFileSystem(pFs *pseudo_fat.FileSystem, pFatsRef *[][]int32, pDataRef *[]byte, newSize uint32) (*ResizeResult, error) {
+	// sanity checks
+	if pFs == nil || pFatsRef == nil || *pFatsRef == nil || pDataRef == nil || *pDataRef == nil {
+		return nil, custom_errors.ErrNilPointer
+	}
+
+	pResized, err := getResizedFileSystem(pFs, newSize)
+	if err != nil {
+		return nil, err
+	}
+
+	fats := *pFatsRef
+	res := &ResizeResult{OldSize: pFs.DiskSize, OldClusterCount: uint32(len(fats[0]))}
+	newCount := pResized.FatCount
+
+	if newCount < res.OldClusterCount {
+		if limit := getUsedClustersLimit(fats[0]); limit > newCount {
+			logging.Info(fmt.Sprintf("Used clusters do not fit (used: %d, needed cluster count: %d, new cluster count: %d)",
+				GetFatUsage(fats[0]).Used, limit, newCount))
+			return nil, custom_errors.ErrResizeNoSpace
+		}
+
+		err = runInTransaction(pFs, fats, *pDataRef, func() error {
+			var err error
+			res.Relocated, err = relocateClustersBelow(pFs, fats, *pDataRef, newCount)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newFats := make([][]int32, len(fats))
+	for i := range fats {
+		newFats[i] = make([]int32, newCount)
+		copied := copy(newFats[i], fats[i])
+		for j := copied; j < len(newFats[i]); j++ {
+			newFats[i][j] = consts.FatFree
+		}
+	}
+
+	newData := make([]byte, int(newCount)*int(pFs.ClusterSize))
+	copy(newData, *pDataRef)
+
+	*pFs = *pResized
+	*pFatsRef = newFats
+	*pDataRef = newData
+
+	logging.Debug(fmt.Sprintf("Filesystem resized: %s", pFs.ToString()))
+	return res, nil
+}
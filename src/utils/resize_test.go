@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"bytes"
+	"kiv-zos-semestral-work/consts"
+	"testing"
+)
+
+// newBadClustersFS returns a filesystem of 100 clusters with the files above the cluster 40,
+// the free clusters 5 and 6 below it marked bad and the clusters 70 to 99 marked bad.
+func newBadClustersFS(t *testing.T) (*testFS, map[string][]byte) {
+	f := newTestFS(t, 100)
+
+	// the filler keeps the low clusters used while the files are written above it
+	f.writeFile("/filler", make([]byte, 45*int(consts.ClusterSize)))
+	files := map[string][]byte{
+		"/a":   testPattern(1, 6*int(consts.ClusterSize)+10),
+		"/b":   testPattern(2, 3*int(consts.ClusterSize)),
+		"/c/d": testPattern(3, 100),
+	}
+	f.mkdir("/c")
+	for _, path := range []string{"/a", "/b", "/c/d"} {
+		f.writeFile(path, files[path])
+	}
+	if err := RemoveFile(f.pFs, f.fats, f.data, "/filler"); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := []uint32{5, 6}
+	for cluster := uint32(70); cluster < 100; cluster++ {
+		bad = append(bad, cluster)
+	}
+	for _, cluster := range bad {
+		if f.fats[0][cluster] != consts.FatFree {
+			t.Fatalf("cluster %d is not free", cluster)
+		}
+		for i := range f.fats {
+			f.fats[i][cluster] = consts.FatBadCluster
+		}
+		NotifyFatChanged(f.fats, cluster)
+	}
+
+	return f, files
+}
+
+func TestShrinkSkipsBadClusters(t *testing.T) {
+	tests := []struct {
+		name   string
+		shrink func(f *testFS) (*ResizeResult, error)
+	}{
+		{"resize", func(f *testFS) (*ResizeResult, error) {
+			return ResizeFileSystem(f.pFs, &f.fats, &f.data, uint32(GetFSSizeForClusters(40)))
+		}},
+		{"compact", func(f *testFS) (*ResizeResult, error) {
+			return CompactFileSystem(f.pFs, &f.fats, &f.data, 0, false)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, files := newBadClustersFS(t)
+			usage := GetFatUsage(f.fats[0])
+
+			// the bad clusters do not fit with the used ones
+			if usage.Used+usage.Bad <= 40 {
+				t.Fatalf("used %d and bad %d clusters fit", usage.Used, usage.Bad)
+			}
+			usedAbove := false
+			for cluster := 40; cluster < 70; cluster++ {
+				usedAbove = usedAbove || f.fats[0][cluster] >= 0 || f.fats[0][cluster] == consts.FatFileEnd
+			}
+			if !usedAbove {
+				t.Fatal("no used cluster to relocate")
+			}
+
+			res, err := tt.shrink(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Relocated == 0 {
+				t.Error("no cluster relocated")
+			}
+
+			// the used clusters and the two bad ones below them
+			if tt.name == "compact" && len(f.fats[0]) != int(usage.Used)+2 {
+				t.Errorf("compacted to %d clusters, expected %d", len(f.fats[0]), usage.Used+2)
+			}
+			for _, cluster := range []uint32{5, 6} {
+				if f.fats[0][cluster] != consts.FatBadCluster {
+					t.Errorf("bad cluster %d was used (FAT value %d)", cluster, f.fats[0][cluster])
+				}
+			}
+			if got := GetFatUsage(f.fats[0]); got.Used != usage.Used || got.Bad != 2 {
+				t.Errorf("usage %+v after shrink, used before %d", got, usage.Used)
+			}
+
+			f.checkConsistency()
+			for path, content := range files {
+				if got := f.readFile(path); !bytes.Equal(got, content) {
+					t.Errorf("%s: content differs after shrink", path)
+				}
+			}
+		})
+	}
+}
+
+func TestResizeNoSpaceWithBadClusters(t *testing.T) {
+	f, _ := newBadClustersFS(t)
+	limit := getUsedClustersLimit(f.fats[0])
+
+	// the two bad clusters below the used ones cannot hold them
+	if limit != GetFatUsage(f.fats[0]).Used+2 {
+		t.Fatalf("limit %d, used %d", limit, GetFatUsage(f.fats[0]).Used)
+	}
+
+	fatsBefore := cloneFats(f.fats)
+	_, err := ResizeFileSystem(f.pFs, &f.fats, &f.data, uint32(GetFSSizeForClusters(limit-1)))
+	if err == nil {
+		t.Fatal("resize below the used clusters succeeded")
+	}
+	if !equalFats(f.fats, fatsBefore) {
+		t.Error("FATs changed by the failed resize")
+	}
+
+	if _, err = ResizeFileSystem(f.pFs, &f.fats, &f.data, uint32(GetFSSizeForClusters(limit))); err != nil {
+		t.Fatal(err)
+	}
+	f.checkConsistency()
+}
+
+// cloneFats returns a deep copy of the FATs.
+func cloneFats(fats [][]int32) [][]int32 {
+	res := make([][]int32, len(fats))
+	for i := range fats {
+		res[i] = append([]int32(nil), fats[i]...)
+	}
+	return res
+}
+
+// equalFats returns true if the FATs have the same entries.
+func equalFats(a [][]int32, b [][]int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
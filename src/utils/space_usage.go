@@ -0,0 +1,30 @@
+// utils package contains utility functions for the project
+package utils
+
+// FatUsage is the number of clusters in each state of the FAT
+type FatUsage struct {
+	// Total is the number of all the clusters
+	Total uint32
+	// Used is the number of the clusters in a cluster chain
+	Used uint32
+	// Free is the number of the free clusters
+	Free uint32
+	// Bad is the number of the bad clusters
+	Bad uint32
+}
+
+// GetFatUsage returns the number of the used, free and bad clusters of the FAT
+// (from the counters, the FAT is scanned only if they are not built for it yet).
+func GetFatUsage(fat []int32) FatUsage {
+	if !usageTracker.isTracked(fat) {
+		usageTracker.rebuild(fat)
+	}
+
+	free, bad := usageTracker.getFreeCount(fat), usageTracker.bad.count
+	return FatUsage{
+		Total: uint32(len(fat)),
+		Used:  uint32(len(fat)) - free - bad,
+		Free:  free,
+		Bad:   bad,
+	}
+}
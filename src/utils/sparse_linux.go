@@ -0,0 +1,39 @@
+//go:build linux
+
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"errors"
+	"kiv-zos-semestral-work/custom_errors"
+	"os"
+	"syscall"
+)
+
+// fallocPunchHole is the FALLOC_FL_PUNCH_HOLE flag of fallocate
+const fallocPunchHole = 0x02
+
+// fallocKeepSize is the FALLOC_FL_KEEP_SIZE flag of fallocate
+const fallocKeepSize = 0x01
+
+// PunchHole deallocates the byte range of the file using fallocate (the file size is kept
+// and the range reads as zeros).
+//
+// It returns ErrSparseUnsupported if the host filesystem does not support it.
+func PunchHole(pFile *os.File, offset int64, length int64) error {
+	// sanity check
+	if pFile == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	if length <= 0 {
+		return nil
+	}
+
+	err := syscall.Fallocate(int(pFile.Fd()), fallocPunchHole|fallocKeepSize, offset, length)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return custom_errors.ErrSparseUnsupported
+	}
+
+	return err
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"kiv-zos-semestral-work/custom_errors"
+	"os"
+)
+
+// PunchHole is not supported on this platform, ErrSparseUnsupported is returned.
+func PunchHole(pFile *os.File, offset int64, length int64) error {
+	// sanity check
+	if pFile == nil {
+		return custom_errors.ErrNilPointer
+	}
+
+	return custom_errors.ErrSparseUnsupported
+}
@@ -0,0 +1,141 @@
+// utils package contains utility functions for the project
+package utils
+
+import (
+	"fmt"
+	"kiv-zos-semestral-work/logging"
+	"kiv-zos-semestral-work/pseudo_fat"
+)
+
+// fsTransaction is the undo log of an operation: the original FAT entries and cluster contents
+// recorded before their first change. The changes are committed by dropping the log
+// or rolled back by restoring the recorded values.
+type fsTransaction struct {
+	// fats are the FATs changed by the operation
+	fats [][]int32
+	// data is the data region changed by the operation
+	data []byte
+	// clusterSize is the size of the clusters of the data region
+	clusterSize int
+	// fatEntries maps the clusters to their original entries in all FATs
+	fatEntries map[uint32][]int32
+	// clusters maps the clusters to their original content
+	clusters map[uint32][]byte
+}
+
+// activeTransaction is the transaction of the running operation (nil outside of the operations)
+var activeTransaction *fsTransaction = nil
+
+// runInTransaction runs the operation in a transaction: if it returns an error (or panics),
+// all FAT entries and clusters it changed are restored, so a failure leaves no partial changes.
+//
+// The operations run inside another operation are part of its transaction.
+func runInTransaction(pFs *pseudo_fat.FileSystem, fats [][]int32, data []byte, operation func() error) (err error) {
+	if activeTransaction != nil || pFs == nil || fats == nil || data == nil {
+		return operation()
+	}
+
+	pTx := &fsTransaction{
+		fats:        fats,
+		data:        data,
+		clusterSize: int(pFs.ClusterSize),
+		fatEntries:  make(map[uint32][]int32),
+		clusters:    make(map[uint32][]byte),
+	}
+	activeTransaction = pTx
+	defer func() {
+		activeTransaction = nil
+		if r := recover(); r != nil {
+			pTx.rollback()
+			panic(r)
+		}
+		if err != nil {
+			pTx.rollback()
+		}
+	}()
+
+	return operation()
+}
+
+// rollback restores the recorded FAT entries and clusters.
+func (pTx *fsTransaction) rollback() {
+	logging.Info(fmt.Sprintf("Rolling back the operation (FAT entries: %d, clusters: %d)", len(pTx.fatEntries), len(pTx.clusters)))
+
+	for cluster, content := range pTx.clusters {
+		byteOffset := int(cluster) * pTx.clusterSize
+		copy(pTx.data[byteOffset:byteOffset+pTx.clusterSize], content)
+	}
+	dirCache.invalidate()
+
+	restored := make([]uint32, 0, len(pTx.fatEntries))
+	for cluster, entries := range pTx.fatEntries {
+		for i := range pTx.fats {
+			pTx.fats[i][cluster] = entries[i]
+		}
+		restored = append(restored, cluster)
+	}
+	NotifyFatChanged(pTx.fats, restored...)
+}
+
+// stageFatEntries records the entries of the clusters in all FATs before they are changed.
+func stageFatEntries(fats [][]int32, clusters ...uint32) {
+	pTx := activeTransaction
+	if pTx == nil || len(fats) == 0 || len(pTx.fats) == 0 || &pTx.fats[0] != &fats[0] {
+		return
+	}
+
+	for _, cluster := range clusters {
+		if _, found := pTx.fatEntries[cluster]; found {
+			continue
+		}
+
+		entries := make([]int32, len(fats))
+		for i := range fats {
+			entries[i] = fats[i][cluster]
+		}
+		pTx.fatEntries[cluster] = entries
+	}
+}
+
+// stageCluster records the content of the cluster before it is changed.
+// It is called before every change of the data region, so it also drops the cached directory entries
+// if they were read from the cluster.
+func stageCluster(pFs *pseudo_fat.FileSystem, data []byte, cluster uint32) {
+	dirCache.clustersChanged(cluster)
+
+	pTx := activeTransaction
+	if pTx == nil || len(data) == 0 || len(pTx.data) == 0 || &pTx.data[0] != &data[0] {
+		return
+	}
+	if _, found := pTx.clusters[cluster]; found {
+		return
+	}
+
+	byteOffset := int(cluster) * int(pFs.ClusterSize)
+	content := make([]byte, int(pFs.ClusterSize))
+	copy(content, data[byteOffset:byteOffset+int(pFs.ClusterSize)])
+	pTx.clusters[cluster] = content
+}
+
+// writeToCluster copies the bytes to the start of the cluster (at most one cluster of them)
+// and returns the number of the copied bytes. The rest of the cluster is kept.
+func writeToCluster(pFs *pseudo_fat.FileSystem, data []byte, cluster uint32, content []byte) int {
+	return writeToClusterAt(pFs, data, cluster, 0, content)
+}
+
+// writeToClusterAt copies the bytes to the offset within the cluster (up to the end of the cluster)
+// and returns the number of the copied bytes.
+func writeToClusterAt(pFs *pseudo_fat.FileSystem, data []byte, cluster uint32, offset int, content []byte) int {
+	stageCluster(pFs, data, cluster)
+
+	byteOffset := int(cluster) * int(pFs.ClusterSize)
+	return copy(data[byteOffset+offset:byteOffset+int(pFs.ClusterSize)], content)
+}
+
+// clearCluster overwrites the content of the cluster with zeros.
+func clearCluster(pFs *pseudo_fat.FileSystem, data []byte, cluster uint32) {
+	stageCluster(pFs, data, cluster)
+
+	byteOffset := int(cluster) * int(pFs.ClusterSize)
+	clear(data[byteOffset : byteOffset+int(pFs.ClusterSize)])
+}
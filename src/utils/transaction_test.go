@@ -0,0 +1,347 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"kiv-zos-semestral-work/consts"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// errInjected is the failure injected by failingAllocator
+var errInjected = errors.New("injected failure")
+
+// failingAllocator makes the operation fail at the given step: the failFindAt-th search for the free
+// clusters returns errInjected, the failChangeAt-th FAT change panics after it is reported (as a crash
+// in the middle of the operation). Zero disables the failure. Only the first failure is injected.
+type failingAllocator struct {
+	*ExtentAllocator
+	failFindAt   int
+	failChangeAt int
+	finds        int
+	changes      int
+	failed       bool
+}
+
+func (a *failingAllocator) FindFreeClusters(fat []int32, count int) ([]uint32, error) {
+	if !a.failed {
+		a.finds++
+		if a.finds == a.failFindAt {
+			a.failed = true
+			return nil, errInjected
+		}
+	}
+
+	return a.ExtentAllocator.FindFreeClusters(fat, count)
+}
+
+func (a *failingAllocator) ClusterChanged(fat []int32, cluster uint32) {
+	a.ExtentAllocator.ClusterChanged(fat, cluster)
+
+	if !a.failed {
+		a.changes++
+		if a.changes == a.failChangeAt {
+			a.failed = true
+			panic(errInjected)
+		}
+	}
+}
+
+// fsSnapshot is the copy of the state of the filesystem that has to be restored by a failed operation
+type fsSnapshot struct {
+	fats       [][]int32
+	data       []byte
+	usageBad   []uint64
+	badCount   uint32
+	allocFree  []uint64
+	extents    []extentKey
+	extentLens map[uint32]uint32
+}
+
+// snapshot returns the copy of the FATs, the data region, the bad cluster bitmap and the allocator index
+// (counting the free clusters as well).
+func (f *testFS) snapshot() *fsSnapshot {
+	f.tb.Helper()
+
+	// the index is built lazily
+	if _, err := f.allocator.FindFreeClusters(f.fats[0], 0); err != nil {
+		f.tb.Fatal(err)
+	}
+	GetFatUsage(f.fats[0])
+
+	return &fsSnapshot{
+		fats:       cloneFats(f.fats),
+		data:       bytes.Clone(f.data),
+		usageBad:   slices.Clone(usageTracker.bad.words),
+		badCount:   usageTracker.bad.count,
+		allocFree:  slices.Clone(f.allocator.free.words),
+		extents:    collectExtents(&f.allocator.extents),
+		extentLens: maps.Clone(f.allocator.extentLens),
+	}
+}
+
+// checkSnapshot fails the test if the state of the filesystem differs from the snapshot.
+func (f *testFS) checkSnapshot(s *fsSnapshot) {
+	f.tb.Helper()
+
+	if !equalFats(f.fats, s.fats) {
+		f.tb.Fatal("FATs differ")
+	}
+	if !bytes.Equal(f.data, s.data) {
+		f.tb.Fatal("data region differs")
+	}
+	if !usageTracker.isTracked(f.fats[0]) || !slices.Equal(usageTracker.bad.words, s.usageBad) ||
+		usageTracker.bad.count != s.badCount {
+		f.tb.Fatal("bad cluster bitmap differs")
+	}
+	if !f.allocator.isIndexed(f.fats[0]) || !slices.Equal(f.allocator.free.words, s.allocFree) ||
+		!slices.Equal(collectExtents(&f.allocator.extents), s.extents) || !maps.Equal(f.allocator.extentLens, s.extentLens) {
+		f.tb.Fatal("allocator index differs")
+	}
+}
+
+// clone returns the copy of the filesystem with a new allocator.
+func (f *testFS) clone(tb testing.TB) *testFS {
+	pFs := *f.pFs
+	res := &testFS{pFs: &pFs, fats: cloneFats(f.fats), data: bytes.Clone(f.data), tb: tb, allocator: NewExtentAllocator()}
+	SetClusterAllocator(res.allocator)
+	RebuildClusterUsage(res.fats[0])
+	InvalidateDirCache()
+
+	return res
+}
+
+// newPopulatedTestFS returns the filesystem with nested directories, files of more clusters,
+// a fragmented file, a directory with an index and an emptied directory with an index.
+func newPopulatedTestFS(tb testing.TB) *testFS {
+	f := newTestFS(tb, 2500)
+	clusterSize := int(consts.ClusterSize)
+
+	f.mkdir("/a")
+	f.mkdir("/a/b")
+	f.mkdir("/a/e")
+	f.writeFile("/a/f1", testPattern(1, 3*clusterSize+5))
+	f.writeFile("/a/b/f2", testPattern(2, 20))
+	f.writeFile("/g", testPattern(3, 2*clusterSize))
+
+	// the appends of the two files interleave
+	f.writeFile("/frag", testPattern(4, clusterSize))
+	f.writeFile("/a/frag", testPattern(5, clusterSize))
+	for i := 0; i < 3; i++ {
+		for _, path := range []string{"/frag", "/a/frag"} {
+			if err := AppendFile(f.pFs, f.fats, f.data, path, testPattern(byte(i), clusterSize)); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+
+	f.mkdir("/big")
+	for i := 0; i <= consts.DirIndexThreshold+20; i++ {
+		f.writeFile(fmt.Sprintf("/big/x%d", i), []byte{byte(i)})
+	}
+
+	f.mkdir("/idx")
+	for i := 0; i <= consts.DirIndexThreshold; i++ {
+		f.mkdir(fmt.Sprintf("/idx/d%d", i))
+	}
+	for i := 0; i <= consts.DirIndexThreshold; i++ {
+		if err := rmdirTest(f, fmt.Sprintf("/idx/d%d", i)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	// a file at the end of the used clusters (relocated by the shrink)
+	f.writeFile("/filler", make([]byte, 100*clusterSize))
+	f.writeFile("/high", testPattern(6, 5*clusterSize))
+	if err := RemoveFile(f.pFs, f.fats, f.data, "/filler"); err != nil {
+		tb.Fatal(err)
+	}
+
+	for _, path := range []string{"/big", "/idx"} {
+		branch, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, found := readTestDirIndexHeader(f, branch[len(branch)-1]); !found {
+			tb.Fatalf("%s has no index", path)
+		}
+	}
+	f.checkConsistency()
+
+	return f
+}
+
+// failureCase is an operation run with the injected failures
+type failureCase struct {
+	name string
+	op   func(f *testFS) error
+	// partial is true if the operation commits its steps separately (only the consistency is checked)
+	partial bool
+	// fatUnchanged is true if the operation changes only the data region (no failure can be injected)
+	fatUnchanged bool
+}
+
+// runWithFailure runs the operation with the allocator failing at the step and returns
+// the error of the operation (the injected panic is returned as errInjected) and whether
+// the failure was injected.
+func runWithFailure(f *testFS, tc failureCase, failFindAt int, failChangeAt int) (err error, failed bool) {
+	allocator := &failingAllocator{ExtentAllocator: f.allocator, failFindAt: failFindAt, failChangeAt: failChangeAt}
+	SetClusterAllocator(allocator)
+	defer SetClusterAllocator(f.allocator)
+
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errInjected {
+				panic(r)
+			}
+			err = errInjected
+		}
+		failed = allocator.failed
+	}()
+
+	return tc.op(f), false
+}
+
+func TestOperationFailureRollback(t *testing.T) {
+	clusterSize := int(consts.ClusterSize)
+	base := newPopulatedTestFS(t)
+
+	tests := []failureCase{
+		{name: "mkdir", op: func(f *testFS) error { return Mkdir(f.pFs, f.fats, f.data, "/a/b/new") }},
+		{name: "mkdir in indexed dir", op: func(f *testFS) error { return Mkdir(f.pFs, f.fats, f.data, "/big/new") }},
+		{name: "copy inside", op: func(f *testFS) error {
+			return CopyInsideFS(f.pFs, f.fats, f.data, "/a/copy", testPattern(7, 5*clusterSize))
+		}},
+		{name: "copy inside to indexed dir", op: func(f *testFS) error {
+			return CopyInsideFS(f.pFs, f.fats, f.data, "/big/copy", testPattern(7, 2*clusterSize))
+		}},
+		{name: "move across dirs", op: func(f *testFS) error { return MoveFile(f.pFs, f.fats, f.data, "/a/f1", "/a/b/f1") }},
+		{name: "move to indexed dir", op: func(f *testFS) error { return MoveFile(f.pFs, f.fats, f.data, "/g", "/big/g") }},
+		{name: "move from indexed dir", op: func(f *testFS) error { return MoveFile(f.pFs, f.fats, f.data, "/big/x3", "/a/x3") }},
+		{name: "rename in indexed dir", op: func(f *testFS) error {
+			return MoveFile(f.pFs, f.fats, f.data, "/big/x10", "/big/y10")
+		}, fatUnchanged: true},
+		{name: "remove", op: func(f *testFS) error { return RemoveFile(f.pFs, f.fats, f.data, "/a/f1") }},
+		{name: "remove from indexed dir", op: func(f *testFS) error { return RemoveFile(f.pFs, f.fats, f.data, "/big/x5") }},
+		{name: "rmdir", op: func(f *testFS) error { return rmdirTest(f, "/a/e") }},
+		{name: "rmdir with index", op: func(f *testFS) error { return rmdirTest(f, "/idx") }},
+		{name: "write new", op: func(f *testFS) error {
+			return WriteFile(f.pFs, f.fats, f.data, "/a/new", testPattern(8, 4*clusterSize))
+		}},
+		{name: "overwrite", op: func(f *testFS) error {
+			return WriteFile(f.pFs, f.fats, f.data, "/a/f1", testPattern(8, 6*clusterSize))
+		}},
+		{name: "append", op: func(f *testFS) error {
+			return AppendFile(f.pFs, f.fats, f.data, "/a/f1", testPattern(9, 3*clusterSize))
+		}},
+		{name: "truncate shrink", op: func(f *testFS) error { return TruncateFile(f.pFs, f.fats, f.data, "/a/f1", 1) }},
+		{name: "truncate extend", op: func(f *testFS) error {
+			return TruncateFile(f.pFs, f.fats, f.data, "/a/f1", uint32(7*clusterSize))
+		}},
+		{name: "defragment file", op: func(f *testFS) error {
+			_, err := Defragment(f.pFs, f.fats, f.data, "/frag", nil)
+			return err
+		}},
+		{name: "defragment dir", op: func(f *testFS) error {
+			_, err := Defragment(f.pFs, f.fats, f.data, "/a", nil)
+			return err
+		}, partial: true},
+		{name: "resize shrink", op: func(f *testFS) error {
+			limit := getUsedClustersLimit(f.fats[0])
+			_, err := ResizeFileSystem(f.pFs, &f.fats, &f.data, uint32(GetFSSizeForClusters(limit+2)))
+			return err
+		}},
+	}
+
+	for _, tc := range tests {
+		for _, kind := range []string{"find", "change"} {
+			t.Run(tc.name+"/"+kind, func(t *testing.T) {
+				f := base.clone(t)
+				contents := readAllFiles(f)
+
+				injected := 0
+				for step := 1; ; step++ {
+					if step > 100000 {
+						t.Fatal("the operation does not finish")
+					}
+
+					before := f.snapshot()
+					failFindAt, failChangeAt := step, 0
+					if kind == "change" {
+						failFindAt, failChangeAt = 0, step
+					}
+
+					err, failed := runWithFailure(f, tc, failFindAt, failChangeAt)
+					if !failed {
+						if err != nil {
+							t.Fatalf("step %d: %v without a failure", step, err)
+						}
+						break
+					}
+					injected++
+					if !errors.Is(err, errInjected) {
+						t.Fatalf("step %d: error %v, expected the injected one", step, err)
+					}
+
+					if tc.partial {
+						f.checkConsistency()
+						checkExtentIndex(t, f.allocator, f.fats[0])
+						for path, content := range contents {
+							if got := f.readFile(path); !bytes.Equal(got, content) {
+								t.Fatalf("step %d: %s differs", step, path)
+							}
+						}
+						continue
+					}
+					f.checkSnapshot(before)
+				}
+
+				if kind == "change" && (injected == 0) != tc.fatUnchanged {
+					t.Fatalf("%d failures injected", injected)
+				}
+				t.Logf("%d failures injected", injected)
+				f.checkConsistency()
+			})
+		}
+	}
+}
+
+// rmdirTest removes the directory with the root as the current directory.
+func rmdirTest(f *testFS, path string) error {
+	pRoot, err := GetRootDirEntry(f.pFs, f.fats, f.data)
+	if err != nil {
+		return err
+	}
+	return Rmdir(f.pFs, f.fats, f.data, pRoot, path)
+}
+
+// readAllFiles returns the contents of all files of the filesystem by their paths.
+func readAllFiles(f *testFS) map[string][]byte {
+	f.tb.Helper()
+
+	res := make(map[string][]byte)
+	var walk func(path string)
+	walk = func(path string) {
+		branch, err := GetBranchDirEntriesFromRoot(f.pFs, f.fats, f.data, path)
+		if err != nil {
+			f.tb.Fatal(err)
+		}
+		children, err := GetDirEntries(f.pFs, branch[len(branch)-1], f.fats, f.data)
+		if err != nil {
+			f.tb.Fatal(err)
+		}
+		for _, pChild := range children {
+			childPath := JoinAbsPath(path, GetNormalizedStrFromMem(pChild.Name[:]))
+			if pChild.IsFile {
+				res[childPath] = f.readFile(childPath)
+			} else {
+				walk(childPath)
+			}
+		}
+	}
+	walk(consts.PathDelimiter)
+
+	return res
+}